@@ -0,0 +1,44 @@
+// Command keygen prints a fresh ENCRYPTION_KEY: 32 random bytes, hex-encoded.
+//
+// The key is checked with crypto.DecodeKey before it is printed, so what it prints is
+// accepted by the api-server, the worker and cmd/rotate as is. Use it for a first setup or
+// as the new key of a rotation.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"ai-reviewer/api-server/internal/crypto"
+)
+
+func main() {
+	key, err := generateKey(rand.Reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(key)
+}
+
+// generateKey reads a 32-byte key from r and returns it hex-encoded, after checking that
+// DecodeKey gives the same bytes back.
+func generateKey(r io.Reader) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return "", fmt.Errorf("reading random bytes: %w", err)
+	}
+	key := hex.EncodeToString(raw)
+	decoded, err := crypto.DecodeKey(key)
+	if err != nil {
+		return "", fmt.Errorf("generated key does not decode: %w", err)
+	}
+	if !bytes.Equal(decoded, raw) {
+		return "", errors.New("generated key decodes to different bytes")
+	}
+	return key, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"ai-reviewer/api-server/internal/crypto"
+)
+
+func TestGenerateKey(t *testing.T) {
+	key, err := generateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generateKey: %v", err)
+	}
+	if len(key) != 64 {
+		t.Errorf("key %q has %d chars, want 64 hex chars", key, len(key))
+	}
+	decoded, err := crypto.DecodeKey(key)
+	if err != nil {
+		t.Fatalf("DecodeKey: %v", err)
+	}
+	if len(decoded) != 32 {
+		t.Errorf("decoded key is %d bytes, want 32", len(decoded))
+	}
+
+	other, err := generateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generateKey: %v", err)
+	}
+	if other == key {
+		t.Error("two generated keys are equal")
+	}
+}
+
+func TestGenerateKey_UsesReaderBytes(t *testing.T) {
+	key, err := generateKey(bytes.NewReader(bytes.Repeat([]byte{0xab}, 32)))
+	if err != nil {
+		t.Fatalf("generateKey: %v", err)
+	}
+	if want := strings.Repeat("ab", 32); key != want {
+		t.Errorf("key = %q, want %q", key, want)
+	}
+}
+
+func TestGenerateKey_ShortRead(t *testing.T) {
+	if _, err := generateKey(bytes.NewReader(make([]byte, 16))); err == nil {
+		t.Error("expected error when the reader runs out")
+	}
+}
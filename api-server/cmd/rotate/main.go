@@ -0,0 +1,100 @@
+// Command rotate re-encrypts every provider token after an encryption key rotation.
+//
+// It reads the previous key from OLD_ENCRYPTION_KEY and the new one from ENCRYPTION_KEY
+// (hex or base64, like the server), and rewrites all tokens in a single transaction: either
+// every token ends up under the new key or none changes. Tokens that already decrypt with
+// the new key are left alone, so an interrupted or repeated run is safe to start again.
+// Stop the api-server and worker first and restart them with the new ENCRYPTION_KEY.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"ai-reviewer/api-server/internal/crypto"
+	"ai-reviewer/api-server/internal/db"
+)
+
+func main() {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+	oldKey, err := decodeKeyEnv("OLD_ENCRYPTION_KEY")
+	if err != nil {
+		log.Fatal(err)
+	}
+	newKey, err := decodeKeyEnv("ENCRYPTION_KEY")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	pool, err := db.NewPoolWithConfig(ctx, databaseURL)
+	if err != nil {
+		log.Fatalf("creating DB pool: %v", err)
+	}
+	defer pool.Close()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		log.Fatalf("begin tx: %v", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	tokens, err := db.ListProvidersWithTokens(ctx, tx)
+	if err != nil {
+		log.Fatalf("listing providers: %v", err)
+	}
+	updated, err := reencryptTokens(tokens, oldKey, newKey)
+	if err != nil {
+		log.Fatalf("re-encrypting tokens (nothing was changed): %v", err)
+	}
+	for _, t := range updated {
+		if err := db.UpdateProviderToken(ctx, tx, t.ID, t.TokenEncrypted); err != nil {
+			log.Fatalf("updating provider %s (nothing was changed): %v", t.ID, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Fatalf("commit (nothing was changed): %v", err)
+	}
+	log.Printf("rotate: re-encrypted %d of %d provider tokens; %d already used the new key",
+		len(updated), len(tokens), len(tokens)-len(updated))
+}
+
+// decodeKeyEnv decodes the key in the named environment variable.
+func decodeKeyEnv(name string) ([]byte, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil, fmt.Errorf("%s is required", name)
+	}
+	key, err := crypto.DecodeKey(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return key, nil
+}
+
+// reencryptTokens returns the tokens that need rewriting, encrypted under newKey. Tokens
+// that already decrypt with newKey are skipped; a token that decrypts with neither key
+// fails the whole rotation.
+func reencryptTokens(tokens []db.ProviderTokenRow, oldKey, newKey []byte) ([]db.ProviderTokenRow, error) {
+	var updated []db.ProviderTokenRow
+	for _, t := range tokens {
+		if _, err := crypto.Decrypt(t.TokenEncrypted, newKey); err == nil {
+			continue
+		}
+		plaintext, err := crypto.Decrypt(t.TokenEncrypted, oldKey)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: token decrypts with neither key: %w", t.ID, err)
+		}
+		ct, err := crypto.Encrypt(plaintext, newKey)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", t.ID, err)
+		}
+		updated = append(updated, db.ProviderTokenRow{ID: t.ID, TokenEncrypted: ct})
+	}
+	return updated, nil
+}
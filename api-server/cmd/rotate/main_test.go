@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"ai-reviewer/api-server/internal/crypto"
+	"ai-reviewer/api-server/internal/db"
+)
+
+func testKey(seed byte) []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = seed + byte(i)
+	}
+	return key
+}
+
+func encrypt(t *testing.T, plaintext string, key []byte) []byte {
+	t.Helper()
+	ct, err := crypto.Encrypt([]byte(plaintext), key)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	return ct
+}
+
+func TestReencryptTokens(t *testing.T) {
+	oldKey, newKey := testKey(1), testKey(100)
+	rotatedAlready := encrypt(t, "tok-b", newKey)
+	tokens := []db.ProviderTokenRow{
+		{ID: "p1", TokenEncrypted: encrypt(t, "tok-a", oldKey)},
+		{ID: "p2", TokenEncrypted: rotatedAlready},
+		{ID: "p3", TokenEncrypted: encrypt(t, "tok-c", oldKey)},
+	}
+
+	updated, err := reencryptTokens(tokens, oldKey, newKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(updated) != 2 || updated[0].ID != "p1" || updated[1].ID != "p3" {
+		t.Fatalf("updated = %+v, want p1 and p3", updated)
+	}
+	for i, want := range []string{"tok-a", "tok-c"} {
+		got, err := crypto.Decrypt(updated[i].TokenEncrypted, newKey)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: Decrypt with new key = %q, %v; want %q", updated[i].ID, got, err, want)
+		}
+	}
+
+	// A second run over the rewritten rows has nothing left to do.
+	tokens[0].TokenEncrypted, tokens[2].TokenEncrypted = updated[0].TokenEncrypted, updated[1].TokenEncrypted
+	again, err := reencryptTokens(tokens, oldKey, newKey)
+	if err != nil || len(again) != 0 {
+		t.Errorf("second run = %+v, %v; want no updates", again, err)
+	}
+	if !bytes.Equal(tokens[1].TokenEncrypted, rotatedAlready) {
+		t.Error("token already under the new key was modified")
+	}
+}
+
+func TestReencryptTokens_UnknownKeyFails(t *testing.T) {
+	oldKey, newKey := testKey(1), testKey(100)
+	tokens := []db.ProviderTokenRow{
+		{ID: "p1", TokenEncrypted: encrypt(t, "tok-a", oldKey)},
+		{ID: "p2", TokenEncrypted: encrypt(t, "tok-b", testKey(200))},
+	}
+	if updated, err := reencryptTokens(tokens, oldKey, newKey); err == nil {
+		t.Fatalf("expected an error, got updates %+v", updated)
+	}
+}
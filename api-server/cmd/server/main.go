@@ -2,15 +2,18 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"connectrpc.com/connect"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
 
 	migrate "github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
@@ -22,6 +25,8 @@ import (
 	"ai-reviewer/api-server/internal/crypto"
 	"ai-reviewer/api-server/internal/db"
 	"ai-reviewer/api-server/internal/handler"
+	"ai-reviewer/api-server/internal/health"
+	"ai-reviewer/api-server/internal/outbox"
 	"ai-reviewer/api-server/internal/restate"
 )
 
@@ -45,6 +50,10 @@ func main() {
 	if err != nil {
 		log.Fatalf("invalid ENCRYPTION_KEY: %v", err)
 	}
+	tlsConfig, err := loadTLSConfig(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		log.Fatalf("invalid TLS configuration: %v", err)
+	}
 
 	// Run migrations.
 	migrationsFS, err := iofs.New(apimigrations.FS, ".")
@@ -66,7 +75,7 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	pool, err := db.NewPool(ctx, cfg.DatabaseURL)
+	pool, err := db.NewPoolWithConfig(ctx, cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("creating DB pool: %v", err)
 	}
@@ -77,39 +86,104 @@ func main() {
 	}
 	log.Println("connected to database")
 
-	restateClient := restate.New(cfg.RestateIngressURL, cfg.RestateAdminURL)
+	restateOpts := []restate.Option{restate.WithDispatchSecret(cfg.DispatchSecret)}
+	if cfg.RestateDebug {
+		debugLog := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		restateOpts = append(restateOpts, restate.WithLogger(debugLog))
+	}
+	restateClient := restate.New(cfg.RestateIngressURL, cfg.RestateAdminURL, restateOpts...)
+
+	// Dispatch review runs that TriggerReview committed but could not send to Restate.
+	go outbox.New(&outbox.PoolStore{Pool: pool}, restateClient, cfg.OutboxPollInterval).Run(ctx)
 
 	mux := http.NewServeMux()
 
 	providerHandler := handler.NewProviderHandler(pool, encKey)
-	repoHandler := handler.NewRepoHandler(pool)
+	providerHandler.SetTLSDir(cfg.ProviderTLSDir)
+	repoHandler := handler.NewRepoHandler(pool, restateClient)
 	reviewHandler := handler.NewReviewHandler(pool, restateClient)
+	if cfg.PreviewTimeout > 0 {
+		reviewHandler.SetPreviewTimeout(cfg.PreviewTimeout)
+	}
 
 	mux.Handle(apiv1connect.NewProviderServiceHandler(providerHandler, connect.WithRecover(recoverHandler)))
 	mux.Handle(apiv1connect.NewRepoServiceHandler(repoHandler, connect.WithRecover(recoverHandler)))
 	mux.Handle(apiv1connect.NewReviewServiceHandler(reviewHandler, connect.WithRecover(recoverHandler)))
-	mux.Handle("/webhooks/", handler.NewWebhookHandler(&handler.PoolWebhookStore{Pool: pool}, restateClient))
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+	webhookHandler := handler.NewWebhookHandler(&handler.PoolWebhookStore{Pool: pool}, restateClient)
+	if cfg.WebhookAsyncTimeout > 0 {
+		webhookHandler.EnableAsyncDispatch(cfg.WebhookAsyncTimeout)
+	}
+	if cfg.WebhookMaxEventAge > 0 {
+		webhookHandler.SetMaxEventAge(cfg.WebhookMaxEventAge)
+	}
+	if cfg.ReviewCommand != "" {
+		webhookHandler.SetReviewCommand(cfg.ReviewCommand)
+	}
+	if cfg.WebhookPathPrefix != "" {
+		webhookHandler.SetPathPrefix(cfg.WebhookPathPrefix)
+	}
+	webhookHandler.SetMaxBodyBytes(cfg.WebhookMaxBodyBytes)
+	// Connect handlers recover via connect.WithRecover; the plain routes need their own guard.
+	mux.Handle(webhookHandler.PathPrefix(), recoverMiddleware(webhookHandler))
+	mux.Handle(handler.ReviewEventsPattern, recoverMiddleware(handler.NewReviewEventsHandler(&handler.PoolReviewEventsStore{Pool: pool})))
+	mux.Handle("/healthz", recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-	})
+	})))
 
-	srv := &http.Server{
-		Addr:    cfg.ListenAddr,
-		Handler: h2c.NewHandler(mux, &http2.Server{}),
+	readiness := health.New(2 * time.Second)
+	readiness.Add("database", pool.Ping)
+	readiness.Add("restate", restateClient.Health)
+	mux.Handle("/readyz", recoverMiddleware(readiness))
+
+	srv, err := newServer(cfg.ListenAddr, mux, tlsConfig)
+	if err != nil {
+		log.Fatalf("creating server: %v", err)
 	}
 
+	var adminSrv *http.Server
+	if cfg.AdminListenAddr != "" {
+		// Counters stay off the public listener: they are for operators, not webhook senders.
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/debug/vars", recoverMiddleware(expvar.Handler()))
+		adminSrv = &http.Server{Addr: cfg.AdminListenAddr, Handler: adminMux}
+		go func() {
+			log.Printf("admin listening on %s", cfg.AdminListenAddr)
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("admin server error: %v", err)
+			}
+		}()
+	}
+
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-ctx.Done()
 		log.Println("shutting down")
 		if err := srv.Shutdown(context.Background()); err != nil {
 			log.Printf("shutdown error: %v", err)
 		}
+		// Let background webhook dispatches finish before the DB pool closes.
+		if err := webhookHandler.Shutdown(context.Background()); err != nil {
+			log.Printf("webhook shutdown error: %v", err)
+		}
+		if adminSrv != nil {
+			adminSrv.Close()
+		}
 	}()
 
-	log.Printf("api-server listening on %s", cfg.ListenAddr)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	ln, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		log.Fatalf("listening on %s: %v", cfg.ListenAddr, err)
+	}
+	if srv.TLSConfig != nil {
+		log.Printf("api-server listening on %s (TLS)", cfg.ListenAddr)
+	} else {
+		log.Printf("api-server listening on %s", cfg.ListenAddr)
+	}
+	if err := serve(srv, ln); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
+	<-shutdownDone
 }
 
 func recoverHandler(ctx context.Context, spec connect.Spec, header http.Header, r any) error {
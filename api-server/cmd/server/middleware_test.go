@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/panic", recoverMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	})))
+	mux.Handle("/ok", recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	resp, err := srv.Client().Get(srv.URL + "/panic")
+	if err != nil {
+		t.Fatalf("request to panicking handler: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("panicking handler status = %d, want 500", resp.StatusCode)
+	}
+
+	// The server keeps serving after the panic.
+	resp, err = srv.Client().Get(srv.URL + "/ok")
+	if err != nil {
+		t.Fatalf("request after panic: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status after panic = %d, want 200", resp.StatusCode)
+	}
+}
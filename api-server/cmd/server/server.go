@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// loadTLSConfig loads the key pair the server is to serve HTTPS with. Both files empty
+// returns nil, meaning cleartext. It runs at startup so a bad path or mismatched pair fails
+// fast instead of at the first handshake.
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS key pair: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// newServer returns the API server for handler on addr. With tlsConfig it serves HTTPS,
+// negotiating HTTP/2 via ALPN; without it, cleartext HTTP/2 (h2c) for a TLS-terminating
+// proxy in front.
+func newServer(addr string, handler http.Handler, tlsConfig *tls.Config) (*http.Server, error) {
+	if tlsConfig == nil {
+		return &http.Server{Addr: addr, Handler: h2c.NewHandler(handler, &http2.Server{})}, nil
+	}
+	srv := &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig}
+	if err := http2.ConfigureServer(srv, &http2.Server{}); err != nil {
+		return nil, fmt.Errorf("configuring HTTP/2: %w", err)
+	}
+	return srv, nil
+}
+
+// serve accepts connections on ln, over TLS when srv has a TLS config.
+func serve(srv *http.Server, ln net.Listener) error {
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and its key to dir.
+func writeSelfSignedCert(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "api-server test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func TestNewServer_TLS(t *testing.T) {
+	certFile, keyFile, pool := writeSelfSignedCert(t, t.TempDir())
+	tlsConfig, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("loadTLSConfig: %v", err)
+	}
+	srv, err := newServer("", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), tlsConfig)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- serve(srv, ln) }()
+	t.Cleanup(func() {
+		srv.Close()
+		if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("serve: %v", err)
+		}
+	})
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatalf("GET over TLS: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if resp.TLS == nil || resp.ProtoMajor != 2 {
+		t.Errorf("proto = %s (TLS %v), want HTTP/2 over TLS", resp.Proto, resp.TLS != nil)
+	}
+}
+
+func TestNewServer_PlainWithoutCert(t *testing.T) {
+	tlsConfig, err := loadTLSConfig("", "")
+	if err != nil || tlsConfig != nil {
+		t.Fatalf("loadTLSConfig = %v, %v, want nil, nil", tlsConfig, err)
+	}
+	srv, err := newServer(":0", http.NotFoundHandler(), nil)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	if srv.TLSConfig != nil {
+		t.Error("expected no TLS config without a key pair")
+	}
+}
+
+func TestLoadTLSConfig_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _, _ := writeSelfSignedCert(t, dir)
+	tests := []struct {
+		name              string
+		certFile, keyFile string
+	}{
+		{"cert without key", certFile, ""},
+		{"key without cert", "", filepath.Join(dir, "key.pem")},
+		{"missing file", certFile, filepath.Join(dir, "missing.pem")},
+		{"cert as key", certFile, certFile},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := loadTLSConfig(tc.certFile, tc.keyFile); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
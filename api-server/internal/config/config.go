@@ -1,6 +1,11 @@
 package config
 
-import "os"
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
 
 // Config holds environment-variable configuration for the API server.
 type Config struct {
@@ -9,6 +14,42 @@ type Config struct {
 	RestateIngressURL string
 	RestateAdminURL   string
 	ListenAddr        string
+	// AdminListenAddr, when set, serves the expvar counters at /debug/vars on this separate
+	// address, meant to be reachable only from inside the deployment. Empty doesn't serve them.
+	AdminListenAddr string
+	// TLSCertFile and TLSKeyFile, when both set, make the server listen with HTTPS instead
+	// of cleartext h2c.
+	TLSCertFile string
+	TLSKeyFile  string
+	// ProviderTLSDir is the directory CreateProvider TLS file paths must lie under. Empty
+	// refuses providers with TLS files.
+	ProviderTLSDir string
+	// WebhookAsyncTimeout, when > 0, makes the webhook handler acknowledge events with 202
+	// immediately and dispatch in the background with this timeout. 0 keeps dispatch synchronous.
+	WebhookAsyncTimeout time.Duration
+	// WebhookMaxEventAge, when > 0, makes the webhook handler skip MR "update" events whose
+	// updated_at is older than this, e.g. a redelivered backlog. 0 disables the check.
+	WebhookMaxEventAge time.Duration
+	// ReviewCommand overrides the MR comment that triggers an on-demand review
+	// (handler.DefaultReviewCommand when empty).
+	ReviewCommand string
+	// PreviewTimeout overrides how long PreviewReview waits for the Reviewer
+	// (handler.DefaultPreviewTimeout when 0).
+	PreviewTimeout time.Duration
+	// WebhookPathPrefix overrides the route webhooks are served under
+	// (handler.DefaultWebhookPathPrefix when empty).
+	WebhookPathPrefix string
+	// RestateDebug logs every Restate ingress/admin call at debug level.
+	RestateDebug bool
+	// OutboxPollInterval overrides how often undispatched review runs are retried
+	// (outbox.DefaultPollInterval when 0).
+	OutboxPollInterval time.Duration
+	// WebhookMaxBodyBytes overrides the largest webhook body accepted
+	// (handler.DefaultWebhookMaxBodyBytes when 0).
+	WebhookMaxBodyBytes int64
+	// DispatchSecret signs the review requests sent to the worker, which must be given the
+	// same DISPATCH_SECRET to verify them. Empty sends them unsigned.
+	DispatchSecret string
 }
 
 // Load reads configuration from environment variables.
@@ -17,11 +58,73 @@ func Load() Config {
 	if addr == "" {
 		addr = ":8090"
 	}
+	var asyncTimeout time.Duration
+	if v := os.Getenv("WEBHOOK_ASYNC_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("config: invalid WEBHOOK_ASYNC_TIMEOUT %q, keeping synchronous dispatch: %v", v, err)
+		} else {
+			asyncTimeout = d
+		}
+	}
+	var maxEventAge time.Duration
+	if v := os.Getenv("WEBHOOK_MAX_EVENT_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Printf("config: invalid WEBHOOK_MAX_EVENT_AGE %q, stale event check disabled", v)
+		} else {
+			maxEventAge = d
+		}
+	}
+	var previewTimeout time.Duration
+	if v := os.Getenv("PREVIEW_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Printf("config: invalid PREVIEW_TIMEOUT %q, using the default", v)
+		} else {
+			previewTimeout = d
+		}
+	}
+	var outboxInterval time.Duration
+	if v := os.Getenv("OUTBOX_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Printf("config: invalid OUTBOX_POLL_INTERVAL %q, using the default", v)
+		} else {
+			outboxInterval = d
+		}
+	}
+	var webhookMaxBody int64
+	if v := os.Getenv("WEBHOOK_MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			log.Printf("config: invalid WEBHOOK_MAX_BODY_BYTES %q, using the default", v)
+		} else {
+			webhookMaxBody = n
+		}
+	}
+	restateDebug, err := strconv.ParseBool(os.Getenv("RESTATE_DEBUG"))
+	if err != nil && os.Getenv("RESTATE_DEBUG") != "" {
+		log.Printf("config: invalid RESTATE_DEBUG %q, logging disabled", os.Getenv("RESTATE_DEBUG"))
+	}
 	return Config{
-		DatabaseURL:       os.Getenv("DATABASE_URL"),
-		EncryptionKey:     os.Getenv("ENCRYPTION_KEY"),
-		RestateIngressURL: os.Getenv("RESTATE_INGRESS_URL"),
-		RestateAdminURL:   os.Getenv("RESTATE_ADMIN_URL"),
-		ListenAddr:        addr,
+		DatabaseURL:         os.Getenv("DATABASE_URL"),
+		EncryptionKey:       os.Getenv("ENCRYPTION_KEY"),
+		RestateIngressURL:   os.Getenv("RESTATE_INGRESS_URL"),
+		RestateAdminURL:     os.Getenv("RESTATE_ADMIN_URL"),
+		ListenAddr:          addr,
+		AdminListenAddr:     os.Getenv("ADMIN_LISTEN_ADDR"),
+		TLSCertFile:         os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:          os.Getenv("TLS_KEY_FILE"),
+		ProviderTLSDir:      os.Getenv("PROVIDER_TLS_DIR"),
+		WebhookAsyncTimeout: asyncTimeout,
+		WebhookMaxEventAge:  maxEventAge,
+		ReviewCommand:       os.Getenv("REVIEW_COMMAND"),
+		PreviewTimeout:      previewTimeout,
+		WebhookPathPrefix:   os.Getenv("WEBHOOK_PATH_PREFIX"),
+		RestateDebug:        restateDebug,
+		OutboxPollInterval:  outboxInterval,
+		WebhookMaxBodyBytes: webhookMaxBody,
+		DispatchSecret:      os.Getenv("DISPATCH_SECRET"),
 	}
 }
@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidDispatchToken is returned by DispatchVerifier.Verify when a token is missing or doesn't
+// match its claims.
+var ErrInvalidDispatchToken = errors.New("invalid dispatch token")
+
+// ErrExpiredDispatchToken is returned by DispatchVerifier.Verify for a valid token past its expiry.
+var ErrExpiredDispatchToken = errors.New("expired dispatch token")
+
+// dispatchTokenPrefix starts the current (v3) token format, "v3.<expires>.<mac>", where
+// <expires> is a unix time in seconds. Tokens without it are the legacy v1/v2 form: the
+// bare hex MAC, with no expiry and no Virtual Object key.
+const dispatchTokenPrefix = "v3."
+
+// DispatchClaims are the fields of a PRReview/Run request that its dispatch token signs.
+// The api-server signs them with the secret it shares with the worker, which verifies them
+// before starting the review.
+type DispatchClaims struct {
+	// Key is the PRReview Virtual Object key the request is sent to.
+	Key          string
+	RunID        string
+	RepoID       string
+	MRNumber     int64
+	Force        bool
+	ReviewDrafts bool
+	SkipDebounce bool
+}
+
+// message is the canonical byte form of c with expiry expires that a v3 token authenticates.
+func (c DispatchClaims) message(expires int64) []byte {
+	return fmt.Appendf(nil, "v3\n%s\n%d\n%s\n%s\n%d\n%t\n%t\n%t", c.Key, expires, c.RunID, c.RepoID, c.MRNumber, c.Force, c.ReviewDrafts, c.SkipDebounce)
+}
+
+// legacyMessages are the canonical forms legacy tokens authenticate: v2, and v1 from before
+// SkipDebounce existed, which therefore can't vouch for it.
+func (c DispatchClaims) legacyMessages() [][]byte {
+	msgs := [][]byte{fmt.Appendf(nil, "v2\n%s\n%s\n%d\n%t\n%t\n%t", c.RunID, c.RepoID, c.MRNumber, c.Force, c.ReviewDrafts, c.SkipDebounce)}
+	if !c.SkipDebounce {
+		msgs = append(msgs, fmt.Appendf(nil, "v1\n%s\n%s\n%d\n%t\n%t", c.RunID, c.RepoID, c.MRNumber, c.Force, c.ReviewDrafts))
+	}
+	return msgs
+}
+
+// SignDispatch returns the v3 token for c under secret, valid until expires.
+func SignDispatch(c DispatchClaims, expires time.Time, secret []byte) string {
+	exp := expires.Unix()
+	return dispatchTokenPrefix + strconv.FormatInt(exp, 10) + "." + hex.EncodeToString(dispatchMAC(c.message(exp), secret))
+}
+
+// DispatchVerifier checks dispatch tokens.
+type DispatchVerifier struct {
+	// Secrets are the secrets a token may be signed with: the current one, then any
+	// previous one still accepted while a rotation rolls out. Empty entries are ignored.
+	Secrets [][]byte
+	// AcceptLegacy also accepts v1/v2 tokens, which have no expiry and don't cover the
+	// Virtual Object key, so api-servers not yet signing v3 keep working during a deploy.
+	AcceptLegacy bool
+}
+
+// Verify checks in constant time that token signs c under one of v.Secrets and, for a v3
+// token, that it hasn't expired at now. It returns ErrInvalidDispatchToken or
+// ErrExpiredDispatchToken if not.
+func (v DispatchVerifier) Verify(c DispatchClaims, token string, now time.Time) error {
+	if rest, ok := strings.CutPrefix(token, dispatchTokenPrefix); ok {
+		expStr, macHex, ok := strings.Cut(rest, ".")
+		exp, err := strconv.ParseInt(expStr, 10, 64)
+		if !ok || err != nil {
+			return ErrInvalidDispatchToken
+		}
+		if !v.matches(macHex, c.message(exp)) {
+			return ErrInvalidDispatchToken
+		}
+		if now.Unix() > exp {
+			return ErrExpiredDispatchToken
+		}
+		return nil
+	}
+	if v.AcceptLegacy {
+		for _, msg := range c.legacyMessages() {
+			if v.matches(token, msg) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidDispatchToken
+}
+
+// matches reports whether macHex is the hex MAC of msg under one of v.Secrets.
+func (v DispatchVerifier) matches(macHex string, msg []byte) bool {
+	got, err := hex.DecodeString(macHex)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	for _, secret := range v.Secrets {
+		if len(secret) > 0 && hmac.Equal(got, dispatchMAC(msg, secret)) {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatchMAC returns the HMAC-SHA256 of msg under secret.
+func dispatchMAC(msg, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
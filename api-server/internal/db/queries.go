@@ -19,18 +19,63 @@ type ProviderRow struct {
 	BaseURL        string
 	TokenEncrypted []byte
 	WebhookSecret  *string
-	CreatedAt      time.Time
+	TriggerEvents  []string
+	RepoScope      string
+	Slug           string
+	// PEM file paths for self-hosted GitLab TLS; empty uses the system roots.
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+	// ProxyURL is an explicit forward proxy for GitLab; empty uses the environment.
+	ProxyURL string
+	// TokenType hints how the token authenticates: "", "personal" or "project".
+	TokenType string
+	CreatedAt time.Time
 }
 
 // RepoRow holds repository data from the repositories table.
 type RepoRow struct {
-	ID            string
-	ProviderID    string
-	RemoteID      string
-	Name          string
-	FullPath      string
-	ReviewEnabled bool
-	CreatedAt     time.Time
+	ID              string
+	ProviderID      string
+	RemoteID        string
+	Name            string
+	FullPath        string
+	ReviewEnabled   bool
+	SummaryTemplate string
+	// Reviewer overrides; empty / nil use the Reviewer's defaults.
+	ReviewModel       string
+	ReviewTemperature *float64
+	CreatedAt         time.Time
+	// AutoApproveOnClean approves MRs whose review has no blocker comments.
+	AutoApproveOnClean bool
+	// ReviewDrafts reviews draft MRs like ready ones instead of waiting for them to be ready.
+	ReviewDrafts bool
+	// CommentPrefix is prepended once to every comment the bot posts; empty posts bodies as is.
+	CommentPrefix string
+	// ReviewerVariant selects the Reviewer deployment the worker routes this repo's reviews
+	// to (its REVIEWER_VARIANTS); empty uses the default Reviewer.
+	ReviewerVariant string
+	// IncludeRelatedIssues sends the issues an MR closes to the Reviewer as context.
+	IncludeRelatedIssues bool
+	// PostEmptySummary posts the summary note of a review without comments; when false such
+	// reviews are only stored.
+	PostEmptySummary bool
+	// TargetBranchPatterns are path.Match globs (e.g. "release/*"); only MRs into a matching
+	// target branch are reviewed. Empty reviews every MR.
+	TargetBranchPatterns []string
+	// RequirePipelineSuccess only reviews MRs whose head pipeline succeeded (GitLab); other
+	// runs are marked skipped.
+	RequirePipelineSuccess bool
+	// PostMode is how the worker publishes review comments: "comments" or "check_run"
+	// (annotations on a GitHub check run).
+	PostMode string
+	// Archived hides the repo from ListReposByProvider and makes webhooks ignore it,
+	// keeping its review history.
+	Archived bool
+	// Latest review run of any MR in the repo; only populated by ListReposByProvider,
+	// empty if the repo has never been reviewed.
+	LatestReviewRunID  string
+	LatestReviewStatus string
 }
 
 // RepoUpsertInput holds data for upserting a repository.
@@ -43,14 +88,50 @@ type RepoUpsertInput struct {
 
 // ReviewRunRow holds a review run row from the database.
 type ReviewRunRow struct {
-	ID                   string
-	RepoID               string
-	MRNumber             int64
-	Status               string
-	Summary              *string
-	RestateInvocationID  *string
-	CreatedAt            time.Time
-	UpdatedAt            time.Time
+	ID                  string
+	RepoID              string
+	MRNumber            int64
+	Status              string
+	Summary             *string
+	RestateInvocationID *string
+	MRTitle             string
+	MRAuthor            string
+	SourceBranch        string
+	TargetBranch        string
+	HeadSHA             string
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+// ReviewRunEventRow holds a review_run_events row from the database.
+type ReviewRunEventRow struct {
+	Status    string
+	Detail    string
+	CreatedAt time.Time
+}
+
+// ActiveReviewRunRow is a pending or running review run, as listed by ListActiveReviewRuns.
+type ActiveReviewRunRow struct {
+	ID                  string
+	RepoID              string
+	MRNumber            int64
+	Status              string
+	RestateInvocationID *string
+	CreatedAt           time.Time
+}
+
+// DispatchOutboxRow is a review run waiting in review_dispatch_outbox to be sent to Restate.
+// Attempts counts claims so far, including the current one.
+type DispatchOutboxRow struct {
+	RunID    string
+	RepoID   string
+	MRNumber int64
+	Force    bool
+	Attempts int
+	// ReviewDrafts is the repo's review_drafts flag at claim time.
+	ReviewDrafts bool
+	// SkipDebounce lets the run start without PRReview's debounce sleep.
+	SkipDebounce bool
 }
 
 // ReviewCommentRow holds a review comment row from the database.
@@ -61,6 +142,33 @@ type ReviewCommentRow struct {
 	LineStart   int
 	LineEnd     int
 	Body        string
+	Severity    string
+	// Posted is true once the comment has been handled by PostReview (including skipped ones).
+	Posted bool
+	// ProviderCommentID is the provider's note/discussion ID, or nil if the comment is
+	// unposted or was skipped because its position was rejected.
+	ProviderCommentID *string
+}
+
+// reviewCommentColumns selects the ReviewCommentRow fields, in scanReviewComment order.
+// The "skipped", "overflow" and "superseded" markers written by the worker are not real
+// provider IDs, so they read as NULL.
+const reviewCommentColumns = `id, review_run_id, file_path, line_start, line_end, body, severity,
+		posted, CASE WHEN provider_comment_id IN ('skipped', 'overflow', 'superseded') THEN NULL ELSE provider_comment_id END`
+
+// scanReviewComment scans a row selected with reviewCommentColumns.
+func scanReviewComment(rows pgx.Rows) (ReviewCommentRow, error) {
+	var c ReviewCommentRow
+	err := rows.Scan(&c.ID, &c.ReviewRunID, &c.FilePath, &c.LineStart, &c.LineEnd, &c.Body, &c.Severity,
+		&c.Posted, &c.ProviderCommentID)
+	return c, err
+}
+
+// FindingCommentRow holds a review comment with the metadata needed to merge findings across runs.
+type FindingCommentRow struct {
+	ReviewCommentRow
+	Fingerprint string
+	Dismissed   bool
 }
 
 // GetDefaultOrgID fetches the ID of the seeded 'default' organization.
@@ -81,11 +189,11 @@ func InsertProvider(ctx context.Context, pool *pgxpool.Pool, orgID, provType, na
 	const q = `
 		INSERT INTO providers (org_id, type, name, base_url, token_encrypted, webhook_secret)
 		VALUES ($1, $2::provider_type, $3, $4, $5, $6)
-		RETURNING id, org_id, type, name, base_url, token_encrypted, webhook_secret, created_at`
+		RETURNING id, org_id, type, name, base_url, token_encrypted, webhook_secret, trigger_events, repo_scope, slug, tls_ca_file, tls_cert_file, tls_key_file, proxy_url, token_type, created_at`
 
 	row := &ProviderRow{}
 	err := pool.QueryRow(ctx, q, orgID, provType, name, baseURL, tokenEncrypted, webhookSecret).Scan(
-		&row.ID, &row.OrgID, &row.Type, &row.Name, &row.BaseURL, &row.TokenEncrypted, &row.WebhookSecret, &row.CreatedAt,
+		&row.ID, &row.OrgID, &row.Type, &row.Name, &row.BaseURL, &row.TokenEncrypted, &row.WebhookSecret, &row.TriggerEvents, &row.RepoScope, &row.Slug, &row.TLSCAFile, &row.TLSCertFile, &row.TLSKeyFile, &row.ProxyURL, &row.TokenType, &row.CreatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("InsertProvider: %w", err)
@@ -93,42 +201,55 @@ func InsertProvider(ctx context.Context, pool *pgxpool.Pool, orgID, provType, na
 	return row, nil
 }
 
-// ListProviders returns all active providers (no token_encrypted in SELECT).
-func ListProviders(ctx context.Context, pool *pgxpool.Pool) ([]ProviderRow, error) {
+// ListProviders returns up to limit active providers starting at offset, ordered by
+// created_at (no token_encrypted in SELECT), along with the total number matching.
+// A non-empty provType restricts the result to that provider type.
+func ListProviders(ctx context.Context, pool *pgxpool.Pool, provType string, limit, offset int) ([]ProviderRow, int, error) {
+	const where = `WHERE deleted_at IS NULL AND ($1 = '' OR type::text = $1)`
+
+	var total int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM providers `+where, provType).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("ListProviders count: %w", err)
+	}
+
 	const q = `
-		SELECT id, org_id, type, name, base_url, created_at
+		SELECT id, org_id, type, name, base_url, trigger_events, repo_scope, slug, tls_ca_file, tls_cert_file, tls_key_file, proxy_url, token_type, created_at
 		FROM providers
-		WHERE deleted_at IS NULL
-		ORDER BY created_at`
+		` + where + `
+		ORDER BY created_at, id
+		LIMIT $2 OFFSET $3`
 
-	rows, err := pool.Query(ctx, q)
+	rows, err := pool.Query(ctx, q, provType, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("ListProviders: %w", err)
+		return nil, 0, fmt.Errorf("ListProviders: %w", err)
 	}
 	defer rows.Close()
 
 	var providers []ProviderRow
 	for rows.Next() {
 		var p ProviderRow
-		if err := rows.Scan(&p.ID, &p.OrgID, &p.Type, &p.Name, &p.BaseURL, &p.CreatedAt); err != nil {
-			return nil, fmt.Errorf("ListProviders scan: %w", err)
+		if err := rows.Scan(&p.ID, &p.OrgID, &p.Type, &p.Name, &p.BaseURL, &p.TriggerEvents, &p.RepoScope, &p.Slug, &p.TLSCAFile, &p.TLSCertFile, &p.TLSKeyFile, &p.ProxyURL, &p.TokenType, &p.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("ListProviders scan: %w", err)
 		}
 		providers = append(providers, p)
 	}
-	return providers, rows.Err()
+	return providers, total, rows.Err()
 }
 
-// GetProvider fetches a provider by ID (includes token and webhook_secret).
+// GetProvider fetches a provider by ID (includes token and webhook_secret). Transient
+// errors are retried (see withRetry), as it is on the webhook hot path.
 func GetProvider(ctx context.Context, pool *pgxpool.Pool, id string) (*ProviderRow, error) {
 	const q = `
-		SELECT id, org_id, type, name, base_url, token_encrypted, webhook_secret, created_at
+		SELECT id, org_id, type, name, base_url, token_encrypted, webhook_secret, trigger_events, repo_scope, slug, tls_ca_file, tls_cert_file, tls_key_file, proxy_url, token_type, created_at
 		FROM providers
 		WHERE id = $1 AND deleted_at IS NULL`
 
 	row := &ProviderRow{}
-	err := pool.QueryRow(ctx, q, id).Scan(
-		&row.ID, &row.OrgID, &row.Type, &row.Name, &row.BaseURL, &row.TokenEncrypted, &row.WebhookSecret, &row.CreatedAt,
-	)
+	err := withRetry(ctx, func() error {
+		return pool.QueryRow(ctx, q, id).Scan(
+			&row.ID, &row.OrgID, &row.Type, &row.Name, &row.BaseURL, &row.TokenEncrypted, &row.WebhookSecret, &row.TriggerEvents, &row.RepoScope, &row.Slug, &row.TLSCAFile, &row.TLSCertFile, &row.TLSKeyFile, &row.ProxyURL, &row.TokenType, &row.CreatedAt,
+		)
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, pgx.ErrNoRows
@@ -138,6 +259,51 @@ func GetProvider(ctx context.Context, pool *pgxpool.Pool, id string) (*ProviderR
 	return row, nil
 }
 
+// GetProviderBySlug fetches an active provider by its slug.
+// Returns pgx.ErrNoRows if no active provider has that slug.
+func GetProviderBySlug(ctx context.Context, pool *pgxpool.Pool, slug string) (*ProviderRow, error) {
+	const q = `
+		SELECT id, org_id, type, name, base_url, token_encrypted, webhook_secret, trigger_events, repo_scope, slug, tls_ca_file, tls_cert_file, tls_key_file, proxy_url, token_type, created_at
+		FROM providers
+		WHERE slug = $1 AND slug <> '' AND deleted_at IS NULL`
+
+	row := &ProviderRow{}
+	err := pool.QueryRow(ctx, q, slug).Scan(
+		&row.ID, &row.OrgID, &row.Type, &row.Name, &row.BaseURL, &row.TokenEncrypted, &row.WebhookSecret, &row.TriggerEvents, &row.RepoScope, &row.Slug, &row.TLSCAFile, &row.TLSCertFile, &row.TLSKeyFile, &row.ProxyURL, &row.TokenType, &row.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, fmt.Errorf("GetProviderBySlug: %w", err)
+	}
+	return row, nil
+}
+
+// UpdateProviderTriggerEvents replaces the trigger_events of an active provider and returns the row.
+// Returns pgx.ErrNoRows if the provider does not exist or is deleted.
+func UpdateProviderTriggerEvents(ctx context.Context, pool *pgxpool.Pool, id string, events []string) (*ProviderRow, error) {
+	const q = `
+		UPDATE providers SET trigger_events = $2
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, org_id, type, name, base_url, trigger_events, repo_scope, slug, tls_ca_file, tls_cert_file, tls_key_file, proxy_url, token_type, created_at`
+
+	if events == nil {
+		events = []string{}
+	}
+	row := &ProviderRow{}
+	err := pool.QueryRow(ctx, q, id, events).Scan(
+		&row.ID, &row.OrgID, &row.Type, &row.Name, &row.BaseURL, &row.TriggerEvents, &row.RepoScope, &row.Slug, &row.TLSCAFile, &row.TLSCertFile, &row.TLSKeyFile, &row.ProxyURL, &row.TokenType, &row.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, fmt.Errorf("UpdateProviderTriggerEvents: %w", err)
+	}
+	return row, nil
+}
+
 // SoftDeleteProvider sets deleted_at = now() for the provider.
 func SoftDeleteProvider(ctx context.Context, pool *pgxpool.Pool, id string) error {
 	const q = `UPDATE providers SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL`
@@ -151,13 +317,55 @@ func SoftDeleteProvider(ctx context.Context, pool *pgxpool.Pool, id string) erro
 	return nil
 }
 
+// ProviderTokenRow is a provider's encrypted API token.
+type ProviderTokenRow struct {
+	ID             string
+	TokenEncrypted []byte
+}
+
+// ListProvidersWithTokens returns the encrypted token of every provider, soft-deleted ones
+// included, and locks their rows until tx ends. Internal to key rotation (cmd/rotate);
+// tokens are never served by the API.
+func ListProvidersWithTokens(ctx context.Context, tx pgx.Tx) ([]ProviderTokenRow, error) {
+	const q = `SELECT id, token_encrypted FROM providers ORDER BY created_at, id FOR UPDATE`
+
+	rows, err := tx.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("ListProvidersWithTokens: %w", err)
+	}
+	defer rows.Close()
+
+	var out []ProviderTokenRow
+	for rows.Next() {
+		var r ProviderTokenRow
+		if err := rows.Scan(&r.ID, &r.TokenEncrypted); err != nil {
+			return nil, fmt.Errorf("ListProvidersWithTokens scan: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// UpdateProviderToken replaces a provider's encrypted token within tx.
+func UpdateProviderToken(ctx context.Context, tx pgx.Tx, id string, tokenEncrypted []byte) error {
+	const q = `UPDATE providers SET token_encrypted = $1 WHERE id = $2`
+	tag, err := tx.Exec(ctx, q, tokenEncrypted, id)
+	if err != nil {
+		return fmt.Errorf("UpdateProviderToken: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
 // UpsertRepos batch-upserts repositories for a provider.
 func UpsertRepos(ctx context.Context, pool *pgxpool.Pool, repos []RepoUpsertInput) error {
 	const q = `
 		INSERT INTO repositories (provider_id, remote_id, name, full_path)
 		VALUES ($1, $2, $3, $4)
 		ON CONFLICT (provider_id, remote_id) DO UPDATE
-		SET name = EXCLUDED.name, full_path = EXCLUDED.full_path`
+		SET name = EXCLUDED.name, full_path = EXCLUDED.full_path, deleted_at = NULL`
 
 	for _, r := range repos {
 		if _, err := pool.Exec(ctx, q, r.ProviderID, r.RemoteID, r.Name, r.FullPath); err != nil {
@@ -167,15 +375,39 @@ func UpsertRepos(ctx context.Context, pool *pgxpool.Pool, repos []RepoUpsertInpu
 	return nil
 }
 
-// ListReposByProvider returns all repositories for a given provider.
-func ListReposByProvider(ctx context.Context, pool *pgxpool.Pool, providerID string) ([]RepoRow, error) {
+// SoftDeleteRepoByRemoteID marks a provider's repository deleted and turns its reviews
+// off. It returns pgx.ErrNoRows if there is no such live repository.
+func SoftDeleteRepoByRemoteID(ctx context.Context, pool *pgxpool.Pool, providerID, remoteID string) error {
 	const q = `
-		SELECT id, provider_id, remote_id, name, full_path, review_enabled, created_at
-		FROM repositories
-		WHERE provider_id = $1
-		ORDER BY full_path`
+		UPDATE repositories SET deleted_at = now(), review_enabled = false
+		WHERE provider_id = $1 AND remote_id = $2 AND deleted_at IS NULL`
+	tag, err := pool.Exec(ctx, q, providerID, remoteID)
+	if err != nil {
+		return fmt.Errorf("SoftDeleteRepoByRemoteID: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ListReposByProvider returns all repositories for a given provider, each with its most
+// recent review run.
+func ListReposByProvider(ctx context.Context, pool *pgxpool.Pool, providerID string, includeArchived bool) ([]RepoRow, error) {
+	const q = `
+		SELECT r.id, r.provider_id, r.remote_id, r.name, r.full_path, r.review_enabled, r.summary_template, r.review_model, r.review_temperature, r.auto_approve_on_clean, r.review_drafts, r.comment_prefix, r.reviewer_variant, r.include_related_issues, r.post_empty_summary, r.target_branch_patterns, r.require_pipeline_success, r.post_mode, r.archived, r.created_at,
+		       COALESCE(latest.id::text, ''), COALESCE(latest.status::text, '')
+		FROM repositories r
+		LEFT JOIN LATERAL (
+			SELECT id, status FROM review_runs
+			WHERE repo_id = r.id
+			ORDER BY created_at DESC
+			LIMIT 1
+		) latest ON true
+		WHERE r.provider_id = $1 AND r.deleted_at IS NULL AND ($2 OR NOT r.archived)
+		ORDER BY r.full_path`
 
-	rows, err := pool.Query(ctx, q, providerID)
+	rows, err := pool.Query(ctx, q, providerID, includeArchived)
 	if err != nil {
 		return nil, fmt.Errorf("ListReposByProvider: %w", err)
 	}
@@ -184,7 +416,8 @@ func ListReposByProvider(ctx context.Context, pool *pgxpool.Pool, providerID str
 	var repos []RepoRow
 	for rows.Next() {
 		var r RepoRow
-		if err := rows.Scan(&r.ID, &r.ProviderID, &r.RemoteID, &r.Name, &r.FullPath, &r.ReviewEnabled, &r.CreatedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.ProviderID, &r.RemoteID, &r.Name, &r.FullPath, &r.ReviewEnabled, &r.SummaryTemplate, &r.ReviewModel, &r.ReviewTemperature, &r.AutoApproveOnClean, &r.ReviewDrafts, &r.CommentPrefix, &r.ReviewerVariant, &r.IncludeRelatedIssues, &r.PostEmptySummary, &r.TargetBranchPatterns, &r.RequirePipelineSuccess, &r.PostMode, &r.Archived, &r.CreatedAt,
+			&r.LatestReviewRunID, &r.LatestReviewStatus); err != nil {
 			return nil, fmt.Errorf("ListReposByProvider scan: %w", err)
 		}
 		repos = append(repos, r)
@@ -195,13 +428,13 @@ func ListReposByProvider(ctx context.Context, pool *pgxpool.Pool, providerID str
 // GetRepo fetches a repository by ID.
 func GetRepo(ctx context.Context, pool *pgxpool.Pool, id string) (*RepoRow, error) {
 	const q = `
-		SELECT id, provider_id, remote_id, name, full_path, review_enabled, created_at
+		SELECT id, provider_id, remote_id, name, full_path, review_enabled, summary_template, review_model, review_temperature, auto_approve_on_clean, review_drafts, comment_prefix, reviewer_variant, include_related_issues, post_empty_summary, target_branch_patterns, require_pipeline_success, post_mode, archived, created_at
 		FROM repositories
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	row := &RepoRow{}
 	err := pool.QueryRow(ctx, q, id).Scan(
-		&row.ID, &row.ProviderID, &row.RemoteID, &row.Name, &row.FullPath, &row.ReviewEnabled, &row.CreatedAt,
+		&row.ID, &row.ProviderID, &row.RemoteID, &row.Name, &row.FullPath, &row.ReviewEnabled, &row.SummaryTemplate, &row.ReviewModel, &row.ReviewTemperature, &row.AutoApproveOnClean, &row.ReviewDrafts, &row.CommentPrefix, &row.ReviewerVariant, &row.IncludeRelatedIssues, &row.PostEmptySummary, &row.TargetBranchPatterns, &row.RequirePipelineSuccess, &row.PostMode, &row.Archived, &row.CreatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -216,12 +449,12 @@ func GetRepo(ctx context.Context, pool *pgxpool.Pool, id string) (*RepoRow, erro
 func SetReviewEnabled(ctx context.Context, pool *pgxpool.Pool, id string, enabled bool) (*RepoRow, error) {
 	const q = `
 		UPDATE repositories SET review_enabled = $1
-		WHERE id = $2
-		RETURNING id, provider_id, remote_id, name, full_path, review_enabled, created_at`
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING id, provider_id, remote_id, name, full_path, review_enabled, summary_template, review_model, review_temperature, auto_approve_on_clean, review_drafts, comment_prefix, reviewer_variant, include_related_issues, post_empty_summary, target_branch_patterns, require_pipeline_success, post_mode, archived, created_at`
 
 	row := &RepoRow{}
 	err := pool.QueryRow(ctx, q, enabled, id).Scan(
-		&row.ID, &row.ProviderID, &row.RemoteID, &row.Name, &row.FullPath, &row.ReviewEnabled, &row.CreatedAt,
+		&row.ID, &row.ProviderID, &row.RemoteID, &row.Name, &row.FullPath, &row.ReviewEnabled, &row.SummaryTemplate, &row.ReviewModel, &row.ReviewTemperature, &row.AutoApproveOnClean, &row.ReviewDrafts, &row.CommentPrefix, &row.ReviewerVariant, &row.IncludeRelatedIssues, &row.PostEmptySummary, &row.TargetBranchPatterns, &row.RequirePipelineSuccess, &row.PostMode, &row.Archived, &row.CreatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -232,30 +465,152 @@ func SetReviewEnabled(ctx context.Context, pool *pgxpool.Pool, id string, enable
 	return row, nil
 }
 
-// CreateReviewRun inserts a new review run with status=pending and returns its ID.
-func CreateReviewRun(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int64) (string, error) {
+// SetRepoArchived sets the archived flag on a repository.
+func SetRepoArchived(ctx context.Context, pool *pgxpool.Pool, id string, archived bool) (*RepoRow, error) {
 	const q = `
-		INSERT INTO review_runs (repo_id, mr_number, status)
-		VALUES ($1, $2, 'pending')
+		UPDATE repositories SET archived = $1
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING id, provider_id, remote_id, name, full_path, review_enabled, summary_template, review_model, review_temperature, auto_approve_on_clean, review_drafts, comment_prefix, reviewer_variant, include_related_issues, post_empty_summary, target_branch_patterns, require_pipeline_success, post_mode, archived, created_at`
+
+	row := &RepoRow{}
+	err := pool.QueryRow(ctx, q, archived, id).Scan(
+		&row.ID, &row.ProviderID, &row.RemoteID, &row.Name, &row.FullPath, &row.ReviewEnabled, &row.SummaryTemplate, &row.ReviewModel, &row.ReviewTemperature, &row.AutoApproveOnClean, &row.ReviewDrafts, &row.CommentPrefix, &row.ReviewerVariant, &row.IncludeRelatedIssues, &row.PostEmptySummary, &row.TargetBranchPatterns, &row.RequirePipelineSuccess, &row.PostMode, &row.Archived, &row.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, fmt.Errorf("SetRepoArchived: %w", err)
+	}
+	return row, nil
+}
+
+// EnqueueReviewRun inserts a pending review run together with its review_dispatch_outbox
+// row in one transaction and returns the run ID. The outbox row only becomes due after
+// lease, leaving the caller time to dispatch the run itself before the poller would.
+// With a non-empty idempotencyKey, a run already created with that key for the repo is
+// returned with created=false and nothing is enqueued.
+func EnqueueReviewRun(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int64, idempotencyKey string, force, skipDebounce bool, lease time.Duration) (id string, created bool, err error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("EnqueueReviewRun begin: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	const insert = `
+		INSERT INTO review_runs (repo_id, mr_number, status, idempotency_key)
+		VALUES ($1, $2, 'pending', NULLIF($3, ''))
+		ON CONFLICT (repo_id, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
 		RETURNING id`
 
-	var id string
-	if err := pool.QueryRow(ctx, q, repoID, mrNumber).Scan(&id); err != nil {
-		return "", fmt.Errorf("CreateReviewRun: %w", err)
+	err = tx.QueryRow(ctx, insert, repoID, mrNumber, idempotencyKey).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		const existing = `SELECT id FROM review_runs WHERE repo_id = $1 AND idempotency_key = $2`
+		if err := tx.QueryRow(ctx, existing, repoID, idempotencyKey).Scan(&id); err != nil {
+			return "", false, fmt.Errorf("EnqueueReviewRun existing: %w", err)
+		}
+		return id, false, nil
 	}
-	return id, nil
+	if err != nil {
+		return "", false, fmt.Errorf("EnqueueReviewRun: %w", err)
+	}
+
+	const outbox = `
+		INSERT INTO review_dispatch_outbox (review_run_id, force, skip_debounce, next_attempt_at)
+		VALUES ($1, $2, $3, now() + make_interval(secs => $4))`
+
+	if _, err := tx.Exec(ctx, outbox, id, force, skipDebounce, lease.Seconds()); err != nil {
+		return "", false, fmt.Errorf("EnqueueReviewRun outbox: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", false, fmt.Errorf("EnqueueReviewRun commit: %w", err)
+	}
+	return id, true, nil
+}
+
+// ClaimDueDispatches returns up to limit outbox entries that are due, oldest first, and
+// pushes each one's next attempt lease into the future so concurrent pollers skip it.
+// Entries whose run is no longer pending (e.g. cancelled) are dropped instead.
+func ClaimDueDispatches(ctx context.Context, pool *pgxpool.Pool, limit int, lease time.Duration) ([]DispatchOutboxRow, error) {
+	const q = `
+		WITH stale AS (
+			DELETE FROM review_dispatch_outbox o
+			USING review_runs r
+			WHERE r.id = o.review_run_id AND r.status <> 'pending'
+		), due AS (
+			SELECT o.review_run_id
+			FROM review_dispatch_outbox o
+			JOIN review_runs r ON r.id = o.review_run_id AND r.status = 'pending'
+			WHERE o.next_attempt_at <= now()
+			ORDER BY o.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF o SKIP LOCKED
+		)
+		UPDATE review_dispatch_outbox o
+		SET attempts = o.attempts + 1, next_attempt_at = now() + make_interval(secs => $2)
+		FROM due, review_runs r
+		WHERE o.review_run_id = due.review_run_id AND r.id = o.review_run_id
+		RETURNING o.review_run_id, r.repo_id, r.mr_number, o.force, o.attempts,
+		          (SELECT review_drafts FROM repositories WHERE id = r.repo_id), o.skip_debounce`
+
+	rows, err := pool.Query(ctx, q, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("ClaimDueDispatches: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []DispatchOutboxRow
+	for rows.Next() {
+		var e DispatchOutboxRow
+		if err := rows.Scan(&e.RunID, &e.RepoID, &e.MRNumber, &e.Force, &e.Attempts, &e.ReviewDrafts, &e.SkipDebounce); err != nil {
+			return nil, fmt.Errorf("ClaimDueDispatches scan: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// CompleteDispatch stores the Restate invocation ID on a review run and removes its
+// outbox entry.
+func CompleteDispatch(ctx context.Context, pool *pgxpool.Pool, runID, invocationID string) error {
+	const q = `
+		WITH done AS (
+			DELETE FROM review_dispatch_outbox WHERE review_run_id = $1
+		)
+		UPDATE review_runs SET restate_invocation_id = $2 WHERE id = $1`
+
+	if _, err := pool.Exec(ctx, q, runID, invocationID); err != nil {
+		return fmt.Errorf("CompleteDispatch: %w", err)
+	}
+	return nil
+}
+
+// FailDispatch records a failed dispatch attempt and makes the entry due again after
+// retryAfter.
+func FailDispatch(ctx context.Context, pool *pgxpool.Pool, runID, reason string, retryAfter time.Duration) error {
+	const q = `
+		UPDATE review_dispatch_outbox
+		SET last_error = $2, next_attempt_at = now() + make_interval(secs => $3)
+		WHERE review_run_id = $1`
+
+	if _, err := pool.Exec(ctx, q, runID, reason, retryAfter.Seconds()); err != nil {
+		return fmt.Errorf("FailDispatch: %w", err)
+	}
+	return nil
 }
 
 // GetReviewRun fetches a review run by ID.
 func GetReviewRun(ctx context.Context, pool *pgxpool.Pool, id string) (*ReviewRunRow, error) {
 	const q = `
-		SELECT id, repo_id, mr_number, status, summary, restate_invocation_id, created_at, updated_at
+		SELECT id, repo_id, mr_number, status, summary, restate_invocation_id,
+		       mr_title, mr_author, source_branch, target_branch, head_sha, created_at, updated_at
 		FROM review_runs
 		WHERE id = $1`
 
 	row := &ReviewRunRow{}
 	err := pool.QueryRow(ctx, q, id).Scan(
-		&row.ID, &row.RepoID, &row.MRNumber, &row.Status, &row.Summary, &row.RestateInvocationID, &row.CreatedAt, &row.UpdatedAt,
+		&row.ID, &row.RepoID, &row.MRNumber, &row.Status, &row.Summary, &row.RestateInvocationID,
+		&row.MRTitle, &row.MRAuthor, &row.SourceBranch, &row.TargetBranch, &row.HeadSHA, &row.CreatedAt, &row.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -266,17 +621,219 @@ func GetReviewRun(ctx context.Context, pool *pgxpool.Pool, id string) (*ReviewRu
 	return row, nil
 }
 
-// GetRepoByRemoteID looks up a repository by provider_id and remote_id.
+// ReviewRunFilter selects the review runs ListReviewRunsFiltered returns. Zero fields
+// don't filter.
+type ReviewRunFilter struct {
+	RepoID   string
+	Statuses []string
+	// From and To bound created_at, both inclusive.
+	From, To *time.Time
+	Limit    int
+	Offset   int
+}
+
+// whereArgs returns the arguments of reviewRunFilterWhere, in order. Statuses is never
+// nil: cardinality(NULL) is NULL, which would filter out every row.
+func (f ReviewRunFilter) whereArgs() []any {
+	statuses := f.Statuses
+	if statuses == nil {
+		statuses = []string{}
+	}
+	return []any{f.RepoID, statuses, f.From, f.To}
+}
+
+// reviewRunFilterWhere is the WHERE clause of ListReviewRunsFiltered over whereArgs.
+// repo_id is compared as a uuid so idx_review_runs_repo_created_status applies.
+const reviewRunFilterWhere = `
+		WHERE ($1 = '' OR repo_id = NULLIF($1, '')::uuid)
+		  AND (cardinality($2::text[]) = 0 OR status::text = ANY($2::text[]))
+		  AND ($3::timestamptz IS NULL OR created_at >= $3)
+		  AND ($4::timestamptz IS NULL OR created_at <= $4)`
+
+// ListReviewRunsFiltered returns up to f.Limit review runs matching f starting at
+// f.Offset, newest first, along with the total number matching.
+func ListReviewRunsFiltered(ctx context.Context, pool *pgxpool.Pool, f ReviewRunFilter) ([]ReviewRunRow, int, error) {
+	args := f.whereArgs()
+
+	var total int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM review_runs `+reviewRunFilterWhere, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("ListReviewRunsFiltered count: %w", err)
+	}
+
+	const q = `
+		SELECT id, repo_id, mr_number, status, summary, restate_invocation_id,
+		       mr_title, mr_author, source_branch, target_branch, head_sha, created_at, updated_at
+		FROM review_runs
+		` + reviewRunFilterWhere + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5 OFFSET $6`
+
+	rows, err := pool.Query(ctx, q, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ListReviewRunsFiltered: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []ReviewRunRow
+	for rows.Next() {
+		var r ReviewRunRow
+		if err := rows.Scan(&r.ID, &r.RepoID, &r.MRNumber, &r.Status, &r.Summary, &r.RestateInvocationID,
+			&r.MRTitle, &r.MRAuthor, &r.SourceBranch, &r.TargetBranch, &r.HeadSHA, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("ListReviewRunsFiltered scan: %w", err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, total, rows.Err()
+}
+
+// ReviewRunProgressRow is the part of a review run a UI watches while it is in flight.
+type ReviewRunProgressRow struct {
+	Status       string
+	CommentCount int64
+	UpdatedAt    time.Time
+}
+
+// GetReviewRunProgress returns a review run's status and comment count.
+// Returns pgx.ErrNoRows if the run does not exist.
+func GetReviewRunProgress(ctx context.Context, pool *pgxpool.Pool, id string) (*ReviewRunProgressRow, error) {
+	const q = `
+		SELECT r.status, (SELECT count(*) FROM review_comments c WHERE c.review_run_id = r.id), r.updated_at
+		FROM review_runs r
+		WHERE r.id = $1`
+
+	row := &ReviewRunProgressRow{}
+	if err := pool.QueryRow(ctx, q, id).Scan(&row.Status, &row.CommentCount, &row.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, fmt.Errorf("GetReviewRunProgress: %w", err)
+	}
+	return row, nil
+}
+
+// ListReviewRunEvents returns a review run's status transitions, oldest first.
+func ListReviewRunEvents(ctx context.Context, pool *pgxpool.Pool, runID string) ([]ReviewRunEventRow, error) {
+	const q = `
+		SELECT status, detail, created_at
+		FROM review_run_events
+		WHERE review_run_id = $1
+		ORDER BY created_at, id`
+
+	rows, err := pool.Query(ctx, q, runID)
+	if err != nil {
+		return nil, fmt.Errorf("ListReviewRunEvents: %w", err)
+	}
+	defer rows.Close()
+
+	var events []ReviewRunEventRow
+	for rows.Next() {
+		var e ReviewRunEventRow
+		if err := rows.Scan(&e.Status, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ListReviewRunEvents scan: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// SetSummaryTemplate updates summary_template on a repository and returns the updated row.
+func SetSummaryTemplate(ctx context.Context, pool *pgxpool.Pool, id, tmpl string) (*RepoRow, error) {
+	const q = `
+		UPDATE repositories SET summary_template = $1
+		WHERE id = $2
+		RETURNING id, provider_id, remote_id, name, full_path, review_enabled, summary_template, review_model, review_temperature, auto_approve_on_clean, review_drafts, comment_prefix, reviewer_variant, include_related_issues, post_empty_summary, target_branch_patterns, require_pipeline_success, post_mode, archived, created_at`
+
+	row := &RepoRow{}
+	err := pool.QueryRow(ctx, q, tmpl, id).Scan(
+		&row.ID, &row.ProviderID, &row.RemoteID, &row.Name, &row.FullPath, &row.ReviewEnabled, &row.SummaryTemplate, &row.ReviewModel, &row.ReviewTemperature, &row.AutoApproveOnClean, &row.ReviewDrafts, &row.CommentPrefix, &row.ReviewerVariant, &row.IncludeRelatedIssues, &row.PostEmptySummary, &row.TargetBranchPatterns, &row.RequirePipelineSuccess, &row.PostMode, &row.Archived, &row.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, fmt.Errorf("SetSummaryTemplate: %w", err)
+	}
+	return row, nil
+}
+
+// SetRepoConfig replaces the Reviewer overrides and review flags of a repository and returns
+// the updated row. An empty model or nil temperature clears the override; an empty prefix
+// posts comments without one, an empty variant uses the default Reviewer, and no target
+// branch patterns review MRs into any branch. postMode must be "comments" or "check_run".
+func SetRepoConfig(ctx context.Context, pool *pgxpool.Pool, id, model string, temperature *float64, autoApprove, reviewDrafts bool, commentPrefix, reviewerVariant string, includeRelatedIssues, postEmptySummary bool, targetBranchPatterns []string, requirePipelineSuccess bool, postMode string) (*RepoRow, error) {
+	if targetBranchPatterns == nil {
+		targetBranchPatterns = []string{} // the column is NOT NULL
+	}
+	const q = `
+		UPDATE repositories SET review_model = $1, review_temperature = $2, auto_approve_on_clean = $4, review_drafts = $5, comment_prefix = $6, reviewer_variant = $7, include_related_issues = $8, post_empty_summary = $9, target_branch_patterns = $10, require_pipeline_success = $11, post_mode = $12
+		WHERE id = $3
+		RETURNING id, provider_id, remote_id, name, full_path, review_enabled, summary_template, review_model, review_temperature, auto_approve_on_clean, review_drafts, comment_prefix, reviewer_variant, include_related_issues, post_empty_summary, target_branch_patterns, require_pipeline_success, post_mode, archived, created_at`
+
+	row := &RepoRow{}
+	err := pool.QueryRow(ctx, q, model, temperature, id, autoApprove, reviewDrafts, commentPrefix, reviewerVariant, includeRelatedIssues, postEmptySummary, targetBranchPatterns, requirePipelineSuccess, postMode).Scan(
+		&row.ID, &row.ProviderID, &row.RemoteID, &row.Name, &row.FullPath, &row.ReviewEnabled, &row.SummaryTemplate, &row.ReviewModel, &row.ReviewTemperature, &row.AutoApproveOnClean, &row.ReviewDrafts, &row.CommentPrefix, &row.ReviewerVariant, &row.IncludeRelatedIssues, &row.PostEmptySummary, &row.TargetBranchPatterns, &row.RequirePipelineSuccess, &row.PostMode, &row.Archived, &row.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, fmt.Errorf("SetRepoConfig: %w", err)
+	}
+	return row, nil
+}
+
+// RepoReviewStatsRow holds a repository's review run counters over a time window.
+type RepoReviewStatsRow struct {
+	Total      int64
+	Completed  int64
+	Skipped    int64
+	Failed     int64
+	Cancelled  int64
+	InProgress int64
+	// Comments counts the comments of completed runs only.
+	Comments int64
+}
+
+// GetRepoReviewStats counts the review runs of a repo created in [from, to) by status,
+// along with the comments of the completed ones, in a single query. Draft placeholder
+// runs are not counted.
+func GetRepoReviewStats(ctx context.Context, pool *pgxpool.Pool, repoID string, from, to time.Time) (*RepoReviewStatsRow, error) {
+	const q = `
+		SELECT count(*),
+		       count(*) FILTER (WHERE r.status = 'completed'),
+		       count(*) FILTER (WHERE r.status = 'skipped'),
+		       count(*) FILTER (WHERE r.status = 'failed'),
+		       count(*) FILTER (WHERE r.status = 'cancelled'),
+		       count(*) FILTER (WHERE r.status IN ('pending', 'running')),
+		       coalesce(sum(c.n) FILTER (WHERE r.status = 'completed'), 0)
+		FROM review_runs r
+		CROSS JOIN LATERAL (SELECT count(*) AS n FROM review_comments WHERE review_run_id = r.id) c
+		WHERE r.repo_id = $1 AND r.status <> 'draft' AND r.created_at >= $2 AND r.created_at < $3`
+
+	row := &RepoReviewStatsRow{}
+	err := pool.QueryRow(ctx, q, repoID, from, to).Scan(
+		&row.Total, &row.Completed, &row.Skipped, &row.Failed, &row.Cancelled, &row.InProgress, &row.Comments,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("GetRepoReviewStats: %w", err)
+	}
+	return row, nil
+}
+
+// GetRepoByRemoteID looks up a repository by provider_id and remote_id. Transient errors
+// are retried (see withRetry).
 func GetRepoByRemoteID(ctx context.Context, pool *pgxpool.Pool, providerID, remoteID string) (*RepoRow, error) {
 	const q = `
-		SELECT id, provider_id, remote_id, name, full_path, review_enabled, created_at
+		SELECT id, provider_id, remote_id, name, full_path, review_enabled, summary_template, review_model, review_temperature, auto_approve_on_clean, review_drafts, comment_prefix, reviewer_variant, include_related_issues, post_empty_summary, target_branch_patterns, require_pipeline_success, post_mode, archived, created_at
 		FROM repositories
-		WHERE provider_id = $1 AND remote_id = $2`
+		WHERE provider_id = $1 AND remote_id = $2 AND deleted_at IS NULL`
 
 	row := &RepoRow{}
-	err := pool.QueryRow(ctx, q, providerID, remoteID).Scan(
-		&row.ID, &row.ProviderID, &row.RemoteID, &row.Name, &row.FullPath, &row.ReviewEnabled, &row.CreatedAt,
-	)
+	err := withRetry(ctx, func() error {
+		return pool.QueryRow(ctx, q, providerID, remoteID).Scan(
+			&row.ID, &row.ProviderID, &row.RemoteID, &row.Name, &row.FullPath, &row.ReviewEnabled, &row.SummaryTemplate, &row.ReviewModel, &row.ReviewTemperature, &row.AutoApproveOnClean, &row.ReviewDrafts, &row.CommentPrefix, &row.ReviewerVariant, &row.IncludeRelatedIssues, &row.PostEmptySummary, &row.TargetBranchPatterns, &row.RequirePipelineSuccess, &row.PostMode, &row.Archived, &row.CreatedAt,
+		)
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, pgx.ErrNoRows
@@ -306,6 +863,101 @@ func GetActiveInvocationID(ctx context.Context, pool *pgxpool.Pool, repoID strin
 	return invocationID, nil
 }
 
+// ReviewTargetRow is what the webhook path needs to dispatch a review of one merge
+// request, as returned by GetReviewTargetByRemoteID.
+type ReviewTargetRow struct {
+	RepoID        string
+	ReviewEnabled bool
+	ReviewDrafts  bool
+	Archived      bool
+	// RequirePipelineSuccess is the repo's require_pipeline_success flag.
+	RequirePipelineSuccess bool
+	// ActiveInvocationID is the Restate invocation of the MR's newest pending or running
+	// review run; nil if there is none or it has no invocation yet.
+	ActiveInvocationID *string
+	// PipelineBlockedSHA is the head commit the pipeline gate skipped the MR's newest review
+	// run at; empty if that run wasn't skipped by the gate.
+	PipelineBlockedSHA string
+}
+
+// GetReviewTargetByRemoteID combines GetRepoByRemoteID and GetActiveInvocationID for MR
+// mrNumber, plus whether the MR's newest run was skipped by the pipeline gate, into one
+// round trip. It returns pgx.ErrNoRows if the repository isn't found.
+// Transient errors are retried (see withRetry).
+func GetReviewTargetByRemoteID(ctx context.Context, pool *pgxpool.Pool, providerID, remoteID string, mrNumber int64) (*ReviewTargetRow, error) {
+	const q = `
+		SELECT r.id, r.review_enabled, r.review_drafts, r.archived, r.require_pipeline_success,
+			(SELECT rr.restate_invocation_id
+			 FROM review_runs rr
+			 WHERE rr.repo_id = r.id AND rr.mr_number = $3 AND rr.status IN ('pending', 'running')
+			 ORDER BY rr.created_at DESC
+			 LIMIT 1),
+			COALESCE((SELECT CASE WHEN rr.pipeline_blocked AND rr.status = 'skipped' THEN rr.head_sha ELSE '' END
+			 FROM review_runs rr
+			 WHERE rr.repo_id = r.id AND rr.mr_number = $3
+			 ORDER BY rr.created_at DESC
+			 LIMIT 1), '')
+		FROM repositories r
+		WHERE r.provider_id = $1 AND r.remote_id = $2 AND r.deleted_at IS NULL`
+
+	row := &ReviewTargetRow{}
+	err := withRetry(ctx, func() error {
+		return pool.QueryRow(ctx, q, providerID, remoteID, mrNumber).Scan(&row.RepoID, &row.ReviewEnabled, &row.ReviewDrafts, &row.Archived, &row.RequirePipelineSuccess, &row.ActiveInvocationID, &row.PipelineBlockedSHA)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		return nil, fmt.Errorf("GetReviewTargetByRemoteID: %w", err)
+	}
+	return row, nil
+}
+
+// ListActiveReviewRuns returns all pending or running review runs, oldest first.
+// A non-empty repoID restricts the result to that repository.
+func ListActiveReviewRuns(ctx context.Context, pool *pgxpool.Pool, repoID string) ([]ActiveReviewRunRow, error) {
+	const q = `
+		SELECT id, repo_id, mr_number, status, restate_invocation_id, created_at
+		FROM review_runs
+		WHERE status IN ('pending', 'running') AND ($1 = '' OR repo_id::text = $1)
+		ORDER BY created_at, id`
+
+	rows, err := pool.Query(ctx, q, repoID)
+	if err != nil {
+		return nil, fmt.Errorf("ListActiveReviewRuns: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []ActiveReviewRunRow
+	for rows.Next() {
+		var r ActiveReviewRunRow
+		if err := rows.Scan(&r.ID, &r.RepoID, &r.MRNumber, &r.Status, &r.RestateInvocationID, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ListActiveReviewRuns scan: %w", err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// CancelReviewRun sets a pending or running review run to cancelled and records the
+// transition in review_run_events with detail. It reports whether the run was still active.
+func CancelReviewRun(ctx context.Context, pool *pgxpool.Pool, runID, detail string) (bool, error) {
+	const q = `
+		WITH cancelled AS (
+			UPDATE review_runs SET status = 'cancelled', updated_at = now()
+			WHERE id = $1 AND status IN ('pending', 'running')
+			RETURNING id
+		)
+		INSERT INTO review_run_events (review_run_id, status, detail)
+		SELECT id, 'cancelled', $2 FROM cancelled`
+
+	tag, err := pool.Exec(ctx, q, runID, detail)
+	if err != nil {
+		return false, fmt.Errorf("CancelReviewRun: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
 // CreateReviewRunWithInvocation inserts a review run with a Restate invocation ID and returns its ID.
 func CreateReviewRunWithInvocation(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int64, invocationID string) (string, error) {
 	const q = `
@@ -354,23 +1006,13 @@ func TransitionDraftToReview(ctx context.Context, pool *pgxpool.Pool, repoID str
 	return nil
 }
 
-// UpdateReviewRunInvocationID sets the restate_invocation_id on an existing review run.
-func UpdateReviewRunInvocationID(ctx context.Context, pool *pgxpool.Pool, runID, invocationID string) error {
-	const q = `UPDATE review_runs SET restate_invocation_id = $1 WHERE id = $2`
-	_, err := pool.Exec(ctx, q, invocationID, runID)
-	if err != nil {
-		return fmt.Errorf("UpdateReviewRunInvocationID: %w", err)
-	}
-	return nil
-}
-
 // GetReviewComments returns all comments for a review run.
 func GetReviewComments(ctx context.Context, pool *pgxpool.Pool, reviewRunID string) ([]ReviewCommentRow, error) {
 	const q = `
-		SELECT id, review_run_id, file_path, line_start, line_end, body
+		SELECT ` + reviewCommentColumns + `
 		FROM review_comments
 		WHERE review_run_id = $1
-		ORDER BY created_at`
+		ORDER BY created_at, id`
 
 	rows, err := pool.Query(ctx, q, reviewRunID)
 	if err != nil {
@@ -380,11 +1022,155 @@ func GetReviewComments(ctx context.Context, pool *pgxpool.Pool, reviewRunID stri
 
 	var comments []ReviewCommentRow
 	for rows.Next() {
-		var c ReviewCommentRow
-		if err := rows.Scan(&c.ID, &c.ReviewRunID, &c.FilePath, &c.LineStart, &c.LineEnd, &c.Body); err != nil {
+		c, err := scanReviewComment(rows)
+		if err != nil {
 			return nil, fmt.Errorf("GetReviewComments scan: %w", err)
 		}
 		comments = append(comments, c)
 	}
 	return comments, rows.Err()
 }
+
+// GetReviewCommentsPage returns up to limit comments for a review run starting at offset,
+// ordered like GetReviewComments, along with the run's total comment count.
+func GetReviewCommentsPage(ctx context.Context, pool *pgxpool.Pool, reviewRunID string, limit, offset int) ([]ReviewCommentRow, int, error) {
+	var total int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM review_comments WHERE review_run_id = $1`, reviewRunID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("GetReviewCommentsPage count: %w", err)
+	}
+
+	const q = `
+		SELECT ` + reviewCommentColumns + `
+		FROM review_comments
+		WHERE review_run_id = $1
+		ORDER BY created_at, id
+		LIMIT $2 OFFSET $3`
+
+	rows, err := pool.Query(ctx, q, reviewRunID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetReviewCommentsPage: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []ReviewCommentRow
+	for rows.Next() {
+		c, err := scanReviewComment(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("GetReviewCommentsPage scan: %w", err)
+		}
+		comments = append(comments, c)
+	}
+	return comments, total, rows.Err()
+}
+
+// GetLatestCompletedRunID returns the ID of the most recent completed review run for the given repo+MR,
+// or "" if none exists.
+func GetLatestCompletedRunID(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int64) (string, error) {
+	const q = `
+		SELECT id FROM review_runs
+		WHERE repo_id = $1 AND mr_number = $2 AND status = 'completed'
+		ORDER BY created_at DESC
+		LIMIT 1`
+
+	var id string
+	err := pool.QueryRow(ctx, q, repoID, mrNumber).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("GetLatestCompletedRunID: %w", err)
+	}
+	return id, nil
+}
+
+// GetLatestReviewHeadSHA returns the head SHA of the most recent completed review
+// for the given repo+MR, or ("", false, nil) if none exists.
+func GetLatestReviewHeadSHA(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int64) (string, bool, error) {
+	const q = `
+		SELECT head_sha FROM review_runs
+		WHERE repo_id = $1 AND mr_number = $2 AND status = 'completed' AND head_sha <> ''
+		ORDER BY created_at DESC
+		LIMIT 1`
+
+	var sha string
+	err := pool.QueryRow(ctx, q, repoID, mrNumber).Scan(&sha)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("GetLatestReviewHeadSHA: %w", err)
+	}
+	return sha, true, nil
+}
+
+// ListMRFindingComments returns all comments from completed review runs of the given repo+MR,
+// ordered oldest run first.
+func ListMRFindingComments(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int64) ([]FindingCommentRow, error) {
+	const q = `
+		SELECT c.id, c.review_run_id, c.file_path, c.line_start, c.line_end, c.body, c.severity,
+		       COALESCE(c.fingerprint, ''), c.dismissed_at IS NOT NULL
+		FROM review_comments c
+		JOIN review_runs r ON r.id = c.review_run_id
+		WHERE r.repo_id = $1 AND r.mr_number = $2 AND r.status = 'completed'
+		ORDER BY r.created_at, c.created_at`
+
+	rows, err := pool.Query(ctx, q, repoID, mrNumber)
+	if err != nil {
+		return nil, fmt.Errorf("ListMRFindingComments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []FindingCommentRow
+	for rows.Next() {
+		var c FindingCommentRow
+		if err := rows.Scan(&c.ID, &c.ReviewRunID, &c.FilePath, &c.LineStart, &c.LineEnd, &c.Body, &c.Severity, &c.Fingerprint, &c.Dismissed); err != nil {
+			return nil, fmt.Errorf("ListMRFindingComments scan: %w", err)
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// DismissFinding marks every comment with the given fingerprint on the repo+MR as dismissed.
+// Already-dismissed comments keep their original timestamp. Returns pgx.ErrNoRows if no comment matches.
+func DismissFinding(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int64, fingerprint string) error {
+	const q = `
+		UPDATE review_comments
+		SET dismissed_at = COALESCE(dismissed_at, now())
+		WHERE fingerprint = $3 AND review_run_id IN (
+			SELECT id FROM review_runs WHERE repo_id = $1 AND mr_number = $2
+		)`
+
+	tag, err := pool.Exec(ctx, q, repoID, mrNumber, fingerprint)
+	if err != nil {
+		return fmt.Errorf("DismissFinding: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// RecordDelivery records a webhook delivery UUID for a provider. Returns seen=true if the
+// delivery had already been recorded.
+func RecordDelivery(ctx context.Context, pool *pgxpool.Pool, providerID, eventUUID string) (bool, error) {
+	const q = `
+		INSERT INTO webhook_deliveries (provider_id, event_uuid)
+		VALUES ($1, $2)
+		ON CONFLICT (provider_id, event_uuid) DO NOTHING`
+
+	tag, err := pool.Exec(ctx, q, providerID, eventUUID)
+	if err != nil {
+		return false, fmt.Errorf("RecordDelivery: %w", err)
+	}
+	return tag.RowsAffected() == 0, nil
+}
+
+// DeleteDelivery removes a webhook delivery UUID recorded by RecordDelivery.
+func DeleteDelivery(ctx context.Context, pool *pgxpool.Pool, providerID, eventUUID string) error {
+	const q = `DELETE FROM webhook_deliveries WHERE provider_id = $1 AND event_uuid = $2`
+	if _, err := pool.Exec(ctx, q, providerID, eventUUID); err != nil {
+		return fmt.Errorf("DeleteDelivery: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// retryAttempts bounds how many times withRetry runs a query.
+	retryAttempts = 3
+)
+
+// retryBaseBackoff is the wait before withRetry's first retry; it doubles on each
+// subsequent one. Tests shorten it.
+var retryBaseBackoff = 50 * time.Millisecond
+
+// withRetry runs fn, retrying with exponential backoff while it fails with a transient
+// error (see isTransient), so a brief database blip such as a failover or a pooled
+// connection reset doesn't fail the caller. It gives up after retryAttempts or when ctx is
+// done, returning fn's last error. Only use it for reads and idempotent writes: a reset
+// connection may have lost the reply to a statement the server already ran.
+func withRetry(ctx context.Context, fn func() error) error {
+	return retry(ctx, fn, isTransient)
+}
+
+// withWriteRetry is withRetry for statements that must not run twice, such as a plain
+// INSERT: it only retries errors pgx raised before sending anything (pgconn.SafeToRetry).
+func withWriteRetry(ctx context.Context, fn func() error) error {
+	return retry(ctx, fn, pgconn.SafeToRetry)
+}
+
+// retry runs fn until it succeeds, fails with an error retryable rejects, retryAttempts
+// runs were made or ctx is done, backing off exponentially between runs.
+func retry(ctx context.Context, fn func() error, retryable func(error) bool) error {
+	backoff := retryBaseBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !retryable(err) || ctx.Err() != nil || attempt >= retryAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether err is a connection-level failure worth retrying: one pgx
+// raised before sending anything, a reset connection, a connection exception (class 08),
+// or the server shutting down or not yet accepting connections (57P01-57P03). Errors about
+// the query itself, such as pgx.ErrNoRows or a constraint violation, are not.
+func isTransient(err error) bool {
+	if pgconn.SafeToRetry(err) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+			return true
+		}
+		return len(pgErr.Code) == 5 && pgErr.Code[:2] == "08"
+	}
+	return false
+}
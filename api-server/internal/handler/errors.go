@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"errors"
+
+	"connectrpc.com/connect"
+
+	apiv1 "ai-reviewer/gen/api/v1"
+)
+
+// invalidArg returns an InvalidArgument error for a bad request field, carrying an
+// apiv1.FieldViolation detail so clients can map it back to the field.
+func invalidArg(field, msg string) *connect.Error {
+	cerr := connect.NewError(connect.CodeInvalidArgument, errors.New(msg))
+	if detail, err := connect.NewErrorDetail(&apiv1.FieldViolation{Field: field, Description: msg}); err == nil {
+		cerr.AddDetail(detail)
+	}
+	return cerr
+}
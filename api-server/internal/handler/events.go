@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ai-reviewer/api-server/internal/db"
+)
+
+// ReviewEventsPattern is the ServeMux pattern ReviewEventsHandler is served under.
+const ReviewEventsPattern = "GET /reviews/{id}/events"
+
+// DefaultEventsPollInterval is how often ReviewEventsHandler checks a run for changes.
+const DefaultEventsPollInterval = time.Second
+
+// ReviewEventsStore is the minimal DB interface needed by ReviewEventsHandler.
+type ReviewEventsStore interface {
+	GetReviewRunProgress(ctx context.Context, id string) (*db.ReviewRunProgressRow, error)
+}
+
+// PoolReviewEventsStore adapts *pgxpool.Pool to the ReviewEventsStore interface.
+type PoolReviewEventsStore struct {
+	Pool *pgxpool.Pool
+}
+
+// GetReviewRunProgress implements ReviewEventsStore.
+func (s *PoolReviewEventsStore) GetReviewRunProgress(ctx context.Context, id string) (*db.ReviewRunProgressRow, error) {
+	return db.GetReviewRunProgress(ctx, s.Pool, id)
+}
+
+// ReviewEventsHandler streams a review run's status and comment count as server-sent
+// events, so a UI doesn't have to poll GetReviewRun. It polls the run itself and emits an
+// event whenever either value changes, starting with the current state. The stream ends
+// once the run reaches a terminal status or the client disconnects.
+type ReviewEventsHandler struct {
+	store        ReviewEventsStore
+	pollInterval time.Duration
+}
+
+// NewReviewEventsHandler creates a ReviewEventsHandler polling every DefaultEventsPollInterval.
+func NewReviewEventsHandler(store ReviewEventsStore) *ReviewEventsHandler {
+	return &ReviewEventsHandler{store: store, pollInterval: DefaultEventsPollInterval}
+}
+
+// SetPollInterval overrides how often the run is checked for changes.
+func (h *ReviewEventsHandler) SetPollInterval(d time.Duration) {
+	h.pollInterval = d
+}
+
+// reviewRunEvent is the data of a "status" event.
+type reviewRunEvent struct {
+	ID           string    `json:"id"`
+	Status       string    `json:"status"`
+	CommentCount int64     `json:"comment_count"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (h *ReviewEventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	progress, err := h.store.GetReviewRunProgress(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "review run not found")
+		return
+	}
+	if err != nil {
+		log.Printf("review events: loading run %s: %v", id, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	ticker := time.NewTicker(h.pollInterval)
+	defer ticker.Stop()
+
+	var last *db.ReviewRunProgressRow
+	for {
+		if last == nil || progress.Status != last.Status || progress.CommentCount != last.CommentCount {
+			if err := writeReviewRunEvent(w, id, progress); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			last = progress
+		}
+		if isTerminalReviewStatus(progress.Status) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		next, err := h.store.GetReviewRunProgress(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// Keep the last state and try again on the next tick.
+			log.Printf("review events: polling run %s: %v", id, err)
+			continue
+		}
+		progress = next
+	}
+}
+
+// writeReviewRunEvent writes one "status" event for the run.
+func writeReviewRunEvent(w io.Writer, id string, p *db.ReviewRunProgressRow) error {
+	data, err := json.Marshal(reviewRunEvent{
+		ID:           id,
+		Status:       p.Status,
+		CommentCount: p.CommentCount,
+		UpdatedAt:    p.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+	return err
+}
+
+// isTerminalReviewStatus reports whether a run in status will not change any more.
+func isTerminalReviewStatus(status string) bool {
+	return status != "pending" && status != "running"
+}
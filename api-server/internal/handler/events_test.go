@@ -0,0 +1,155 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"ai-reviewer/api-server/internal/db"
+	"ai-reviewer/api-server/internal/handler"
+)
+
+// stubEventsStore returns the progress rows in order, repeating the last one.
+type stubEventsStore struct {
+	mu    sync.Mutex
+	steps []db.ReviewRunProgressRow
+	calls int
+}
+
+func (s *stubEventsStore) GetReviewRunProgress(_ context.Context, id string) (*db.ReviewRunProgressRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id != "run1" {
+		return nil, pgx.ErrNoRows
+	}
+	i := min(s.calls, len(s.steps)-1)
+	s.calls++
+	row := s.steps[i]
+	return &row, nil
+}
+
+func newEventsServer(t *testing.T, store handler.ReviewEventsStore) *httptest.Server {
+	t.Helper()
+	h := handler.NewReviewEventsHandler(store)
+	h.SetPollInterval(time.Millisecond)
+	mux := http.NewServeMux()
+	mux.Handle(handler.ReviewEventsPattern, h)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// readEvents reads "status" events until the server closes the stream.
+func readEvents(t *testing.T, resp *http.Response) []map[string]any {
+	t.Helper()
+	var events []map[string]any
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev map[string]any
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatalf("decoding event %q: %v", data, err)
+		}
+		events = append(events, ev)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+	return events
+}
+
+func TestReviewEvents_StreamsChangesUntilTerminal(t *testing.T) {
+	store := &stubEventsStore{steps: []db.ReviewRunProgressRow{
+		{Status: "pending"},
+		{Status: "pending"},
+		{Status: "running"},
+		{Status: "running", CommentCount: 3},
+		{Status: "completed", CommentCount: 3},
+	}}
+	srv := newEventsServer(t, store)
+
+	resp, err := http.Get(srv.URL + "/reviews/run1/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	events := readEvents(t, resp)
+	var got []string
+	for _, ev := range events {
+		got = append(got, ev["status"].(string))
+	}
+	// The repeated "pending" poll emits nothing.
+	if want := "pending,running,running,completed"; strings.Join(got, ",") != want {
+		t.Errorf("statuses = %v, want %s", got, want)
+	}
+	if last := events[len(events)-1]; last["id"] != "run1" || last["comment_count"] != float64(3) {
+		t.Errorf("last event = %v", last)
+	}
+}
+
+func TestReviewEvents_AlreadyTerminal(t *testing.T) {
+	store := &stubEventsStore{steps: []db.ReviewRunProgressRow{{Status: "failed"}}}
+	srv := newEventsServer(t, store)
+
+	resp, err := http.Get(srv.URL + "/reviews/run1/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if events := readEvents(t, resp); len(events) != 1 || events[0]["status"] != "failed" {
+		t.Errorf("events = %v, want one failed event", events)
+	}
+}
+
+func TestReviewEvents_NotFound(t *testing.T) {
+	srv := newEventsServer(t, &stubEventsStore{})
+
+	resp, err := http.Get(srv.URL + "/reviews/missing/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestReviewEvents_ClientDisconnect(t *testing.T) {
+	store := &stubEventsStore{steps: []db.ReviewRunProgressRow{{Status: "running"}}}
+	h := handler.NewReviewEventsHandler(store)
+	h.SetPollInterval(time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/reviews/run1/events", nil)
+	req.SetPathValue("id", "run1")
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler did not return after the client disconnected")
+	}
+}
@@ -0,0 +1,4 @@
+package handler
+
+// SetAsyncDone installs a hook called after each background webhook event completes.
+func SetAsyncDone(h *WebhookHandler, done func()) { h.asyncDone = done }
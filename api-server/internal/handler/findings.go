@@ -0,0 +1,57 @@
+package handler
+
+import (
+	apiv1 "ai-reviewer/gen/api/v1"
+	"ai-reviewer/api-server/internal/db"
+)
+
+// mergeFindings collapses comments from successive review runs into one finding per fingerprint.
+// comments must be ordered oldest run first. A finding is open if it was reported by latestRunID,
+// resolved otherwise, and dismissed if any of its occurrences was dismissed.
+func mergeFindings(comments []db.FindingCommentRow, latestRunID string) []*apiv1.Finding {
+	byFingerprint := make(map[string]*apiv1.Finding)
+	dismissed := make(map[string]bool)
+	var findings []*apiv1.Finding
+
+	for _, c := range comments {
+		fp := c.Fingerprint
+		if fp == "" {
+			// Comment predates fingerprinting — it cannot be matched against other runs.
+			fp = c.ID
+		}
+
+		f, ok := byFingerprint[fp]
+		if !ok {
+			f = &apiv1.Finding{Fingerprint: fp, FirstSeenRunId: c.ReviewRunID}
+			byFingerprint[fp] = f
+			findings = append(findings, f)
+		}
+
+		// Count runs rather than comments, so duplicates within one run don't inflate it.
+		if f.LastSeenRunId != c.ReviewRunID {
+			f.Occurrences++
+		}
+		// The most recent occurrence wins for location and wording.
+		f.LastSeenRunId = c.ReviewRunID
+		f.FilePath = c.FilePath
+		f.LineStart = int32(c.LineStart)
+		f.LineEnd = int32(c.LineEnd)
+		f.Body = c.Body
+
+		if c.Dismissed {
+			dismissed[fp] = true
+		}
+	}
+
+	for _, f := range findings {
+		switch {
+		case dismissed[f.Fingerprint]:
+			f.Status = apiv1.FindingStatus_FINDING_STATUS_DISMISSED
+		case f.LastSeenRunId == latestRunID:
+			f.Status = apiv1.FindingStatus_FINDING_STATUS_OPEN
+		default:
+			f.Status = apiv1.FindingStatus_FINDING_STATUS_RESOLVED
+		}
+	}
+	return findings
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"testing"
+
+	apiv1 "ai-reviewer/gen/api/v1"
+	"ai-reviewer/api-server/internal/db"
+)
+
+func findingComment(id, runID, fingerprint string, line int, dismissed bool) db.FindingCommentRow {
+	return db.FindingCommentRow{
+		ReviewCommentRow: db.ReviewCommentRow{
+			ID:          id,
+			ReviewRunID: runID,
+			FilePath:    "main.go",
+			LineStart:   line,
+			LineEnd:     line,
+			Body:        "body " + fingerprint,
+		},
+		Fingerprint: fingerprint,
+		Dismissed:   dismissed,
+	}
+}
+
+func TestMergeFindings_TwoRunsOverlapping(t *testing.T) {
+	comments := []db.FindingCommentRow{
+		// run1: fpA, fpB
+		findingComment("c1", "run1", "fpA", 10, false),
+		findingComment("c2", "run1", "fpB", 20, false),
+		// run2: fpA (moved), fpC — fpB was fixed
+		findingComment("c3", "run2", "fpA", 14, false),
+		findingComment("c4", "run2", "fpC", 30, false),
+	}
+
+	findings := mergeFindings(comments, "run2")
+	if len(findings) != 3 {
+		t.Fatalf("expected 3 findings, got %d", len(findings))
+	}
+
+	byFP := make(map[string]*apiv1.Finding)
+	for _, f := range findings {
+		byFP[f.Fingerprint] = f
+	}
+
+	a := byFP["fpA"]
+	if a.Status != apiv1.FindingStatus_FINDING_STATUS_OPEN {
+		t.Errorf("fpA: expected OPEN, got %v", a.Status)
+	}
+	if a.Occurrences != 2 {
+		t.Errorf("fpA: expected 2 occurrences, got %d", a.Occurrences)
+	}
+	if a.FirstSeenRunId != "run1" || a.LastSeenRunId != "run2" {
+		t.Errorf("fpA: unexpected run range %s..%s", a.FirstSeenRunId, a.LastSeenRunId)
+	}
+	if a.LineStart != 14 {
+		t.Errorf("fpA: expected latest line 14, got %d", a.LineStart)
+	}
+
+	if b := byFP["fpB"]; b.Status != apiv1.FindingStatus_FINDING_STATUS_RESOLVED {
+		t.Errorf("fpB: expected RESOLVED, got %v", b.Status)
+	}
+	if c := byFP["fpC"]; c.Status != apiv1.FindingStatus_FINDING_STATUS_OPEN || c.Occurrences != 1 {
+		t.Errorf("fpC: expected OPEN with 1 occurrence, got %v/%d", c.Status, c.Occurrences)
+	}
+}
+
+func TestMergeFindings_DismissedIsSticky(t *testing.T) {
+	comments := []db.FindingCommentRow{
+		findingComment("c1", "run1", "fpA", 10, true),
+		findingComment("c2", "run2", "fpA", 10, false),
+	}
+
+	findings := mergeFindings(comments, "run2")
+	if len(findings) != 1 {
+		t.Fatalf("expected 1 finding, got %d", len(findings))
+	}
+	if findings[0].Status != apiv1.FindingStatus_FINDING_STATUS_DISMISSED {
+		t.Errorf("expected DISMISSED, got %v", findings[0].Status)
+	}
+}
+
+func TestMergeFindings_DuplicateWithinRunCountsOnce(t *testing.T) {
+	comments := []db.FindingCommentRow{
+		findingComment("c1", "run1", "fpA", 10, false),
+		findingComment("c2", "run1", "fpA", 40, false),
+	}
+
+	findings := mergeFindings(comments, "run1")
+	if len(findings) != 1 || findings[0].Occurrences != 1 {
+		t.Fatalf("expected 1 finding with 1 occurrence, got %+v", findings)
+	}
+}
+
+func TestMergeFindings_MissingFingerprintNotMerged(t *testing.T) {
+	comments := []db.FindingCommentRow{
+		findingComment("c1", "run1", "", 10, false),
+		findingComment("c2", "run1", "", 10, false),
+	}
+
+	if findings := mergeFindings(comments, "run1"); len(findings) != 2 {
+		t.Fatalf("expected 2 unmerged findings, got %d", len(findings))
+	}
+}
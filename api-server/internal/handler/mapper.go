@@ -3,8 +3,10 @@ package handler
 import (
 	"time"
 
-	apiv1 "ai-reviewer/gen/api/v1"
 	"ai-reviewer/api-server/internal/db"
+	"ai-reviewer/api-server/internal/restate"
+	"ai-reviewer/api-server/internal/sarif"
+	apiv1 "ai-reviewer/gen/api/v1"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -16,6 +18,10 @@ func providerTypeToString(t apiv1.ProviderType) string {
 		return "gitlab_cloud"
 	case apiv1.ProviderType_PROVIDER_TYPE_GITHUB:
 		return "github"
+	case apiv1.ProviderType_PROVIDER_TYPE_GITEA:
+		return "gitea"
+	case apiv1.ProviderType_PROVIDER_TYPE_BITBUCKET_CLOUD:
+		return "bitbucket_cloud"
 	default:
 		return ""
 	}
@@ -29,6 +35,10 @@ func stringToProviderType(s string) apiv1.ProviderType {
 		return apiv1.ProviderType_PROVIDER_TYPE_GITLAB_CLOUD
 	case "github":
 		return apiv1.ProviderType_PROVIDER_TYPE_GITHUB
+	case "gitea":
+		return apiv1.ProviderType_PROVIDER_TYPE_GITEA
+	case "bitbucket_cloud":
+		return apiv1.ProviderType_PROVIDER_TYPE_BITBUCKET_CLOUD
 	default:
 		return apiv1.ProviderType_PROVIDER_TYPE_UNSPECIFIED
 	}
@@ -44,56 +54,201 @@ func stringToReviewStatus(s string) apiv1.ReviewStatus {
 		return apiv1.ReviewStatus_REVIEW_STATUS_COMPLETED
 	case "failed":
 		return apiv1.ReviewStatus_REVIEW_STATUS_FAILED
+	case "cancelled":
+		return apiv1.ReviewStatus_REVIEW_STATUS_CANCELLED
 	default:
 		return apiv1.ReviewStatus_REVIEW_STATUS_UNSPECIFIED
 	}
 }
 
+// repoReviewStatsToProto maps a repo's counters over [start, end) and derives the averages
+// and rates from them.
+func repoReviewStatsToProto(repoID string, start, end time.Time, s db.RepoReviewStatsRow) *apiv1.RepoReviewStats {
+	stats := &apiv1.RepoReviewStats{
+		RepoId:       repoID,
+		WindowStart:  toTimestamp(start),
+		WindowEnd:    toTimestamp(end),
+		TotalReviews: s.Total,
+		Completed:    s.Completed,
+		Skipped:      s.Skipped,
+		Failed:       s.Failed,
+		Cancelled:    s.Cancelled,
+		InProgress:   s.InProgress,
+		CommentCount: s.Comments,
+	}
+	if s.Completed > 0 {
+		stats.AvgComments = float64(s.Comments) / float64(s.Completed)
+	}
+	if s.Total > 0 {
+		stats.SkipRate = float64(s.Skipped) / float64(s.Total)
+		stats.FailureRate = float64(s.Failed) / float64(s.Total)
+	}
+	return stats
+}
+
+// reviewStatusToString is the inverse of stringToReviewStatus; it reports false for
+// REVIEW_STATUS_UNSPECIFIED and unknown values.
+func reviewStatusToString(s apiv1.ReviewStatus) (string, bool) {
+	switch s {
+	case apiv1.ReviewStatus_REVIEW_STATUS_PENDING:
+		return "pending", true
+	case apiv1.ReviewStatus_REVIEW_STATUS_RUNNING:
+		return "running", true
+	case apiv1.ReviewStatus_REVIEW_STATUS_COMPLETED:
+		return "completed", true
+	case apiv1.ReviewStatus_REVIEW_STATUS_FAILED:
+		return "failed", true
+	case apiv1.ReviewStatus_REVIEW_STATUS_CANCELLED:
+		return "cancelled", true
+	default:
+		return "", false
+	}
+}
+
 func toTimestamp(t time.Time) *timestamppb.Timestamp {
 	return timestamppb.New(t)
 }
 
 func providerRowToProto(p db.ProviderRow) *apiv1.Provider {
 	return &apiv1.Provider{
-		Id:        p.ID,
-		Type:      stringToProviderType(p.Type),
-		Name:      p.Name,
-		BaseUrl:   p.BaseURL,
-		CreatedAt: toTimestamp(p.CreatedAt),
+		Id:            p.ID,
+		Type:          stringToProviderType(p.Type),
+		Name:          p.Name,
+		BaseUrl:       p.BaseURL,
+		CreatedAt:     toTimestamp(p.CreatedAt),
+		TriggerEvents: p.TriggerEvents,
+		RepoScope:     p.RepoScope,
+		Slug:          p.Slug,
+		TlsCaFile:     p.TLSCAFile,
+		TlsCertFile:   p.TLSCertFile,
+		TlsKeyFile:    p.TLSKeyFile,
+		ProxyUrl:      p.ProxyURL,
+		TokenType:     p.TokenType,
 	}
 }
 
 func repoRowToProto(r db.RepoRow) *apiv1.Repository {
 	return &apiv1.Repository{
-		Id:            r.ID,
-		ProviderId:    r.ProviderID,
-		RemoteId:      r.RemoteID,
-		Name:          r.Name,
-		FullPath:      r.FullPath,
-		ReviewEnabled: r.ReviewEnabled,
-		CreatedAt:     toTimestamp(r.CreatedAt),
+		Id:              r.ID,
+		ProviderId:      r.ProviderID,
+		RemoteId:        r.RemoteID,
+		Name:            r.Name,
+		FullPath:        r.FullPath,
+		ReviewEnabled:   r.ReviewEnabled,
+		CreatedAt:       toTimestamp(r.CreatedAt),
+		SummaryTemplate: r.SummaryTemplate,
+
+		ReviewModel:       r.ReviewModel,
+		ReviewTemperature: r.ReviewTemperature,
+
+		AutoApproveOnClean: r.AutoApproveOnClean,
+		ReviewDrafts:       r.ReviewDrafts,
+		CommentPrefix:      r.CommentPrefix,
+		ReviewerVariant:    r.ReviewerVariant,
+
+		IncludeRelatedIssues: r.IncludeRelatedIssues,
+		PostEmptySummary:     r.PostEmptySummary,
+		TargetBranchPatterns: r.TargetBranchPatterns,
+
+		RequirePipelineSuccess: r.RequirePipelineSuccess,
+		PostMode:               r.PostMode,
+		Archived:               r.Archived,
+
+		LatestReviewStatus: stringToReviewStatus(r.LatestReviewStatus),
+		LatestReviewRunId:  r.LatestReviewRunID,
 	}
 }
 
+func reviewCommentToProto(c db.ReviewCommentRow) *apiv1.ReviewComment {
+	pc := &apiv1.ReviewComment{
+		Id:          c.ID,
+		ReviewRunId: c.ReviewRunID,
+		FilePath:    c.FilePath,
+		LineStart:   int32(c.LineStart),
+		LineEnd:     int32(c.LineEnd),
+		Body:        c.Body,
+		Severity:    c.Severity,
+		Posted:      c.Posted,
+	}
+	if c.ProviderCommentID != nil {
+		pc.ProviderCommentId = *c.ProviderCommentID
+	}
+	return pc
+}
+
 func reviewRunToProto(run db.ReviewRunRow, comments []db.ReviewCommentRow) *apiv1.ReviewRun {
 	protoComments := make([]*apiv1.ReviewComment, len(comments))
 	for i, c := range comments {
-		protoComments[i] = &apiv1.ReviewComment{
-			Id:          c.ID,
-			ReviewRunId: c.ReviewRunID,
-			FilePath:    c.FilePath,
-			LineStart:   int32(c.LineStart),
-			LineEnd:     int32(c.LineEnd),
-			Body:        c.Body,
-		}
+		protoComments[i] = reviewCommentToProto(c)
 	}
 	return &apiv1.ReviewRun{
-		Id:        run.ID,
-		RepoId:    run.RepoID,
-		MrNumber:  run.MRNumber,
-		Status:    stringToReviewStatus(run.Status),
-		Comments:  protoComments,
-		CreatedAt: toTimestamp(run.CreatedAt),
-		UpdatedAt: toTimestamp(run.UpdatedAt),
+		Id:           run.ID,
+		RepoId:       run.RepoID,
+		MrNumber:     run.MRNumber,
+		Status:       stringToReviewStatus(run.Status),
+		Comments:     protoComments,
+		CreatedAt:    toTimestamp(run.CreatedAt),
+		UpdatedAt:    toTimestamp(run.UpdatedAt),
+		MrTitle:      run.MRTitle,
+		MrAuthor:     run.MRAuthor,
+		SourceBranch: run.SourceBranch,
+		TargetBranch: run.TargetBranch,
+		HeadSha:      run.HeadSHA,
+	}
+}
+
+func reviewRunEventToProto(e db.ReviewRunEventRow) *apiv1.ReviewRunEvent {
+	return &apiv1.ReviewRunEvent{
+		Status:    stringToReviewStatus(e.Status),
+		Detail:    e.Detail,
+		CreatedAt: toTimestamp(e.CreatedAt),
+	}
+}
+
+// activeReviewToProto maps an active run; its age is measured against now.
+func activeReviewToProto(r db.ActiveReviewRunRow, now time.Time) *apiv1.ActiveReview {
+	out := &apiv1.ActiveReview{
+		ReviewRunId: r.ID,
+		RepoId:      r.RepoID,
+		MrNumber:    r.MRNumber,
+		Status:      stringToReviewStatus(r.Status),
+		CreatedAt:   toTimestamp(r.CreatedAt),
+		AgeSeconds:  int64(now.Sub(r.CreatedAt) / time.Second),
+	}
+	if r.RestateInvocationID != nil {
+		out.InvocationId = *r.RestateInvocationID
+	}
+	return out
+}
+
+func previewToProto(p *restate.PreviewResponse) *apiv1.PreviewReviewResponse {
+	comments := make([]*apiv1.ReviewComment, len(p.Comments))
+	for i, c := range p.Comments {
+		comments[i] = &apiv1.ReviewComment{
+			FilePath:  c.FilePath,
+			LineStart: int32(c.LineStart),
+			LineEnd:   int32(c.LineEnd),
+			Body:      c.Body,
+			Severity:  c.Severity,
+		}
+	}
+	return &apiv1.PreviewReviewResponse{
+		Summary:      p.Summary,
+		Comments:     comments,
+		DiffTooLarge: p.DiffTooLarge,
+	}
+}
+
+func commentsToSARIF(comments []db.ReviewCommentRow) []sarif.Finding {
+	findings := make([]sarif.Finding, len(comments))
+	for i, c := range comments {
+		findings[i] = sarif.Finding{
+			FilePath:  c.FilePath,
+			LineStart: c.LineStart,
+			LineEnd:   c.LineEnd,
+			Body:      c.Body,
+			Severity:  c.Severity,
+		}
 	}
+	return findings
 }
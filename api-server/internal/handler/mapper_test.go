@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+
+	apiv1 "ai-reviewer/gen/api/v1"
+	"ai-reviewer/api-server/internal/db"
+	"ai-reviewer/api-server/internal/restate"
+)
+
+func TestReviewCommentToProto_ProviderCommentID(t *testing.T) {
+	noteID := "note-42"
+	posted := reviewCommentToProto(db.ReviewCommentRow{ID: "c1", Posted: true, ProviderCommentID: &noteID})
+	if !posted.Posted || posted.ProviderCommentId != "note-42" {
+		t.Errorf("posted comment: got posted=%v id=%q", posted.Posted, posted.ProviderCommentId)
+	}
+
+	// Unposted and skipped comments both come back from the DB with a NULL provider ID.
+	unposted := reviewCommentToProto(db.ReviewCommentRow{ID: "c2"})
+	if unposted.Posted || unposted.ProviderCommentId != "" {
+		t.Errorf("unposted comment: got posted=%v id=%q", unposted.Posted, unposted.ProviderCommentId)
+	}
+	skipped := reviewCommentToProto(db.ReviewCommentRow{ID: "c3", Posted: true})
+	if skipped.ProviderCommentId != "" {
+		t.Errorf("skipped comment: expected empty provider id, got %q", skipped.ProviderCommentId)
+	}
+}
+
+func TestRepoRowToProto_LatestReview(t *testing.T) {
+	active := repoRowToProto(db.RepoRow{ID: "r1", LatestReviewRunID: "run1", LatestReviewStatus: "running"})
+	if active.LatestReviewRunId != "run1" || active.LatestReviewStatus != apiv1.ReviewStatus_REVIEW_STATUS_RUNNING {
+		t.Errorf("active repo: got run=%q status=%v", active.LatestReviewRunId, active.LatestReviewStatus)
+	}
+
+	never := repoRowToProto(db.RepoRow{ID: "r2"})
+	if never.LatestReviewRunId != "" || never.LatestReviewStatus != apiv1.ReviewStatus_REVIEW_STATUS_UNSPECIFIED {
+		t.Errorf("unreviewed repo: got run=%q status=%v", never.LatestReviewRunId, never.LatestReviewStatus)
+	}
+}
+
+func TestReviewRunToProto_MRMetadata(t *testing.T) {
+	got := reviewRunToProto(db.ReviewRunRow{
+		ID:           "run-1",
+		Status:       "completed",
+		MRTitle:      "Add feature",
+		MRAuthor:     "alice",
+		SourceBranch: "feature",
+		TargetBranch: "main",
+		HeadSHA:      "abc123",
+	}, nil)
+	if got.MrTitle != "Add feature" || got.MrAuthor != "alice" {
+		t.Errorf("title/author: got %q/%q", got.MrTitle, got.MrAuthor)
+	}
+	if got.SourceBranch != "feature" || got.TargetBranch != "main" || got.HeadSha != "abc123" {
+		t.Errorf("branches/sha: got %q -> %q @ %q", got.SourceBranch, got.TargetBranch, got.HeadSha)
+	}
+}
+
+func TestReviewRunEventToProto(t *testing.T) {
+	got := reviewRunEventToProto(db.ReviewRunEventRow{Status: "failed", Detail: "running reviewer: timeout"})
+	if got.Status != apiv1.ReviewStatus_REVIEW_STATUS_FAILED || got.Detail != "running reviewer: timeout" {
+		t.Errorf("got status=%v detail=%q", got.Status, got.Detail)
+	}
+}
+
+func TestRepoRowToProto_ReviewOverrides(t *testing.T) {
+	temp := 0.2
+	got := repoRowToProto(db.RepoRow{ID: "r1", ReviewModel: "openai/gpt-4o", ReviewTemperature: &temp})
+	if got.ReviewModel != "openai/gpt-4o" || got.ReviewTemperature == nil || *got.ReviewTemperature != 0.2 {
+		t.Errorf("got model=%q temperature=%v", got.ReviewModel, got.ReviewTemperature)
+	}
+
+	unset := repoRowToProto(db.RepoRow{ID: "r2"})
+	if unset.ReviewModel != "" || unset.ReviewTemperature != nil {
+		t.Errorf("unset overrides: got model=%q temperature=%v", unset.ReviewModel, unset.ReviewTemperature)
+	}
+}
+
+func TestPreviewToProto(t *testing.T) {
+	got := previewToProto(&restate.PreviewResponse{
+		Summary:  "Looks fine.",
+		Comments: []restate.PreviewComment{{FilePath: "a.go", LineStart: 3, LineEnd: 5, Body: "nil deref", Severity: "blocker"}},
+	})
+	if got.Summary != "Looks fine." || len(got.Comments) != 1 {
+		t.Fatalf("unexpected response: %+v", got)
+	}
+	c := got.Comments[0]
+	if c.FilePath != "a.go" || c.LineStart != 3 || c.LineEnd != 5 || c.Severity != "blocker" || c.Posted || c.Id != "" {
+		t.Errorf("unexpected comment: %+v", c)
+	}
+}
+
+func TestPreviewError(t *testing.T) {
+	err := previewError(fmt.Errorf("calling preview: %w", context.DeadlineExceeded), time.Minute)
+	if err.Code() != connect.CodeDeadlineExceeded {
+		t.Errorf("timeout: got %v, want %v", err.Code(), connect.CodeDeadlineExceeded)
+	}
+	err = previewError(fmt.Errorf("preview returned 500"), time.Minute)
+	if err.Code() != connect.CodeInternal {
+		t.Errorf("failure: got %v, want %v", err.Code(), connect.CodeInternal)
+	}
+}
+
+func TestActiveReviewToProto(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	row := db.ActiveReviewRunRow{ID: "run1", RepoID: "r1", MRNumber: 9, Status: "running", CreatedAt: created}
+
+	got := activeReviewToProto(row, created.Add(90*time.Second))
+	if got.AgeSeconds != 90 || got.Status != apiv1.ReviewStatus_REVIEW_STATUS_RUNNING || got.InvocationId != "" {
+		t.Errorf("unexpected review: %+v", got)
+	}
+
+	row.RestateInvocationID = strPtr("inv1")
+	if got := activeReviewToProto(row, created); got.InvocationId != "inv1" {
+		t.Errorf("InvocationId = %q, want inv1", got.InvocationId)
+	}
+}
+
+func TestRepoReviewStatsToProto(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(30 * 24 * time.Hour)
+	got := repoReviewStatsToProto("r1", start, end, db.RepoReviewStatsRow{
+		Total: 20, Completed: 10, Skipped: 5, Failed: 2, Cancelled: 1, InProgress: 2, Comments: 35,
+	})
+	if got.RepoId != "r1" || !got.WindowStart.AsTime().Equal(start) || !got.WindowEnd.AsTime().Equal(end) {
+		t.Errorf("identity = %s [%v, %v)", got.RepoId, got.WindowStart.AsTime(), got.WindowEnd.AsTime())
+	}
+	if got.TotalReviews != 20 || got.Completed != 10 || got.InProgress != 2 || got.CommentCount != 35 {
+		t.Errorf("counters = %+v", got)
+	}
+	// Comments average over completed reviews; rates are fractions of all reviews.
+	if got.AvgComments != 3.5 || got.SkipRate != 0.25 || got.FailureRate != 0.1 {
+		t.Errorf("avg/skip/failure = %v/%v/%v, want 3.5/0.25/0.1", got.AvgComments, got.SkipRate, got.FailureRate)
+	}
+}
+
+func TestRepoReviewStatsToProto_NoReviews(t *testing.T) {
+	got := repoReviewStatsToProto("r1", time.Time{}, time.Time{}, db.RepoReviewStatsRow{})
+	if got.AvgComments != 0 || got.SkipRate != 0 || got.FailureRate != 0 {
+		t.Errorf("avg/skip/failure = %v/%v/%v, want zeros", got.AvgComments, got.SkipRate, got.FailureRate)
+	}
+	// Skipped runs alone have no completed reviews to average over.
+	got = repoReviewStatsToProto("r1", time.Time{}, time.Time{}, db.RepoReviewStatsRow{Total: 2, Skipped: 2})
+	if got.AvgComments != 0 || got.SkipRate != 1 {
+		t.Errorf("avg/skip = %v/%v, want 0/1", got.AvgComments, got.SkipRate)
+	}
+}
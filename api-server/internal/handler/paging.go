@@ -0,0 +1,34 @@
+package handler
+
+import "fmt"
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pageBounds validates a requested limit/offset and applies the default and maximum page size.
+func pageBounds(limit, offset int32) (int, int, error) {
+	if limit < 0 {
+		return 0, 0, fmt.Errorf("limit must not be negative")
+	}
+	if offset < 0 {
+		return 0, 0, fmt.Errorf("offset must not be negative")
+	}
+	switch {
+	case limit == 0:
+		limit = defaultPageSize
+	case limit > maxPageSize:
+		limit = maxPageSize
+	}
+	return int(limit), int(offset), nil
+}
+
+// nextOffset returns the offset of the page after one of n rows starting at offset,
+// or 0 if that page reached the end of total rows.
+func nextOffset(offset, n, total int) int {
+	if next := offset + n; n > 0 && next < total {
+		return next
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package handler
+
+import "testing"
+
+func TestPageBounds(t *testing.T) {
+	tests := []struct {
+		name               string
+		limit, offset      int32
+		wantLimit, wantOff int
+		wantErr            bool
+	}{
+		{name: "defaults", wantLimit: defaultPageSize},
+		{name: "explicit", limit: 10, offset: 20, wantLimit: 10, wantOff: 20},
+		{name: "at max", limit: maxPageSize, wantLimit: maxPageSize},
+		{name: "over max is capped", limit: maxPageSize + 1, wantLimit: maxPageSize},
+		{name: "negative limit", limit: -1, wantErr: true},
+		{name: "negative offset", offset: -5, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			limit, offset, err := pageBounds(tc.limit, tc.offset)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if limit != tc.wantLimit || offset != tc.wantOff {
+				t.Errorf("got (%d, %d), want (%d, %d)", limit, offset, tc.wantLimit, tc.wantOff)
+			}
+		})
+	}
+}
+
+func TestNextOffset(t *testing.T) {
+	tests := []struct {
+		name                   string
+		offset, n, total, want int
+	}{
+		{name: "first of several pages", offset: 0, n: 10, total: 25, want: 10},
+		{name: "middle page", offset: 10, n: 10, total: 25, want: 20},
+		{name: "last partial page", offset: 20, n: 5, total: 25, want: 0},
+		{name: "page ends exactly at total", offset: 15, n: 10, total: 25, want: 0},
+		{name: "offset past end", offset: 30, n: 0, total: 25, want: 0},
+		{name: "empty run", offset: 0, n: 0, total: 0, want: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nextOffset(tc.offset, tc.n, tc.total); got != tc.want {
+				t.Errorf("nextOffset(%d, %d, %d) = %d, want %d", tc.offset, tc.n, tc.total, got, tc.want)
+			}
+		})
+	}
+}
@@ -6,20 +6,30 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"regexp"
 
 	"connectrpc.com/connect"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	apiv1 "ai-reviewer/gen/api/v1"
 	"ai-reviewer/gen/api/v1/apiv1connect"
 	"ai-reviewer/api-server/internal/crypto"
 	"ai-reviewer/api-server/internal/db"
+	"ai-reviewer/api-server/internal/httpclient"
+	"ai-reviewer/api-server/internal/provider"
+	"ai-reviewer/api-server/internal/provider/bitbucket"
+	"ai-reviewer/api-server/internal/provider/gitea"
+	"ai-reviewer/api-server/internal/provider/github"
 	"ai-reviewer/api-server/internal/provider/gitlab"
 )
 
 // insertProviderTx wraps InsertProvider + UpsertRepos in a single transaction.
-func insertProviderTx(ctx context.Context, pool *pgxpool.Pool, orgID, provTypeStr, name, baseURL string, tokenEncrypted []byte, webhookSecret string, upsertInputs []db.RepoUpsertInput) (*db.ProviderRow, error) {
+func insertProviderTx(ctx context.Context, pool *pgxpool.Pool, orgID, provTypeStr, name, baseURL, repoScope, slug string, tlsOpts httpclient.TLSOptions, proxyURL, tokenType string, tokenEncrypted []byte, webhookSecret string, upsertInputs []db.RepoUpsertInput) (*db.ProviderRow, error) {
 	tx, err := pool.Begin(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("begin tx: %w", err)
@@ -27,13 +37,13 @@ func insertProviderTx(ctx context.Context, pool *pgxpool.Pool, orgID, provTypeSt
 	defer tx.Rollback(ctx) //nolint:errcheck
 
 	const q = `
-		INSERT INTO providers (org_id, type, name, base_url, token_encrypted, webhook_secret)
-		VALUES ($1, $2::provider_type, $3, $4, $5, $6)
-		RETURNING id, org_id, type, name, base_url, token_encrypted, webhook_secret, created_at`
+		INSERT INTO providers (org_id, type, name, base_url, token_encrypted, webhook_secret, repo_scope, slug, tls_ca_file, tls_cert_file, tls_key_file, proxy_url, token_type)
+		VALUES ($1, $2::provider_type, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, org_id, type, name, base_url, token_encrypted, webhook_secret, trigger_events, repo_scope, slug, tls_ca_file, tls_cert_file, tls_key_file, proxy_url, token_type, created_at`
 
 	row := &db.ProviderRow{}
-	if err := tx.QueryRow(ctx, q, orgID, provTypeStr, name, baseURL, tokenEncrypted, webhookSecret).Scan(
-		&row.ID, &row.OrgID, &row.Type, &row.Name, &row.BaseURL, &row.TokenEncrypted, &row.WebhookSecret, &row.CreatedAt,
+	if err := tx.QueryRow(ctx, q, orgID, provTypeStr, name, baseURL, tokenEncrypted, webhookSecret, repoScope, slug, tlsOpts.CAFile, tlsOpts.CertFile, tlsOpts.KeyFile, proxyURL, tokenType).Scan(
+		&row.ID, &row.OrgID, &row.Type, &row.Name, &row.BaseURL, &row.TokenEncrypted, &row.WebhookSecret, &row.TriggerEvents, &row.RepoScope, &row.Slug, &row.TLSCAFile, &row.TLSCertFile, &row.TLSKeyFile, &row.ProxyURL, &row.TokenType, &row.CreatedAt,
 	); err != nil {
 		return nil, fmt.Errorf("insert provider: %w", err)
 	}
@@ -42,7 +52,7 @@ func insertProviderTx(ctx context.Context, pool *pgxpool.Pool, orgID, provTypeSt
 		INSERT INTO repositories (provider_id, remote_id, name, full_path)
 		VALUES ($1, $2, $3, $4)
 		ON CONFLICT (provider_id, remote_id) DO UPDATE
-		SET name = EXCLUDED.name, full_path = EXCLUDED.full_path`
+		SET name = EXCLUDED.name, full_path = EXCLUDED.full_path, deleted_at = NULL`
 
 	for _, r := range upsertInputs {
 		if _, err := tx.Exec(ctx, uq, row.ID, r.RemoteID, r.Name, r.FullPath); err != nil {
@@ -56,11 +66,209 @@ func insertProviderTx(ctx context.Context, pool *pgxpool.Pool, orgID, provTypeSt
 	return row, nil
 }
 
+// repoLister lists the repositories a provider token can access.
+type repoLister interface {
+	ListRepos(ctx context.Context) ([]provider.Repo, error)
+}
+
+// newRepoLister returns the API client used to sync a new provider's repositories.
+// repoScope, tlsOpts and proxyURL only apply to GitLab and must already be validated.
+func newRepoLister(provType, baseURL, token, repoScope string, tlsOpts httpclient.TLSOptions, proxyURL string) (repoLister, error) {
+	switch provType {
+	case "gitea":
+		if baseURL == "" {
+			return nil, fmt.Errorf("base_url is required for gitea providers")
+		}
+		return gitea.New(baseURL, token), nil
+	case "bitbucket_cloud":
+		if baseURL == "" {
+			baseURL = bitbucket.DefaultBaseURL
+		}
+		return bitbucket.New(baseURL, token), nil
+	case "github":
+		if baseURL == "" {
+			baseURL = github.DefaultBaseURL
+		}
+		return github.New(baseURL, token), nil
+	default:
+		if baseURL == "" {
+			baseURL = "https://gitlab.com"
+		}
+		hc, err := httpclient.New(tlsOpts)
+		if err != nil {
+			return nil, err
+		}
+		return gitlab.New(baseURL, token, gitlab.WithHTTPClient(hc), gitlab.WithProxy(proxyURL), gitlab.WithRepoScope(repoScope), gitlab.WithRateLimiter(gitlab.SharedRateLimiter(baseURL))), nil
+	}
+}
+
+// validateProxyURL checks a CreateProvider proxy_url: only GitLab providers accept one,
+// and it must be a URL gitlab.WithProxy accepts.
+func validateProxyURL(provType, proxyURL string) error {
+	if proxyURL == "" {
+		return nil
+	}
+	if provType != "gitlab_self_hosted" && provType != "gitlab_cloud" {
+		return fmt.Errorf("proxy_url is only supported for GitLab providers")
+	}
+	return gitlab.ValidateProxyURL(proxyURL)
+}
+
+// errTLSFileLoad is returned for a TLS file that doesn't load. The cause is only logged:
+// echoing it would tell API callers what exists on the server's filesystem.
+var errTLSFileLoad = errors.New("the file could not be loaded as PEM")
+
+// validateTLSOptions checks CreateProvider TLS file paths: only GitLab providers accept
+// them, they must lie under dir (the server's PROVIDER_TLS_DIR; empty accepts none), and
+// the files must load. It returns the offending request field with the error.
+func validateTLSOptions(provType string, opts httpclient.TLSOptions, dir string) (string, error) {
+	if opts.IsZero() {
+		return "", nil
+	}
+	fields := []struct{ name, path string }{
+		{"tls_ca_file", opts.CAFile},
+		{"tls_cert_file", opts.CertFile},
+		{"tls_key_file", opts.KeyFile},
+	}
+	for _, f := range fields {
+		if f.path == "" {
+			continue
+		}
+		if provType != "gitlab_self_hosted" && provType != "gitlab_cloud" {
+			return f.name, fmt.Errorf("TLS options are only supported for GitLab providers")
+		}
+		if dir == "" {
+			return f.name, fmt.Errorf("TLS files are not enabled on this server")
+		}
+		if !inDir(dir, f.path) {
+			return f.name, fmt.Errorf("must be an absolute path under the server's provider TLS directory")
+		}
+	}
+	if _, err := httpclient.New(httpclient.TLSOptions{CAFile: opts.CAFile}); err != nil {
+		log.Printf("CreateProvider: loading %s: %v", opts.CAFile, err)
+		return "tls_ca_file", errTLSFileLoad
+	}
+	if _, err := httpclient.New(opts); err != nil {
+		log.Printf("CreateProvider: loading client certificate %s: %v", opts.CertFile, err)
+		return "tls_cert_file", errTLSFileLoad
+	}
+	return "", nil
+}
+
+// inDir reports whether path is an absolute path inside dir once both are cleaned.
+func inDir(dir, path string) bool {
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != "." && filepath.IsLocal(rel)
+}
+
+// validateRepoScope checks a CreateProvider repo_scope: GitLab providers accept the scopes
+// gitlab.WithRepoScope does, other types only the empty default.
+func validateRepoScope(provType, scope string) error {
+	switch provType {
+	case "gitlab_self_hosted", "gitlab_cloud":
+		return gitlab.ValidateRepoScope(scope)
+	default:
+		if scope != "" {
+			return fmt.Errorf("repo_scope is only supported for GitLab providers")
+		}
+		return nil
+	}
+}
+
+// validateTokenType checks a CreateProvider token_type hint. "project" (a GitLab project
+// access token) only sees the project it belongs to, so it can't be combined with a
+// repo_scope that lists other projects.
+func validateTokenType(provType, tokenType, repoScope string) error {
+	switch tokenType {
+	case "", "personal":
+		return nil
+	case "project":
+		if provType != "gitlab_self_hosted" && provType != "gitlab_cloud" {
+			return fmt.Errorf("project tokens are only supported for GitLab providers")
+		}
+		if repoScope != "" && repoScope != gitlab.ScopeMembership {
+			return fmt.Errorf("a project access token only sees its own project; leave repo_scope empty")
+		}
+		return nil
+	default:
+		return fmt.Errorf("token_type must be \"personal\" or \"project\", got %q", tokenType)
+	}
+}
+
+// checkListedRepos checks the repositories a new provider's token listed. A project access
+// token lists exactly its own project; none means the token lacks the read_api scope or
+// its project was deleted, which would leave the provider with nothing to review.
+func checkListedRepos(tokenType string, repos []provider.Repo) error {
+	if tokenType == "project" && len(repos) == 0 {
+		return fmt.Errorf("the project access token can't see its project; it needs the read_api scope")
+	}
+	return nil
+}
+
+// slugRe matches a provider slug: lowercase letters, digits and inner hyphens.
+var slugRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// validateSlug checks a CreateProvider slug. Empty is allowed (the provider is then only
+// addressable by id); a UUID-shaped slug is rejected so webhook paths stay unambiguous.
+func validateSlug(slug string) error {
+	if slug == "" {
+		return nil
+	}
+	if !slugRe.MatchString(slug) || isUUID(slug) {
+		return fmt.Errorf("slug must be 1-63 lowercase letters, digits or inner hyphens and not a UUID, got %q", slug)
+	}
+	return nil
+}
+
+// isSlugTaken reports whether err is the unique violation on an active provider's slug.
+func isSlugTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_providers_slug"
+}
+
+// versionChecker is implemented by clients with a cheap pre-flight call (GitLab's
+// /api/v4/version) that validates the base URL and token before the repo sync.
+type versionChecker interface {
+	CheckVersion(ctx context.Context) error
+}
+
+// validateBaseURL checks that a provider base URL, if given, is an absolute http(s) URL.
+func validateBaseURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("base_url must be an http(s) URL, got %q", raw)
+	}
+	return nil
+}
+
+// providerAPIError maps an error from the provider API during CreateProvider to a Connect
+// error: a rejected token or an unreachable/non-API base URL is the caller's input problem.
+func providerAPIError(op string, err error) *connect.Error {
+	var urlErr *url.Error
+	switch {
+	case errors.Is(err, provider.ErrUnauthorized), errors.Is(err, provider.ErrForbidden):
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("bad token: %w", err))
+	case errors.Is(err, provider.ErrNotFound):
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("base URL unreachable: provider API not found at base_url"))
+	case errors.As(err, &urlErr) && !errors.Is(err, context.Canceled):
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("base URL unreachable: %w", err))
+	default:
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("%s: %w", op, err))
+	}
+}
+
 // ProviderHandler implements apiv1connect.ProviderServiceHandler.
 type ProviderHandler struct {
 	apiv1connect.UnimplementedProviderServiceHandler
 	pool   *pgxpool.Pool
 	encKey []byte
+	tlsDir string // TLS file paths must lie under it; empty rejects them
 }
 
 // NewProviderHandler creates a ProviderHandler.
@@ -68,18 +276,61 @@ func NewProviderHandler(pool *pgxpool.Pool, encKey []byte) *ProviderHandler {
 	return &ProviderHandler{pool: pool, encKey: encKey}
 }
 
+// SetTLSDir sets the directory CreateProvider TLS file paths must lie under. Until it is
+// set, providers can't be created with TLS files.
+func (h *ProviderHandler) SetTLSDir(dir string) {
+	h.tlsDir = dir
+}
+
 // CreateProvider registers a new provider, syncs its repos, and returns the provider.
 func (h *ProviderHandler) CreateProvider(ctx context.Context, req *connect.Request[apiv1.CreateProviderRequest]) (*connect.Response[apiv1.CreateProviderResponse], error) {
 	msg := req.Msg
 	if msg.Name == "" {
-		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("name is required"))
+		return nil, invalidArg("name", "name is required")
 	}
 	if msg.Token == "" {
-		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("token is required"))
+		return nil, invalidArg("token", "token is required")
 	}
 	provTypeStr := providerTypeToString(msg.Type)
 	if provTypeStr == "" {
-		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unsupported provider type"))
+		return nil, invalidArg("type", "unsupported provider type")
+	}
+	if err := validateBaseURL(msg.BaseUrl); err != nil {
+		return nil, invalidArg("base_url", err.Error())
+	}
+	if err := validateRepoScope(provTypeStr, msg.RepoScope); err != nil {
+		return nil, invalidArg("repo_scope", err.Error())
+	}
+	if err := validateSlug(msg.Slug); err != nil {
+		return nil, invalidArg("slug", err.Error())
+	}
+	tlsOpts := httpclient.TLSOptions{CAFile: msg.TlsCaFile, CertFile: msg.TlsCertFile, KeyFile: msg.TlsKeyFile}
+	if field, err := validateTLSOptions(provTypeStr, tlsOpts, h.tlsDir); err != nil {
+		return nil, invalidArg(field, err.Error())
+	}
+	if err := validateProxyURL(provTypeStr, msg.ProxyUrl); err != nil {
+		return nil, invalidArg("proxy_url", err.Error())
+	}
+	if err := validateTokenType(provTypeStr, msg.TokenType, msg.RepoScope); err != nil {
+		return nil, invalidArg("token_type", err.Error())
+	}
+
+	// Fetch repos before writing to DB — so we can roll back atomically if it fails.
+	client, err := newRepoLister(provTypeStr, msg.BaseUrl, msg.Token, msg.RepoScope, tlsOpts, msg.ProxyUrl)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	if vc, ok := client.(versionChecker); ok {
+		if err := vc.CheckVersion(ctx); err != nil {
+			return nil, providerAPIError("checking provider", err)
+		}
+	}
+	repos, err := client.ListRepos(ctx)
+	if err != nil {
+		return nil, providerAPIError("listing repos", err)
+	}
+	if err := checkListedRepos(msg.TokenType, repos); err != nil {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, err)
 	}
 
 	orgID, err := db.GetDefaultOrgID(ctx, h.pool)
@@ -92,17 +343,6 @@ func (h *ProviderHandler) CreateProvider(ctx context.Context, req *connect.Reque
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("encrypting token: %w", err))
 	}
 
-	// Fetch repos before writing to DB — so we can roll back atomically if it fails.
-	baseURL := msg.BaseUrl
-	if baseURL == "" {
-		baseURL = "https://gitlab.com"
-	}
-	client := gitlab.New(baseURL, msg.Token)
-	repos, err := client.ListRepos(ctx)
-	if err != nil {
-		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("listing repos: %w", err))
-	}
-
 	// Use a placeholder provider ID so we can build upsert inputs before the real INSERT.
 	// The actual ID is assigned inside the transaction.
 	upsertInputs := make([]db.RepoUpsertInput, len(repos))
@@ -121,8 +361,11 @@ func (h *ProviderHandler) CreateProvider(ctx context.Context, req *connect.Reque
 	}
 	webhookSecret := hex.EncodeToString(secretBytes)
 
-	row, err := insertProviderTx(ctx, h.pool, orgID, provTypeStr, msg.Name, msg.BaseUrl, tokenEncrypted, webhookSecret, upsertInputs)
+	row, err := insertProviderTx(ctx, h.pool, orgID, provTypeStr, msg.Name, msg.BaseUrl, msg.RepoScope, msg.Slug, tlsOpts, msg.ProxyUrl, msg.TokenType, tokenEncrypted, webhookSecret, upsertInputs)
 	if err != nil {
+		if isSlugTaken(err) {
+			return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("slug %q is already in use", msg.Slug))
+		}
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("creating provider: %w", err))
 	}
 
@@ -132,9 +375,18 @@ func (h *ProviderHandler) CreateProvider(ctx context.Context, req *connect.Reque
 	}), nil
 }
 
-// ListProviders returns all active providers.
+// ListProviders returns a page of active providers, optionally filtered by type.
 func (h *ProviderHandler) ListProviders(ctx context.Context, req *connect.Request[apiv1.ListProvidersRequest]) (*connect.Response[apiv1.ListProvidersResponse], error) {
-	rows, err := db.ListProviders(ctx, h.pool)
+	provType, err := providerTypeFilter(req.Msg.Type)
+	if err != nil {
+		return nil, invalidArg("type", err.Error())
+	}
+	limit, offset, err := pageBounds(req.Msg.Limit, req.Msg.Offset)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	rows, total, err := db.ListProviders(ctx, h.pool, provType, limit, offset)
 	if err != nil {
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("listing providers: %w", err))
 	}
@@ -143,13 +395,30 @@ func (h *ProviderHandler) ListProviders(ctx context.Context, req *connect.Reques
 	for i, r := range rows {
 		providers[i] = providerRowToProto(r)
 	}
-	return connect.NewResponse(&apiv1.ListProvidersResponse{Providers: providers}), nil
+	return connect.NewResponse(&apiv1.ListProvidersResponse{
+		Providers:  providers,
+		TotalCount: int32(total),
+		NextOffset: int32(nextOffset(offset, len(rows), total)),
+	}), nil
+}
+
+// providerTypeFilter maps a ListProviders type filter to its DB value; unspecified
+// means no filter and yields "".
+func providerTypeFilter(t apiv1.ProviderType) (string, error) {
+	if t == apiv1.ProviderType_PROVIDER_TYPE_UNSPECIFIED {
+		return "", nil
+	}
+	s := providerTypeToString(t)
+	if s == "" {
+		return "", fmt.Errorf("unsupported provider type %d", t)
+	}
+	return s, nil
 }
 
 // DeleteProvider soft-deletes a provider.
 func (h *ProviderHandler) DeleteProvider(ctx context.Context, req *connect.Request[apiv1.DeleteProviderRequest]) (*connect.Response[apiv1.DeleteProviderResponse], error) {
 	if req.Msg.Id == "" {
-		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("id is required"))
+		return nil, invalidArg("id", "id is required")
 	}
 
 	err := db.SoftDeleteProvider(ctx, h.pool, req.Msg.Id)
@@ -162,3 +431,28 @@ func (h *ProviderHandler) DeleteProvider(ctx context.Context, req *connect.Reque
 
 	return connect.NewResponse(&apiv1.DeleteProviderResponse{}), nil
 }
+
+// UpdateProvider replaces the set of MR actions that trigger a review for a provider.
+func (h *ProviderHandler) UpdateProvider(ctx context.Context, req *connect.Request[apiv1.UpdateProviderRequest]) (*connect.Response[apiv1.UpdateProviderResponse], error) {
+	msg := req.Msg
+	if msg.Id == "" {
+		return nil, invalidArg("id", "id is required")
+	}
+	for _, e := range msg.TriggerEvents {
+		if !defaultTriggerEvents[e] {
+			return nil, invalidArg("trigger_events", fmt.Sprintf("unsupported trigger event %q", e))
+		}
+	}
+
+	row, err := db.UpdateProviderTriggerEvents(ctx, h.pool, msg.Id, msg.TriggerEvents)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("provider not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("updating provider: %w", err))
+	}
+
+	return connect.NewResponse(&apiv1.UpdateProviderResponse{
+		Provider: providerRowToProto(*row),
+	}), nil
+}
@@ -4,10 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
 
 	"connectrpc.com/connect"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	apiv1 "ai-reviewer/gen/api/v1"
 	"ai-reviewer/gen/api/v1/apiv1connect"
@@ -17,21 +25,24 @@ import (
 // RepoHandler implements apiv1connect.RepoServiceHandler.
 type RepoHandler struct {
 	apiv1connect.UnimplementedRepoServiceHandler
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	restate RestateDispatcher
 }
 
-// NewRepoHandler creates a RepoHandler.
-func NewRepoHandler(pool *pgxpool.Pool) *RepoHandler {
-	return &RepoHandler{pool: pool}
+// NewRepoHandler creates a RepoHandler. restate cancels in-flight reviews of a repo whose
+// review is disabled; nil skips that.
+func NewRepoHandler(pool *pgxpool.Pool, restate RestateDispatcher) *RepoHandler {
+	return &RepoHandler{pool: pool, restate: restate}
 }
 
-// ListRepos returns all repositories for the given provider.
+// ListRepos returns the repositories of the given provider; archived ones only with
+// include_archived.
 func (h *RepoHandler) ListRepos(ctx context.Context, req *connect.Request[apiv1.ListReposRequest]) (*connect.Response[apiv1.ListReposResponse], error) {
 	if req.Msg.ProviderId == "" {
-		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("provider_id is required"))
+		return nil, invalidArg("provider_id", "provider_id is required")
 	}
 
-	rows, err := db.ListReposByProvider(ctx, h.pool, req.Msg.ProviderId)
+	rows, err := db.ListReposByProvider(ctx, h.pool, req.Msg.ProviderId, req.Msg.IncludeArchived)
 	if err != nil {
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("listing repos: %w", err))
 	}
@@ -46,7 +57,7 @@ func (h *RepoHandler) ListRepos(ctx context.Context, req *connect.Request[apiv1.
 // EnableReview sets review_enabled=true on a repository.
 func (h *RepoHandler) EnableReview(ctx context.Context, req *connect.Request[apiv1.EnableReviewRequest]) (*connect.Response[apiv1.EnableReviewResponse], error) {
 	if req.Msg.RepoId == "" {
-		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("repo_id is required"))
+		return nil, invalidArg("repo_id", "repo_id is required")
 	}
 
 	row, err := db.SetReviewEnabled(ctx, h.pool, req.Msg.RepoId, true)
@@ -62,10 +73,11 @@ func (h *RepoHandler) EnableReview(ctx context.Context, req *connect.Request[api
 	}), nil
 }
 
-// DisableReview sets review_enabled=false on a repository.
+// DisableReview sets review_enabled=false on a repository and cancels its pending and
+// running reviews (best-effort), so an in-flight run doesn't post comments anyway.
 func (h *RepoHandler) DisableReview(ctx context.Context, req *connect.Request[apiv1.DisableReviewRequest]) (*connect.Response[apiv1.DisableReviewResponse], error) {
 	if req.Msg.RepoId == "" {
-		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("repo_id is required"))
+		return nil, invalidArg("repo_id", "repo_id is required")
 	}
 
 	row, err := db.SetReviewEnabled(ctx, h.pool, req.Msg.RepoId, false)
@@ -76,7 +88,243 @@ func (h *RepoHandler) DisableReview(ctx context.Context, req *connect.Request[ap
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("disabling review: %w", err))
 	}
 
+	h.cancelActiveReviews(ctx, "DisableReview", row.ID, "cancelled: review disabled")
+
 	return connect.NewResponse(&apiv1.DisableReviewResponse{
 		Repository: repoRowToProto(*row),
 	}), nil
 }
+
+// SetRepoArchived archives or unarchives a repository. Archived repos are hidden from
+// ListRepos, their webhooks are ignored and archiving cancels their pending and running
+// reviews, best-effort; review history is kept.
+func (h *RepoHandler) SetRepoArchived(ctx context.Context, req *connect.Request[apiv1.SetRepoArchivedRequest]) (*connect.Response[apiv1.SetRepoArchivedResponse], error) {
+	if req.Msg.RepoId == "" {
+		return nil, invalidArg("repo_id", "repo_id is required")
+	}
+
+	row, err := db.SetRepoArchived(ctx, h.pool, req.Msg.RepoId, req.Msg.Archived)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("repository not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("setting archived: %w", err))
+	}
+	if req.Msg.Archived {
+		h.cancelActiveReviews(ctx, "SetRepoArchived", row.ID, "cancelled: repository archived")
+	}
+
+	return connect.NewResponse(&apiv1.SetRepoArchivedResponse{
+		Repository: repoRowToProto(*row),
+	}), nil
+}
+
+// cancelActiveReviews cancels repoID's pending and running reviews, marking them cancelled
+// with reason. It is best-effort: failures are logged under op, not returned.
+func (h *RepoHandler) cancelActiveReviews(ctx context.Context, op, repoID, reason string) {
+	if h.restate == nil {
+		return
+	}
+	active, err := db.ListActiveReviewRuns(ctx, h.pool, repoID)
+	if err != nil {
+		log.Printf("%s: listing active reviews of repo %s: %v", op, repoID, err)
+		return
+	}
+	cancelDisabledRepoReviews(ctx, h.restate, active, func(ctx context.Context, runID string) (bool, error) {
+		return db.CancelReviewRun(ctx, h.pool, runID, reason)
+	})
+}
+
+// cancelDisabledRepoReviews cancels the active reviews of a repo whose review was just
+// disabled or that was archived, and returns the cancelled run ids. Failures are logged,
+// not returned.
+func cancelDisabledRepoReviews(ctx context.Context, d RestateDispatcher, runs []db.ActiveReviewRunRow,
+	markCancelled func(ctx context.Context, runID string) (bool, error),
+) []string {
+	failures := make(map[string]string)
+	cancelled := cancelRuns(ctx, runs, failures, d.CancelInvocation, markCancelled)
+	for runID, reason := range failures {
+		log.Printf("repo reviews: run %s not cancelled: %s", runID, reason)
+	}
+	return cancelled
+}
+
+// defaultStatsWindow is the GetRepoReviewStats window when window_start is unset.
+const defaultStatsWindow = 30 * 24 * time.Hour
+
+// GetRepoReviewStats returns a repository's review counters over a time window.
+func (h *RepoHandler) GetRepoReviewStats(ctx context.Context, req *connect.Request[apiv1.GetRepoReviewStatsRequest]) (*connect.Response[apiv1.GetRepoReviewStatsResponse], error) {
+	msg := req.Msg
+	if msg.RepoId == "" {
+		return nil, invalidArg("repo_id", "repo_id is required")
+	}
+	start, end, err := statsWindow(msg.WindowStart, msg.WindowEnd, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.GetRepo(ctx, h.pool, msg.RepoId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("repository not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting repository: %w", err))
+	}
+
+	row, err := db.GetRepoReviewStats(ctx, h.pool, msg.RepoId, start, end)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting review stats: %w", err))
+	}
+	return connect.NewResponse(&apiv1.GetRepoReviewStatsResponse{
+		Stats: repoReviewStatsToProto(msg.RepoId, start, end, *row),
+	}), nil
+}
+
+// statsWindow resolves a GetRepoReviewStats window: an unset end is now and an unset start
+// is defaultStatsWindow before the end. The window must not be empty.
+func statsWindow(startTS, endTS *timestamppb.Timestamp, now time.Time) (time.Time, time.Time, error) {
+	end := now
+	if endTS != nil {
+		end = endTS.AsTime()
+	}
+	start := end.Add(-defaultStatsWindow)
+	if startTS != nil {
+		start = startTS.AsTime()
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, invalidArg("window_start", "window_start must be before window_end")
+	}
+	return start, end, nil
+}
+
+// SetSummaryTemplate sets the template used to render the summary note posted on MRs.
+func (h *RepoHandler) SetSummaryTemplate(ctx context.Context, req *connect.Request[apiv1.SetSummaryTemplateRequest]) (*connect.Response[apiv1.SetSummaryTemplateResponse], error) {
+	msg := req.Msg
+	if msg.RepoId == "" {
+		return nil, invalidArg("repo_id", "repo_id is required")
+	}
+	if msg.SummaryTemplate != "" && msg.SummaryTemplate != "details" {
+		if _, err := template.New("summary").Parse(msg.SummaryTemplate); err != nil {
+			return nil, invalidArg("summary_template", fmt.Sprintf("invalid summary_template: %v", err))
+		}
+	}
+
+	row, err := db.SetSummaryTemplate(ctx, h.pool, msg.RepoId, msg.SummaryTemplate)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("repository not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("setting summary template: %w", err))
+	}
+
+	return connect.NewResponse(&apiv1.SetSummaryTemplateResponse{
+		Repository: repoRowToProto(*row),
+	}), nil
+}
+
+// maxReviewTemperature is the upper bound OpenRouter accepts for temperature.
+const maxReviewTemperature = 2
+
+// validateRepoConfig checks the Reviewer overrides of a SetRepoConfig request.
+func validateRepoConfig(model string, temperature *float64) error {
+	if strings.TrimSpace(model) != model {
+		return fmt.Errorf("review_model must not have leading or trailing whitespace")
+	}
+	if temperature != nil && (*temperature < 0 || *temperature > maxReviewTemperature) {
+		return fmt.Errorf("review_temperature must be between 0 and %d, got %g", maxReviewTemperature, *temperature)
+	}
+	return nil
+}
+
+// maxCommentPrefixLen bounds comment_prefix, in characters.
+const maxCommentPrefixLen = 64
+
+// validateCommentPrefix checks a SetRepoConfig comment_prefix: a short single line without
+// surrounding whitespace (the worker adds the separating space).
+func validateCommentPrefix(prefix string) error {
+	if strings.TrimSpace(prefix) != prefix {
+		return fmt.Errorf("comment_prefix must not have leading or trailing whitespace")
+	}
+	if strings.ContainsAny(prefix, "\r\n") {
+		return fmt.Errorf("comment_prefix must be a single line")
+	}
+	if n := utf8.RuneCountInString(prefix); n > maxCommentPrefixLen {
+		return fmt.Errorf("comment_prefix must be at most %d characters, got %d", maxCommentPrefixLen, n)
+	}
+	return nil
+}
+
+// maxTargetBranchPatterns bounds target_branch_patterns.
+const maxTargetBranchPatterns = 32
+
+// validateTargetBranchPatterns checks SetRepoConfig target_branch_patterns: non-empty
+// path.Match globs without surrounding whitespace.
+func validateTargetBranchPatterns(patterns []string) error {
+	if len(patterns) > maxTargetBranchPatterns {
+		return fmt.Errorf("target_branch_patterns must have at most %d entries, got %d", maxTargetBranchPatterns, len(patterns))
+	}
+	for _, p := range patterns {
+		if p == "" || strings.TrimSpace(p) != p {
+			return fmt.Errorf("target branch pattern %q must be non-empty without surrounding whitespace", p)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("target branch pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// parsePostMode checks a SetRepoConfig post_mode and returns the value to store; empty
+// means the default, "comments".
+func parsePostMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return "comments", nil
+	case "comments", "check_run":
+		return mode, nil
+	}
+	return "", fmt.Errorf("post_mode must be \"comments\" or \"check_run\", got %q", mode)
+}
+
+// reviewerVariantPattern is what a SetRepoConfig reviewer_variant may look like.
+var reviewerVariantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{0,64}$`)
+
+// SetRepoConfig sets the per-repo Reviewer model and temperature overrides.
+func (h *RepoHandler) SetRepoConfig(ctx context.Context, req *connect.Request[apiv1.SetRepoConfigRequest]) (*connect.Response[apiv1.SetRepoConfigResponse], error) {
+	msg := req.Msg
+	if msg.RepoId == "" {
+		return nil, invalidArg("repo_id", "repo_id is required")
+	}
+	if err := validateRepoConfig(msg.ReviewModel, msg.ReviewTemperature); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	if err := validateCommentPrefix(msg.CommentPrefix); err != nil {
+		return nil, invalidArg("comment_prefix", err.Error())
+	}
+	if !reviewerVariantPattern.MatchString(msg.ReviewerVariant) {
+		return nil, invalidArg("reviewer_variant", "reviewer_variant must be at most 64 letters, digits, '-' or '_'")
+	}
+
+	if err := validateTargetBranchPatterns(msg.TargetBranchPatterns); err != nil {
+		return nil, invalidArg("target_branch_patterns", err.Error())
+	}
+
+	postMode, err := parsePostMode(msg.PostMode)
+	if err != nil {
+		return nil, invalidArg("post_mode", err.Error())
+	}
+
+	// Unlike the other flags, post_empty_summary defaults to on.
+	postEmptySummary := msg.PostEmptySummary == nil || *msg.PostEmptySummary
+
+	row, err := db.SetRepoConfig(ctx, h.pool, msg.RepoId, msg.ReviewModel, msg.ReviewTemperature, msg.AutoApproveOnClean, msg.ReviewDrafts, msg.CommentPrefix, msg.ReviewerVariant, msg.IncludeRelatedIssues, postEmptySummary, msg.TargetBranchPatterns, msg.RequirePipelineSuccess, postMode)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("repository not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("setting repo config: %w", err))
+	}
+
+	return connect.NewResponse(&apiv1.SetRepoConfigResponse{
+		Repository: repoRowToProto(*row),
+	}), nil
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"ai-reviewer/api-server/internal/restate"
+	apiv1 "ai-reviewer/gen/api/v1"
+)
+
+func TestValidateRepoConfig(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name        string
+		model       string
+		temperature *float64
+		wantErr     bool
+	}{
+		{name: "unset", model: "", temperature: nil},
+		{name: "model only", model: "anthropic/claude-opus-4", temperature: nil},
+		{name: "zero temperature", temperature: f(0)},
+		{name: "max temperature", temperature: f(2)},
+		{name: "negative temperature", temperature: f(-0.1), wantErr: true},
+		{name: "temperature too high", temperature: f(2.5), wantErr: true},
+		{name: "padded model", model: " openai/gpt-4o", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateRepoConfig(tc.model, tc.temperature); (err != nil) != tc.wantErr {
+				t.Errorf("validateRepoConfig(%q, %v) = %v, wantErr %v", tc.model, tc.temperature, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnableReview_MissingRepoIDFieldViolation(t *testing.T) {
+	h := &RepoHandler{}
+	_, err := h.EnableReview(context.Background(), connect.NewRequest(&apiv1.EnableReviewRequest{}))
+
+	var cerr *connect.Error
+	if !errors.As(err, &cerr) || cerr.Code() != connect.CodeInvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	details := cerr.Details()
+	if len(details) != 1 {
+		t.Fatalf("expected 1 error detail, got %d", len(details))
+	}
+	v, err := details[0].Value()
+	if err != nil {
+		t.Fatalf("decoding detail: %v", err)
+	}
+	fv, ok := v.(*apiv1.FieldViolation)
+	if !ok {
+		t.Fatalf("detail is %T, want *apiv1.FieldViolation", v)
+	}
+	if fv.Field != "repo_id" || fv.Description != "repo_id is required" {
+		t.Errorf("got field %q description %q", fv.Field, fv.Description)
+	}
+}
+
+func TestSetRepoArchived_MissingRepoID(t *testing.T) {
+	h := &RepoHandler{}
+	_, err := h.SetRepoArchived(context.Background(), connect.NewRequest(&apiv1.SetRepoArchivedRequest{Archived: true}))
+	if connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestValidateCommentPrefix(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		wantErr bool
+	}{
+		{prefix: ""},
+		{prefix: "🤖 nitai:"},
+		{prefix: " padded", wantErr: true},
+		{prefix: "two\nlines", wantErr: true},
+		{prefix: strings.Repeat("x", maxCommentPrefixLen)},
+		{prefix: strings.Repeat("x", maxCommentPrefixLen+1), wantErr: true},
+	}
+	for _, tc := range tests {
+		if err := validateCommentPrefix(tc.prefix); (err != nil) != tc.wantErr {
+			t.Errorf("validateCommentPrefix(%q) = %v, wantErr %v", tc.prefix, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateTargetBranchPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		wantErr  bool
+	}{
+		{patterns: nil},
+		{patterns: []string{"main", "release/*", "hotfix-[0-9]*"}},
+		{patterns: []string{""}, wantErr: true},
+		{patterns: []string{" main"}, wantErr: true},
+		{patterns: []string{"release/["}, wantErr: true},
+		{patterns: make([]string, maxTargetBranchPatterns+1), wantErr: true},
+	}
+	for _, tc := range tests {
+		if err := validateTargetBranchPatterns(tc.patterns); (err != nil) != tc.wantErr {
+			t.Errorf("validateTargetBranchPatterns(%q) = %v, wantErr %v", tc.patterns, err, tc.wantErr)
+		}
+	}
+}
+
+func TestReviewerVariantPattern(t *testing.T) {
+	for variant, want := range map[string]bool{
+		"":                      true,
+		"b":                     true,
+		"claude-opus_v2":        true,
+		"has space":             false,
+		"dot.name":              false,
+		strings.Repeat("x", 65): false,
+	} {
+		if got := reviewerVariantPattern.MatchString(variant); got != want {
+			t.Errorf("reviewerVariantPattern.MatchString(%q) = %v, want %v", variant, got, want)
+		}
+	}
+}
+
+func TestParsePostMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    string
+		wantErr bool
+	}{
+		{mode: "", want: "comments"},
+		{mode: "comments", want: "comments"},
+		{mode: "check_run", want: "check_run"},
+		{mode: "annotations", wantErr: true},
+		{mode: "Check_Run", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := parsePostMode(tc.mode)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("parsePostMode(%q) = %q, %v; want %q, wantErr %v", tc.mode, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+// cancelRecorder is a RestateDispatcher that records cancelled invocation ids.
+type cancelRecorder struct {
+	cancelErr    error
+	cancelledIDs []string
+}
+
+func (c *cancelRecorder) SendPRReview(context.Context, string, restate.PRReviewRequest) (string, error) {
+	return "", errors.New("unexpected SendPRReview")
+}
+
+func (c *cancelRecorder) CancelInvocation(_ context.Context, invocationID string) error {
+	c.cancelledIDs = append(c.cancelledIDs, invocationID)
+	return c.cancelErr
+}
+
+func TestCancelDisabledRepoReviews(t *testing.T) {
+	d := &cancelRecorder{}
+	var marked []string
+	markCancelled := func(_ context.Context, id string) (bool, error) {
+		marked = append(marked, id)
+		return true, nil
+	}
+
+	cancelled := cancelDisabledRepoReviews(context.Background(), d, activeRuns(), markCancelled)
+
+	if want := []string{"inv1", "inv3"}; !reflect.DeepEqual(d.cancelledIDs, want) {
+		t.Errorf("cancelled invocations = %v, want %v", d.cancelledIDs, want)
+	}
+	if want := []string{"run1", "run2", "run3"}; !reflect.DeepEqual(marked, want) {
+		t.Errorf("marked = %v, want %v", marked, want)
+	}
+	if !reflect.DeepEqual(cancelled, marked) {
+		t.Errorf("cancelled = %v, want %v", cancelled, marked)
+	}
+}
+
+func TestCancelDisabledRepoReviews_BestEffort(t *testing.T) {
+	d := &cancelRecorder{cancelErr: errors.New("restate unavailable")}
+	var marked []string
+	markCancelled := func(_ context.Context, id string) (bool, error) {
+		marked = append(marked, id)
+		return true, nil
+	}
+
+	cancelled := cancelDisabledRepoReviews(context.Background(), d, activeRuns(), markCancelled)
+
+	if want := []string{"inv1", "inv3"}; !reflect.DeepEqual(d.cancelledIDs, want) {
+		t.Errorf("cancelled invocations = %v, want %v", d.cancelledIDs, want)
+	}
+	// Only run2 had no invocation to cancel; the failed ones stay active.
+	if want := []string{"run2"}; !reflect.DeepEqual(cancelled, want) {
+		t.Errorf("cancelled = %v, want %v", cancelled, want)
+	}
+}
+
+func TestStatsWindow(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name               string
+		start, end         *timestamppb.Timestamp
+		wantStart, wantEnd time.Time
+	}{
+		{name: "defaults", wantStart: now.Add(-defaultStatsWindow), wantEnd: now},
+		{name: "only start", start: timestamppb.New(start), wantStart: start, wantEnd: now},
+		{name: "only end", end: timestamppb.New(end), wantStart: end.Add(-defaultStatsWindow), wantEnd: end},
+		{name: "both", start: timestamppb.New(start), end: timestamppb.New(end), wantStart: start, wantEnd: end},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gotStart, gotEnd, err := statsWindow(tc.start, tc.end, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !gotStart.Equal(tc.wantStart) || !gotEnd.Equal(tc.wantEnd) {
+				t.Errorf("window = [%v, %v), want [%v, %v)", gotStart, gotEnd, tc.wantStart, tc.wantEnd)
+			}
+		})
+	}
+}
+
+func TestStatsWindow_Empty(t *testing.T) {
+	at := timestamppb.New(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	// The end is exclusive, so equal bounds select nothing and are rejected.
+	if _, _, err := statsWindow(at, at, time.Now()); connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("err = %v, want InvalidArgument", err)
+	}
+}
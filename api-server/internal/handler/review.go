@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	"connectrpc.com/connect"
 	"github.com/jackc/pgx/v5"
@@ -12,33 +14,52 @@ import (
 	apiv1 "ai-reviewer/gen/api/v1"
 	"ai-reviewer/gen/api/v1/apiv1connect"
 	"ai-reviewer/api-server/internal/db"
+	"ai-reviewer/api-server/internal/outbox"
 	"ai-reviewer/api-server/internal/restate"
+	"ai-reviewer/api-server/internal/sarif"
 )
 
+// DefaultPreviewTimeout bounds a PreviewReview call unless SetPreviewTimeout overrides it.
+const DefaultPreviewTimeout = 2 * time.Minute
+
 // ReviewHandler implements apiv1connect.ReviewServiceHandler.
 type ReviewHandler struct {
 	apiv1connect.UnimplementedReviewServiceHandler
-	pool    *pgxpool.Pool
-	restate *restate.Client
+	pool           *pgxpool.Pool
+	restate        *restate.Client
+	dispatcher     *outbox.Dispatcher
+	previewTimeout time.Duration
 }
 
 // NewReviewHandler creates a ReviewHandler.
 func NewReviewHandler(pool *pgxpool.Pool, restate *restate.Client) *ReviewHandler {
-	return &ReviewHandler{pool: pool, restate: restate}
+	return &ReviewHandler{
+		pool:           pool,
+		restate:        restate,
+		dispatcher:     outbox.New(&outbox.PoolStore{Pool: pool}, restate, 0),
+		previewTimeout: DefaultPreviewTimeout,
+	}
+}
+
+// SetPreviewTimeout sets how long PreviewReview waits for the Reviewer.
+func (h *ReviewHandler) SetPreviewTimeout(d time.Duration) {
+	h.previewTimeout = d
 }
 
-// TriggerReview creates a review run and sends a fire-and-forget message to Restate.
+// TriggerReview creates a review run and sends a fire-and-forget message to Restate. The run
+// is committed with a review_dispatch_outbox entry, so if the send fails (or the process dies
+// before it) the outbox poller dispatches it later and the pending run is still returned.
 func (h *ReviewHandler) TriggerReview(ctx context.Context, req *connect.Request[apiv1.TriggerReviewRequest]) (*connect.Response[apiv1.TriggerReviewResponse], error) {
 	msg := req.Msg
 	if msg.RepoId == "" {
-		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("repo_id is required"))
+		return nil, invalidArg("repo_id", "repo_id is required")
 	}
 	if msg.MrNumber <= 0 {
-		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("mr_number must be positive"))
+		return nil, invalidArg("mr_number", "mr_number must be positive")
 	}
 
 	// Verify repo exists.
-	_, err := db.GetRepo(ctx, h.pool, msg.RepoId)
+	repo, err := db.GetRepo(ctx, h.pool, msg.RepoId)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("repository not found"))
@@ -46,24 +67,17 @@ func (h *ReviewHandler) TriggerReview(ctx context.Context, req *connect.Request[
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting repo: %w", err))
 	}
 
-	runID, err := db.CreateReviewRun(ctx, h.pool, msg.RepoId, msg.MrNumber)
+	runID, created, err := db.EnqueueReviewRun(ctx, h.pool, msg.RepoId, msg.MrNumber, msg.IdempotencyKey, true, true, outbox.Lease)
 	if err != nil {
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("creating review run: %w", err))
 	}
-
-	key := fmt.Sprintf("%s-%d", msg.RepoId, msg.MrNumber)
-	invocationID, err := h.restate.SendPRReview(ctx, key, restate.PRReviewRequest{
-		RunID:    runID,
-		RepoID:   msg.RepoId,
-		MRNumber: msg.MrNumber,
-		Force:    true,
-	})
-	if err != nil {
-		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("sending to restate: %w", err))
-	}
-
-	if err := db.UpdateReviewRunInvocationID(ctx, h.pool, runID, invocationID); err != nil {
-		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("storing invocation id: %w", err))
+	// A duplicate idempotency key returns the original run, which that call dispatched.
+	if created {
+		// A manual trigger is deliberate, so it skips the debounce meant for bursts of pushes.
+		entry := db.DispatchOutboxRow{RunID: runID, RepoID: msg.RepoId, MRNumber: msg.MrNumber, Force: true, Attempts: 1, ReviewDrafts: repo.ReviewDrafts, SkipDebounce: true}
+		if _, err := h.dispatcher.Dispatch(ctx, entry); err != nil {
+			log.Printf("TriggerReview: run %s left to the outbox poller: %v", runID, err)
+		}
 	}
 
 	run, err := db.GetReviewRun(ctx, h.pool, runID)
@@ -76,10 +90,53 @@ func (h *ReviewHandler) TriggerReview(ctx context.Context, req *connect.Request[
 	}), nil
 }
 
+// PreviewReview runs DiffFetcher and the Reviewer synchronously via Restate and returns
+// the summary and comments without creating a review run or posting anything.
+func (h *ReviewHandler) PreviewReview(ctx context.Context, req *connect.Request[apiv1.PreviewReviewRequest]) (*connect.Response[apiv1.PreviewReviewResponse], error) {
+	msg := req.Msg
+	if msg.RepoId == "" {
+		return nil, invalidArg("repo_id", "repo_id is required")
+	}
+	if msg.MrNumber <= 0 {
+		return nil, invalidArg("mr_number", "mr_number must be positive")
+	}
+
+	if _, err := db.GetRepo(ctx, h.pool, msg.RepoId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("repository not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting repo: %w", err))
+	}
+
+	previewCtx, cancel := context.WithTimeout(ctx, h.previewTimeout)
+	defer cancel()
+	preview, err := h.restate.PreviewReview(previewCtx, restate.PreviewRequest{
+		RepoID:   msg.RepoId,
+		MRNumber: msg.MrNumber,
+	})
+	if err != nil {
+		return nil, previewError(err, h.previewTimeout)
+	}
+	if preview.SkipReason != "" {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, errors.New(preview.SkipReason))
+	}
+
+	return connect.NewResponse(previewToProto(preview)), nil
+}
+
+// previewError maps a failed preview call to a Connect error; running out of time is
+// reported as DeadlineExceeded rather than an internal error.
+func previewError(err error, timeout time.Duration) *connect.Error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return connect.NewError(connect.CodeDeadlineExceeded, fmt.Errorf("review preview did not finish within %s", timeout))
+	}
+	return connect.NewError(connect.CodeInternal, fmt.Errorf("running preview: %w", err))
+}
+
 // GetReviewRun fetches a review run with its comments.
 func (h *ReviewHandler) GetReviewRun(ctx context.Context, req *connect.Request[apiv1.GetReviewRunRequest]) (*connect.Response[apiv1.GetReviewRunResponse], error) {
 	if req.Msg.Id == "" {
-		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("id is required"))
+		return nil, invalidArg("id", "id is required")
 	}
 
 	run, err := db.GetReviewRun(ctx, h.pool, req.Msg.Id)
@@ -90,12 +147,304 @@ func (h *ReviewHandler) GetReviewRun(ctx context.Context, req *connect.Request[a
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting review run: %w", err))
 	}
 
-	comments, err := db.GetReviewComments(ctx, h.pool, run.ID)
-	if err != nil {
-		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting comments: %w", err))
+	var comments []db.ReviewCommentRow
+	if req.Msg.IncludeComments == nil || *req.Msg.IncludeComments {
+		comments, err = db.GetReviewComments(ctx, h.pool, run.ID)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting comments: %w", err))
+		}
 	}
 
 	return connect.NewResponse(&apiv1.GetReviewRunResponse{
 		ReviewRun: reviewRunToProto(*run, comments),
 	}), nil
 }
+
+// ListReviewComments returns one page of a review run's comments with the total count.
+func (h *ReviewHandler) ListReviewComments(ctx context.Context, req *connect.Request[apiv1.ListReviewCommentsRequest]) (*connect.Response[apiv1.ListReviewCommentsResponse], error) {
+	msg := req.Msg
+	if msg.ReviewRunId == "" {
+		return nil, invalidArg("review_run_id", "review_run_id is required")
+	}
+	limit, offset, err := pageBounds(msg.Limit, msg.Offset)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if _, err := db.GetReviewRun(ctx, h.pool, msg.ReviewRunId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("review run not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting review run: %w", err))
+	}
+
+	rows, total, err := db.GetReviewCommentsPage(ctx, h.pool, msg.ReviewRunId, limit, offset)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("listing comments: %w", err))
+	}
+
+	comments := make([]*apiv1.ReviewComment, len(rows))
+	for i, c := range rows {
+		comments[i] = reviewCommentToProto(c)
+	}
+	return connect.NewResponse(&apiv1.ListReviewCommentsResponse{
+		Comments:   comments,
+		TotalCount: int32(total),
+		NextOffset: int32(nextOffset(offset, len(rows), total)),
+	}), nil
+}
+
+// GetReviewRunEvents returns a review run's status transitions, oldest first.
+func (h *ReviewHandler) GetReviewRunEvents(ctx context.Context, req *connect.Request[apiv1.GetReviewRunEventsRequest]) (*connect.Response[apiv1.GetReviewRunEventsResponse], error) {
+	if req.Msg.ReviewRunId == "" {
+		return nil, invalidArg("review_run_id", "review_run_id is required")
+	}
+
+	if _, err := db.GetReviewRun(ctx, h.pool, req.Msg.ReviewRunId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("review run not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting review run: %w", err))
+	}
+
+	rows, err := db.ListReviewRunEvents(ctx, h.pool, req.Msg.ReviewRunId)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("listing events: %w", err))
+	}
+
+	events := make([]*apiv1.ReviewRunEvent, len(rows))
+	for i, e := range rows {
+		events[i] = reviewRunEventToProto(e)
+	}
+	return connect.NewResponse(&apiv1.GetReviewRunEventsResponse{Events: events}), nil
+}
+
+// ListActiveReviews returns pending and running review runs, oldest first, optionally
+// restricted to one repository.
+func (h *ReviewHandler) ListActiveReviews(ctx context.Context, req *connect.Request[apiv1.ListActiveReviewsRequest]) (*connect.Response[apiv1.ListActiveReviewsResponse], error) {
+	rows, err := db.ListActiveReviewRuns(ctx, h.pool, req.Msg.RepoId)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("listing active reviews: %w", err))
+	}
+
+	now := time.Now()
+	reviews := make([]*apiv1.ActiveReview, len(rows))
+	for i, r := range rows {
+		reviews[i] = activeReviewToProto(r, now)
+	}
+	return connect.NewResponse(&apiv1.ListActiveReviewsResponse{Reviews: reviews}), nil
+}
+
+// ListReviewRuns returns one page of review runs matching the filter, newest first, with
+// the total count.
+func (h *ReviewHandler) ListReviewRuns(ctx context.Context, req *connect.Request[apiv1.ListReviewRunsRequest]) (*connect.Response[apiv1.ListReviewRunsResponse], error) {
+	filter, err := reviewRunFilterFromProto(req.Msg)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, total, err := db.ListReviewRunsFiltered(ctx, h.pool, filter)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("listing review runs: %w", err))
+	}
+
+	runs := make([]*apiv1.ReviewRun, len(rows))
+	for i, r := range rows {
+		runs[i] = reviewRunToProto(r, nil)
+	}
+	return connect.NewResponse(&apiv1.ListReviewRunsResponse{
+		ReviewRuns: runs,
+		TotalCount: int32(total),
+		NextOffset: int32(nextOffset(filter.Offset, len(rows), total)),
+	}), nil
+}
+
+// reviewRunFilterFromProto validates a ListReviewRuns request and turns it into a filter.
+func reviewRunFilterFromProto(msg *apiv1.ListReviewRunsRequest) (db.ReviewRunFilter, error) {
+	limit, offset, err := pageBounds(msg.Limit, msg.Offset)
+	if err != nil {
+		return db.ReviewRunFilter{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	if msg.RepoId != "" {
+		if !isUUID(msg.RepoId) {
+			return db.ReviewRunFilter{}, invalidArg("repo_id", "repo_id must be a UUID")
+		}
+	}
+	filter := db.ReviewRunFilter{RepoID: msg.RepoId, Limit: limit, Offset: offset}
+	for _, s := range msg.Statuses {
+		status, ok := reviewStatusToString(s)
+		if !ok {
+			return db.ReviewRunFilter{}, invalidArg("statuses", fmt.Sprintf("unsupported status %s", s))
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+	if msg.CreatedFrom != nil {
+		from := msg.CreatedFrom.AsTime()
+		filter.From = &from
+	}
+	if msg.CreatedTo != nil {
+		to := msg.CreatedTo.AsTime()
+		filter.To = &to
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return db.ReviewRunFilter{}, invalidArg("created_to", "created_to must not be before created_from")
+	}
+	return filter, nil
+}
+
+// CancelReviews cancels the given active review runs, or every active run of repo_id when
+// no ids are given. Each run's Restate invocation is cancelled before the run is marked
+// cancelled; per-run failures are reported in the response rather than failing the call.
+func (h *ReviewHandler) CancelReviews(ctx context.Context, req *connect.Request[apiv1.CancelReviewsRequest]) (*connect.Response[apiv1.CancelReviewsResponse], error) {
+	msg := req.Msg
+	if len(msg.ReviewRunIds) == 0 && msg.RepoId == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("review_run_ids or repo_id is required"))
+	}
+
+	active, err := db.ListActiveReviewRuns(ctx, h.pool, msg.RepoId)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("listing active reviews: %w", err))
+	}
+
+	runs, failures := selectRunsToCancel(active, msg.ReviewRunIds)
+	cancelled := cancelRuns(ctx, runs, failures, h.restate.CancelInvocation, func(ctx context.Context, runID string) (bool, error) {
+		return db.CancelReviewRun(ctx, h.pool, runID, "cancelled via CancelReviews")
+	})
+	return connect.NewResponse(&apiv1.CancelReviewsResponse{
+		CancelledReviewRunIds: cancelled,
+		Failures:              failures,
+	}), nil
+}
+
+// selectRunsToCancel picks the runs named by ids out of active, or all of active when ids
+// is empty. Requested ids that aren't active are returned as failures.
+func selectRunsToCancel(active []db.ActiveReviewRunRow, ids []string) ([]db.ActiveReviewRunRow, map[string]string) {
+	failures := make(map[string]string)
+	if len(ids) == 0 {
+		return active, failures
+	}
+	byID := make(map[string]db.ActiveReviewRunRow, len(active))
+	for _, r := range active {
+		byID[r.ID] = r
+	}
+	var runs []db.ActiveReviewRunRow
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		r, ok := byID[id]
+		if !ok {
+			failures[id] = "not an active review run"
+			continue
+		}
+		runs = append(runs, r)
+	}
+	return runs, failures
+}
+
+// cancelRuns cancels each run's invocation (runs not yet dispatched have none) and then
+// marks the run cancelled, returning the ids that were cancelled. A run whose invocation
+// couldn't be cancelled is left untouched so it can be retried.
+func cancelRuns(ctx context.Context, runs []db.ActiveReviewRunRow, failures map[string]string,
+	cancelInvocation func(ctx context.Context, invocationID string) error,
+	markCancelled func(ctx context.Context, runID string) (bool, error),
+) []string {
+	var cancelled []string
+	for _, r := range runs {
+		if r.RestateInvocationID != nil && *r.RestateInvocationID != "" {
+			if err := cancelInvocation(ctx, *r.RestateInvocationID); err != nil {
+				failures[r.ID] = fmt.Sprintf("cancelling invocation: %v", err)
+				continue
+			}
+		}
+		ok, err := markCancelled(ctx, r.ID)
+		if err != nil {
+			failures[r.ID] = fmt.Sprintf("marking run cancelled: %v", err)
+			continue
+		}
+		if !ok {
+			failures[r.ID] = "run finished before it could be cancelled"
+			continue
+		}
+		log.Printf("review: cancelled run %s (repo=%s mr=%d)", r.ID, r.RepoID, r.MRNumber)
+		cancelled = append(cancelled, r.ID)
+	}
+	return cancelled
+}
+
+// GetMRFindings returns the findings of all completed review runs for an MR, merged by fingerprint.
+func (h *ReviewHandler) GetMRFindings(ctx context.Context, req *connect.Request[apiv1.GetMRFindingsRequest]) (*connect.Response[apiv1.GetMRFindingsResponse], error) {
+	msg := req.Msg
+	if msg.RepoId == "" {
+		return nil, invalidArg("repo_id", "repo_id is required")
+	}
+	if msg.MrNumber <= 0 {
+		return nil, invalidArg("mr_number", "mr_number must be positive")
+	}
+
+	latestRunID, err := db.GetLatestCompletedRunID(ctx, h.pool, msg.RepoId, msg.MrNumber)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting latest run: %w", err))
+	}
+
+	comments, err := db.ListMRFindingComments(ctx, h.pool, msg.RepoId, msg.MrNumber)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("listing comments: %w", err))
+	}
+
+	return connect.NewResponse(&apiv1.GetMRFindingsResponse{
+		Findings: mergeFindings(comments, latestRunID),
+	}), nil
+}
+
+// DismissFinding marks a finding as dismissed so it is no longer reported as open.
+func (h *ReviewHandler) DismissFinding(ctx context.Context, req *connect.Request[apiv1.DismissFindingRequest]) (*connect.Response[apiv1.DismissFindingResponse], error) {
+	msg := req.Msg
+	if msg.RepoId == "" {
+		return nil, invalidArg("repo_id", "repo_id is required")
+	}
+	if msg.MrNumber <= 0 {
+		return nil, invalidArg("mr_number", "mr_number must be positive")
+	}
+	if msg.Fingerprint == "" {
+		return nil, invalidArg("fingerprint", "fingerprint is required")
+	}
+
+	if err := db.DismissFinding(ctx, h.pool, msg.RepoId, msg.MrNumber, msg.Fingerprint); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("finding not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("dismissing finding: %w", err))
+	}
+
+	return connect.NewResponse(&apiv1.DismissFindingResponse{}), nil
+}
+
+// GetReviewRunSARIF renders a review run's comments as a SARIF 2.1.0 log.
+func (h *ReviewHandler) GetReviewRunSARIF(ctx context.Context, req *connect.Request[apiv1.GetReviewRunSARIFRequest]) (*connect.Response[apiv1.GetReviewRunSARIFResponse], error) {
+	if req.Msg.RunId == "" {
+		return nil, invalidArg("run_id", "run_id is required")
+	}
+
+	run, err := db.GetReviewRun(ctx, h.pool, req.Msg.RunId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("review run not found"))
+		}
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting review run: %w", err))
+	}
+
+	comments, err := db.GetReviewComments(ctx, h.pool, run.ID)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("getting comments: %w", err))
+	}
+
+	out, err := sarif.Render(run.ID, commentsToSARIF(comments))
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	return connect.NewResponse(&apiv1.GetReviewRunSARIFResponse{Sarif: string(out)}), nil
+}
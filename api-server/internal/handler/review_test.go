@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"ai-reviewer/api-server/internal/db"
+	apiv1 "ai-reviewer/gen/api/v1"
+)
+
+func activeRuns() []db.ActiveReviewRunRow {
+	return []db.ActiveReviewRunRow{
+		{ID: "run1", RepoID: "r1", MRNumber: 1, Status: "running", RestateInvocationID: strPtr("inv1")},
+		{ID: "run2", RepoID: "r1", MRNumber: 2, Status: "pending"},
+		{ID: "run3", RepoID: "r2", MRNumber: 3, Status: "running", RestateInvocationID: strPtr("inv3")},
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestSelectRunsToCancel_AllWhenNoIDs(t *testing.T) {
+	runs, failures := selectRunsToCancel(activeRuns(), nil)
+	if len(runs) != 3 || len(failures) != 0 {
+		t.Errorf("got %d runs and failures %v, want 3 runs and none", len(runs), failures)
+	}
+}
+
+func TestSelectRunsToCancel_ByID(t *testing.T) {
+	runs, failures := selectRunsToCancel(activeRuns(), []string{"run3", "gone", "run3"})
+	if len(runs) != 1 || runs[0].ID != "run3" {
+		t.Errorf("runs = %+v, want only run3", runs)
+	}
+	if want := map[string]string{"gone": "not an active review run"}; !reflect.DeepEqual(failures, want) {
+		t.Errorf("failures = %v, want %v", failures, want)
+	}
+}
+
+func TestCancelRuns(t *testing.T) {
+	var cancelledInvocations, marked []string
+	cancelInvocation := func(_ context.Context, id string) error {
+		if id == "inv3" {
+			return errors.New("restate unavailable")
+		}
+		cancelledInvocations = append(cancelledInvocations, id)
+		return nil
+	}
+	markCancelled := func(_ context.Context, id string) (bool, error) {
+		marked = append(marked, id)
+		return id != "run2", nil // run2 finished in the meantime
+	}
+
+	failures := map[string]string{}
+	cancelled := cancelRuns(context.Background(), activeRuns(), failures, cancelInvocation, markCancelled)
+
+	if want := []string{"run1"}; !reflect.DeepEqual(cancelled, want) {
+		t.Errorf("cancelled = %v, want %v", cancelled, want)
+	}
+	if want := []string{"inv1"}; !reflect.DeepEqual(cancelledInvocations, want) {
+		t.Errorf("cancelled invocations = %v, want %v", cancelledInvocations, want)
+	}
+	// run3's invocation cancel failed, so its row must be left active for a retry.
+	if want := []string{"run1", "run2"}; !reflect.DeepEqual(marked, want) {
+		t.Errorf("marked = %v, want %v", marked, want)
+	}
+	if failures["run2"] != "run finished before it could be cancelled" {
+		t.Errorf("run2 failure = %q", failures["run2"])
+	}
+	if failures["run3"] != "cancelling invocation: restate unavailable" {
+		t.Errorf("run3 failure = %q", failures["run3"])
+	}
+}
+
+func TestReviewRunFilterFromProto(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 3, 31, 23, 59, 59, 0, time.UTC)
+	filter, err := reviewRunFilterFromProto(&apiv1.ListReviewRunsRequest{
+		RepoId:      "6f1c2a4e-8a39-4c55-9d3e-1f2b3c4d5e6f",
+		Statuses:    []apiv1.ReviewStatus{apiv1.ReviewStatus_REVIEW_STATUS_COMPLETED, apiv1.ReviewStatus_REVIEW_STATUS_FAILED},
+		CreatedFrom: timestamppb.New(from),
+		CreatedTo:   timestamppb.New(to),
+		Offset:      100,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(filter.Statuses, []string{"completed", "failed"}) {
+		t.Errorf("Statuses = %v", filter.Statuses)
+	}
+	if !filter.From.Equal(from) || !filter.To.Equal(to) {
+		t.Errorf("range = [%v, %v], want [%v, %v]", filter.From, filter.To, from, to)
+	}
+	if filter.Limit != defaultPageSize || filter.Offset != 100 {
+		t.Errorf("limit/offset = %d/%d", filter.Limit, filter.Offset)
+	}
+}
+
+func TestReviewRunFilterFromProto_Unbounded(t *testing.T) {
+	filter, err := reviewRunFilterFromProto(&apiv1.ListReviewRunsRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filter.RepoID != "" || filter.Statuses != nil || filter.From != nil || filter.To != nil {
+		t.Errorf("filter = %+v, want no filtering", filter)
+	}
+}
+
+func TestReviewRunFilterFromProto_RangeBoundaries(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Both bounds are inclusive, so a single instant is a valid range.
+	if _, err := reviewRunFilterFromProto(&apiv1.ListReviewRunsRequest{
+		CreatedFrom: timestamppb.New(at),
+		CreatedTo:   timestamppb.New(at),
+	}); err != nil {
+		t.Errorf("equal bounds: unexpected error: %v", err)
+	}
+	_, err := reviewRunFilterFromProto(&apiv1.ListReviewRunsRequest{
+		CreatedFrom: timestamppb.New(at),
+		CreatedTo:   timestamppb.New(at.Add(-time.Nanosecond)),
+	})
+	if connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("to before from: err = %v, want InvalidArgument", err)
+	}
+}
+
+func TestReviewRunFilterFromProto_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *apiv1.ListReviewRunsRequest
+	}{
+		{name: "unspecified status", req: &apiv1.ListReviewRunsRequest{Statuses: []apiv1.ReviewStatus{apiv1.ReviewStatus_REVIEW_STATUS_UNSPECIFIED}}},
+		{name: "bad repo id", req: &apiv1.ListReviewRunsRequest{RepoId: "not-a-uuid"}},
+		{name: "negative offset", req: &apiv1.ListReviewRunsRequest{Offset: -1}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := reviewRunFilterFromProto(tc.req); connect.CodeOf(err) != connect.CodeInvalidArgument {
+				t.Errorf("err = %v, want InvalidArgument", err)
+			}
+		})
+	}
+}
@@ -1,15 +1,22 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"regexp"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -21,11 +28,22 @@ import (
 // WebhookStore is the minimal DB interface needed by WebhookHandler.
 type WebhookStore interface {
 	GetProvider(ctx context.Context, id string) (*db.ProviderRow, error)
+	GetProviderBySlug(ctx context.Context, slug string) (*db.ProviderRow, error)
 	GetRepoByRemoteID(ctx context.Context, providerID, remoteID string) (*db.RepoRow, error)
 	GetActiveInvocationID(ctx context.Context, repoID string, mrNumber int64) (*string, error)
+	// GetReviewTargetByRemoteID combines the two lookups above in one query for the
+	// webhook hot path.
+	GetReviewTargetByRemoteID(ctx context.Context, providerID, remoteID string, mrNumber int64) (*db.ReviewTargetRow, error)
 	CreateReviewRunWithInvocation(ctx context.Context, repoID string, mrNumber int64, invocationID string) (string, error)
 	CreateDraftReviewRun(ctx context.Context, repoID string, mrNumber int64) (string, error)
 	TransitionDraftToReview(ctx context.Context, repoID string, mrNumber int64) error
+	RecordDelivery(ctx context.Context, providerID, eventUUID string) (seen bool, err error)
+	// ForgetDelivery removes a delivery recorded by RecordDelivery, so GitLab's redelivery
+	// of an event whose processing failed isn't dropped as a duplicate.
+	ForgetDelivery(ctx context.Context, providerID, eventUUID string) error
+	GetLatestReviewHeadSHA(ctx context.Context, repoID string, mrNumber int64) (string, bool, error)
+	UpsertRepo(ctx context.Context, repo db.RepoUpsertInput) error
+	SoftDeleteRepo(ctx context.Context, providerID, remoteID string) error
 }
 
 // RestateDispatcher abstracts Restate invocation submission and cancellation.
@@ -44,6 +62,11 @@ func (s *PoolWebhookStore) GetProvider(ctx context.Context, id string) (*db.Prov
 	return db.GetProvider(ctx, s.Pool, id)
 }
 
+// GetProviderBySlug implements WebhookStore.
+func (s *PoolWebhookStore) GetProviderBySlug(ctx context.Context, slug string) (*db.ProviderRow, error) {
+	return db.GetProviderBySlug(ctx, s.Pool, slug)
+}
+
 // GetRepoByRemoteID implements WebhookStore.
 func (s *PoolWebhookStore) GetRepoByRemoteID(ctx context.Context, providerID, remoteID string) (*db.RepoRow, error) {
 	return db.GetRepoByRemoteID(ctx, s.Pool, providerID, remoteID)
@@ -54,6 +77,11 @@ func (s *PoolWebhookStore) GetActiveInvocationID(ctx context.Context, repoID str
 	return db.GetActiveInvocationID(ctx, s.Pool, repoID, mrNumber)
 }
 
+// GetReviewTargetByRemoteID implements WebhookStore.
+func (s *PoolWebhookStore) GetReviewTargetByRemoteID(ctx context.Context, providerID, remoteID string, mrNumber int64) (*db.ReviewTargetRow, error) {
+	return db.GetReviewTargetByRemoteID(ctx, s.Pool, providerID, remoteID, mrNumber)
+}
+
 // CreateReviewRunWithInvocation implements WebhookStore.
 func (s *PoolWebhookStore) CreateReviewRunWithInvocation(ctx context.Context, repoID string, mrNumber int64, invocationID string) (string, error) {
 	return db.CreateReviewRunWithInvocation(ctx, s.Pool, repoID, mrNumber, invocationID)
@@ -69,12 +97,41 @@ func (s *PoolWebhookStore) TransitionDraftToReview(ctx context.Context, repoID s
 	return db.TransitionDraftToReview(ctx, s.Pool, repoID, mrNumber)
 }
 
+// RecordDelivery implements WebhookStore.
+func (s *PoolWebhookStore) RecordDelivery(ctx context.Context, providerID, eventUUID string) (bool, error) {
+	return db.RecordDelivery(ctx, s.Pool, providerID, eventUUID)
+}
+
+// ForgetDelivery implements WebhookStore.
+func (s *PoolWebhookStore) ForgetDelivery(ctx context.Context, providerID, eventUUID string) error {
+	return db.DeleteDelivery(ctx, s.Pool, providerID, eventUUID)
+}
+
+// GetLatestReviewHeadSHA implements WebhookStore.
+func (s *PoolWebhookStore) GetLatestReviewHeadSHA(ctx context.Context, repoID string, mrNumber int64) (string, bool, error) {
+	return db.GetLatestReviewHeadSHA(ctx, s.Pool, repoID, mrNumber)
+}
+
+// UpsertRepo implements WebhookStore.
+func (s *PoolWebhookStore) UpsertRepo(ctx context.Context, repo db.RepoUpsertInput) error {
+	return db.UpsertRepos(ctx, s.Pool, []db.RepoUpsertInput{repo})
+}
+
+// SoftDeleteRepo implements WebhookStore.
+func (s *PoolWebhookStore) SoftDeleteRepo(ctx context.Context, providerID, remoteID string) error {
+	return db.SoftDeleteRepoByRemoteID(ctx, s.Pool, providerID, remoteID)
+}
+
 // GitLabWebhookPayload represents an incoming GitLab webhook payload.
 type GitLabWebhookPayload struct {
 	ObjectKind       string                `json:"object_kind"`
 	Project          GitLabWebhookProject  `json:"project"`
 	ObjectAttributes GitLabMRAttributes    `json:"object_attributes"`
 	Changes          *GitLabWebhookChanges `json:"changes,omitempty"`
+	Repository       WebhookRepository     `json:"repository"`
+	// MergeRequest is set on note events for comments on a merge request, and on pipeline
+	// events for merge request pipelines.
+	MergeRequest *GitLabNoteMergeRequest `json:"merge_request,omitempty"`
 }
 
 // GitLabWebhookProject holds the project info from a GitLab webhook.
@@ -82,12 +139,40 @@ type GitLabWebhookProject struct {
 	ID int64 `json:"id"`
 }
 
-// GitLabMRAttributes holds merge request attributes from a GitLab webhook.
+// WebhookRepository holds the repository identity from a webhook. Only GitHub sends
+// full_name ("owner/repo"); GitLab identifies the repo by Project.ID instead.
+type WebhookRepository struct {
+	FullName string `json:"full_name"`
+}
+
+// GitLabMRAttributes holds merge request attributes from a GitLab webhook. On note
+// events it holds the comment instead: Note and NoteableType are set and IID is unset.
 type GitLabMRAttributes struct {
-	IID            int64  `json:"iid"`
-	Action         string `json:"action"`
-	Draft          bool   `json:"draft"`
-	WorkInProgress bool   `json:"work_in_progress"`
+	IID            int64            `json:"iid"`
+	Action         string           `json:"action"`
+	Draft          bool             `json:"draft"`
+	WorkInProgress bool             `json:"work_in_progress"`
+	LastCommit     GitLabLastCommit `json:"last_commit"`
+	// UpdatedAt is when the MR was last changed, as GitLab formats it (see parseGitLabTime).
+	UpdatedAt    string `json:"updated_at"`
+	Note         string `json:"note"`
+	NoteableType string `json:"noteable_type"`
+	// On pipeline events it holds the pipeline: Status and SHA are set.
+	Status string `json:"status"`
+	SHA    string `json:"sha"`
+}
+
+// GitLabNoteMergeRequest holds the merge request a note or pipeline event belongs to.
+type GitLabNoteMergeRequest struct {
+	IID int64 `json:"iid"`
+	// Draft state, where GitLab includes it; only pipeline events use it.
+	Draft          bool `json:"draft"`
+	WorkInProgress bool `json:"work_in_progress"`
+}
+
+// GitLabLastCommit holds the head commit of a merge request from a GitLab webhook.
+type GitLabLastCommit struct {
+	ID string `json:"id"`
 }
 
 // GitLabWebhookChanges holds changed fields from a GitLab webhook.
@@ -101,42 +186,157 @@ type GitLabFieldChange struct {
 	Current  any `json:"current"`
 }
 
+// Counters for background webhook processing, exported via expvar at /debug/vars.
+var (
+	webhookAsyncProcessed = expvar.NewInt("webhook_async_processed")
+	webhookAsyncFailures  = expvar.NewInt("webhook_async_failures")
+)
+
+// DefaultReviewCommand is the MR comment that triggers an on-demand review.
+const DefaultReviewCommand = "/nitai review"
+
+// DefaultWebhookPathPrefix is the route prefix webhooks are served under; the rest of
+// the path is the provider's id or slug.
+const DefaultWebhookPathPrefix = "/webhooks/"
+
+// DefaultWebhookMaxBodyBytes caps the size of a webhook body; larger deliveries get 413.
+const DefaultWebhookMaxBodyBytes = 1 << 20
+
+// uuidRe matches the canonical textual form of a UUID.
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func isUUID(s string) bool {
+	return uuidRe.MatchString(s)
+}
+
 // WebhookHandler handles incoming GitLab webhook events.
 type WebhookHandler struct {
-	store      WebhookStore
-	dispatcher RestateDispatcher
+	store         WebhookStore
+	dispatcher    RestateDispatcher
+	reviewCommand string
+	pathPrefix    string
+	maxBodyBytes  int64
+
+	maxEventAge time.Duration // 0 disables the stale update check
+
+	async        bool
+	asyncTimeout time.Duration
+	asyncWG      sync.WaitGroup // background events in flight, drained by Shutdown
+	asyncDone    func()         // test hook, called after each background event completes
 }
 
 // NewWebhookHandler creates a WebhookHandler using the provided store and dispatcher.
 func NewWebhookHandler(store WebhookStore, dispatcher RestateDispatcher) *WebhookHandler {
-	return &WebhookHandler{store: store, dispatcher: dispatcher}
+	return &WebhookHandler{store: store, dispatcher: dispatcher, reviewCommand: DefaultReviewCommand, pathPrefix: DefaultWebhookPathPrefix, maxBodyBytes: DefaultWebhookMaxBodyBytes}
 }
 
-// ServeHTTP dispatches webhook requests routed to /webhooks/{provider_id}.
+// SetMaxBodyBytes changes the largest webhook body accepted; n <= 0 keeps the current limit.
+func (h *WebhookHandler) SetMaxBodyBytes(n int64) {
+	if n > 0 {
+		h.maxBodyBytes = n
+	}
+}
+
+// SetPathPrefix changes the route prefix stripped from request paths to find the provider
+// key. It is normalised to start and end with "/"; mount the handler at PathPrefix().
+func (h *WebhookHandler) SetPathPrefix(prefix string) {
+	h.pathPrefix = "/" + strings.Trim(prefix, "/") + "/"
+	if h.pathPrefix == "//" {
+		h.pathPrefix = "/"
+	}
+}
+
+// PathPrefix returns the route prefix the handler expects to be mounted at.
+func (h *WebhookHandler) PathPrefix() string {
+	return h.pathPrefix
+}
+
+// resolveProvider looks up the provider named by a webhook path key: a UUID is taken as
+// the provider id, anything else as its slug.
+func (h *WebhookHandler) resolveProvider(ctx context.Context, key string) (*db.ProviderRow, error) {
+	if isUUID(key) {
+		return h.store.GetProvider(ctx, key)
+	}
+	return h.store.GetProviderBySlug(ctx, key)
+}
+
+// SetReviewCommand changes the MR comment that triggers an on-demand review.
+func (h *WebhookHandler) SetReviewCommand(cmd string) {
+	h.reviewCommand = cmd
+}
+
+// SetMaxEventAge makes the handler skip "update" events whose MR updated_at is more than
+// maxAge in the past, such as the backlog GitLab redelivers after an outage. 0 disables it.
+func (h *WebhookHandler) SetMaxEventAge(maxAge time.Duration) {
+	h.maxEventAge = maxAge
+}
+
+// EnableAsyncDispatch makes the handler acknowledge verified MR events with 202 immediately
+// and process them (repo lookup, cancel, dispatch, DB writes) in a background goroutine
+// bounded by timeout. Failures and panics are logged and counted in webhook_async_failures.
+// Call Shutdown before closing the store so in-flight events aren't cut off.
+func (h *WebhookHandler) EnableAsyncDispatch(timeout time.Duration) {
+	h.async = true
+	h.asyncTimeout = timeout
+}
+
+// Shutdown waits until the background events started so far have finished, or ctx is
+// done. Call it once the server has stopped accepting requests.
+func (h *WebhookHandler) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.asyncWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ServeHTTP dispatches webhook requests routed to <prefix>{provider_id or slug}, and
+// serves the read-only configuration check at GET <prefix>{provider_id or slug}/test.
 func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), testPathSuffix) {
+		h.serveTest(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	// Reject oversized deliveries up front when they declare their length, and cap the
+	// read for those that don't (chunked) or lie about it.
+	if r.ContentLength > h.maxBodyBytes {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, errBodyTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
 
-	// Extract provider_id from path: /webhooks/<provider_id>
-	providerID := strings.TrimPrefix(r.URL.Path, "/webhooks/")
-	providerID = strings.TrimSuffix(providerID, "/")
-	if providerID == "" {
+	// Extract the provider key from the path: <prefix><provider_id or slug>
+	if !strings.HasPrefix(r.URL.Path, h.pathPrefix) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	providerKey := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, h.pathPrefix), "/")
+	if providerKey == "" {
 		http.Error(w, "provider id required", http.StatusNotFound)
 		return
 	}
 
-	provider, err := h.store.GetProvider(r.Context(), providerID)
+	provider, err := h.resolveProvider(r.Context(), providerKey)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			http.Error(w, "provider not found", http.StatusNotFound)
 			return
 		}
-		log.Printf("webhook: GetProvider(%s): %v", providerID, err)
+		log.Printf("webhook: resolving provider %q: %v", providerKey, err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	providerID := provider.ID
 
 	token := r.Header.Get("X-Gitlab-Token")
 	if token == "" || provider.WebhookSecret == nil {
@@ -148,9 +348,37 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var payload GitLabWebhookPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+	if r.Header.Get("X-Gitlab-Event") == gitlabSystemHookEvent {
+		kind, err := systemHookObjectKind(r)
+		if err != nil {
+			log.Printf("webhook: provider=%s reading system hook: %v", providerID, err)
+			if isBodyTooLarge(err) {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, errBodyTooLarge)
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, ErrInvalidJSON.Error())
+			return
+		}
+		// System hooks deliver merge request events in the project hook format; only the
+		// rest are system events.
+		if kind != "merge_request" {
+			h.serveSystemHook(w, r, provider)
+			return
+		}
+	}
+
+	payload, err := parseGitLabPayload(r)
+	if err != nil {
+		log.Printf("webhook: provider=%s rejected payload: %v", providerID, err)
+		if isBodyTooLarge(err) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, errBodyTooLarge)
+			return
+		}
+		if errors.Is(err, ErrMissingObjectKind) {
+			writeJSONError(w, http.StatusUnprocessableEntity, ErrMissingObjectKind.Error())
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, ErrInvalidJSON.Error())
 		return
 	}
 
@@ -163,110 +391,593 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		payload.ObjectAttributes.Draft || payload.ObjectAttributes.WorkInProgress,
 	)
 
-	// Filter non-MR events.
-	if payload.ObjectKind != "merge_request" {
+	// force bypasses DiffFetcher's diff-hash dedup; only a review command can set it.
+	var force bool
+	switch payload.ObjectKind {
+	case "merge_request":
+		// Filter actions the provider isn't configured to review.
+		if !triggersReview(provider.TriggerEvents, payload.ObjectAttributes.Action) {
+			log.Printf("webhook: ignoring non-reviewable action: %s", payload.ObjectAttributes.Action)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	case "note":
+		// Comments are only actionable when they are the review command on an MR.
+		cmdPayload, cmdForce, ok := h.reviewCommandEvent(payload)
+		if !ok {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		log.Printf("webhook: provider=%s review command on MR %d force=%v", providerID, cmdPayload.ObjectAttributes.IID, cmdForce)
+		payload = cmdPayload
+		force = cmdForce
+	case "pipeline":
+		// A finished pipeline re-triggers reviews its gate skipped; see pipelineEvent.
+		mrPayload, ok := pipelineEvent(payload)
+		if !ok {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		log.Printf("webhook: provider=%s pipeline succeeded on MR %d", providerID, mrPayload.ObjectAttributes.IID)
+		payload = mrPayload
+	default:
 		log.Printf("webhook: ignoring non-MR event: %s", payload.ObjectKind)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	remoteID, err := remoteIDFromPayload(provider.Type, payload)
+	if err != nil {
+		log.Printf("webhook: provider=%s: %v", providerID, err)
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	eventUUID := r.Header.Get("X-Gitlab-Event-UUID")
+
+	if h.async {
+		// Acknowledge now so a slow Restate ingress can't make GitLab time out and redeliver.
+		w.WriteHeader(http.StatusAccepted)
+		h.asyncWG.Add(1)
+		go func() {
+			defer h.asyncWG.Done()
+			if h.asyncDone != nil {
+				defer h.asyncDone()
+			}
+			// No middleware covers this goroutine; a panic here would take the server down.
+			defer func() {
+				if rec := recover(); rec != nil {
+					log.Printf("webhook: async processing for provider=%s mr=%d panicked: %v\n%s", providerID, payload.ObjectAttributes.IID, rec, debug.Stack())
+					webhookAsyncFailures.Add(1)
+				}
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), h.asyncTimeout)
+			defer cancel()
+			if err := h.processMREvent(ctx, providerID, remoteID, eventUUID, payload, force); err != nil {
+				log.Printf("webhook: async processing for provider=%s mr=%d failed: %v", providerID, payload.ObjectAttributes.IID, err)
+				webhookAsyncFailures.Add(1)
+			} else {
+				webhookAsyncProcessed.Add(1)
+			}
+		}()
+		return
+	}
+
+	if err := h.processMREvent(r.Context(), providerID, remoteID, eventUUID, payload, force); err != nil {
+		log.Printf("webhook: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// processMREvent handles a verified, reviewable MR event: delivery dedup, repo lookup,
+// draft tracking, cancel-and-replace of the active invocation, and dispatch. Events that
+// are intentionally ignored return nil; a non-nil error means processing failed.
+// force is passed through to the dispatched review.
+func (h *WebhookHandler) processMREvent(ctx context.Context, providerID, remoteID, eventUUID string, payload *GitLabWebhookPayload, force bool) error {
 	action := payload.ObjectAttributes.Action
 	mrIID := payload.ObjectAttributes.IID
 
-	// Filter non-reviewable actions.
-	reviewableActions := map[string]bool{"open": true, "update": true, "reopen": true}
-	if !reviewableActions[action] {
-		log.Printf("webhook: ignoring non-reviewable action: %s", action)
-		w.WriteHeader(http.StatusOK)
-		return
+	if action == "update" && staleEvent(payload.ObjectAttributes.UpdatedAt, h.maxEventAge, time.Now()) {
+		log.Printf("webhook: update of MR %d from %s is older than %s, ignoring", mrIID, payload.ObjectAttributes.UpdatedAt, h.maxEventAge)
+		return nil
 	}
 
-	ctx := r.Context()
-	remoteID := strconv.FormatInt(payload.Project.ID, 10)
+	// GitLab retries deliveries it considers failed; skip ones we've already processed.
+	// The delivery is recorded up front so concurrent redeliveries are dropped, and
+	// forgotten again if processing fails, so GitLab's retry of it isn't.
+	if eventUUID != "" {
+		seen, err := h.store.RecordDelivery(ctx, providerID, eventUUID)
+		if err != nil {
+			return fmt.Errorf("RecordDelivery: %w", err)
+		}
+		if seen {
+			log.Printf("webhook: duplicate delivery %s for provider=%s, ignoring", eventUUID, providerID)
+			return nil
+		}
+	}
 
-	// Repo lookup (must happen before draft check to get repoID for DB calls).
-	repo, err := h.store.GetRepoByRemoteID(ctx, providerID, remoteID)
+	err := h.dispatchMREvent(ctx, providerID, remoteID, payload, force)
+	if err != nil && eventUUID != "" {
+		if ferr := h.store.ForgetDelivery(context.WithoutCancel(ctx), providerID, eventUUID); ferr != nil {
+			log.Printf("webhook: forgetting failed delivery %s for provider=%s: %v", eventUUID, providerID, ferr)
+		}
+	}
+	return err
+}
+
+// dispatchMREvent is processMREvent after the delivery dedup.
+func (h *WebhookHandler) dispatchMREvent(ctx context.Context, providerID, remoteID string, payload *GitLabWebhookPayload, force bool) error {
+	action := payload.ObjectAttributes.Action
+	mrIID := payload.ObjectAttributes.IID
+
+	// Repo lookup (must happen before draft check to get target.RepoID for DB calls). The active
+	// invocation to cancel comes back with it, saving a round trip per event.
+	target, err := h.store.GetReviewTargetByRemoteID(ctx, providerID, remoteID, mrIID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("webhook: repo not found for provider=%s remote_id=%s, ignoring", providerID, remoteID)
-			w.WriteHeader(http.StatusOK)
-			return
+			return nil
 		}
-		log.Printf("webhook: GetRepoByRemoteID: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("GetReviewTargetByRemoteID: %w", err)
 	}
-	if !repo.ReviewEnabled {
-		log.Printf("webhook: review disabled for repo=%s, ignoring", repo.ID)
-		w.WriteHeader(http.StatusOK)
-		return
+	if target.Archived {
+		log.Printf("webhook: repo=%s archived, ignoring", target.RepoID)
+		return nil
+	}
+	if !target.ReviewEnabled {
+		log.Printf("webhook: review disabled for repo=%s, ignoring", target.RepoID)
+		return nil
+	}
+
+	// A passed pipeline only matters to repos that gate reviews on it, and a run still in
+	// flight checks the pipeline itself. It only re-dispatches the review the gate skipped
+	// at this very commit: a newer run (reviewed, draft, another push) has superseded it.
+	if action == pipelineSuccessAction {
+		if !target.RequirePipelineSuccess || target.ActiveInvocationID != nil {
+			return nil
+		}
+		if headSHA := payload.ObjectAttributes.LastCommit.ID; headSHA == "" || target.PipelineBlockedSHA != headSHA {
+			log.Printf("webhook: MR %d has no review skipped by the pipeline gate at %s, ignoring", mrIID, headSHA)
+			return nil
+		}
 	}
 
 	// Draft detection.
 	isDraft := payload.ObjectAttributes.Draft || payload.ObjectAttributes.WorkInProgress
 	isDraftToReady := action == "update" && isDraftToReadyTransition(payload.Changes)
 
-	if isDraft && !isDraftToReady {
-		// Draft MR (open/update, not a transition): record it but don't dispatch.
-		runID, err := h.store.CreateDraftReviewRun(ctx, repo.ID, mrIID)
+	if isDraft && !isDraftToReady && !target.ReviewDrafts {
+		// Draft MR (open/update, not a transition): record it but don't dispatch, unless the
+		// repo opted into draft reviews.
+		runID, err := h.store.CreateDraftReviewRun(ctx, target.RepoID, mrIID)
 		if err != nil {
-			log.Printf("webhook: CreateDraftReviewRun: %v", err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
-			return
+			return fmt.Errorf("CreateDraftReviewRun: %w", err)
 		}
 		log.Printf("webhook: draft MR %d recorded as run=%s, skipping dispatch", mrIID, runID)
-		w.WriteHeader(http.StatusOK)
-		return
+		return nil
 	}
 
 	if isDraftToReady {
 		log.Printf("webhook: MR %d draft→ready transition, transitioning DB record", mrIID)
-		if err := h.store.TransitionDraftToReview(ctx, repo.ID, mrIID); err != nil {
+		if err := h.store.TransitionDraftToReview(ctx, target.RepoID, mrIID); err != nil {
 			log.Printf("webhook: TransitionDraftToReview: %v (continuing)", err)
 		}
 	}
 
+	// Reopening an MR whose head was already reviewed would re-review identical code.
+	// Compare the head SHA against the one the last completed review saw and skip the
+	// dispatch entirely. If the branch was force-pushed while the MR was closed the
+	// head SHA differs and the reopen is reviewed as usual; a force-push back to an
+	// already-reviewed SHA is skipped, which is fine since the code is identical.
+	if action == "reopen" {
+		if headSHA := payload.ObjectAttributes.LastCommit.ID; headSHA != "" {
+			prevSHA, found, err := h.store.GetLatestReviewHeadSHA(ctx, target.RepoID, mrIID)
+			if err != nil {
+				log.Printf("webhook: GetLatestReviewHeadSHA: %v (continuing)", err)
+			} else if found && prevSHA == headSHA {
+				log.Printf("webhook: MR %d reopened at already-reviewed head %s, skipping dispatch", mrIID, headSHA)
+				return nil
+			}
+		}
+	}
+
 	if h.dispatcher == nil {
-		w.WriteHeader(http.StatusOK)
-		return
+		return nil
 	}
 
 	// Cancel existing active invocation (best-effort).
-	activeInvocationID, err := h.store.GetActiveInvocationID(ctx, repo.ID, mrIID)
-	if err != nil {
-		log.Printf("webhook: GetActiveInvocationID: %v", err)
-	} else if activeInvocationID != nil {
+	if activeInvocationID := target.ActiveInvocationID; activeInvocationID != nil {
 		if err := h.dispatcher.CancelInvocation(ctx, *activeInvocationID); err != nil {
 			log.Printf("webhook: CancelInvocation(%s): %v (continuing)", *activeInvocationID, err)
 		} else {
-			log.Printf("webhook: cancelled invocation %s for repo=%s mr=%d", *activeInvocationID, repo.ID, mrIID)
+			log.Printf("webhook: cancelled invocation %s for repo=%s mr=%d", *activeInvocationID, target.RepoID, mrIID)
 		}
 	}
 
 	// Submit new review invocation.
-	key := fmt.Sprintf("%s-%d", repo.ID, mrIID)
+	key := fmt.Sprintf("%s-%d", target.RepoID, mrIID)
 	invocationID, err := h.dispatcher.SendPRReview(ctx, key, restate.PRReviewRequest{
-		RepoID:   repo.ID,
-		MRNumber: mrIID,
+		RepoID:       target.RepoID,
+		MRNumber:     mrIID,
+		Force:        force,
+		ReviewDrafts: target.ReviewDrafts,
 	})
 	if err != nil {
-		log.Printf("webhook: SendPRReview: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("SendPRReview: %w", err)
 	}
 
 	// Create review run record.
-	runID, err := h.store.CreateReviewRunWithInvocation(ctx, repo.ID, mrIID, invocationID)
+	runID, err := h.store.CreateReviewRunWithInvocation(ctx, target.RepoID, mrIID, invocationID)
 	if err != nil {
-		log.Printf("webhook: CreateReviewRunWithInvocation: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		return fmt.Errorf("CreateReviewRunWithInvocation: %w", err)
+	}
+
+	log.Printf("webhook: dispatched review run=%s invocation=%s repo=%s mr=%d", runID, invocationID, target.RepoID, mrIID)
+	return nil
+}
+
+// testPathSuffix ends the path of the webhook configuration check.
+const testPathSuffix = "/test"
+
+// webhookTestResponse is the body of the webhook configuration check. Provider details
+// are only included once the token matched.
+type webhookTestResponse struct {
+	ProviderID       string            `json:"provider_id,omitempty"`
+	ProviderType     string            `json:"provider_type,omitempty"`
+	WebhookPath      string            `json:"webhook_path"`
+	SecretConfigured bool              `json:"secret_configured"`
+	TokenValid       bool              `json:"token_valid"`
+	TriggerEvents    []string          `json:"trigger_events,omitempty"`
+	ExpectedHeaders  map[string]string `json:"expected_headers"`
+}
+
+// webhookExpectedHeaders describes the headers a GitLab delivery must or may carry.
+var webhookExpectedHeaders = map[string]string{
+	"X-Gitlab-Token":      "required: the provider's webhook secret (returned by CreateProvider)",
+	"X-Gitlab-Event":      "sent by GitLab; Merge Request Hook, Note Hook, Pipeline Hook and System Hook (project_create, project_destroy) events are handled",
+	"X-Gitlab-Event-UUID": "optional: redelivered events with a seen UUID are ignored",
+	"Content-Type":        "application/json",
+}
+
+// serveTest answers GET <prefix>{provider_id or slug}/test so users can check routing and
+// the secret before configuring GitLab: 404 if the provider doesn't exist, 401 if its secret
+// is set and X-Gitlab-Token doesn't match, 200 otherwise. It never dispatches, and the
+// secret itself is never returned.
+func (h *WebhookHandler) serveTest(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if !strings.HasPrefix(path, h.pathPrefix) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	providerKey := strings.TrimSuffix(strings.TrimPrefix(path, h.pathPrefix), testPathSuffix)
+	if providerKey == "" || strings.Contains(providerKey, "/") {
+		writeJSONError(w, http.StatusNotFound, "provider not found")
+		return
+	}
+
+	provider, err := h.resolveProvider(r.Context(), providerKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, "provider not found")
+			return
+		}
+		log.Printf("webhook: test: resolving provider %q: %v", providerKey, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := webhookTestResponse{
+		WebhookPath:      h.pathPrefix + providerKey,
+		SecretConfigured: provider.WebhookSecret != nil && *provider.WebhookSecret != "",
+		ExpectedHeaders:  webhookExpectedHeaders,
+	}
+	token := r.Header.Get("X-Gitlab-Token")
+	resp.TokenValid = resp.SecretConfigured && token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(*provider.WebhookSecret)) == 1
+
+	status := http.StatusOK
+	switch {
+	case resp.TokenValid:
+		resp.ProviderID = provider.ID
+		resp.ProviderType = provider.Type
+		resp.TriggerEvents = provider.TriggerEvents
+	case resp.SecretConfigured:
+		status = http.StatusUnauthorized
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp) //nolint:errcheck
+}
+
+// Payload errors returned by parseGitLabPayload.
+var (
+	ErrInvalidJSON       = errors.New("invalid json")
+	ErrMissingObjectKind = errors.New("missing object_kind")
+)
+
+// errBodyTooLarge is the error message of a 413 response.
+const errBodyTooLarge = "request body too large"
+
+// isBodyTooLarge reports whether err comes from reading past the handler's body limit.
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// parseGitLabPayload decodes and validates a GitLab webhook body.
+// Returns ErrInvalidJSON if the body cannot be decoded and ErrMissingObjectKind if
+// it decodes but lacks the event kind.
+func parseGitLabPayload(r *http.Request) (*GitLabWebhookPayload, error) {
+	var payload GitLabWebhookPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJSON, err)
+	}
+	if payload.ObjectKind == "" {
+		return nil, ErrMissingObjectKind
+	}
+	return &payload, nil
+}
+
+// gitlabSystemHookEvent is the X-Gitlab-Event value of GitLab system hook deliveries.
+// Their project events carry event_name instead of object_kind.
+const gitlabSystemHookEvent = "System Hook"
+
+// Errors returned by parseGitLabSystemHookPayload.
+var (
+	ErrMissingEventName = errors.New("missing event_name")
+	ErrMissingProjectID = errors.New("missing project_id")
+)
+
+// GitLabSystemHookPayload represents the project events of a GitLab system hook.
+type GitLabSystemHookPayload struct {
+	EventName         string `json:"event_name"`
+	ProjectID         int64  `json:"project_id"`
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"`
+}
+
+// parseGitLabSystemHookPayload decodes a GitLab system hook body. Returns ErrInvalidJSON if
+// the body cannot be decoded and ErrMissingEventName if it lacks the event name; project
+// events without a project_id return ErrMissingProjectID.
+func parseGitLabSystemHookPayload(r *http.Request) (*GitLabSystemHookPayload, error) {
+	var payload GitLabSystemHookPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJSON, err)
+	}
+	if payload.EventName == "" {
+		return nil, ErrMissingEventName
+	}
+	if strings.HasPrefix(payload.EventName, "project_") && payload.ProjectID == 0 {
+		return nil, ErrMissingProjectID
+	}
+	return &payload, nil
+}
+
+// systemHookObjectKind returns the object_kind of a system hook delivery, "" for events
+// that carry event_name instead or for a malformed body, which the parser that runs next
+// rejects. The body is buffered and put back on r for that parser.
+func systemHookObjectKind(r *http.Request) (string, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var kind struct {
+		ObjectKind string `json:"object_kind"`
+	}
+	_ = json.Unmarshal(body, &kind)
+	return kind.ObjectKind, nil
+}
+
+// serveSystemHook keeps a GitLab provider's repositories in sync with instance-wide
+// system hooks: project_create upserts the repository and project_destroy soft-deletes
+// it. Other system events, including ones without an event_name, are acknowledged and
+// ignored.
+func (h *WebhookHandler) serveSystemHook(w http.ResponseWriter, r *http.Request, provider *db.ProviderRow) {
+	if provider.Type != "gitlab_self_hosted" && provider.Type != "gitlab_cloud" {
+		writeJSONError(w, http.StatusUnprocessableEntity, "system hooks are only supported for GitLab providers")
+		return
+	}
+	payload, err := parseGitLabSystemHookPayload(r)
+	if err != nil {
+		log.Printf("webhook: provider=%s rejected system hook: %v", provider.ID, err)
+		if isBodyTooLarge(err) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, errBodyTooLarge)
+			return
+		}
+		if errors.Is(err, ErrInvalidJSON) {
+			writeJSONError(w, http.StatusBadRequest, ErrInvalidJSON.Error())
+			return
+		}
+		if errors.Is(err, ErrMissingEventName) {
+			// An event kind we don't know; GitLab would only keep retrying a rejection.
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
 		return
 	}
 
-	log.Printf("webhook: dispatched review run=%s invocation=%s repo=%s mr=%d", runID, invocationID, repo.ID, mrIID)
+	remoteID := strconv.FormatInt(payload.ProjectID, 10)
+	switch payload.EventName {
+	case "project_create":
+		err = h.store.UpsertRepo(r.Context(), db.RepoUpsertInput{
+			ProviderID: provider.ID,
+			RemoteID:   remoteID,
+			Name:       payload.Name,
+			FullPath:   payload.PathWithNamespace,
+		})
+	case "project_destroy":
+		err = h.store.SoftDeleteRepo(r.Context(), provider.ID, remoteID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Never synced, or already deleted.
+			err = nil
+		}
+	default:
+		log.Printf("webhook: provider=%s ignoring system event: %s", provider.ID, payload.EventName)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		log.Printf("webhook: provider=%s %s project_id=%d: %v", provider.ID, payload.EventName, payload.ProjectID, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("webhook: provider=%s %s project_id=%d path=%s", provider.ID, payload.EventName, payload.ProjectID, payload.PathWithNamespace)
 	w.WriteHeader(http.StatusOK)
 }
 
+// remoteIDFromPayload returns the repository's remote ID as stored in repositories.remote_id
+// for the given provider type: the numeric project ID for GitLab, "owner/repo" for GitHub.
+func remoteIDFromPayload(providerType string, payload *GitLabWebhookPayload) (string, error) {
+	switch providerType {
+	case "gitlab_self_hosted", "gitlab_cloud":
+		if payload.Project.ID == 0 {
+			return "", errors.New("missing project.id")
+		}
+		return strconv.FormatInt(payload.Project.ID, 10), nil
+	case "github":
+		if payload.Repository.FullName == "" {
+			return "", errors.New("missing repository.full_name")
+		}
+		return payload.Repository.FullName, nil
+	default:
+		return "", fmt.Errorf("unsupported provider type %q", providerType)
+	}
+}
+
+// reviewCommandAction is the synthetic MR action for reviews requested by comment.
+const reviewCommandAction = "review_command"
+
+// reviewCommandEvent converts a note event carrying the review command into an MR event
+// for processMREvent. The result has no draft flags, so a requested review is dispatched
+// even on a draft MR. force reports a "--force" flag after the command. ok is false for
+// notes on other objects or without the command.
+func (h *WebhookHandler) reviewCommandEvent(note *GitLabWebhookPayload) (mrEvent *GitLabWebhookPayload, force, ok bool) {
+	if note.ObjectAttributes.NoteableType != "MergeRequest" || note.MergeRequest == nil || note.MergeRequest.IID == 0 {
+		return nil, false, false
+	}
+	// Editing an old comment shouldn't re-trigger it.
+	if action := note.ObjectAttributes.Action; action != "" && action != "create" {
+		return nil, false, false
+	}
+	args, ok := parseReviewCommand(note.ObjectAttributes.Note, h.reviewCommand)
+	if !ok {
+		return nil, false, false
+	}
+	for _, arg := range args {
+		if arg == "--force" {
+			force = true
+		}
+	}
+	return &GitLabWebhookPayload{
+		ObjectKind: "merge_request",
+		Project:    note.Project,
+		Repository: note.Repository,
+		ObjectAttributes: GitLabMRAttributes{
+			IID:    note.MergeRequest.IID,
+			Action: reviewCommandAction,
+		},
+	}, force, true
+}
+
+// pipelineSuccessAction is the synthetic MR action for reviews re-triggered by a pipeline.
+const pipelineSuccessAction = "pipeline_success"
+
+// pipelineEvent converts a pipeline event into an MR event for processMREvent, so a review
+// the pipeline gate skipped runs once the MR's pipeline has passed. The MR's draft state is
+// carried over so a draft stays unreviewed like on an update. ok is false for other
+// statuses and for pipelines without a merge request: GitLab only attaches one to merge
+// request pipelines, so branch pipelines rely on PIPELINE_WAIT_CHECKS instead.
+func pipelineEvent(pipeline *GitLabWebhookPayload) (mrEvent *GitLabWebhookPayload, ok bool) {
+	if pipeline.ObjectAttributes.Status != "success" || pipeline.MergeRequest == nil || pipeline.MergeRequest.IID == 0 {
+		return nil, false
+	}
+	return &GitLabWebhookPayload{
+		ObjectKind: "merge_request",
+		Project:    pipeline.Project,
+		Repository: pipeline.Repository,
+		ObjectAttributes: GitLabMRAttributes{
+			IID:            pipeline.MergeRequest.IID,
+			Action:         pipelineSuccessAction,
+			LastCommit:     GitLabLastCommit{ID: pipeline.ObjectAttributes.SHA},
+			Draft:          pipeline.MergeRequest.Draft,
+			WorkInProgress: pipeline.MergeRequest.WorkInProgress,
+		},
+	}, true
+}
+
+// gitLabTimeLayouts are the updated_at formats GitLab webhooks use: RFC 3339 on current
+// versions, "2006-01-02 15:04:05 UTC" on older ones.
+var gitLabTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05 MST"}
+
+// parseGitLabTime parses a webhook timestamp; ok is false if it is empty or malformed.
+func parseGitLabTime(s string) (t time.Time, ok bool) {
+	for _, layout := range gitLabTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// staleEvent reports whether an event with the given updated_at is more than maxAge older
+// than now. A maxAge of 0 or a missing or malformed timestamp is never stale, so such
+// events are processed as usual.
+func staleEvent(updatedAt string, maxAge time.Duration, now time.Time) bool {
+	if maxAge <= 0 {
+		return false
+	}
+	t, ok := parseGitLabTime(updatedAt)
+	return ok && now.Sub(t) > maxAge
+}
+
+// parseReviewCommand reports whether a comment body starts with cmd as a whole word and
+// returns the whitespace-separated arguments that follow it on the same line.
+func parseReviewCommand(body, cmd string) (args []string, ok bool) {
+	if cmd == "" {
+		return nil, false
+	}
+	body = strings.TrimSpace(body)
+	if !strings.HasPrefix(body, cmd) {
+		return nil, false
+	}
+	rest := body[len(cmd):]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' && rest[0] != '\n' && rest[0] != '\r' {
+		return nil, false
+	}
+	line, _, _ := strings.Cut(rest, "\n")
+	return strings.Fields(line), true
+}
+
+// writeJSONError writes a {"error": msg} body with the given status.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg}) //nolint:errcheck
+}
+
+// defaultTriggerEvents is the set of MR actions reviewed when a provider has no trigger_events
+// configured. It is also the set of values trigger_events may contain.
+var defaultTriggerEvents = map[string]bool{"open": true, "update": true, "reopen": true}
+
+// triggersReview reports whether an MR action should be reviewed given a provider's
+// configured trigger events. An empty configuration means defaultTriggerEvents.
+func triggersReview(events []string, action string) bool {
+	if len(events) == 0 {
+		return defaultTriggerEvents[action]
+	}
+	for _, e := range events {
+		if e == action {
+			return true
+		}
+	}
+	return false
+}
+
 // isDraftToReadyTransition returns true if the changes indicate a draft→ready transition.
 func isDraftToReadyTransition(changes *GitLabWebhookChanges) bool {
 	if changes == nil || changes.Draft == nil {
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseGitLabPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{name: "valid", body: `{"object_kind":"merge_request","object_attributes":{"iid":1}}`},
+		{name: "not json", body: `not json`, wantErr: ErrInvalidJSON},
+		{name: "empty body", body: ``, wantErr: ErrInvalidJSON},
+		{name: "wrong type", body: `{"object_kind":42}`, wantErr: ErrInvalidJSON},
+		{name: "missing object_kind", body: `{"object_attributes":{"iid":1}}`, wantErr: ErrMissingObjectKind},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/webhooks/p1", strings.NewReader(tc.body))
+			payload, err := parseGitLabPayload(r)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if payload.ObjectKind != "merge_request" || payload.ObjectAttributes.IID != 1 {
+				t.Errorf("unexpected payload: %+v", payload)
+			}
+		})
+	}
+}
+
+func TestRemoteIDFromPayload(t *testing.T) {
+	tests := []struct {
+		name         string
+		providerType string
+		payload      GitLabWebhookPayload
+		want         string
+		wantErr      bool
+	}{
+		{name: "gitlab self-hosted", providerType: "gitlab_self_hosted", payload: GitLabWebhookPayload{Project: GitLabWebhookProject{ID: 123}}, want: "123"},
+		{name: "gitlab cloud", providerType: "gitlab_cloud", payload: GitLabWebhookPayload{Project: GitLabWebhookProject{ID: 7}}, want: "7"},
+		{name: "gitlab missing project", providerType: "gitlab_cloud", wantErr: true},
+		{name: "github", providerType: "github", payload: GitLabWebhookPayload{Repository: WebhookRepository{FullName: "octo/hello"}}, want: "octo/hello"},
+		{name: "github ignores project id", providerType: "github", payload: GitLabWebhookPayload{Project: GitLabWebhookProject{ID: 1}}, wantErr: true},
+		{name: "unknown type", providerType: "bitbucket", payload: GitLabWebhookPayload{Project: GitLabWebhookProject{ID: 1}}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := remoteIDFromPayload(tc.providerType, &tc.payload)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseGitLabSystemHookPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    GitLabSystemHookPayload
+		wantErr error
+	}{
+		{
+			name: "project_create",
+			body: `{"event_name":"project_create","project_id":74,"name":"StoreCloud","path_with_namespace":"jsmith/storecloud","owner_name":"John Smith"}`,
+			want: GitLabSystemHookPayload{EventName: "project_create", ProjectID: 74, Name: "StoreCloud", PathWithNamespace: "jsmith/storecloud"},
+		},
+		{
+			name: "project_destroy",
+			body: `{"event_name":"project_destroy","project_id":73,"name":"Ruby","path_with_namespace":"jsmith/underscore"}`,
+			want: GitLabSystemHookPayload{EventName: "project_destroy", ProjectID: 73, Name: "Ruby", PathWithNamespace: "jsmith/underscore"},
+		},
+		{name: "non-project event", body: `{"event_name":"user_create","user_id":41}`, want: GitLabSystemHookPayload{EventName: "user_create"}},
+		{name: "not json", body: `not json`, wantErr: ErrInvalidJSON},
+		{name: "missing event_name", body: `{"project_id":74}`, wantErr: ErrMissingEventName},
+		{name: "project event without id", body: `{"event_name":"project_destroy"}`, wantErr: ErrMissingProjectID},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/webhooks/p1", strings.NewReader(tc.body))
+			payload, err := parseGitLabSystemHookPayload(r)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *payload != tc.want {
+				t.Errorf("payload = %+v, want %+v", *payload, tc.want)
+			}
+		})
+	}
+}
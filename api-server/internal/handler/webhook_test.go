@@ -2,10 +2,14 @@ package handler_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 
@@ -16,24 +20,42 @@ import (
 
 // stubWebhookStore is a test double for WebhookStore.
 type stubWebhookStore struct {
-	provider                *db.ProviderRow
-	providerErr             error
-	repo                    *db.RepoRow
-	repoErr                 error
-	activeInvocationID      *string
-	activeInvocationErr     error
-	createdRunID            string
-	createRunErr            error
-	draftRunID              string
-	draftRunErr             error
-	transitionErr           error
+	provider            *db.ProviderRow
+	providerErr         error
+	repo                *db.RepoRow
+	repoErr             error
+	activeInvocationID  *string
+	activeInvocationErr error
+	createdRunID        string
+	createRunErr        error
+	draftRunID          string
+	draftRunErr         error
+	transitionErr       error
+	deliveries          map[string]bool
+	recordDeliveryErr   error
+	latestHeadSHA       string
+	latestHeadSHAErr    error
+	pipelineBlockedSHA  string
+	upsertRepoErr       error
+	softDeleteRepoErr   error
 	// tracking
+	lookupByID           string
+	lookupBySlug         string
 	createRunCalled      bool
 	createDraftRunCalled bool
 	transitionCalled     bool
+	reviewTargetLookups  int
+	upsertedRepos        []db.RepoUpsertInput
+	softDeletedRemoteIDs []string
 }
 
-func (s *stubWebhookStore) GetProvider(_ context.Context, _ string) (*db.ProviderRow, error) {
+func (s *stubWebhookStore) GetProvider(_ context.Context, id string) (*db.ProviderRow, error) {
+	s.lookupByID = id
+	return s.provider, s.providerErr
+}
+
+func (s *stubWebhookStore) GetProviderBySlug(_ context.Context, slug string) (*db.ProviderRow, error) {
+	s.lookupBySlug = slug
 	return s.provider, s.providerErr
 }
 
@@ -45,6 +67,21 @@ func (s *stubWebhookStore) GetActiveInvocationID(_ context.Context, _ string, _
 	return s.activeInvocationID, s.activeInvocationErr
 }
 
+// GetReviewTargetByRemoteID composes the granular lookups, so tests configure repo and
+// activeInvocationID as before.
+func (s *stubWebhookStore) GetReviewTargetByRemoteID(ctx context.Context, providerID, remoteID string, mrNumber int64) (*db.ReviewTargetRow, error) {
+	s.reviewTargetLookups++
+	repo, err := s.GetRepoByRemoteID(ctx, providerID, remoteID)
+	if err != nil {
+		return nil, err
+	}
+	invocationID, err := s.GetActiveInvocationID(ctx, repo.ID, mrNumber)
+	if err != nil {
+		return nil, err
+	}
+	return &db.ReviewTargetRow{RepoID: repo.ID, ReviewEnabled: repo.ReviewEnabled, ReviewDrafts: repo.ReviewDrafts, Archived: repo.Archived, RequirePipelineSuccess: repo.RequirePipelineSuccess, ActiveInvocationID: invocationID, PipelineBlockedSHA: s.pipelineBlockedSHA}, nil
+}
+
 func (s *stubWebhookStore) CreateReviewRunWithInvocation(_ context.Context, _ string, _ int64, _ string) (string, error) {
 	s.createRunCalled = true
 	return s.createdRunID, s.createRunErr
@@ -60,18 +97,52 @@ func (s *stubWebhookStore) TransitionDraftToReview(_ context.Context, _ string,
 	return s.transitionErr
 }
 
+func (s *stubWebhookStore) RecordDelivery(_ context.Context, providerID, eventUUID string) (bool, error) {
+	if s.recordDeliveryErr != nil {
+		return false, s.recordDeliveryErr
+	}
+	if s.deliveries == nil {
+		s.deliveries = make(map[string]bool)
+	}
+	key := providerID + "/" + eventUUID
+	seen := s.deliveries[key]
+	s.deliveries[key] = true
+	return seen, nil
+}
+
+func (s *stubWebhookStore) ForgetDelivery(_ context.Context, providerID, eventUUID string) error {
+	delete(s.deliveries, providerID+"/"+eventUUID)
+	return nil
+}
+
+func (s *stubWebhookStore) GetLatestReviewHeadSHA(_ context.Context, _ string, _ int64) (string, bool, error) {
+	return s.latestHeadSHA, s.latestHeadSHA != "", s.latestHeadSHAErr
+}
+
+func (s *stubWebhookStore) UpsertRepo(_ context.Context, repo db.RepoUpsertInput) error {
+	s.upsertedRepos = append(s.upsertedRepos, repo)
+	return s.upsertRepoErr
+}
+
+func (s *stubWebhookStore) SoftDeleteRepo(_ context.Context, _, remoteID string) error {
+	s.softDeletedRemoteIDs = append(s.softDeletedRemoteIDs, remoteID)
+	return s.softDeleteRepoErr
+}
+
 // stubRestateDispatcher is a test double for RestateDispatcher.
 type stubRestateDispatcher struct {
-	invocationID    string
-	sendErr         error
-	cancelErr       error
-	sendCalled      bool
-	cancelCalled    bool
-	cancelledIDs    []string
+	invocationID string
+	sendErr      error
+	cancelErr    error
+	sendCalled   bool
+	lastReq      restate.PRReviewRequest
+	cancelCalled bool
+	cancelledIDs []string
 }
 
-func (s *stubRestateDispatcher) SendPRReview(_ context.Context, _ string, _ restate.PRReviewRequest) (string, error) {
+func (s *stubRestateDispatcher) SendPRReview(_ context.Context, _ string, req restate.PRReviewRequest) (string, error) {
 	s.sendCalled = true
+	s.lastReq = req
 	return s.invocationID, s.sendErr
 }
 
@@ -96,7 +167,7 @@ func newWebhookRequest(method, path, token, body string) *http.Request {
 const validPayload = `{"object_kind":"merge_request","object_attributes":{"action":"open","iid":42,"draft":false},"project":{"id":123}}`
 
 func defaultProvider() *db.ProviderRow {
-	return &db.ProviderRow{ID: "p1", WebhookSecret: secret("mysecret")}
+	return &db.ProviderRow{ID: "p1", Type: "gitlab_self_hosted", WebhookSecret: secret("mysecret")}
 }
 
 func defaultRepo() *db.RepoRow {
@@ -175,7 +246,7 @@ func TestWebhookHandler_NonMRObjectKind(t *testing.T) {
 
 func TestWebhookHandler_ParsesMRPayload(t *testing.T) {
 	store := &stubWebhookStore{
-		provider:   &db.ProviderRow{ID: "p1", WebhookSecret: secret("s3cr3t")},
+		provider:   &db.ProviderRow{ID: "p1", Type: "gitlab_cloud", WebhookSecret: secret("s3cr3t")},
 		repo:       &db.RepoRow{ID: "r1", ProviderID: "p1", RemoteID: "99", ReviewEnabled: true},
 		draftRunID: "draft1",
 	}
@@ -228,6 +299,25 @@ func TestWebhookHandler_MROpen_ReviewDisabled_NoDispatch(t *testing.T) {
 	}
 }
 
+func TestWebhookHandler_MROpen_Archived_NoDispatch(t *testing.T) {
+	repo := defaultRepo()
+	repo.Archived = true
+	store := &stubWebhookStore{
+		provider: defaultProvider(),
+		repo:     repo,
+	}
+	disp := &stubRestateDispatcher{}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if disp.sendCalled || store.createRunCalled {
+		t.Fatal("expected no dispatch or review run for archived repo")
+	}
+}
+
 func TestWebhookHandler_MROpen_UnknownRepo_NoDispatch(t *testing.T) {
 	store := &stubWebhookStore{
 		provider: defaultProvider(),
@@ -312,6 +402,40 @@ func TestWebhookHandler_DraftMR_UpdateCreatesDBRecord(t *testing.T) {
 	}
 }
 
+func TestWebhookHandler_DraftMR_ReviewDraftsDispatches(t *testing.T) {
+	repo := defaultRepo()
+	repo.ReviewDrafts = true
+	for _, action := range []string{"open", "update"} {
+		t.Run(action, func(t *testing.T) {
+			store := &stubWebhookStore{
+				provider:     defaultProvider(),
+				repo:         repo,
+				createdRunID: "run1",
+			}
+			disp := &stubRestateDispatcher{invocationID: "inv1"}
+			h := handler.NewWebhookHandler(store, disp)
+			w := httptest.NewRecorder()
+			payload := `{"object_kind":"merge_request","object_attributes":{"action":"` + action + `","iid":42,"draft":true},"project":{"id":123}}`
+			h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", payload))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", w.Code)
+			}
+			if !disp.sendCalled {
+				t.Fatal("expected dispatch for draft MR when the repo reviews drafts")
+			}
+			if !disp.lastReq.ReviewDrafts {
+				t.Error("expected ReviewDrafts in the dispatched request")
+			}
+			if store.createDraftRunCalled {
+				t.Error("expected no draft record when the draft is reviewed")
+			}
+			if !store.createRunCalled {
+				t.Error("expected a review run to be created")
+			}
+		})
+	}
+}
+
 func TestWebhookHandler_DraftToReadyTransition_Dispatches(t *testing.T) {
 	store := &stubWebhookStore{
 		provider:     defaultProvider(),
@@ -410,6 +534,46 @@ func TestWebhookHandler_CancelsExistingBeforeDispatch(t *testing.T) {
 	}
 }
 
+func TestWebhookHandler_ReviewTargetLookedUpOnce(t *testing.T) {
+	store := &stubWebhookStore{
+		provider:           defaultProvider(),
+		repo:               defaultRepo(),
+		activeInvocationID: strPtr("inv_old"),
+		createdRunID:       "run1",
+	}
+	disp := &stubRestateDispatcher{invocationID: "inv_new"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	// Repo settings and the invocation to cancel come from one combined query.
+	if store.reviewTargetLookups != 1 {
+		t.Errorf("review target lookups = %d, want 1", store.reviewTargetLookups)
+	}
+	if len(disp.cancelledIDs) != 1 || disp.cancelledIDs[0] != "inv_old" {
+		t.Errorf("cancelled %v, want [inv_old]", disp.cancelledIDs)
+	}
+}
+
+func TestWebhookHandler_ReviewTargetLookupError(t *testing.T) {
+	store := &stubWebhookStore{
+		provider: defaultProvider(),
+		repoErr:  errors.New("connection refused"),
+	}
+	disp := &stubRestateDispatcher{invocationID: "inv_new"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	if disp.sendCalled {
+		t.Error("expected no dispatch after a failed lookup")
+	}
+}
+
 func TestWebhookHandler_CancelFails_StillDispatches(t *testing.T) {
 	existingInvID := "inv_old"
 	store := &stubWebhookStore{
@@ -432,3 +596,843 @@ func TestWebhookHandler_CancelFails_StillDispatches(t *testing.T) {
 		t.Fatal("expected SendPRReview still called after cancel error")
 	}
 }
+
+func TestWebhookHandler_DuplicateDelivery_NoDispatch(t *testing.T) {
+	store := &stubWebhookStore{
+		provider:     defaultProvider(),
+		repo:         defaultRepo(),
+		createdRunID: "run1",
+	}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+
+	first := newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload)
+	first.Header.Set("X-Gitlab-Event-UUID", "uuid-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, first)
+	if w.Code != http.StatusOK || !disp.sendCalled {
+		t.Fatalf("expected first delivery to dispatch, got code=%d sendCalled=%v", w.Code, disp.sendCalled)
+	}
+
+	disp.sendCalled = false
+	replay := newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload)
+	replay.Header.Set("X-Gitlab-Event-UUID", "uuid-1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, replay)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for replayed delivery, got %d", w.Code)
+	}
+	if disp.sendCalled {
+		t.Fatal("expected no SendPRReview for replayed delivery")
+	}
+}
+
+func TestWebhookHandler_FailedDeliveryRetried(t *testing.T) {
+	store := &stubWebhookStore{
+		provider:     defaultProvider(),
+		repo:         defaultRepo(),
+		createdRunID: "run1",
+	}
+	disp := &stubRestateDispatcher{invocationID: "inv1", sendErr: errors.New("restate down")}
+	h := handler.NewWebhookHandler(store, disp)
+
+	first := newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload)
+	first.Header.Set("X-Gitlab-Event-UUID", "uuid-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, first)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 for a failed dispatch, got %d", w.Code)
+	}
+
+	disp.sendErr = nil
+	disp.sendCalled = false
+	retry := newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload)
+	retry.Header.Set("X-Gitlab-Event-UUID", "uuid-1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, retry)
+	if w.Code != http.StatusOK || !disp.sendCalled {
+		t.Fatalf("expected the redelivery to dispatch, got code=%d sendCalled=%v", w.Code, disp.sendCalled)
+	}
+}
+
+func TestWebhookHandler_DistinctDeliveries_BothDispatch(t *testing.T) {
+	store := &stubWebhookStore{
+		provider:     defaultProvider(),
+		repo:         defaultRepo(),
+		createdRunID: "run1",
+	}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+
+	for _, id := range []string{"uuid-1", "uuid-2"} {
+		disp.sendCalled = false
+		r := newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload)
+		r.Header.Set("X-Gitlab-Event-UUID", id)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if !disp.sendCalled {
+			t.Fatalf("delivery %s: expected SendPRReview to be called", id)
+		}
+	}
+}
+
+func TestWebhookHandler_RecordDeliveryError_500(t *testing.T) {
+	store := &stubWebhookStore{
+		provider:          defaultProvider(),
+		repo:              defaultRepo(),
+		recordDeliveryErr: errors.New("db down"),
+	}
+	disp := &stubRestateDispatcher{}
+	h := handler.NewWebhookHandler(store, disp)
+
+	r := newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload)
+	r.Header.Set("X-Gitlab-Event-UUID", "uuid-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	if disp.sendCalled {
+		t.Fatal("expected no dispatch when delivery cannot be recorded")
+	}
+}
+
+func TestWebhookHandler_InvalidJSON_400(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider()}
+	h := handler.NewWebhookHandler(store, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", "{not json"))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"error":"invalid json"}` {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+func TestWebhookHandler_MissingObjectKind_422(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider()}
+	disp := &stubRestateDispatcher{}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", `{"project":{"id":123}}`))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", w.Code)
+	}
+	if disp.sendCalled {
+		t.Fatal("expected no dispatch for invalid payload")
+	}
+}
+
+func TestWebhookHandler_OversizedBody_413(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider()}
+	disp := &stubRestateDispatcher{}
+	h := handler.NewWebhookHandler(store, disp)
+	h.SetMaxBodyBytes(64)
+	body := `{"object_kind":"merge_request","description":"` + strings.Repeat("x", 100) + `"}`
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", body))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", w.Code)
+	}
+	if disp.sendCalled {
+		t.Fatal("expected no dispatch for oversized payload")
+	}
+}
+
+func TestWebhookHandler_OversizedChunkedBody_413(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider()}
+	disp := &stubRestateDispatcher{}
+	h := handler.NewWebhookHandler(store, disp)
+	h.SetMaxBodyBytes(64)
+	// No declared length, so the limit is only hit while decoding.
+	r := newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", `{"object_kind":"merge_request","description":"`+strings.Repeat("x", 100)+`"}`)
+	r.ContentLength = -1
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", w.Code)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"error":"request body too large"}` {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+const reopenPayload = `{"object_kind":"merge_request","object_attributes":{"action":"reopen","iid":42,"last_commit":{"id":"abc123"}},"project":{"id":123}}`
+
+func TestWebhookHandler_ReopenUnchangedSkipsDispatch(t *testing.T) {
+	store := &stubWebhookStore{
+		provider:      defaultProvider(),
+		repo:          defaultRepo(),
+		latestHeadSHA: "abc123",
+	}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", reopenPayload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if disp.sendCalled || store.createRunCalled {
+		t.Fatal("expected no dispatch for reopen with unchanged head")
+	}
+}
+
+func TestWebhookHandler_ReopenChangedDispatches(t *testing.T) {
+	store := &stubWebhookStore{
+		provider:      defaultProvider(),
+		repo:          defaultRepo(),
+		latestHeadSHA: "old456",
+		createdRunID:  "run1",
+	}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", reopenPayload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !disp.sendCalled {
+		t.Fatal("expected dispatch for reopen with new head")
+	}
+}
+
+func TestWebhookHandler_ReopenLookupErrorDispatches(t *testing.T) {
+	store := &stubWebhookStore{
+		provider:         defaultProvider(),
+		repo:             defaultRepo(),
+		latestHeadSHAErr: errors.New("db down"),
+		createdRunID:     "run1",
+	}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", reopenPayload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !disp.sendCalled {
+		t.Fatal("expected dispatch when diff hash lookup fails")
+	}
+}
+
+func TestWebhookHandler_ProviderIgnoresUpdate(t *testing.T) {
+	prov := defaultProvider()
+	prov.TriggerEvents = []string{"open"}
+	store := &stubWebhookStore{provider: prov, repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+
+	w := httptest.NewRecorder()
+	payload := `{"object_kind":"merge_request","object_attributes":{"action":"update","iid":42},"project":{"id":123}}`
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", payload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if disp.sendCalled {
+		t.Fatal("expected no dispatch for update when provider only triggers on open")
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !disp.sendCalled {
+		t.Fatal("expected dispatch for open")
+	}
+}
+
+func TestWebhookHandler_DefaultTriggerEventsIncludeUpdate(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	payload := `{"object_kind":"merge_request","object_attributes":{"action":"update","iid":42},"project":{"id":123}}`
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", payload))
+	if !disp.sendCalled {
+		t.Fatal("expected dispatch for update with default trigger events")
+	}
+}
+
+// updatePayload is an MR update event whose MR was last changed at updatedAt.
+func updatePayload(updatedAt string) string {
+	return `{"object_kind":"merge_request","object_attributes":{"action":"update","iid":42,"updated_at":"` + updatedAt + `"},"project":{"id":123}}`
+}
+
+func TestWebhookHandler_StaleUpdateSkipped(t *testing.T) {
+	hourAgo := time.Now().Add(-time.Hour).UTC()
+	for _, updatedAt := range []string{hourAgo.Format(time.RFC3339), hourAgo.Format("2006-01-02 15:04:05 UTC")} {
+		store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+		disp := &stubRestateDispatcher{invocationID: "inv1"}
+		h := handler.NewWebhookHandler(store, disp)
+		h.SetMaxEventAge(10 * time.Minute)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", updatePayload(updatedAt)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("updated_at %q: expected 200, got %d", updatedAt, w.Code)
+		}
+		if disp.sendCalled {
+			t.Errorf("updated_at %q: expected no dispatch for a stale update", updatedAt)
+		}
+	}
+}
+
+func TestWebhookHandler_FreshUpdateDispatches(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	h.SetMaxEventAge(10 * time.Minute)
+
+	w := httptest.NewRecorder()
+	updatedAt := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", updatePayload(updatedAt)))
+	if !disp.sendCalled {
+		t.Fatal("expected dispatch for a fresh update")
+	}
+}
+
+func TestWebhookHandler_StaleUpdateDispatchesByDefault(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+
+	w := httptest.NewRecorder()
+	updatedAt := time.Now().Add(-24 * time.Hour).UTC().Format(time.RFC3339)
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", updatePayload(updatedAt)))
+	if !disp.sendCalled {
+		t.Fatal("expected dispatch with the stale event check disabled")
+	}
+}
+
+func TestWebhookHandler_AsyncAcknowledgesThenDispatches(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	h.EnableAsyncDispatch(time.Second)
+	done := make(chan struct{})
+	handler.SetAsyncDone(h, func() { close(done) })
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", w.Code)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("background dispatch did not complete")
+	}
+	if !disp.sendCalled || !store.createRunCalled {
+		t.Fatal("expected background dispatch and run creation")
+	}
+}
+
+func TestWebhookHandler_AsyncFailureStillAcknowledged(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repoErr: errors.New("db down")}
+	disp := &stubRestateDispatcher{}
+	h := handler.NewWebhookHandler(store, disp)
+	h.EnableAsyncDispatch(time.Second)
+	done := make(chan struct{})
+	handler.SetAsyncDone(h, func() { close(done) })
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", w.Code)
+	}
+	<-done
+	if disp.sendCalled {
+		t.Fatal("expected no dispatch when repo lookup fails")
+	}
+}
+
+// panickingRepoStore panics on repo lookup, to exercise recovery in background dispatch.
+type panickingRepoStore struct {
+	*stubWebhookStore
+}
+
+func (s panickingRepoStore) GetReviewTargetByRemoteID(context.Context, string, string, int64) (*db.ReviewTargetRow, error) {
+	panic("boom")
+}
+
+func TestWebhookHandler_AsyncPanicRecoveredAndDrained(t *testing.T) {
+	store := panickingRepoStore{&stubWebhookStore{provider: defaultProvider()}}
+	h := handler.NewWebhookHandler(store, &stubRestateDispatcher{})
+	h.EnableAsyncDispatch(time.Second)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", w.Code)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown did not drain the panicked event: %v", err)
+	}
+}
+
+func TestWebhookHandler_AsyncStillRejectsBadToken(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider()}
+	h := handler.NewWebhookHandler(store, nil)
+	h.EnableAsyncDispatch(time.Second)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "wrongtoken", validPayload))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+}
+
+// remoteIDStore records the remote ID the handler looked the repo up with.
+type remoteIDStore struct {
+	stubWebhookStore
+	gotRemoteID string
+}
+
+func (s *remoteIDStore) GetReviewTargetByRemoteID(ctx context.Context, providerID, remoteID string, mrNumber int64) (*db.ReviewTargetRow, error) {
+	s.gotRemoteID = remoteID
+	return s.stubWebhookStore.GetReviewTargetByRemoteID(ctx, providerID, remoteID, mrNumber)
+}
+
+func TestWebhookHandler_GitHubRemoteIDLookup(t *testing.T) {
+	store := &remoteIDStore{stubWebhookStore: stubWebhookStore{
+		provider: &db.ProviderRow{ID: "p1", Type: "github", WebhookSecret: secret("mysecret")},
+		repo:     defaultRepo(),
+	}}
+	h := handler.NewWebhookHandler(store, nil)
+	w := httptest.NewRecorder()
+	payload := `{"object_kind":"merge_request","object_attributes":{"action":"open","iid":42},"repository":{"full_name":"octo/hello"}}`
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", payload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if store.gotRemoteID != "octo/hello" {
+		t.Errorf("looked up remote ID %q, want octo/hello", store.gotRemoteID)
+	}
+}
+
+func TestWebhookHandler_MissingRemoteID_422(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo()}
+	disp := &stubRestateDispatcher{}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	payload := `{"object_kind":"merge_request","object_attributes":{"action":"open","iid":42}}`
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", payload))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", w.Code)
+	}
+	if disp.sendCalled {
+		t.Fatal("expected no dispatch without a remote ID")
+	}
+}
+
+func notePayload(body string) string {
+	return `{"object_kind":"note","project":{"id":123},` +
+		`"object_attributes":{"id":900,"note":` + body + `,"noteable_type":"MergeRequest"},` +
+		`"merge_request":{"iid":42,"draft":true}}`
+}
+
+func TestWebhookHandler_NoteReviewCommandDispatches(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", notePayload(`"/nitai review please"`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !disp.sendCalled {
+		t.Fatal("expected dispatch for review command")
+	}
+	if store.createDraftRunCalled {
+		t.Error("review command on a draft MR should dispatch, not record a draft run")
+	}
+	if !store.createRunCalled {
+		t.Error("expected review run to be created")
+	}
+}
+
+func TestWebhookHandler_NoteWithoutCommandIgnored(t *testing.T) {
+	for _, body := range []string{`"looks good to me"`, `"/nitai reviewer"`, `"please /nitai review"`} {
+		store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo()}
+		disp := &stubRestateDispatcher{}
+		h := handler.NewWebhookHandler(store, disp)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", notePayload(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", body, w.Code)
+		}
+		if disp.sendCalled {
+			t.Errorf("%s: expected no dispatch", body)
+		}
+	}
+}
+
+func TestWebhookHandler_NoteCustomReviewCommand(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	h.SetReviewCommand("@bot review")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", notePayload(`"@bot review"`)))
+	if !disp.sendCalled {
+		t.Fatal("expected dispatch for custom review command")
+	}
+}
+
+func TestWebhookHandler_NoteReviewCommandForce(t *testing.T) {
+	tests := []struct {
+		body      string
+		wantForce bool
+	}{
+		{body: `"/nitai review --force"`, wantForce: true},
+		{body: `"/nitai review"`, wantForce: false},
+		{body: `"/nitai review\n--force is not on the command line"`, wantForce: false},
+	}
+	for _, tc := range tests {
+		store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+		disp := &stubRestateDispatcher{invocationID: "inv1"}
+		h := handler.NewWebhookHandler(store, disp)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", notePayload(tc.body)))
+		if !disp.sendCalled {
+			t.Fatalf("%s: expected dispatch", tc.body)
+		}
+		if disp.lastReq.Force != tc.wantForce {
+			t.Errorf("%s: Force = %v, want %v", tc.body, disp.lastReq.Force, tc.wantForce)
+		}
+	}
+}
+
+func TestWebhookHandler_MREventNotForced(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	h.ServeHTTP(httptest.NewRecorder(), newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload))
+	if disp.lastReq.Force {
+		t.Error("MR events must not dispatch forced reviews")
+	}
+}
+
+func TestWebhookHandler_ResolvesProviderByID(t *testing.T) {
+	const id = "3f0c2a9e-7b1d-4c55-9e3a-0d6f1b2c4a88"
+	p := defaultProvider()
+	p.ID = id
+	store := &stubWebhookStore{provider: p, repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/"+id, "mysecret", validPayload))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if store.lookupByID != id || store.lookupBySlug != "" {
+		t.Errorf("expected lookup by id, got id=%q slug=%q", store.lookupByID, store.lookupBySlug)
+	}
+}
+
+func TestWebhookHandler_ResolvesProviderBySlug(t *testing.T) {
+	p := defaultProvider()
+	p.Slug = "team-gitlab"
+	store := &stubWebhookStore{provider: p, repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/team-gitlab/", "mysecret", validPayload))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if store.lookupBySlug != "team-gitlab" || store.lookupByID != "" {
+		t.Errorf("expected lookup by slug, got id=%q slug=%q", store.lookupByID, store.lookupBySlug)
+	}
+	if !disp.sendCalled {
+		t.Error("expected dispatch for provider resolved by slug")
+	}
+}
+
+func TestWebhookHandler_CustomPathPrefix(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	h.SetPathPrefix("hooks/gitlab")
+	if got := h.PathPrefix(); got != "/hooks/gitlab/" {
+		t.Fatalf("PathPrefix() = %q, want %q", got, "/hooks/gitlab/")
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/hooks/gitlab/p1", "mysecret", validPayload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if store.lookupBySlug != "p1" {
+		t.Errorf("expected provider key p1, got %q", store.lookupBySlug)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", validPayload))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("old prefix: expected 404, got %d", w.Code)
+	}
+}
+
+// ── Configuration check ───────────────────────────────────────────────────────
+
+type webhookTestBody struct {
+	ProviderID       string            `json:"provider_id"`
+	ProviderType     string            `json:"provider_type"`
+	WebhookPath      string            `json:"webhook_path"`
+	SecretConfigured bool              `json:"secret_configured"`
+	TokenValid       bool              `json:"token_valid"`
+	ExpectedHeaders  map[string]string `json:"expected_headers"`
+}
+
+func serveWebhookTest(t *testing.T, store *stubWebhookStore, path, token string) (*httptest.ResponseRecorder, webhookTestBody, *stubRestateDispatcher) {
+	t.Helper()
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodGet, path, token, ""))
+	var body webhookTestBody
+	if w.Code != http.StatusNotFound {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decoding body %q: %v", w.Body.String(), err)
+		}
+	}
+	if strings.Contains(w.Body.String(), "mysecret") {
+		t.Errorf("response reveals the webhook secret: %s", w.Body.String())
+	}
+	if disp.sendCalled || store.createRunCalled || store.createDraftRunCalled {
+		t.Error("the configuration check must never dispatch or create runs")
+	}
+	return w, body, disp
+}
+
+func TestWebhookTest_ValidToken(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo()}
+	w, body, _ := serveWebhookTest(t, store, "/webhooks/team-gitlab/test", "mysecret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if store.lookupBySlug != "team-gitlab" {
+		t.Errorf("looked up slug %q, want team-gitlab", store.lookupBySlug)
+	}
+	if !body.SecretConfigured || !body.TokenValid || body.ProviderID != "p1" || body.ProviderType != "gitlab_self_hosted" {
+		t.Errorf("unexpected body: %+v", body)
+	}
+	if body.WebhookPath != "/webhooks/team-gitlab" {
+		t.Errorf("webhook_path = %q, want /webhooks/team-gitlab", body.WebhookPath)
+	}
+	if _, ok := body.ExpectedHeaders["X-Gitlab-Token"]; !ok {
+		t.Errorf("expected_headers missing X-Gitlab-Token: %v", body.ExpectedHeaders)
+	}
+}
+
+func TestWebhookTest_TokenMismatch(t *testing.T) {
+	for _, token := range []string{"", "wrong"} {
+		store := &stubWebhookStore{provider: defaultProvider()}
+		w, body, _ := serveWebhookTest(t, store, "/webhooks/p1/test", token)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("token %q: expected 401, got %d", token, w.Code)
+		}
+		if !body.SecretConfigured || body.TokenValid || body.ProviderID != "" {
+			t.Errorf("token %q: unexpected body: %+v", token, body)
+		}
+	}
+}
+
+func TestWebhookTest_SecretNotConfigured(t *testing.T) {
+	store := &stubWebhookStore{provider: &db.ProviderRow{ID: "p1", Type: "gitlab_self_hosted"}}
+	w, body, _ := serveWebhookTest(t, store, "/webhooks/p1/test", "anything")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if body.SecretConfigured || body.TokenValid {
+		t.Errorf("unexpected body: %+v", body)
+	}
+}
+
+func TestWebhookTest_ProviderNotFound(t *testing.T) {
+	store := &stubWebhookStore{providerErr: pgx.ErrNoRows}
+	w, _, _ := serveWebhookTest(t, store, "/webhooks/missing/test", "mysecret")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestWebhookTest_PostIsNotATest(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), providerErr: pgx.ErrNoRows}
+	disp := &stubRestateDispatcher{}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1/test", "mysecret", validPayload))
+	if w.Code != http.StatusNotFound || disp.sendCalled {
+		t.Errorf("POST to the test path: got %d, dispatched=%v; want 404 without dispatch", w.Code, disp.sendCalled)
+	}
+}
+
+func newSystemHookRequest(token, body string) *http.Request {
+	r := newWebhookRequest(http.MethodPost, "/webhooks/p1", token, body)
+	r.Header.Set("X-Gitlab-Event", "System Hook")
+	return r
+}
+
+func TestWebhookHandler_SystemHookProjectCreate_UpsertsRepo(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider()}
+	disp := &stubRestateDispatcher{}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	payload := `{"event_name":"project_create","project_id":74,"name":"StoreCloud","path_with_namespace":"jsmith/storecloud"}`
+	h.ServeHTTP(w, newSystemHookRequest("mysecret", payload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	want := []db.RepoUpsertInput{{ProviderID: "p1", RemoteID: "74", Name: "StoreCloud", FullPath: "jsmith/storecloud"}}
+	if !reflect.DeepEqual(store.upsertedRepos, want) {
+		t.Errorf("upserted = %+v, want %+v", store.upsertedRepos, want)
+	}
+	if disp.sendCalled {
+		t.Error("system hooks must not dispatch reviews")
+	}
+}
+
+func TestWebhookHandler_SystemHookProjectDestroy_SoftDeletesRepo(t *testing.T) {
+	for _, deleteErr := range []error{nil, pgx.ErrNoRows} {
+		store := &stubWebhookStore{provider: defaultProvider(), softDeleteRepoErr: deleteErr}
+		h := handler.NewWebhookHandler(store, nil)
+		w := httptest.NewRecorder()
+		payload := `{"event_name":"project_destroy","project_id":73,"name":"Ruby","path_with_namespace":"jsmith/underscore"}`
+		h.ServeHTTP(w, newSystemHookRequest("mysecret", payload))
+		// An unknown or already deleted project is not an error.
+		if w.Code != http.StatusOK {
+			t.Fatalf("deleteErr=%v: expected 200, got %d", deleteErr, w.Code)
+		}
+		if want := []string{"73"}; !reflect.DeepEqual(store.softDeletedRemoteIDs, want) {
+			t.Errorf("soft-deleted = %v, want %v", store.softDeletedRemoteIDs, want)
+		}
+	}
+}
+
+func TestWebhookHandler_SystemHookStoreError_500(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), upsertRepoErr: errors.New("db down")}
+	h := handler.NewWebhookHandler(store, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newSystemHookRequest("mysecret", `{"event_name":"project_create","project_id":74}`))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+}
+
+func TestWebhookHandler_SystemHookRequiresToken(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider()}
+	h := handler.NewWebhookHandler(store, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newSystemHookRequest("wrongtoken", `{"event_name":"project_destroy","project_id":73}`))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+	if len(store.softDeletedRemoteIDs) != 0 {
+		t.Errorf("unauthenticated hook soft-deleted %v", store.softDeletedRemoteIDs)
+	}
+}
+
+func TestWebhookHandler_SystemHookOtherEventIgnored(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider()}
+	h := handler.NewWebhookHandler(store, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newSystemHookRequest("mysecret", `{"event_name":"user_create","user_id":41}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if len(store.upsertedRepos) != 0 || len(store.softDeletedRemoteIDs) != 0 {
+		t.Errorf("unexpected repo changes: upserted %v, deleted %v", store.upsertedRepos, store.softDeletedRemoteIDs)
+	}
+}
+
+func pipelinePayload(status, mergeRequest string) string {
+	return `{"object_kind":"pipeline","project":{"id":123},` +
+		`"object_attributes":{"id":77,"status":"` + status + `","sha":"abc123"},` +
+		`"merge_request":` + mergeRequest + `}`
+}
+
+func TestWebhookHandler_PipelineSuccessRedispatchesGatedRepo(t *testing.T) {
+	repo := defaultRepo()
+	repo.RequirePipelineSuccess = true
+	// The MR's newest run was skipped by the pipeline gate at the pipeline's commit.
+	gated := func() *stubWebhookStore {
+		return &stubWebhookStore{provider: defaultProvider(), repo: repo, createdRunID: "run1", pipelineBlockedSHA: "abc123"}
+	}
+	tests := []struct {
+		name         string
+		store        *stubWebhookStore
+		payload      string
+		wantDispatch bool
+		wantDraftRun bool
+	}{
+		{name: "success on MR pipeline", store: gated(), payload: pipelinePayload("success", `{"iid":42}`), wantDispatch: true},
+		{name: "already reviewed", store: &stubWebhookStore{provider: defaultProvider(), repo: repo}, payload: pipelinePayload("success", `{"iid":42}`)},
+		{name: "gate skipped an older commit", store: &stubWebhookStore{provider: defaultProvider(), repo: repo, pipelineBlockedSHA: "old999"}, payload: pipelinePayload("success", `{"iid":42}`)},
+		{name: "draft", store: gated(), payload: pipelinePayload("success", `{"iid":42,"draft":true}`), wantDraftRun: true},
+		{name: "failed pipeline", store: gated(), payload: pipelinePayload("failed", `{"iid":42}`)},
+		{name: "branch pipeline", store: gated(), payload: pipelinePayload("success", `null`)},
+		{name: "repo without gate", store: &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo()}, payload: pipelinePayload("success", `{"iid":42}`)},
+		{name: "run in flight", store: &stubWebhookStore{provider: defaultProvider(), repo: repo, activeInvocationID: strPtr("inv_old")}, payload: pipelinePayload("success", `{"iid":42}`)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			disp := &stubRestateDispatcher{invocationID: "inv1"}
+			h := handler.NewWebhookHandler(tc.store, disp)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, newWebhookRequest(http.MethodPost, "/webhooks/p1", "mysecret", tc.payload))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", w.Code)
+			}
+			if disp.sendCalled != tc.wantDispatch {
+				t.Errorf("dispatched = %v, want %v", disp.sendCalled, tc.wantDispatch)
+			}
+			if tc.wantDispatch && disp.lastReq.MRNumber != 42 {
+				t.Errorf("dispatched MR %d, want 42", disp.lastReq.MRNumber)
+			}
+			if tc.store.createDraftRunCalled != tc.wantDraftRun {
+				t.Errorf("draft run recorded = %v, want %v", tc.store.createDraftRunCalled, tc.wantDraftRun)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_SystemHookMergeRequestDispatches(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider(), repo: defaultRepo(), createdRunID: "run1"}
+	disp := &stubRestateDispatcher{invocationID: "inv1"}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newSystemHookRequest("mysecret", validPayload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !disp.sendCalled || !store.createRunCalled {
+		t.Error("expected a system hook merge request event to dispatch like a project hook one")
+	}
+}
+
+func TestWebhookHandler_SystemHookUnknownEventAcknowledged(t *testing.T) {
+	store := &stubWebhookStore{provider: defaultProvider()}
+	disp := &stubRestateDispatcher{}
+	h := handler.NewWebhookHandler(store, disp)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newSystemHookRequest("mysecret", `{"object_kind":"push","ref":"refs/heads/main"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if disp.sendCalled {
+		t.Error("unknown system events must not dispatch")
+	}
+}
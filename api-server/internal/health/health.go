@@ -0,0 +1,68 @@
+// Package health implements the readiness probe for the API server.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// CheckFunc reports whether a dependency is usable. It must honor ctx cancellation.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker runs a fixed set of dependency checks and serves the result as a readiness probe.
+type Checker struct {
+	timeout time.Duration
+	checks  []check
+}
+
+// New creates a Checker that gives each check at most timeout to complete.
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a named dependency check. Checks run in the order they were added.
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Result is the JSON body returned by ServeHTTP.
+type Result struct {
+	Status string            `json:"status"`
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// Run executes every check and returns the failures keyed by check name.
+func (c *Checker) Run(ctx context.Context) map[string]string {
+	failed := make(map[string]string)
+	for _, ch := range c.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		err := ch.fn(checkCtx)
+		cancel()
+		if err != nil {
+			failed[ch.name] = err.Error()
+		}
+	}
+	return failed
+}
+
+// ServeHTTP responds 200 {"status":"ok"} when all checks pass, or 503 with the failed
+// dependencies otherwise.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	res := Result{Status: "ok"}
+	status := http.StatusOK
+	if failed := c.Run(r.Context()); len(failed) > 0 {
+		res = Result{Status: "unavailable", Failed: failed}
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res) //nolint:errcheck
+}
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ok(context.Context) error { return nil }
+
+func TestChecker_AllHealthy(t *testing.T) {
+	c := New(time.Second)
+	c.Add("database", ok)
+	c.Add("restate", ok)
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var res Result
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if res.Status != "ok" || len(res.Failed) != 0 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestChecker_ReportsFailedDependency(t *testing.T) {
+	c := New(time.Second)
+	c.Add("database", func(context.Context) error { return errors.New("connection refused") })
+	c.Add("restate", ok)
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+	var res Result
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if res.Status != "unavailable" {
+		t.Errorf("status = %q, want unavailable", res.Status)
+	}
+	if res.Failed["database"] != "connection refused" {
+		t.Errorf("expected database failure, got %v", res.Failed)
+	}
+	if _, ok := res.Failed["restate"]; ok {
+		t.Errorf("restate should not be reported as failed: %v", res.Failed)
+	}
+}
+
+func TestChecker_TimesOutSlowCheck(t *testing.T) {
+	c := New(20 * time.Millisecond)
+	c.Add("restate", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	failed := c.Run(context.Background())
+	if time.Since(start) > time.Second {
+		t.Fatal("check was not bounded by the timeout")
+	}
+	if failed["restate"] != context.DeadlineExceeded.Error() {
+		t.Errorf("expected deadline exceeded, got %v", failed)
+	}
+}
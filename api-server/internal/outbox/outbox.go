@@ -0,0 +1,152 @@
+// Package outbox dispatches review runs recorded in review_dispatch_outbox to Restate.
+// TriggerReview commits each run with an outbox entry and dispatches it right away; the
+// poller started by main picks up whatever that missed, e.g. after a crash between the
+// commit and the send or while Restate was unreachable.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ai-reviewer/api-server/internal/db"
+	"ai-reviewer/api-server/internal/restate"
+)
+
+const (
+	// DefaultPollInterval is how often the poller looks for due entries.
+	DefaultPollInterval = 10 * time.Second
+	// Lease is how long a claimed or freshly enqueued entry stays hidden from the poller
+	// while it is being dispatched. It must comfortably exceed a SendPRReview call.
+	Lease = time.Minute
+
+	batchSize     = 20
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 5 * time.Minute
+)
+
+// Store is the outbox persistence used by Dispatcher.
+type Store interface {
+	ClaimDueDispatches(ctx context.Context, limit int, lease time.Duration) ([]db.DispatchOutboxRow, error)
+	CompleteDispatch(ctx context.Context, runID, invocationID string) error
+	FailDispatch(ctx context.Context, runID, reason string, retryAfter time.Duration) error
+}
+
+// Sender sends a PRReview invocation to Restate.
+type Sender interface {
+	SendPRReview(ctx context.Context, key string, req restate.PRReviewRequest) (string, error)
+}
+
+// PoolStore adapts *pgxpool.Pool to the Store interface.
+type PoolStore struct {
+	Pool *pgxpool.Pool
+}
+
+// ClaimDueDispatches implements Store.
+func (s *PoolStore) ClaimDueDispatches(ctx context.Context, limit int, lease time.Duration) ([]db.DispatchOutboxRow, error) {
+	return db.ClaimDueDispatches(ctx, s.Pool, limit, lease)
+}
+
+// CompleteDispatch implements Store.
+func (s *PoolStore) CompleteDispatch(ctx context.Context, runID, invocationID string) error {
+	return db.CompleteDispatch(ctx, s.Pool, runID, invocationID)
+}
+
+// FailDispatch implements Store.
+func (s *PoolStore) FailDispatch(ctx context.Context, runID, reason string, retryAfter time.Duration) error {
+	return db.FailDispatch(ctx, s.Pool, runID, reason, retryAfter)
+}
+
+// Dispatcher sends outbox entries to Restate and records the outcome.
+type Dispatcher struct {
+	store    Store
+	sender   Sender
+	interval time.Duration
+}
+
+// New creates a Dispatcher whose Run polls every interval (DefaultPollInterval when <= 0).
+func New(store Store, sender Sender, interval time.Duration) *Dispatcher {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &Dispatcher{store: store, sender: sender, interval: interval}
+}
+
+// Dispatch sends one entry to Restate. On success the invocation ID is stored and the
+// entry removed; on failure the entry is rescheduled with exponential backoff and the
+// send error returned.
+func (d *Dispatcher) Dispatch(ctx context.Context, e db.DispatchOutboxRow) (string, error) {
+	key := fmt.Sprintf("%s-%d", e.RepoID, e.MRNumber)
+	invocationID, err := d.sender.SendPRReview(ctx, key, restate.PRReviewRequest{
+		RunID:        e.RunID,
+		RepoID:       e.RepoID,
+		MRNumber:     e.MRNumber,
+		Force:        e.Force,
+		ReviewDrafts: e.ReviewDrafts,
+		SkipDebounce: e.SkipDebounce,
+	})
+	if err != nil {
+		if ferr := d.store.FailDispatch(ctx, e.RunID, err.Error(), retryDelay(e.Attempts)); ferr != nil {
+			log.Printf("outbox: recording failed dispatch of run %s: %v", e.RunID, ferr)
+		}
+		return "", fmt.Errorf("sending to restate: %w", err)
+	}
+	// If this fails the run was dispatched but stays in the outbox; it is sent again once
+	// the lease runs out. The resend carries the run ID as its idempotency key, so Restate
+	// attaches it to the first invocation rather than running the review twice.
+	if err := d.store.CompleteDispatch(ctx, e.RunID, invocationID); err != nil {
+		return invocationID, fmt.Errorf("storing invocation id: %w", err)
+	}
+	return invocationID, nil
+}
+
+// Drain dispatches all entries that are currently due and returns how many were sent.
+func (d *Dispatcher) Drain(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		entries, err := d.store.ClaimDueDispatches(ctx, batchSize, Lease)
+		if err != nil {
+			return sent, err
+		}
+		for _, e := range entries {
+			if _, err := d.Dispatch(ctx, e); err != nil {
+				log.Printf("outbox: dispatching run %s (attempt %d): %v", e.RunID, e.Attempts, err)
+				continue
+			}
+			sent++
+		}
+		if len(entries) < batchSize {
+			return sent, nil
+		}
+	}
+}
+
+// Run drains the outbox every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		if n, err := d.Drain(ctx); err != nil {
+			log.Printf("outbox: draining: %v", err)
+		} else if n > 0 {
+			log.Printf("outbox: dispatched %d pending review run(s)", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// retryDelay is the backoff before the next attempt after attempts failed ones.
+func retryDelay(attempts int) time.Duration {
+	d := minRetryDelay
+	for i := 1; i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryDelay)
+}
@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ai-reviewer/api-server/internal/db"
+	"ai-reviewer/api-server/internal/restate"
+)
+
+// memEntry is an outbox row in memStore.
+type memEntry struct {
+	row       db.DispatchOutboxRow
+	dueAt     time.Time
+	lastError string
+}
+
+// memStore mimics review_dispatch_outbox on a manual clock.
+type memStore struct {
+	now         time.Time
+	entries     map[string]*memEntry
+	invocations map[string]string
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		now:         time.Unix(1_700_000_000, 0),
+		entries:     map[string]*memEntry{},
+		invocations: map[string]string{},
+	}
+}
+
+// enqueue adds an entry the way db.EnqueueReviewRun does: hidden for Lease.
+func (s *memStore) enqueue(runID string) {
+	s.entries[runID] = &memEntry{
+		row:   db.DispatchOutboxRow{RunID: runID, RepoID: "repo-1", MRNumber: 7, Force: true},
+		dueAt: s.now.Add(Lease),
+	}
+}
+
+func (s *memStore) ClaimDueDispatches(_ context.Context, limit int, lease time.Duration) ([]db.DispatchOutboxRow, error) {
+	var due []db.DispatchOutboxRow
+	for _, e := range s.entries {
+		if len(due) == limit || e.dueAt.After(s.now) {
+			continue
+		}
+		e.row.Attempts++
+		e.dueAt = s.now.Add(lease)
+		due = append(due, e.row)
+	}
+	return due, nil
+}
+
+func (s *memStore) CompleteDispatch(_ context.Context, runID, invocationID string) error {
+	delete(s.entries, runID)
+	s.invocations[runID] = invocationID
+	return nil
+}
+
+func (s *memStore) FailDispatch(_ context.Context, runID, reason string, retryAfter time.Duration) error {
+	e := s.entries[runID]
+	e.lastError = reason
+	e.dueAt = s.now.Add(retryAfter)
+	return nil
+}
+
+// stubSender fails its first failures calls, then returns "inv-<run id>".
+type stubSender struct {
+	failures int
+	keys     []string
+	reqs     []restate.PRReviewRequest
+}
+
+func (s *stubSender) SendPRReview(_ context.Context, key string, req restate.PRReviewRequest) (string, error) {
+	s.keys = append(s.keys, key)
+	s.reqs = append(s.reqs, req)
+	if s.failures > 0 {
+		s.failures--
+		return "", errors.New("connection refused")
+	}
+	return "inv-" + req.RunID, nil
+}
+
+func TestDrain_RecoversRunLeftByCrash(t *testing.T) {
+	store := newMemStore()
+	sender := &stubSender{}
+	d := New(store, sender, 0)
+
+	// The run was committed with its outbox entry, then the process died before sending.
+	store.enqueue("run-1")
+
+	// Within the lease the entry belongs to the (dead) TriggerReview call.
+	if n, err := d.Drain(context.Background()); err != nil || n != 0 {
+		t.Fatalf("Drain within lease = %d, %v; want 0, nil", n, err)
+	}
+
+	store.now = store.now.Add(Lease)
+	n, err := d.Drain(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("Drain after lease = %d, %v; want 1, nil", n, err)
+	}
+	if got := store.invocations["run-1"]; got != "inv-run-1" {
+		t.Errorf("stored invocation id %q, want inv-run-1", got)
+	}
+	if len(store.entries) != 0 {
+		t.Errorf("outbox still has %d entries", len(store.entries))
+	}
+	if len(sender.keys) != 1 || sender.keys[0] != "repo-1-7" {
+		t.Errorf("sent keys %v, want [repo-1-7]", sender.keys)
+	}
+}
+
+func TestDispatch_FailureIsRetriedWithBackoff(t *testing.T) {
+	store := newMemStore()
+	sender := &stubSender{failures: 1}
+	d := New(store, sender, 0)
+	store.enqueue("run-1")
+
+	// The inline dispatch from TriggerReview fails: the entry stays, due after the backoff.
+	if _, err := d.Dispatch(context.Background(), db.DispatchOutboxRow{RunID: "run-1", RepoID: "repo-1", MRNumber: 7, Attempts: 1}); err == nil {
+		t.Fatal("expected the send error")
+	}
+	e := store.entries["run-1"]
+	if e == nil || e.lastError != "connection refused" || !e.dueAt.Equal(store.now.Add(minRetryDelay)) {
+		t.Fatalf("entry after failure = %+v, want last error recorded and due in %s", e, minRetryDelay)
+	}
+
+	store.now = store.now.Add(minRetryDelay)
+	if n, err := d.Drain(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Drain after backoff = %d, %v; want 1, nil", n, err)
+	}
+	if store.invocations["run-1"] != "inv-run-1" {
+		t.Errorf("run was not completed: %v", store.invocations)
+	}
+}
+
+func TestDrain_KeepsSkipDebounce(t *testing.T) {
+	store := newMemStore()
+	sender := &stubSender{}
+	d := New(store, sender, 0)
+	store.enqueue("run-1")
+	store.entries["run-1"].row.SkipDebounce = true
+
+	store.now = store.now.Add(Lease)
+	if n, err := d.Drain(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Drain after lease = %d, %v; want 1, nil", n, err)
+	}
+	if len(sender.reqs) != 1 || !sender.reqs[0].SkipDebounce || !sender.reqs[0].Force {
+		t.Errorf("sent %+v, want Force and SkipDebounce set", sender.reqs)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: 5 * time.Second},
+		{attempts: 1, want: 5 * time.Second},
+		{attempts: 2, want: 10 * time.Second},
+		{attempts: 4, want: 40 * time.Second},
+		{attempts: 20, want: maxRetryDelay},
+	}
+	for _, tc := range tests {
+		if got := retryDelay(tc.attempts); got != tc.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
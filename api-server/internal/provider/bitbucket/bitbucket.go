@@ -0,0 +1,115 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"ai-reviewer/api-server/internal/provider"
+)
+
+// DefaultBaseURL is the Bitbucket Cloud API root.
+const DefaultBaseURL = "https://api.bitbucket.org"
+
+// Client is a Bitbucket Cloud REST API 2.0 client. The api-server only needs ListRepos;
+// the worker's copy in go-services implements the full provider.GitProvider.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// New creates a Bitbucket Cloud client. baseURL is the API root (DefaultBaseURL),
+// without a trailing slash. token is either an OAuth access token, sent as a bearer
+// token, or "username:app_password", sent with basic auth.
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// bitbucketRepoPage maps a page of GET /2.0/repositories.
+type bitbucketRepoPage struct {
+	Values []struct {
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+		Links    struct {
+			Clone []struct {
+				Name string `json:"name"`
+				Href string `json:"href"`
+			} `json:"clone"`
+		} `json:"links"`
+	} `json:"values"`
+	Next string `json:"next"`
+}
+
+func checkStatus(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return provider.ErrUnauthorized
+	case http.StatusForbidden:
+		return provider.ErrForbidden
+	case http.StatusNotFound:
+		return provider.ErrNotFound
+	case http.StatusTooManyRequests:
+		return provider.ErrRateLimited
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("bitbucket: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+
+// ListRepos returns all repositories the authenticated user is a member of, following
+// the "next" page URL. RemoteID is the repo's "workspace/repo_slug" full name.
+func (c *Client) ListRepos(ctx context.Context) ([]provider.Repo, error) {
+	var repos []provider.Repo
+	next := c.baseURL + "/2.0/repositories?role=member&pagelen=100"
+
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+		if user, pass, ok := strings.Cut(c.token, ":"); ok {
+			req.SetBasicAuth(user, pass)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var page bitbucketRepoPage
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("bitbucket: decode repositories: %w", err)
+		}
+
+		for _, r := range page.Values {
+			repo := provider.Repo{RemoteID: r.FullName, Name: r.Name, FullPath: r.FullName}
+			for _, l := range r.Links.Clone {
+				if l.Name == "https" {
+					repo.HTTPURL = l.Href
+				}
+			}
+			repos = append(repos, repo)
+		}
+
+		next = page.Next
+	}
+
+	return repos, nil
+}
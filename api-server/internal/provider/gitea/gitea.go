@@ -0,0 +1,102 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"ai-reviewer/api-server/internal/provider"
+)
+
+// pageSize is the page size requested from list endpoints. Gitea caps it at the
+// instance's MAX_RESPONSE_ITEMS (50 by default).
+const pageSize = 50
+
+// Client is a Gitea REST API v1 client. The api-server only needs ListRepos; the
+// worker's copy in go-services implements the full provider.GitProvider.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// New creates a Gitea client. baseURL should be the Gitea instance root
+// (e.g. "https://gitea.example.com"), without a trailing slash.
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// giteaRepo maps a repository item from GET /api/v1/user/repos.
+type giteaRepo struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+}
+
+func checkStatus(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return provider.ErrUnauthorized
+	case http.StatusForbidden:
+		return provider.ErrForbidden
+	case http.StatusNotFound:
+		return provider.ErrNotFound
+	case http.StatusTooManyRequests:
+		return provider.ErrRateLimited
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("gitea: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+
+// ListRepos returns all repositories the authenticated user can access, paging until
+// a short page is returned. RemoteID is the repo's "owner/repo" full name.
+func (c *Client) ListRepos(ctx context.Context) ([]provider.Repo, error) {
+	var repos []provider.Repo
+
+	for page := 1; ; page++ {
+		u := fmt.Sprintf("%s/api/v1/user/repos?limit=%d&page=%d", c.baseURL, pageSize, page)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "token "+c.token)
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var items []giteaRepo
+		err = json.NewDecoder(resp.Body).Decode(&items)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("gitea: decode repos: %w", err)
+		}
+
+		for _, r := range items {
+			repos = append(repos, provider.Repo{
+				RemoteID: r.FullName,
+				Name:     r.Name,
+				FullPath: r.FullName,
+				HTTPURL:  r.CloneURL,
+			})
+		}
+
+		if len(items) < pageSize {
+			return repos, nil
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"ai-reviewer/api-server/internal/provider"
+)
+
+// DefaultBaseURL is the github.com API root.
+const DefaultBaseURL = "https://api.github.com"
+
+// pageSize is the page size requested from list endpoints (GitHub's maximum).
+const pageSize = 100
+
+// Client is a GitHub REST API client. The api-server only needs ListRepos; the worker's
+// copy in go-services implements the full provider.GitProvider and check runs.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// New creates a GitHub client. baseURL is the API root (DefaultBaseURL, or
+// "https://ghe.example.com/api/v3" for GitHub Enterprise Server).
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// githubRepo maps a repository item from GET /user/repos.
+type githubRepo struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+}
+
+func checkStatus(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return provider.ErrUnauthorized
+	case http.StatusForbidden:
+		// GitHub signals an exhausted rate limit with 403 and no remaining requests.
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			return provider.ErrRateLimited
+		}
+		return provider.ErrForbidden
+	case http.StatusNotFound:
+		return provider.ErrNotFound
+	case http.StatusTooManyRequests:
+		return provider.ErrRateLimited
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("github: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+
+// ListRepos returns all repositories the authenticated user can access, paging until
+// a short page is returned. RemoteID is the repo's "owner/repo" full name.
+func (c *Client) ListRepos(ctx context.Context) ([]provider.Repo, error) {
+	var repos []provider.Repo
+
+	for page := 1; ; page++ {
+		u := fmt.Sprintf("%s/user/repos?per_page=%d&page=%d", c.baseURL, pageSize, page)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var items []githubRepo
+		err = json.NewDecoder(resp.Body).Decode(&items)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("github: decode repos: %w", err)
+		}
+
+		for _, r := range items {
+			repos = append(repos, provider.Repo{
+				RemoteID: r.FullName,
+				Name:     r.Name,
+				FullPath: r.FullName,
+				HTTPURL:  r.CloneURL,
+			})
+		}
+
+		if len(items) < pageSize {
+			return repos, nil
+		}
+	}
+}
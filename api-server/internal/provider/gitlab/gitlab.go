@@ -4,23 +4,48 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"ai-reviewer/api-server/internal/provider"
 )
 
+// DefaultUserAgent identifies our API traffic to GitLab admins. It is a var so release
+// builds can stamp the version via -ldflags "-X".
+var DefaultUserAgent = "nitai/dev"
+
 // Client is a GitLab REST API v4 client.
 type Client struct {
 	baseURL    string
 	token      string
+	userAgent  string
+	repoScope  string
 	httpClient *http.Client
+	limiter    *RateLimiter
+	maxPages   int
+	proxy      string
 }
 
+// DefaultMaxPages caps how many pages a paginated listing follows (100 items each).
+const DefaultMaxPages = 1000
+
+// ErrPageLimit is returned when a listing still advertises a next page after the cap
+// set by WithMaxPages, e.g. a misbehaving server that always sends X-Next-Page.
+var ErrPageLimit = errors.New("gitlab: page limit exceeded")
+
+// Repo listing scopes accepted by WithRepoScope, besides "group:<id or full path>".
+const (
+	ScopeMembership = "membership"
+	ScopeAll        = "all"
+	scopeGroup      = "group:"
+)
+
 // Option configures a Client.
 type Option func(*Client)
 
@@ -31,17 +56,130 @@ func WithHTTPClient(c *http.Client) Option {
 	}
 }
 
+// WithRepoScope sets which projects ListRepos returns: ScopeMembership (the default; projects
+// the token's user is a member of), ScopeAll (every project visible to the token, i.e. the
+// whole instance for an admin token) or "group:<id>" (a group and its subgroups).
+func WithRepoScope(scope string) Option {
+	return func(cl *Client) {
+		cl.repoScope = scope
+	}
+}
+
+// ValidateRepoScope reports an error if scope is not one WithRepoScope accepts.
+// An empty scope means ScopeMembership.
+func ValidateRepoScope(scope string) error {
+	_, err := projectsURL(scope)
+	return err
+}
+
+// projectsURL returns the path and scope query of the project listing for scope,
+// ending in "?" or "&" so paging parameters can be appended.
+func projectsURL(scope string) (string, error) {
+	switch {
+	case scope == "" || scope == ScopeMembership:
+		return "/api/v4/projects?membership=true&", nil
+	case scope == ScopeAll:
+		return "/api/v4/projects?", nil
+	case strings.HasPrefix(scope, scopeGroup) && strings.TrimPrefix(scope, scopeGroup) != "":
+		group := strings.TrimPrefix(scope, scopeGroup)
+		return "/api/v4/groups/" + url.PathEscape(group) + "/projects?include_subgroups=true&", nil
+	default:
+		return "", fmt.Errorf("gitlab: invalid repo scope %q (want %q, %q or \"group:<id>\")", scope, ScopeMembership, ScopeAll)
+	}
+}
+
+// WithMaxPages overrides DefaultMaxPages for paginated listings; n <= 0 keeps the default.
+func WithMaxPages(n int) Option {
+	return func(cl *Client) {
+		if n > 0 {
+			cl.maxPages = n
+		}
+	}
+}
+
+// WithProxy routes requests through the proxy at rawURL (e.g. "http://proxy.corp:3128")
+// instead of the HTTPS_PROXY / NO_PROXY environment the default transport honours. It
+// applies on top of the client chosen by WithHTTPClient, whatever the option order. An
+// empty rawURL keeps the environment; an invalid one fails every request.
+func WithProxy(rawURL string) Option {
+	return func(cl *Client) {
+		cl.proxy = rawURL
+	}
+}
+
+// ValidateProxyURL reports an error if rawURL is not a proxy URL WithProxy accepts:
+// an http, https or socks5 URL with a host and no credentials, which would be stored and
+// listed in plain text. An empty rawURL is valid. The error never repeats rawURL.
+func ValidateProxyURL(rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+		return errors.New("gitlab: invalid proxy URL (want http, https or socks5 with a host)")
+	}
+	if u.User != nil {
+		return errors.New("gitlab: invalid proxy URL (credentials are not supported)")
+	}
+	return nil
+}
+
+type proxyKey struct {
+	base  *http.Client
+	proxy string
+}
+
+// proxyClients caches the proxied copy of each base client so clients built per call
+// share one transport and its idle connections.
+var proxyClients sync.Map // proxyKey -> *http.Client
+
+// withProxy returns a copy of base whose transport (a clone of base's, or of the default
+// transport) sends requests through proxy.
+func withProxy(base *http.Client, proxy string) *http.Client {
+	key := proxyKey{base, proxy}
+	if c, ok := proxyClients.Load(key); ok {
+		return c.(*http.Client)
+	}
+	bt, ok := base.Transport.(*http.Transport)
+	if !ok {
+		bt = http.DefaultTransport.(*http.Transport)
+	}
+	tr := bt.Clone()
+	if err := ValidateProxyURL(proxy); err != nil {
+		tr.Proxy = func(*http.Request) (*url.URL, error) { return nil, err }
+	} else {
+		u, _ := url.Parse(proxy)
+		tr.Proxy = http.ProxyURL(u)
+	}
+	hc := *base
+	hc.Transport = tr
+	c, _ := proxyClients.LoadOrStore(key, &hc)
+	return c.(*http.Client)
+}
+
+// WithUserAgent overrides the User-Agent header sent on every request.
+func WithUserAgent(ua string) Option {
+	return func(cl *Client) {
+		cl.userAgent = ua
+	}
+}
+
 // New creates a GitLab client. baseURL should be the GitLab instance root
 // (e.g. "https://gitlab.com"), without a trailing slash.
 func New(baseURL, token string, opts ...Option) *Client {
 	c := &Client{
 		baseURL:    strings.TrimRight(baseURL, "/"),
 		token:      token,
+		userAgent:  DefaultUserAgent,
 		httpClient: http.DefaultClient,
+		maxPages:   DefaultMaxPages,
 	}
 	for _, o := range opts {
 		o(c)
 	}
+	if c.proxy != "" {
+		c.httpClient = withProxy(c.httpClient, c.proxy)
+	}
 	return c
 }
 
@@ -53,6 +191,7 @@ func (c *Client) newRequest(ctx context.Context, method, rawURL string, body io.
 		return nil, err
 	}
 	req.Header.Set("PRIVATE-TOKEN", c.token)
+	req.Header.Set("User-Agent", c.userAgent)
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -60,7 +199,29 @@ func (c *Client) newRequest(ctx context.Context, method, rawURL string, body io.
 }
 
 func (c *Client) do(req *http.Request) (*http.Response, error) {
-	return c.httpClient.Do(req)
+	if c.limiter == nil {
+		return c.httpClient.Do(req)
+	}
+	if err := c.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		c.limiter.observe(resp.Header)
+	}
+	return resp, err
+}
+
+// checkPage is called before fetching page number pages (0-based) of a listing. It stops
+// the loop when ctx is done or the listing has run past c.maxPages.
+func (c *Client) checkPage(ctx context.Context, pages int, what string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pages >= c.maxPages {
+		return fmt.Errorf("%w: %s listing has more than %d pages", ErrPageLimit, what, c.maxPages)
+	}
+	return nil
 }
 
 func checkStatus(resp *http.Response) error {
@@ -86,16 +247,41 @@ func decodeJSON(resp *http.Response, v any) error {
 	return json.NewDecoder(resp.Body).Decode(v)
 }
 
+// ── CheckVersion ──────────────────────────────────────────────────────────────
+
+// CheckVersion calls GET /api/v4/version, a cheap authenticated endpoint, to confirm the
+// base URL is a reachable GitLab API and the token is accepted.
+func (c *Client) CheckVersion(ctx context.Context) error {
+	req, err := c.newRequest(ctx, http.MethodGet, c.baseURL+"/api/v4/version", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkStatus(resp)
+}
+
 // ── ListRepos ─────────────────────────────────────────────────────────────────
 
 // ListRepos returns all repositories the authenticated user is a member of,
 // following X-Next-Page pagination.
 func (c *Client) ListRepos(ctx context.Context) ([]provider.Repo, error) {
+	listURL, err := projectsURL(c.repoScope)
+	if err != nil {
+		return nil, err
+	}
+
 	var repos []provider.Repo
 	nextPage := "1"
 
-	for nextPage != "" {
-		u := fmt.Sprintf("%s/api/v4/projects?membership=true&per_page=100&page=%s", c.baseURL, url.QueryEscape(nextPage))
+	for pages := 0; nextPage != ""; pages++ {
+		if err := c.checkPage(ctx, pages, "projects"); err != nil {
+			return nil, err
+		}
+		u := fmt.Sprintf("%s%sper_page=100&page=%s", c.baseURL, listURL, url.QueryEscape(nextPage))
 		req, err := c.newRequest(ctx, http.MethodGet, u, nil)
 		if err != nil {
 			return nil, err
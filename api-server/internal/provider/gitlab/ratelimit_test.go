@@ -0,0 +1,163 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ai-reviewer/api-server/internal/provider"
+)
+
+func newTestServer(t *testing.T, routes map[string]http.HandlerFunc) (*httptest.Server, *Client) {
+	t.Helper()
+	mux := http.NewServeMux()
+	for path, h := range routes {
+		mux.HandleFunc(path, h)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c := New(srv.URL, "test-token", WithHTTPClient(srv.Client()))
+	return srv, c
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// fakeClock drives a RateLimiter: timers fire only when Advance moves past them.
+type fakeClock struct {
+	mu      sync.Mutex
+	t       time.Time
+	waiters []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.t
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	f.waiters = append(f.waiters, fakeTimer{at: f.t.Add(d), ch: ch})
+	return ch
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.t = f.t.Add(d)
+	kept := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.t) {
+			kept = append(kept, w)
+			continue
+		}
+		w.ch <- f.t
+	}
+	f.waiters = kept
+}
+
+func (f *fakeClock) pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+func TestRateLimiter_429BlocksUntilReset(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	limiter := &RateLimiter{now: clock.Now, after: clock.After}
+
+	var calls atomic.Int32
+	srv, _ := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/42/merge_requests/7": func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.Header().Set("RateLimit-Reset", strconv.FormatInt(clock.Now().Add(time.Minute).Unix(), 10))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			writeJSON(w, gitlabMR{Title: "t"})
+		},
+	})
+	// Two clients sharing one limiter, as reviews of different MRs on a host would.
+	first := New(srv.URL, "test-token", WithHTTPClient(srv.Client()), WithRateLimiter(limiter))
+	second := New(srv.URL, "test-token", WithHTTPClient(srv.Client()), WithRateLimiter(limiter))
+
+	if _, err := first.GetMRDetails(context.Background(), "42", 7); !errors.Is(err, provider.ErrRateLimited) {
+		t.Fatalf("first call: got %v, want ErrRateLimited", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := second.GetMRDetails(context.Background(), "42", 7)
+		done <- err
+	}()
+
+	// Wait for the second call to park on the limiter, then check it hasn't gone out.
+	deadline := time.Now().Add(2 * time.Second)
+	for clock.pending() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("second call never waited on the limiter")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(30 * time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("second call finished before the reset: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected 1 request before the reset, got %d", n)
+	}
+
+	clock.Advance(30 * time.Second)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("second call: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("second call still blocked after the reset")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestRateLimiter_WaitHonoursContext(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	limiter := &RateLimiter{now: clock.Now, after: clock.After}
+	limiter.observe(http.Header{"Ratelimit-Reset": {strconv.FormatInt(clock.Now().Add(time.Hour).Unix(), 10)}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestSharedRateLimiter_PerHost(t *testing.T) {
+	a := SharedRateLimiter("https://gitlab.example.com")
+	if SharedRateLimiter("https://gitlab.example.com/") != a {
+		t.Error("same host should share a limiter")
+	}
+	if SharedRateLimiter("https://other.example.com") == a {
+		t.Error("different hosts should not share a limiter")
+	}
+}
@@ -5,23 +5,74 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
+
+	"ai-reviewer/api-server/internal/crypto"
+)
+
+const (
+	// defaultMaxAttempts bounds how many times a request is sent before giving up.
+	defaultMaxAttempts = 4
+	// defaultBaseBackoff is the wait before the first retry; it doubles on each subsequent one.
+	defaultBaseBackoff = 200 * time.Millisecond
 )
 
-// Client sends fire-and-forget messages to the Restate ingress and cancels invocations via the admin API.
+// Client sends messages and preview calls to the Restate ingress and cancels invocations via the admin API.
 type Client struct {
-	baseURL    string
-	adminURL   string
-	httpClient *http.Client
+	baseURL     string
+	adminURL    string
+	httpClient  *http.Client
+	maxAttempts int
+	baseBackoff time.Duration
+	logger      *slog.Logger // nil disables request logging
+	// dispatchSecret signs PRReview/Run requests (see WithDispatchSecret); nil sends them unsigned.
+	dispatchSecret []byte
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithLogger logs each ingress/admin call made by the client (URL, request body, response
+// status and, for sends, the invocation id) to l at debug level. Off by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// WithDispatchSecret signs every PRReview/Run request with an HMAC token under secret,
+// which the worker verifies when it has the same DISPATCH_SECRET. Empty leaves them unsigned.
+func WithDispatchSecret(secret string) Option {
+	return func(c *Client) {
+		if secret != "" {
+			c.dispatchSecret = []byte(secret)
+		}
+	}
 }
 
 // New creates a new Restate client with both ingress and admin URLs.
-func New(ingressURL, adminURL string) *Client {
-	return &Client{
-		baseURL:    strings.TrimRight(ingressURL, "/"),
-		adminURL:   strings.TrimRight(adminURL, "/"),
-		httpClient: http.DefaultClient,
+func New(ingressURL, adminURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:     strings.TrimRight(ingressURL, "/"),
+		adminURL:    strings.TrimRight(adminURL, "/"),
+		httpClient:  http.DefaultClient,
+		maxAttempts: defaultMaxAttempts,
+		baseBackoff: defaultBaseBackoff,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// debug logs msg with attrs when a logger is configured.
+func (c *Client) debug(ctx context.Context, msg string, attrs ...any) {
+	if c.logger != nil {
+		c.logger.DebugContext(ctx, msg, attrs...)
 	}
 }
 
@@ -31,8 +82,33 @@ type PRReviewRequest struct {
 	RepoID   string `json:"repo_id"`
 	MRNumber int64  `json:"mr_number"`
 	Force    bool   `json:"force"`
+	// ReviewDrafts lets the run review the MR even while it is a draft.
+	ReviewDrafts bool `json:"review_drafts,omitempty"`
+	// SkipDebounce starts the run without the debounce sleep; set for manual triggers.
+	SkipDebounce bool `json:"skip_debounce,omitempty"`
+	// DispatchToken authenticates the request to the worker; set by SendPRReview.
+	DispatchToken string `json:"dispatch_token,omitempty"`
 }
 
+// claims returns the fields of req, sent to the PRReview object key, covered by its
+// dispatch token.
+func (req PRReviewRequest) claims(key string) crypto.DispatchClaims {
+	return crypto.DispatchClaims{
+		Key:          key,
+		RunID:        req.RunID,
+		RepoID:       req.RepoID,
+		MRNumber:     req.MRNumber,
+		Force:        req.Force,
+		ReviewDrafts: req.ReviewDrafts,
+		SkipDebounce: req.SkipDebounce,
+	}
+}
+
+// dispatchTokenTTL is how long a dispatch token stays valid. It covers the time a run may
+// wait in its object's queue before Run verifies it, and matches Restate's default
+// idempotency retention, within which a replayed request only reattaches to its run.
+const dispatchTokenTTL = 24 * time.Hour
+
 // sendResponse is the JSON body returned by Restate's /send endpoint.
 type sendResponse struct {
 	InvocationID string `json:"invocationId"`
@@ -40,27 +116,45 @@ type sendResponse struct {
 }
 
 // SendPRReview sends a fire-and-forget PRReview/Run message to Restate and returns the invocation ID.
+// With WithDispatchSecret the request is signed first. A request with a RunID carries it as
+// the idempotency key, so sending the same run again attaches to its first invocation
+// instead of starting another one.
 // key format: "{repo_id}-{mr_number}"
 func (c *Client) SendPRReview(ctx context.Context, key string, req PRReviewRequest) (string, error) {
+	if c.dispatchSecret != nil {
+		req.DispatchToken = crypto.SignDispatch(req.claims(key), time.Now().Add(dispatchTokenTTL), c.dispatchSecret)
+	}
 	body, err := json.Marshal(req)
 	if err != nil {
 		return "", fmt.Errorf("marshaling request: %w", err)
 	}
 
 	url := fmt.Sprintf("%s/PRReview/%s/Run/send", c.baseURL, key)
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
-	if err != nil {
-		return "", fmt.Errorf("creating request: %w", err)
+	newReq := func() (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		if req.RunID != "" {
+			httpReq.Header.Set("idempotency-key", req.RunID)
+		}
+		return httpReq, nil
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	c.debug(ctx, "restate: send", "url", url, "body", string(body))
+
+	// Connection errors and 5xx from the ingress are transient; anything else (including 409) is final.
+	resp, err := c.doWithRetry(ctx, newReq, func(status int) bool { return status >= 500 })
 	if err != nil {
+		c.debug(ctx, "restate: send failed", "url", url, "error", err)
 		return "", fmt.Errorf("sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusAccepted {
+	// A repeated idempotency key is answered with 200 and the original invocation.
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		c.debug(ctx, "restate: send response", "url", url, "status", resp.StatusCode)
 		return "", fmt.Errorf("restate: unexpected status %d", resp.StatusCode)
 	}
 
@@ -68,22 +162,87 @@ func (c *Client) SendPRReview(ctx context.Context, key string, req PRReviewReque
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return "", fmt.Errorf("decoding response: %w", err)
 	}
+	c.debug(ctx, "restate: send response", "url", url, "status", resp.StatusCode, "invocation_id", result.InvocationID)
 	return result.InvocationID, nil
 }
 
+// PreviewRequest is the request body for the ReviewPreview Preview handler.
+type PreviewRequest struct {
+	RepoID   string `json:"repo_id"`
+	MRNumber int64  `json:"mr_number"`
+}
+
+// PreviewComment is one inline comment in a PreviewResponse.
+type PreviewComment struct {
+	FilePath  string `json:"file_path"`
+	LineStart int    `json:"line_start"`
+	LineEnd   int    `json:"line_end"`
+	Body      string `json:"body"`
+	Severity  string `json:"severity"`
+}
+
+// PreviewResponse is the response body of the ReviewPreview Preview handler.
+type PreviewResponse struct {
+	Summary      string           `json:"summary"`
+	Comments     []PreviewComment `json:"comments"`
+	DiffTooLarge bool             `json:"diff_too_large"`
+	// SkipReason is set, with nothing else, when a review run would skip the MR (merged or
+	// closed, outside the target branch patterns, blocked by its pipeline).
+	SkipReason string `json:"skip_reason,omitempty"`
+}
+
+// PreviewReview calls ReviewPreview/Preview request-response and waits for the result. It is
+// not retried: the call runs the LLM, so the caller's deadline bounds a single attempt.
+func (c *Client) PreviewReview(ctx context.Context, req PreviewRequest) (*PreviewResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/ReviewPreview/Preview", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	c.debug(ctx, "restate: preview", "url", httpReq.URL.String(), "body", string(body))
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		c.debug(ctx, "restate: preview failed", "url", httpReq.URL.String(), "error", err)
+		return nil, fmt.Errorf("preview request: %w", err)
+	}
+	defer resp.Body.Close()
+	c.debug(ctx, "restate: preview response", "url", httpReq.URL.String(), "status", resp.StatusCode)
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("restate preview: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var result PreviewResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	return &result, nil
+}
+
 // CancelInvocation cancels a Restate invocation by ID. 404 (already completed) is silently ignored.
 func (c *Client) CancelInvocation(ctx context.Context, invocationID string) error {
 	url := fmt.Sprintf("%s/invocations/%s/cancel", c.adminURL, invocationID)
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPatch, url, nil)
-	if err != nil {
-		return fmt.Errorf("creating cancel request: %w", err)
+	newReq := func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPatch, url, nil)
 	}
 
-	resp, err := c.httpClient.Do(httpReq)
+	c.debug(ctx, "restate: cancel", "url", url)
+
+	// Only connection errors are retried; any HTTP response is taken as the answer.
+	resp, err := c.doWithRetry(ctx, newReq, func(int) bool { return false })
 	if err != nil {
+		c.debug(ctx, "restate: cancel failed", "url", url, "error", err)
 		return fmt.Errorf("cancel request: %w", err)
 	}
 	defer resp.Body.Close()
+	c.debug(ctx, "restate: cancel response", "url", url, "status", resp.StatusCode)
 
 	if resp.StatusCode == http.StatusNotFound {
 		return nil // already completed, ignore
@@ -93,3 +252,54 @@ func (c *Client) CancelInvocation(ctx context.Context, invocationID string) erro
 	}
 	return nil
 }
+
+// doWithRetry sends the request built by newReq, retrying with exponential backoff on
+// connection errors and on responses for which retryStatus returns true. It gives up
+// after maxAttempts or when ctx is done. On a retryable final response, that response
+// is returned so the caller can report its status.
+func (c *Client) doWithRetry(ctx context.Context, newReq func() (*http.Request, error), retryStatus func(int) bool) (*http.Response, error) {
+	backoff := c.baseBackoff
+	for attempt := 1; ; attempt++ {
+		httpReq, err := newReq()
+		if err != nil {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+
+		resp, err := c.httpClient.Do(httpReq)
+		if err == nil && !retryStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if ctx.Err() != nil || attempt >= c.maxAttempts {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Health checks that the Restate ingress is reachable and reports healthy. It is not retried.
+func (c *Client) Health(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/restate/health", nil)
+	if err != nil {
+		return fmt.Errorf("creating health request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("health request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("restate health: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
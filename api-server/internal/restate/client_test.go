@@ -0,0 +1,291 @@
+package restate
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ai-reviewer/api-server/internal/crypto"
+)
+
+// newTestClient returns a Client pointed at srv with retries that don't slow tests down.
+func newTestClient(srv *httptest.Server) *Client {
+	c := New(srv.URL, srv.URL)
+	c.baseBackoff = time.Millisecond
+	return c
+}
+
+func TestSendPRReview_RetriesOn503(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"invocationId":"inv_123","status":"Accepted"}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	id, err := newTestClient(srv).SendPRReview(context.Background(), "r1-1", PRReviewRequest{RepoID: "r1", MRNumber: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "inv_123" {
+		t.Errorf("invocation id = %q, want inv_123", id)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 calls, got %d", got)
+	}
+}
+
+func TestSendPRReview_GivesUpAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	if _, err := newTestClient(srv).SendPRReview(context.Background(), "r1-1", PRReviewRequest{}); err == nil {
+		t.Fatal("expected error after exhausting retries")
+	}
+	if got := calls.Load(); got != defaultMaxAttempts {
+		t.Errorf("expected %d calls, got %d", defaultMaxAttempts, got)
+	}
+}
+
+func TestSendPRReview_ConflictNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer srv.Close()
+
+	if _, err := newTestClient(srv).SendPRReview(context.Background(), "r1-1", PRReviewRequest{}); err == nil {
+		t.Fatal("expected error for 409")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 call, got %d", got)
+	}
+}
+
+func TestSendPRReview_HonorsContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv)
+	c.baseBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.SendPRReview(ctx, "r1-1", PRReviewRequest{}); err == nil {
+		t.Fatal("expected error when context expires during backoff")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("retry loop ignored context cancellation (took %s)", elapsed)
+	}
+}
+
+func TestCancelInvocation_5xxNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if err := newTestClient(srv).CancelInvocation(context.Background(), "inv_1"); err == nil {
+		t.Fatal("expected error for 503")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 call, got %d", got)
+	}
+}
+
+func TestCancelInvocation_RetriesConnectionError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	c := newTestClient(srv)
+	srv.Close() // every attempt fails to connect
+
+	if err := c.CancelInvocation(context.Background(), "inv_1"); err == nil {
+		t.Fatal("expected connection error")
+	}
+}
+
+func TestHealth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/restate/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	if err := newTestClient(srv).Health(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPreviewReview(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ReviewPreview/Preview" {
+			t.Errorf("path = %q, want /ReviewPreview/Preview", r.URL.Path)
+		}
+		w.Write([]byte(`{"summary":"LGTM","comments":[{"file_path":"a.go","line_start":3,"line_end":4,"body":"nil","severity":"blocker"}],"diff_too_large":false}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	got, err := newTestClient(srv).PreviewReview(context.Background(), PreviewRequest{RepoID: "r1", MRNumber: 7})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Summary != "LGTM" || len(got.Comments) != 1 || got.Comments[0].LineEnd != 4 || got.Comments[0].Severity != "blocker" {
+		t.Errorf("unexpected response: %+v", got)
+	}
+}
+
+func TestPreviewReview_ErrorStatusNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, `{"message":"repo not found"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	if _, err := newTestClient(srv).PreviewReview(context.Background(), PreviewRequest{RepoID: "r1", MRNumber: 7}); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 call, got %d", got)
+	}
+}
+
+// captureHandler is a slog.Handler that keeps every record's message and attributes.
+type captureHandler struct {
+	mu      sync.Mutex
+	records []map[string]any
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *captureHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	rec := map[string]any{"msg": r.Message, "level": r.Level}
+	r.Attrs(func(a slog.Attr) bool {
+		rec[a.Key] = a.Value.Any()
+		return true
+	})
+	h.mu.Lock()
+	h.records = append(h.records, rec)
+	h.mu.Unlock()
+	return nil
+}
+
+func TestSendPRReview_LogsRequestAndResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"invocationId":"inv_42","status":"Accepted"}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	capture := &captureHandler{}
+	c := New(srv.URL, srv.URL, WithLogger(slog.New(capture)))
+	if _, err := c.SendPRReview(context.Background(), "r1-7", PRReviewRequest{RepoID: "r1", MRNumber: 7}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(capture.records) != 2 {
+		t.Fatalf("expected 2 log records, got %d: %v", len(capture.records), capture.records)
+	}
+	req, resp := capture.records[0], capture.records[1]
+	wantURL := srv.URL + "/PRReview/r1-7/Run/send"
+	if req["url"] != wantURL || req["body"] != `{"run_id":"","repo_id":"r1","mr_number":7,"force":false}` {
+		t.Errorf("unexpected request record: %v", req)
+	}
+	if resp["url"] != wantURL || resp["status"] != int64(http.StatusAccepted) || resp["invocation_id"] != "inv_42" {
+		t.Errorf("unexpected response record: %v", resp)
+	}
+	for _, r := range capture.records {
+		if r["level"] != slog.LevelDebug {
+			t.Errorf("expected debug level, got %v", r["level"])
+		}
+	}
+}
+
+func TestSendPRReview_SignsWithDispatchSecret(t *testing.T) {
+	var got PRReviewRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got) //nolint:errcheck
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"invocationId":"inv_1","status":"Accepted"}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	req := PRReviewRequest{RunID: "run1", RepoID: "r1", MRNumber: 7, Force: true}
+	if _, err := New(srv.URL, srv.URL, WithDispatchSecret("s3cret")).SendPRReview(context.Background(), "r1-7", req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v := crypto.DispatchVerifier{Secrets: [][]byte{[]byte("s3cret")}}
+	if err := v.Verify(got.claims("r1-7"), got.DispatchToken, time.Now()); err != nil {
+		t.Errorf("sent token %q does not verify: %v", got.DispatchToken, err)
+	}
+	if err := v.Verify(got.claims("r1-8"), got.DispatchToken, time.Now()); err == nil {
+		t.Errorf("sent token %q verifies for another object key", got.DispatchToken)
+	}
+	if err := v.Verify(got.claims("r1-7"), got.DispatchToken, time.Now().Add(dispatchTokenTTL+time.Minute)); err == nil {
+		t.Errorf("sent token %q does not expire", got.DispatchToken)
+	}
+
+	// Without a secret requests go out unsigned.
+	got = PRReviewRequest{}
+	if _, err := New(srv.URL, srv.URL, WithDispatchSecret("")).SendPRReview(context.Background(), "r1-7", req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.DispatchToken != "" {
+		t.Errorf("unsigned request carries token %q", got.DispatchToken)
+	}
+}
+
+func TestSendPRReview_RunIDIsIdempotencyKey(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("idempotency-key"))
+		// Restate answers a repeated key with 200 and the original invocation.
+		if len(keys) > 1 {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"invocationId":"inv_1","status":"PreviouslyAccepted"}`)) //nolint:errcheck
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"invocationId":"inv_1","status":"Accepted"}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.URL)
+	req := PRReviewRequest{RunID: "run1", RepoID: "r1", MRNumber: 7, Force: true}
+	for i := 0; i < 2; i++ {
+		id, err := c.SendPRReview(context.Background(), "r1-7", req)
+		if err != nil {
+			t.Fatalf("send %d: unexpected error: %v", i+1, err)
+		}
+		if id != "inv_1" {
+			t.Errorf("send %d: invocation id = %q, want inv_1", i+1, id)
+		}
+	}
+	if len(keys) != 2 || keys[0] != "run1" || keys[1] != "run1" {
+		t.Errorf("idempotency keys = %q, want run1 on both sends", keys)
+	}
+}
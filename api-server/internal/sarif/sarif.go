@@ -0,0 +1,170 @@
+// Package sarif renders review findings as SARIF 2.1.0 logs for security dashboards.
+package sarif
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// Version is the SARIF specification version produced by Render.
+	Version = "2.1.0"
+	// SchemaURI is the JSON schema for Version.
+	SchemaURI = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	toolName    = "ai-reviewer"
+	defaultRule = "ai-review"
+)
+
+// Finding is a single review comment to export.
+type Finding struct {
+	FilePath  string
+	LineStart int
+	LineEnd   int
+	Body      string
+	Severity  string // e.g. "blocker", "warning", "nit"; empty maps to warning
+	Category  string // used as the SARIF rule ID; empty maps to "ai-review"
+}
+
+// Log is the top-level SARIF document.
+type Log struct {
+	Schema  string `json:"$schema"`
+	Version string `json:"version"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Run is a single analysis run.
+type Run struct {
+	Tool              Tool           `json:"tool"`
+	AutomationDetails *RunAutomation `json:"automationDetails,omitempty"`
+	Results           []Result       `json:"results"`
+}
+
+// RunAutomation identifies the run that produced the results.
+type RunAutomation struct {
+	ID string `json:"id"`
+}
+
+// Tool describes the analysis tool.
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Driver is the tool component that produced the results.
+type Driver struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Rule is a reporting descriptor referenced by results.
+type Rule struct {
+	ID string `json:"id"`
+}
+
+// Result is a single finding.
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	Level     string     `json:"level"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+}
+
+// Message is the human-readable text of a result.
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Location points a result at a file region.
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+// PhysicalLocation is a file plus an optional region.
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+// ArtifactLocation is a repository-relative file URI.
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// Region is a 1-based line range.
+type Region struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+// Build converts findings for a review run into a SARIF log.
+func Build(runID string, findings []Finding) *Log {
+	run := Run{
+		Tool:    Tool{Driver: Driver{Name: toolName}},
+		Results: make([]Result, 0, len(findings)),
+	}
+	if runID != "" {
+		run.AutomationDetails = &RunAutomation{ID: runID}
+	}
+
+	rules := make(map[string]bool)
+	for _, f := range findings {
+		ruleID := f.Category
+		if ruleID == "" {
+			ruleID = defaultRule
+		}
+		rules[ruleID] = true
+
+		loc := Location{PhysicalLocation: PhysicalLocation{
+			ArtifactLocation: ArtifactLocation{URI: f.FilePath},
+		}}
+		// SARIF lines are 1-based; omit the region rather than emit an invalid one.
+		if f.LineStart > 0 {
+			region := &Region{StartLine: f.LineStart}
+			if f.LineEnd > f.LineStart {
+				region.EndLine = f.LineEnd
+			}
+			loc.PhysicalLocation.Region = region
+		}
+
+		run.Results = append(run.Results, Result{
+			RuleID:    ruleID,
+			Level:     level(f.Severity),
+			Message:   Message{Text: f.Body},
+			Locations: []Location{loc},
+		})
+	}
+
+	ids := make([]string, 0, len(rules))
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, Rule{ID: id})
+	}
+
+	return &Log{Schema: SchemaURI, Version: Version, Runs: []Run{run}}
+}
+
+// Render builds the SARIF log for a review run and encodes it as indented JSON.
+func Render(runID string, findings []Finding) ([]byte, error) {
+	b, err := json.MarshalIndent(Build(runID, findings), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("sarif: encoding log: %w", err)
+	}
+	return b, nil
+}
+
+// level maps a review severity onto a SARIF result level.
+func level(severity string) string {
+	switch strings.ToLower(severity) {
+	case "blocker", "critical", "high", "error":
+		return "error"
+	case "nit", "low", "info", "note":
+		return "note"
+	default:
+		return "warning"
+	}
+}
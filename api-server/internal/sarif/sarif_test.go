@@ -0,0 +1,126 @@
+package sarif
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func sampleFindings() []Finding {
+	return []Finding{
+		{FilePath: "cmd/main.go", LineStart: 10, LineEnd: 12, Body: "SQL built from user input", Severity: "high", Category: "security"},
+		{FilePath: "internal/x.go", LineStart: 5, LineEnd: 5, Body: "Unused variable"},
+		{FilePath: "README.md", Body: "Typo", Severity: "low", Category: "style"},
+	}
+}
+
+// TestRender_Schema checks the rendered document against the required SARIF 2.1.0 structure.
+func TestRender_Schema(t *testing.T) {
+	b, err := Render("run1", sampleFindings())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if doc["version"] != "2.1.0" {
+		t.Errorf("version = %v, want 2.1.0", doc["version"])
+	}
+	if doc["$schema"] != SchemaURI {
+		t.Errorf("$schema = %v, want %s", doc["$schema"], SchemaURI)
+	}
+
+	runs, ok := doc["runs"].([]any)
+	if !ok || len(runs) != 1 {
+		t.Fatalf("expected exactly one run, got %v", doc["runs"])
+	}
+	run := runs[0].(map[string]any)
+	driver := run["tool"].(map[string]any)["driver"].(map[string]any)
+	if driver["name"] != toolName {
+		t.Errorf("driver.name = %v, want %s", driver["name"], toolName)
+	}
+
+	ruleIDs := make(map[string]bool)
+	for _, r := range driver["rules"].([]any) {
+		ruleIDs[r.(map[string]any)["id"].(string)] = true
+	}
+
+	results := run["results"].([]any)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	validLevels := map[string]bool{"none": true, "note": true, "warning": true, "error": true}
+	for i, raw := range results {
+		res := raw.(map[string]any)
+		ruleID, _ := res["ruleId"].(string)
+		if !ruleIDs[ruleID] {
+			t.Errorf("result %d: ruleId %q not declared in driver.rules", i, ruleID)
+		}
+		if !validLevels[res["level"].(string)] {
+			t.Errorf("result %d: invalid level %v", i, res["level"])
+		}
+		if res["message"].(map[string]any)["text"] == "" {
+			t.Errorf("result %d: empty message text", i)
+		}
+		loc := res["locations"].([]any)[0].(map[string]any)["physicalLocation"].(map[string]any)
+		if loc["artifactLocation"].(map[string]any)["uri"] == "" {
+			t.Errorf("result %d: empty artifact uri", i)
+		}
+		if region, ok := loc["region"].(map[string]any); ok {
+			start := region["startLine"].(float64)
+			if start < 1 {
+				t.Errorf("result %d: startLine %v must be >= 1", i, start)
+			}
+			if end, ok := region["endLine"].(float64); ok && end < start {
+				t.Errorf("result %d: endLine %v < startLine %v", i, end, start)
+			}
+		}
+	}
+}
+
+func TestBuild_LevelsAndRules(t *testing.T) {
+	log := Build("run1", sampleFindings())
+	results := log.Runs[0].Results
+
+	wantLevels := []string{"error", "warning", "note"}
+	for i, want := range wantLevels {
+		if results[i].Level != want {
+			t.Errorf("result %d: level = %s, want %s", i, results[i].Level, want)
+		}
+	}
+	if results[1].RuleID != defaultRule {
+		t.Errorf("uncategorized finding: ruleId = %s, want %s", results[1].RuleID, defaultRule)
+	}
+	if results[2].Locations[0].PhysicalLocation.Region != nil {
+		t.Error("expected no region for a finding without a line")
+	}
+	if got := len(log.Runs[0].Tool.Driver.Rules); got != 3 {
+		t.Errorf("expected 3 distinct rules, got %d", got)
+	}
+	if log.Runs[0].AutomationDetails.ID != "run1" {
+		t.Errorf("automationDetails.id = %s, want run1", log.Runs[0].AutomationDetails.ID)
+	}
+}
+
+func TestRender_Empty(t *testing.T) {
+	b, err := Render("run1", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var log Log
+	if err := json.Unmarshal(b, &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Runs[0].Results == nil {
+		t.Error("results must be an empty array, not null")
+	}
+}
+
+func TestLevel_ReviewerSeverities(t *testing.T) {
+	for sev, want := range map[string]string{"blocker": "error", "warning": "warning", "nit": "note", "": "warning"} {
+		if got := level(sev); got != want {
+			t.Errorf("level(%q) = %s, want %s", sev, got, want)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_review_comments_fingerprint;
+ALTER TABLE review_comments DROP COLUMN IF EXISTS dismissed_at;
+ALTER TABLE review_comments DROP COLUMN IF EXISTS fingerprint;
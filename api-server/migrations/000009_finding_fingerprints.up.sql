@@ -0,0 +1,10 @@
+-- Stable fingerprint for deduplicating findings across review runs of the same MR.
+ALTER TABLE review_comments ADD COLUMN IF NOT EXISTS fingerprint TEXT;
+ALTER TABLE review_comments ADD COLUMN IF NOT EXISTS dismissed_at TIMESTAMPTZ;
+
+-- Backfill existing rows; must match db.CommentFingerprint in go-services.
+UPDATE review_comments
+SET fingerprint = encode(digest(file_path || E'\n' || btrim(body, E' \t\r\n'), 'sha256'), 'hex')
+WHERE fingerprint IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_review_comments_fingerprint ON review_comments(fingerprint);
@@ -0,0 +1,7 @@
+-- Processed webhook deliveries, keyed by the provider's delivery UUID (X-Gitlab-Event-UUID).
+CREATE TABLE webhook_deliveries (
+    provider_id UUID        NOT NULL REFERENCES providers(id),
+    event_uuid  TEXT        NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (provider_id, event_uuid)
+);
@@ -0,0 +1 @@
+ALTER TABLE review_comments DROP COLUMN IF EXISTS severity;
@@ -0,0 +1,2 @@
+-- Reviewer-assigned severity ("blocker", "warning", "nit"); empty for comments created before it existed.
+ALTER TABLE review_comments ADD COLUMN IF NOT EXISTS severity TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- MR webhook actions that trigger a review; empty means the default set (open, update, reopen).
+ALTER TABLE providers ADD COLUMN IF NOT EXISTS trigger_events TEXT[] NOT NULL DEFAULT '{}';
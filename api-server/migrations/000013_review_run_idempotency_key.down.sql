@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_review_runs_idempotency_key;
+ALTER TABLE review_runs DROP COLUMN IF EXISTS idempotency_key;
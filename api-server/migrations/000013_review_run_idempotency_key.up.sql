@@ -0,0 +1,6 @@
+-- Client-supplied key that makes TriggerReview retries return the original run.
+ALTER TABLE review_runs ADD COLUMN IF NOT EXISTS idempotency_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_review_runs_idempotency_key
+    ON review_runs(repo_id, idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
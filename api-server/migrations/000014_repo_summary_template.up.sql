@@ -0,0 +1,2 @@
+-- Optional Go text/template for the posted summary note; empty posts the summary as-is.
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS summary_template TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Serves the per-repo "latest review run" lookup in ListReposByProvider.
+CREATE INDEX IF NOT EXISTS idx_review_runs_repo_created_at
+    ON review_runs(repo_id, created_at DESC);
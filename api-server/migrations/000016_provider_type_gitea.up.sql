@@ -0,0 +1 @@
+ALTER TYPE provider_type ADD VALUE IF NOT EXISTS 'gitea';
@@ -0,0 +1,3 @@
+-- Postgres cannot drop a value from an enum type; 'bitbucket_cloud' stays in provider_type.
+-- Providers of that type must be deleted before downgrading past this migration.
+SELECT 1;
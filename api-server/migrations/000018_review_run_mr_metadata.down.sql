@@ -0,0 +1,6 @@
+ALTER TABLE review_runs
+    DROP COLUMN IF EXISTS mr_title,
+    DROP COLUMN IF EXISTS mr_author,
+    DROP COLUMN IF EXISTS source_branch,
+    DROP COLUMN IF EXISTS target_branch,
+    DROP COLUMN IF EXISTS head_sha;
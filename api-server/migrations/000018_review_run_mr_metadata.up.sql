@@ -0,0 +1,8 @@
+-- Snapshot of the MR a review was based on; empty for runs created before it existed
+-- or that never got past the diff fetch.
+ALTER TABLE review_runs
+    ADD COLUMN IF NOT EXISTS mr_title      TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS mr_author     TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS source_branch TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS target_branch TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS head_sha      TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+-- Audit log of review run status transitions, written by the worker on each status change.
+CREATE TABLE review_run_events (
+    id            UUID          PRIMARY KEY DEFAULT gen_random_uuid(),
+    review_run_id UUID          NOT NULL REFERENCES review_runs(id) ON DELETE CASCADE,
+    status        review_status NOT NULL,
+    detail        TEXT          NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ   NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_review_run_events_run_id ON review_run_events(review_run_id, created_at);
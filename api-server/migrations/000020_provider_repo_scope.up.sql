@@ -0,0 +1,2 @@
+-- GitLab project listing scope for the repo sync: "membership", "all" or "group:<id>"; empty means membership.
+ALTER TABLE providers ADD COLUMN IF NOT EXISTS repo_scope TEXT NOT NULL DEFAULT '';
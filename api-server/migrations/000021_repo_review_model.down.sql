@@ -0,0 +1,3 @@
+ALTER TABLE repositories
+    DROP COLUMN IF EXISTS review_model,
+    DROP COLUMN IF EXISTS review_temperature;
@@ -0,0 +1,4 @@
+-- Per-repo Reviewer overrides; empty model / NULL temperature fall back to the Reviewer's env defaults.
+ALTER TABLE repositories
+    ADD COLUMN IF NOT EXISTS review_model       TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS review_temperature DOUBLE PRECISION;
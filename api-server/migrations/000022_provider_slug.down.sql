@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_providers_slug;
+ALTER TABLE providers DROP COLUMN IF EXISTS slug;
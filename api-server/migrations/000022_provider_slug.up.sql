@@ -0,0 +1,3 @@
+-- Human-readable webhook path key (/webhooks/<slug>); empty means the provider is only reachable by id.
+ALTER TABLE providers ADD COLUMN IF NOT EXISTS slug TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_providers_slug ON providers(slug) WHERE slug <> '' AND deleted_at IS NULL;
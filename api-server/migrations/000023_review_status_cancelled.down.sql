@@ -0,0 +1 @@
+-- PostgreSQL cannot remove enum values; no-op.
@@ -0,0 +1 @@
+ALTER TYPE review_status ADD VALUE IF NOT EXISTS 'cancelled';
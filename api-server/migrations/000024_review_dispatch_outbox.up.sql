@@ -0,0 +1,13 @@
+-- Review runs created by TriggerReview that still have to be sent to Restate. A row is
+-- written in the same transaction as its run and deleted once the invocation id is stored,
+-- so a crash between the two leaves the run for the outbox poller instead of stuck pending.
+CREATE TABLE review_dispatch_outbox (
+    review_run_id   UUID        PRIMARY KEY REFERENCES review_runs(id) ON DELETE CASCADE,
+    force           BOOLEAN     NOT NULL DEFAULT false,
+    attempts        INT         NOT NULL DEFAULT 0,
+    last_error      TEXT        NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_review_dispatch_outbox_next_attempt_at ON review_dispatch_outbox(next_attempt_at);
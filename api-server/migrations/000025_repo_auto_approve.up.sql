@@ -0,0 +1 @@
+ALTER TABLE repositories ADD COLUMN auto_approve_on_clean BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,4 @@
+ALTER TABLE providers
+    DROP COLUMN IF EXISTS tls_ca_file,
+    DROP COLUMN IF EXISTS tls_cert_file,
+    DROP COLUMN IF EXISTS tls_key_file;
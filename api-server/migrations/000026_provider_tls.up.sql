@@ -0,0 +1,5 @@
+-- PEM file paths for self-hosted GitLab behind a private CA or requiring client certificates.
+ALTER TABLE providers
+    ADD COLUMN tls_ca_file   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN tls_cert_file TEXT NOT NULL DEFAULT '',
+    ADD COLUMN tls_key_file  TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Explicit forward proxy for GitLab API requests; empty uses HTTPS_PROXY / NO_PROXY.
+ALTER TABLE providers ADD COLUMN proxy_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Provider id of the run's posted summary note, so a retried Post edits it instead of
+-- posting a duplicate. NULL until the summary is posted.
+ALTER TABLE review_runs ADD COLUMN summary_note_id TEXT;
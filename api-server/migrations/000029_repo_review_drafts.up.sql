@@ -0,0 +1 @@
+ALTER TABLE repositories ADD COLUMN review_drafts BOOLEAN NOT NULL DEFAULT false;
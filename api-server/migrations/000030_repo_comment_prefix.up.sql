@@ -0,0 +1 @@
+ALTER TABLE repositories ADD COLUMN comment_prefix TEXT NOT NULL DEFAULT '';
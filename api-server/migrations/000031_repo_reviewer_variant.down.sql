@@ -0,0 +1 @@
+ALTER TABLE repositories DROP COLUMN IF EXISTS reviewer_variant;
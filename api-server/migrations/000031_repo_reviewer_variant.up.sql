@@ -0,0 +1 @@
+ALTER TABLE repositories ADD COLUMN reviewer_variant TEXT NOT NULL DEFAULT '';
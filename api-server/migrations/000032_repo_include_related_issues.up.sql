@@ -0,0 +1 @@
+ALTER TABLE repositories ADD COLUMN include_related_issues BOOLEAN NOT NULL DEFAULT false;
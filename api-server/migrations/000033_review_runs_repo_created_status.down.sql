@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_review_runs_repo_created_status;
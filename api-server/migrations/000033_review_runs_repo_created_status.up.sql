@@ -0,0 +1,3 @@
+-- Serves ListReviewRunsFiltered: a repo's runs in a created_at range, optionally by status.
+CREATE INDEX IF NOT EXISTS idx_review_runs_repo_created_status
+    ON review_runs(repo_id, created_at, status);
@@ -0,0 +1,3 @@
+-- Set when GitLab reports the project destroyed (system hook); deleted repos are hidden
+-- and never reviewed. A later sync or project_create for the same remote_id restores it.
+ALTER TABLE repositories ADD COLUMN deleted_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+ALTER TABLE repositories ADD COLUMN post_empty_summary BOOLEAN NOT NULL DEFAULT true;
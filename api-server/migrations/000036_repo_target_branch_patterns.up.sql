@@ -0,0 +1 @@
+ALTER TABLE repositories ADD COLUMN target_branch_patterns TEXT[] NOT NULL DEFAULT '{}';
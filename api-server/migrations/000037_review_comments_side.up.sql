@@ -0,0 +1,2 @@
+-- Diff side a comment is anchored to: 'new' (added/context lines) or 'old' (deleted lines).
+ALTER TABLE review_comments ADD COLUMN side TEXT NOT NULL DEFAULT 'new' CHECK (side IN ('new', 'old'));
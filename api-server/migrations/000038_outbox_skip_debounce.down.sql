@@ -0,0 +1 @@
+ALTER TABLE review_dispatch_outbox DROP COLUMN IF EXISTS skip_debounce;
@@ -0,0 +1 @@
+ALTER TABLE review_dispatch_outbox ADD COLUMN skip_debounce BOOLEAN NOT NULL DEFAULT false;
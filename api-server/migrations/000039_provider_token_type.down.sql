@@ -0,0 +1 @@
+ALTER TABLE providers DROP COLUMN IF EXISTS token_type;
@@ -0,0 +1,4 @@
+-- Hint for how the provider token authenticates: '' (unspecified), 'personal' or, for
+-- GitLab, 'project' (a project access token scoped to a single project).
+ALTER TABLE providers ADD COLUMN token_type TEXT NOT NULL DEFAULT ''
+    CHECK (token_type IN ('', 'personal', 'project'));
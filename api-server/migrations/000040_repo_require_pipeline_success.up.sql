@@ -0,0 +1 @@
+ALTER TABLE repositories ADD COLUMN require_pipeline_success BOOLEAN NOT NULL DEFAULT false;
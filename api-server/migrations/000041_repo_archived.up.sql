@@ -0,0 +1 @@
+ALTER TABLE repositories ADD COLUMN archived BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- Nothing to undo: 'overflow' rows are never reposted, as intended for these comments.
+SELECT 1;
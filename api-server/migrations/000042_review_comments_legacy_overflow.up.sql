@@ -0,0 +1,11 @@
+-- Overflow comments (over the worker's MAX_POSTED_COMMENTS) were once stored as 'skipped',
+-- which later runs repost when the line is back in the diff. Relabel them 'overflow': they
+-- are the ones the run's summary lists as "- `file:line`" under its overflow heading
+-- (see withOverflowList in go-services).
+UPDATE review_comments c
+SET provider_comment_id = 'overflow'
+FROM review_runs r
+WHERE r.id = c.review_run_id
+  AND c.provider_comment_id = 'skipped'
+  AND r.summary LIKE '%not posted inline:**%'
+  AND strpos(r.summary, E'\n- `' || c.file_path || ':' || c.line_start || '`') > 0;
@@ -0,0 +1 @@
+ALTER TABLE repositories ADD COLUMN post_mode TEXT NOT NULL DEFAULT 'comments' CHECK (post_mode IN ('comments', 'check_run'));
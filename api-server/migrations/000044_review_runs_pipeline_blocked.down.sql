@@ -0,0 +1 @@
+ALTER TABLE review_runs DROP COLUMN IF EXISTS pipeline_blocked;
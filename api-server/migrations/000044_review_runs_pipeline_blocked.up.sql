@@ -0,0 +1 @@
+ALTER TABLE review_runs ADD COLUMN pipeline_blocked BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// drainPollInterval is how often wait re-checks the in-flight count.
+const drainPollInterval = 100 * time.Millisecond
+
+// inflight counts handler invocations in progress so shutdown can wait for them to finish.
+// http.Server.Shutdown alone is not enough: Restate's server.Start returns as soon as
+// Shutdown begins, which would let main close the DB pool under running handlers.
+type inflight struct {
+	n atomic.Int64
+}
+
+// wrap returns next with each request counted while it runs.
+func (f *inflight) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.n.Add(1)
+		defer f.n.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// count returns the number of requests currently in progress.
+func (f *inflight) count() int64 {
+	return f.n.Load()
+}
+
+// wait blocks until no requests are in progress or ctx is done, returning ctx.Err() in
+// the latter case.
+func (f *inflight) wait(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for f.count() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
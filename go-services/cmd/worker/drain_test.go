@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInflight_WaitDrains(t *testing.T) {
+	var f inflight
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := f.wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	<-started
+	if got := f.count(); got != 1 {
+		t.Fatalf("count = %d, want 1", got)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	if err := f.wait(context.Background()); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if got := f.count(); got != 0 {
+		t.Errorf("count after wait = %d, want 0", got)
+	}
+}
+
+func TestInflight_WaitTimesOut(t *testing.T) {
+	var f inflight
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	h := f.wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := f.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait error = %v, want DeadlineExceeded", err)
+	}
+	if got := f.count(); got != 1 {
+		t.Errorf("count = %d, want 1 still in flight", got)
+	}
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	restate "github.com/restatedev/sdk-go"
 	"github.com/restatedev/sdk-go/server"
@@ -36,29 +39,79 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	pool, err := db.NewPool(ctx, cfg.DatabaseURL)
+	// SIGHUP reloads review settings (env + CONFIG_FILE) without restarting.
+	cfgStore := config.NewStore(cfg)
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go cfgStore.ReloadOn(ctx, sighup)
+
+	// The pool must outlive the context: it is closed explicitly once handlers have drained.
+	pool, err := db.NewPoolWithConfig(context.Background(), cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("creating DB pool: %v", err)
 	}
-	defer pool.Close()
 
 	if err := pool.Ping(ctx); err != nil {
 		log.Fatalf("pinging DB: %v", err)
 	}
 	log.Println("connected to database")
 
-	diffFetcher := difffetcher.New(pool, encKey)
-	postReviewSvc := postreview.New(pool, encKey)
-	prReviewSvc := prreview.New(pool)
+	postreview.SetProviderConcurrency(cfg.ProviderMaxConcurrency)
+
+	diffFetcher := difffetcher.New(pool, encKey, cfgStore)
+	postReviewSvc := postreview.New(pool, encKey, cfgStore)
+	prReviewSvc := prreview.New(pool, cfgStore)
+	previewSvc := prreview.NewPreview(cfgStore)
 	repoSyncerSvc := reposyncer.New(pool, encKey)
 
-	log.Printf("starting worker on %s", cfg.WorkerAddr)
-	if err := server.NewRestate().
+	handler, err := server.NewRestate().
 		Bind(restate.Reflect(diffFetcher)).
 		Bind(restate.Reflect(postReviewSvc)).
 		Bind(restate.Reflect(prReviewSvc)).
+		Bind(restate.Reflect(previewSvc)).
 		Bind(restate.Reflect(repoSyncerSvc)).
-		Start(ctx, cfg.WorkerAddr); err != nil {
+		Handler()
+	if err != nil {
+		log.Fatalf("building handler: %v", err)
+	}
+
+	// Serve the Restate handler ourselves (as server.Start does, over h2c) so shutdown can
+	// drain in-flight invocations before the pool is closed.
+	var tracker inflight
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{
+		Addr:              cfg.WorkerAddr,
+		Handler:           tracker.wrap(handler),
+		Protocols:         &protocols,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("starting worker on %s", cfg.WorkerAddr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		pool.Close()
 		log.Fatalf("server error: %v", err)
+	case <-ctx.Done():
+	}
+
+	// Stop accepting new work, then wait for running handlers up to the shutdown timeout.
+	log.Printf("shutting down: draining %d in-flight invocation(s), timeout %s", tracker.count(), cfg.ShutdownTimeout)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if err := tracker.wait(shutdownCtx); err != nil {
+		// Restate retries the abandoned invocations from their journal on another attempt.
+		log.Printf("shutdown: timed out with %d invocation(s) still in flight", tracker.count())
+	} else {
+		log.Println("shutdown: all in-flight invocations finished")
 	}
+	pool.Close()
 }
@@ -8,6 +8,7 @@ require (
 	github.com/go-git/go-git/v5 v5.17.0
 	github.com/jackc/pgx/v5 v5.8.0
 	github.com/restatedev/sdk-go v0.23.0
+	golang.org/x/sync v0.18.0
 )
 
 require (
@@ -42,7 +43,6 @@ require (
 	go.opentelemetry.io/otel/trace v1.38.0 // indirect
 	golang.org/x/crypto v0.45.0 // indirect
 	golang.org/x/net v0.47.0 // indirect
-	golang.org/x/sync v0.18.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
 	google.golang.org/protobuf v1.36.10 // indirect
@@ -1,23 +1,316 @@
 package config
 
-import "os"
+import (
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultReviewDebounce is the debounce window used when REVIEW_DEBOUNCE is unset.
+const DefaultReviewDebounce = 3 * time.Minute
+
+// DefaultProviderMaxConcurrency is the provider call limit used when PROVIDER_MAX_CONCURRENCY is unset.
+const DefaultProviderMaxConcurrency = 8
+
+// DefaultShutdownTimeout bounds in-flight draining on shutdown when WORKER_SHUTDOWN_TIMEOUT is unset.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// DefaultReviewerTimeout bounds a single Reviewer call when REVIEWER_TIMEOUT is unset.
+const DefaultReviewerTimeout = 5 * time.Minute
+
+// DefaultFileContextMaxBytes is the per-file size cap used when FILE_CONTEXT_MAX_BYTES is unset.
+const DefaultFileContextMaxBytes = 64 << 10
+
+// DefaultMaxCommentBytes caps a posted comment body when MAX_COMMENT_BYTES is unset, just
+// under GitLab's 1,000,000 character note limit.
+const DefaultMaxCommentBytes = 999_000
+
+// DefaultPipelineWaitChecks and DefaultPipelineWaitInterval make a run wait up to ten
+// minutes for a running head pipeline when PIPELINE_WAIT_CHECKS / PIPELINE_WAIT_INTERVAL
+// are unset.
+const (
+	DefaultPipelineWaitChecks   = 5
+	DefaultPipelineWaitInterval = 2 * time.Minute
+)
+
+// DefaultMaxPostedComments caps the inline comments posted per review when MAX_POSTED_COMMENTS is unset.
+const DefaultMaxPostedComments = 25
+
+// DefaultReviewerService and DefaultReviewerHandler name the Python Reviewer's Restate
+// handler, used when REVIEWER_SERVICE / REVIEWER_HANDLER are unset.
+const (
+	DefaultReviewerService = "Reviewer"
+	DefaultReviewerHandler = "RunReview"
+)
+
+// DefaultRedactPatterns are the secrets masked when REDACT_SECRETS is on and
+// REDACT_PATTERNS is unset: well-known token formats, private key headers, credentials in
+// URLs and quoted password/secret/key literals.
+var DefaultRedactPatterns = []string{
+	`AKIA[0-9A-Z]{16}`,
+	`gh[pousr]_[A-Za-z0-9]{36,}`,
+	`glpat-[A-Za-z0-9_-]{20,}`,
+	`xox[abprs]-[A-Za-z0-9-]{10,}`,
+	`sk-[A-Za-z0-9_-]{20,}`,
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----`,
+	`[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:[^/\s@]+@`,
+	`(?i)(password|passwd|pwd|secret|api[_-]?key|access[_-]?key|auth[_-]?token)\s*[:=]+\s*["'][^"'\s]{4,}["']`,
+	`(?i)\b(password|passwd|pwd)=[^\s&"']+`,
+}
 
 // Config holds environment-variable configuration for the worker.
 type Config struct {
-	DatabaseURL   string
-	EncryptionKey string
-	WorkerAddr    string
+	DatabaseURL    string
+	EncryptionKey  string
+	WorkerAddr     string
+	ReviewDebounce time.Duration
+	// ReviewJitter, when > 0, delays each PRReview run that isn't debounced by a random
+	// duration in [0, ReviewJitter), spreading out bursts of webhooks for many MRs.
+	ReviewJitter time.Duration
+	// PostSummaryLast posts inline comments before the summary, so the summary only
+	// appears once every inline comment has been posted.
+	PostSummaryLast bool
+	// UpdateSummaryInPlace makes a re-review of an MR edit the summary note posted by the
+	// previous review instead of posting a new one (GitLab only; others post a new note).
+	UpdateSummaryInPlace bool
+	// MaxDiffTokens, when > 0, gates reviews on the estimated token count of the diff
+	// instead of the changed-line count.
+	MaxDiffTokens int
+	// DiffContextLines, when >= 0, trims each hunk of a fetched diff to at most this many
+	// context lines around its changes before review. Negative keeps the provider's context.
+	DiffContextLines int
+	// IncrementalReview makes re-reviews of an MR without Force cover only the commits since
+	// the last completed review instead of the whole MR diff.
+	IncrementalReview bool
+	// MaxPostedComments, when > 0, caps the inline comments posted per review; the rest
+	// are stored but only listed in the summary note.
+	MaxPostedComments int
+	// MaxCommentBytes, when > 0, truncates posted summary and inline comment bodies to this
+	// many bytes so the provider doesn't reject them.
+	MaxCommentBytes int
+	// PipelineWaitChecks is how many times a run of a repo that requires a successful
+	// pipeline re-checks a still-running one, PipelineWaitInterval apart, before it is
+	// skipped. 0 skips it at once. A skipped run is dispatched again when the api-server
+	// receives the MR pipeline's success event.
+	PipelineWaitChecks   int
+	PipelineWaitInterval time.Duration
+	// FileContextMaxFiles, when > 0, sends the head content of up to this many changed files
+	// to the Reviewer alongside the diff. Files over FileContextMaxBytes are left out.
+	FileContextMaxFiles int
+	FileContextMaxBytes int
+	// RedactPatterns, when non-nil, masks their matches in the diff and file contents
+	// sent to the Reviewer. Set by REDACT_SECRETS, with REDACT_PATTERNS replacing
+	// DefaultRedactPatterns.
+	RedactPatterns []*regexp.Regexp
+	// ReviewerService and ReviewerHandler name the Restate handler that runs reviews.
+	ReviewerService string
+	ReviewerHandler string
+	// ReviewerVariants maps a repo's reviewer_variant to the Reviewer service deployed for
+	// it, e.g. to A/B test review models. Parsed from REVIEWER_VARIANTS="name=Service,...".
+	ReviewerVariants map[string]string
+	// ReviewerTimeout fails a review run whose Reviewer call hasn't answered within it;
+	// 0 waits indefinitely.
+	ReviewerTimeout time.Duration
+	// DispatchSecret, when set, makes PRReview.Run reject requests whose dispatch_token
+	// isn't the api-server's HMAC signature under the same DISPATCH_SECRET.
+	DispatchSecret string
+	// DispatchSecretPrevious is also accepted while DISPATCH_SECRET is being rotated
+	// (DISPATCH_SECRET_PREVIOUS); unset it once every api-server signs with the new secret.
+	DispatchSecretPrevious string
+	// DispatchAcceptLegacy also accepts the v1/v2 tokens signed by api-servers older than
+	// the v3 format (DISPATCH_ACCEPT_LEGACY_TOKENS, default true). Turn it off once all
+	// api-servers are upgraded: legacy tokens don't expire or name the object key.
+	DispatchAcceptLegacy bool
+	// ProviderMaxConcurrency bounds concurrent provider API calls made by PostReview in this
+	// worker process. Read once at startup; not affected by SIGHUP reloads.
+	ProviderMaxConcurrency int
+	// ShutdownTimeout is how long the worker waits for in-flight invocations to finish on
+	// SIGINT/SIGTERM before closing the DB pool. Read once at startup.
+	ShutdownTimeout time.Duration
 }
 
-// Load reads configuration from environment variables.
+// Load reads configuration from environment variables. If CONFIG_FILE names a file of
+// KEY=VALUE lines, its values take precedence over the environment.
 func Load() Config {
-	addr := os.Getenv("WORKER_ADDR")
+	getenv := os.Getenv
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		overrides, err := readEnvFile(path)
+		if err != nil {
+			log.Printf("config: reading CONFIG_FILE: %v (using environment only)", err)
+		} else {
+			getenv = func(name string) string {
+				if v, ok := overrides[name]; ok {
+					return v
+				}
+				return os.Getenv(name)
+			}
+		}
+	}
+	return load(getenv)
+}
+
+func load(getenv func(string) string) Config {
+	addr := getenv("WORKER_ADDR")
 	if addr == "" {
 		addr = ":9080"
 	}
 	return Config{
-		DatabaseURL:   os.Getenv("DATABASE_URL"),
-		EncryptionKey: os.Getenv("ENCRYPTION_KEY"),
-		WorkerAddr:    addr,
+		DatabaseURL:     getenv("DATABASE_URL"),
+		EncryptionKey:   getenv("ENCRYPTION_KEY"),
+		WorkerAddr:      addr,
+		ReviewDebounce:  durationEnv(getenv, "REVIEW_DEBOUNCE", DefaultReviewDebounce),
+		ReviewJitter:    durationEnv(getenv, "REVIEW_JITTER", 0),
+		PostSummaryLast: boolEnv(getenv, "POST_SUMMARY_LAST", false),
+		MaxDiffTokens:   intEnv(getenv, "MAX_DIFF_TOKENS", 0),
+
+		DiffContextLines:       intEnv(getenv, "DIFF_CONTEXT_LINES", -1),
+		IncrementalReview:      boolEnv(getenv, "INCREMENTAL_REVIEW", false),
+		UpdateSummaryInPlace:   boolEnv(getenv, "UPDATE_SUMMARY_IN_PLACE", false),
+		MaxPostedComments:      intEnv(getenv, "MAX_POSTED_COMMENTS", DefaultMaxPostedComments),
+		MaxCommentBytes:        intEnv(getenv, "MAX_COMMENT_BYTES", DefaultMaxCommentBytes),
+		PipelineWaitChecks:     intEnv(getenv, "PIPELINE_WAIT_CHECKS", DefaultPipelineWaitChecks),
+		PipelineWaitInterval:   durationEnv(getenv, "PIPELINE_WAIT_INTERVAL", DefaultPipelineWaitInterval),
+		FileContextMaxFiles:    intEnv(getenv, "FILE_CONTEXT_MAX_FILES", 0),
+		FileContextMaxBytes:    intEnv(getenv, "FILE_CONTEXT_MAX_BYTES", DefaultFileContextMaxBytes),
+		ProviderMaxConcurrency: intEnv(getenv, "PROVIDER_MAX_CONCURRENCY", DefaultProviderMaxConcurrency),
+		RedactPatterns:         redactPatterns(getenv),
+		ShutdownTimeout:        durationEnv(getenv, "WORKER_SHUTDOWN_TIMEOUT", DefaultShutdownTimeout),
+
+		ReviewerService:  stringEnv(getenv, "REVIEWER_SERVICE", DefaultReviewerService),
+		ReviewerHandler:  stringEnv(getenv, "REVIEWER_HANDLER", DefaultReviewerHandler),
+		ReviewerVariants: mapEnv(getenv, "REVIEWER_VARIANTS"),
+		ReviewerTimeout:  durationEnv(getenv, "REVIEWER_TIMEOUT", DefaultReviewerTimeout),
+
+		DispatchSecret:         getenv("DISPATCH_SECRET"),
+		DispatchSecretPrevious: getenv("DISPATCH_SECRET_PREVIOUS"),
+		DispatchAcceptLegacy:   boolEnv(getenv, "DISPATCH_ACCEPT_LEGACY_TOKENS", true),
+	}
+}
+
+// redactPatterns compiles the secret patterns to mask when REDACT_SECRETS is on: the
+// ";"-separated REDACT_PATTERNS, or DefaultRedactPatterns when that is unset. Invalid
+// patterns are logged and skipped. nil when redaction is off.
+func redactPatterns(getenv func(string) string) []*regexp.Regexp {
+	if !boolEnv(getenv, "REDACT_SECRETS", false) {
+		return nil
+	}
+	exprs := DefaultRedactPatterns
+	if v := getenv("REDACT_PATTERNS"); v != "" {
+		exprs = strings.Split(v, ";")
+	}
+	patterns := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		if expr = strings.TrimSpace(expr); expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			log.Printf("config: invalid REDACT_PATTERNS entry %q, skipping: %v", expr, err)
+			continue
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns
+}
+
+// readEnvFile parses a dotenv-style file: KEY=VALUE per line, blank lines and
+// #-comments ignored, optional surrounding quotes stripped.
+func readEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	vals := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		vals[strings.TrimSpace(k)] = v
+	}
+	return vals, nil
+}
+
+// durationEnv parses a Go duration (e.g. "90s") from the named variable, falling back to def
+// when it is unset or invalid.
+func durationEnv(getenv func(string) string, name string, def time.Duration) time.Duration {
+	v := getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("config: invalid %s=%q, using default %s", name, v, def)
+		return def
+	}
+	return d
+}
+
+// boolEnv parses a boolean (e.g. "true", "1") from the named variable, falling back to def
+// when it is unset or invalid.
+func boolEnv(getenv func(string) string, name string, def bool) bool {
+	v := getenv(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("config: invalid %s=%q, using default %v", name, v, def)
+		return def
+	}
+	return b
+}
+
+// stringEnv returns the named variable, or def when it is unset.
+func stringEnv(getenv func(string) string, name, def string) string {
+	if v := getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// mapEnv parses comma-separated key=value pairs from the named variable. Malformed pairs
+// are logged and skipped; nil when it is unset.
+func mapEnv(getenv func(string) string, name string) map[string]string {
+	v := getenv(name)
+	if v == "" {
+		return nil
+	}
+	m := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(pair, "=")
+		k, val = strings.TrimSpace(k), strings.TrimSpace(val)
+		if !ok || k == "" || val == "" {
+			log.Printf("config: invalid %s entry %q, skipping", name, pair)
+			continue
+		}
+		m[k] = val
+	}
+	return m
+}
+
+// intEnv parses a non-negative integer from the named variable, falling back to def
+// when it is unset or invalid.
+func intEnv(getenv func(string) string, name string, def int) int {
+	v := getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("config: invalid %s=%q, using default %d", name, v, def)
+		return def
 	}
+	return n
 }
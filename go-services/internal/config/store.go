@@ -0,0 +1,52 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// Store holds the current worker configuration and allows replacing it at runtime.
+// Reads are lock-free, so services may call Get on every invocation while a reload
+// happens concurrently; each invocation sees either the old or the new Config, never a mix.
+//
+// Only review settings take effect on reload. DatabaseURL, EncryptionKey and WorkerAddr
+// are consumed once at startup.
+type Store struct {
+	cur atomic.Pointer[Config]
+}
+
+// NewStore creates a Store holding cfg.
+func NewStore(cfg Config) *Store {
+	s := &Store{}
+	s.cur.Store(&cfg)
+	return s
+}
+
+// Get returns the current configuration.
+func (s *Store) Get() Config {
+	return *s.cur.Load()
+}
+
+// Reload re-reads the configuration with Load and makes it current.
+func (s *Store) Reload() Config {
+	cfg := Load()
+	s.cur.Store(&cfg)
+	return cfg
+}
+
+// ReloadOn calls Reload each time a signal arrives on sig, until ctx is done.
+// Typically sig is registered for SIGHUP.
+func (s *Store) ReloadOn(ctx context.Context, sig <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			cfg := s.Reload()
+			log.Printf("config: reloaded (review_debounce=%s post_summary_last=%v max_diff_tokens=%d diff_context_lines=%d)",
+				cfg.ReviewDebounce, cfg.PostSummaryLast, cfg.MaxDiffTokens, cfg.DiffContextLines)
+		}
+	}
+}
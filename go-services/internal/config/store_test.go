@@ -0,0 +1,98 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStore_ReloadOnSignal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "worker.env")
+	if err := os.WriteFile(path, []byte("REVIEW_DEBOUNCE=1m\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("REVIEW_DEBOUNCE", "")
+
+	store := NewStore(Load())
+	if got := store.Get().ReviewDebounce; got != time.Minute {
+		t.Fatalf("initial ReviewDebounce = %s, want 1m", got)
+	}
+
+	if err := os.WriteFile(path, []byte("# changed\nREVIEW_DEBOUNCE=\"2m\"\nPOST_SUMMARY_LAST=true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	go store.ReloadOn(ctx, sig)
+	sig <- syscall.SIGHUP
+
+	deadline := time.Now().Add(2 * time.Second)
+	for store.Get().ReviewDebounce != 2*time.Minute {
+		if time.Now().After(deadline) {
+			t.Fatalf("ReviewDebounce = %s after reload, want 2m", store.Get().ReviewDebounce)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !store.Get().PostSummaryLast {
+		t.Error("expected PostSummaryLast=true after reload")
+	}
+}
+
+func TestLoad_ConfigFileOverridesEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "worker.env")
+	if err := os.WriteFile(path, []byte("MAX_DIFF_TOKENS=100\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("MAX_DIFF_TOKENS", "5")
+	t.Setenv("WORKER_ADDR", ":1234")
+
+	cfg := Load()
+	if cfg.MaxDiffTokens != 100 {
+		t.Errorf("MaxDiffTokens = %d, want 100 from file", cfg.MaxDiffTokens)
+	}
+	if cfg.WorkerAddr != ":1234" {
+		t.Errorf("WorkerAddr = %q, want env value", cfg.WorkerAddr)
+	}
+}
+
+func TestLoad_ReviewerVariants(t *testing.T) {
+	env := map[string]string{"REVIEWER_VARIANTS": "b=ReviewerB, c = ReviewerC,broken,=x"}
+	cfg := load(func(name string) string { return env[name] })
+
+	want := map[string]string{"b": "ReviewerB", "c": "ReviewerC"}
+	if !reflect.DeepEqual(cfg.ReviewerVariants, want) {
+		t.Errorf("ReviewerVariants = %v, want %v", cfg.ReviewerVariants, want)
+	}
+	if cfg.ReviewerService != DefaultReviewerService || cfg.ReviewerHandler != DefaultReviewerHandler {
+		t.Errorf("reviewer = %s/%s, want the defaults", cfg.ReviewerService, cfg.ReviewerHandler)
+	}
+}
+
+func TestLoad_RedactPatterns(t *testing.T) {
+	off := load(func(string) string { return "" })
+	if off.RedactPatterns != nil {
+		t.Errorf("RedactPatterns = %v without REDACT_SECRETS, want nil", off.RedactPatterns)
+	}
+
+	defaults := load(func(name string) string {
+		return map[string]string{"REDACT_SECRETS": "true"}[name]
+	})
+	if len(defaults.RedactPatterns) != len(DefaultRedactPatterns) {
+		t.Errorf("got %d default patterns, want %d", len(defaults.RedactPatterns), len(DefaultRedactPatterns))
+	}
+
+	custom := load(func(name string) string {
+		return map[string]string{"REDACT_SECRETS": "1", "REDACT_PATTERNS": `internal-[0-9]+; ([ ;`}[name]
+	})
+	if len(custom.RedactPatterns) != 1 || custom.RedactPatterns[0].String() != "internal-[0-9]+" {
+		t.Errorf("RedactPatterns = %v, want just the valid custom pattern", custom.RedactPatterns)
+	}
+}
@@ -0,0 +1,130 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var (
+	testNow     = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	testExpires = testNow.Add(time.Hour)
+)
+
+func TestDispatchToken_RoundTrip(t *testing.T) {
+	secret := []byte("shared-secret")
+	c := DispatchClaims{Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 42, ReviewDrafts: true}
+
+	token := SignDispatch(c, testExpires, secret)
+	v := DispatchVerifier{Secrets: [][]byte{secret}}
+	if err := v.Verify(c, token, testNow); err != nil {
+		t.Fatalf("Verify of a fresh token: %v", err)
+	}
+	if again := SignDispatch(c, testExpires, secret); again != token {
+		t.Errorf("SignDispatch is not deterministic: %q != %q", again, token)
+	}
+}
+
+func TestDispatchToken_Expired(t *testing.T) {
+	secret := []byte("shared-secret")
+	c := DispatchClaims{Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 42}
+	token := SignDispatch(c, testExpires, secret)
+
+	v := DispatchVerifier{Secrets: [][]byte{secret}}
+	if err := v.Verify(c, token, testExpires.Add(time.Second)); !errors.Is(err, ErrExpiredDispatchToken) {
+		t.Errorf("Verify after expiry = %v, want ErrExpiredDispatchToken", err)
+	}
+}
+
+func TestDispatchToken_PreviousSecret(t *testing.T) {
+	c := DispatchClaims{Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 42}
+	token := SignDispatch(c, testExpires, []byte("old-secret"))
+
+	rotating := DispatchVerifier{Secrets: [][]byte{[]byte("new-secret"), []byte("old-secret")}}
+	if err := rotating.Verify(c, token, testNow); err != nil {
+		t.Errorf("Verify with the previous secret still configured: %v", err)
+	}
+	rotated := DispatchVerifier{Secrets: [][]byte{[]byte("new-secret")}}
+	if err := rotated.Verify(c, token, testNow); !errors.Is(err, ErrInvalidDispatchToken) {
+		t.Errorf("Verify after the previous secret was dropped = %v, want ErrInvalidDispatchToken", err)
+	}
+}
+
+func TestDispatchToken_Legacy(t *testing.T) {
+	secret := []byte("shared-secret")
+	c := DispatchClaims{Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 42}
+	legacy := func(format string, args ...any) string {
+		return hex.EncodeToString(dispatchMAC(fmt.Appendf(nil, format, args...), secret))
+	}
+	v2 := legacy("v2\n%s\n%s\n%d\n%t\n%t\n%t", c.RunID, c.RepoID, c.MRNumber, false, false, false)
+	v1 := legacy("v1\n%s\n%s\n%d\n%t\n%t", c.RunID, c.RepoID, c.MRNumber, false, false)
+
+	transition := DispatchVerifier{Secrets: [][]byte{secret}, AcceptLegacy: true}
+	for name, token := range map[string]string{"v1": v1, "v2": v2} {
+		if err := transition.Verify(c, token, testNow); err != nil {
+			t.Errorf("%s token during the transition: %v", name, err)
+		}
+		if err := (DispatchVerifier{Secrets: [][]byte{secret}}).Verify(c, token, testNow); !errors.Is(err, ErrInvalidDispatchToken) {
+			t.Errorf("%s token after the transition = %v, want ErrInvalidDispatchToken", name, err)
+		}
+	}
+
+	// A v1 token predates skip_debounce, so it can't authorize it.
+	skip := c
+	skip.SkipDebounce = true
+	if err := transition.Verify(skip, v1, testNow); !errors.Is(err, ErrInvalidDispatchToken) {
+		t.Errorf("v1 token with skip_debounce = %v, want ErrInvalidDispatchToken", err)
+	}
+}
+
+func TestDispatchToken_Invalid(t *testing.T) {
+	secret := []byte("shared-secret")
+	c := DispatchClaims{Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 42}
+	token := SignDispatch(c, testExpires, secret)
+
+	tests := []struct {
+		name   string
+		claims DispatchClaims
+		token  string
+		secret []byte
+	}{
+		{name: "missing token", claims: c, token: "", secret: secret},
+		{name: "not hex", claims: c, token: "not-a-token", secret: secret},
+		{name: "wrong secret", claims: c, token: token, secret: []byte("other-secret")},
+		{name: "forged token", claims: c, token: SignDispatch(c, testExpires, []byte("attacker")), secret: secret},
+		{name: "truncated token", claims: c, token: token[:len(token)-2], secret: secret},
+		{name: "extended expiry", claims: c, token: "v3.9999999999." + token[len(token)-64:], secret: secret},
+		{name: "missing mac", claims: c, token: fmt.Sprintf("v3.%d", testExpires.Unix()), secret: secret},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := DispatchVerifier{Secrets: [][]byte{tc.secret}, AcceptLegacy: true}
+			if err := v.Verify(tc.claims, tc.token, testNow); !errors.Is(err, ErrInvalidDispatchToken) {
+				t.Errorf("Verify = %v, want ErrInvalidDispatchToken", err)
+			}
+		})
+	}
+}
+
+func TestDispatchToken_DetectsTampering(t *testing.T) {
+	secret := []byte("shared-secret")
+	c := DispatchClaims{Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 42}
+	token := SignDispatch(c, testExpires, secret)
+
+	v := DispatchVerifier{Secrets: [][]byte{secret}}
+	for name, tampered := range map[string]DispatchClaims{
+		"key":           {Key: "repo1-43", RunID: "run1", RepoID: "repo1", MRNumber: 42},
+		"repo_id":       {Key: "repo1-42", RunID: "run1", RepoID: "repo2", MRNumber: 42},
+		"mr_number":     {Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 43},
+		"run_id":        {Key: "repo1-42", RunID: "run2", RepoID: "repo1", MRNumber: 42},
+		"force":         {Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 42, Force: true},
+		"review_drafts": {Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 42, ReviewDrafts: true},
+		"skip_debounce": {Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 42, SkipDebounce: true},
+	} {
+		if err := v.Verify(tampered, token, testNow); !errors.Is(err, ErrInvalidDispatchToken) {
+			t.Errorf("tampered %s: Verify = %v, want ErrInvalidDispatchToken", name, err)
+		}
+	}
+}
@@ -2,16 +2,87 @@ package db
 
 import (
 	"context"
+	"expvar"
 	"fmt"
+	"os"
+	"strconv"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// NewPool creates a new pgx connection pool.
+// dbConnectionsOpened counts physical connections opened by the pool, exported via expvar.
+// A steadily climbing value means the pool is churning connections (lifetime too short or
+// MaxConns too low for the load).
+var dbConnectionsOpened = expvar.NewInt("db_connections_opened")
+
+// NewPool creates a new pgx connection pool with pgx's default sizing.
 func NewPool(ctx context.Context, databaseURL string) (*pgxpool.Pool, error) {
-	pool, err := pgxpool.New(ctx, databaseURL)
+	return newPool(ctx, databaseURL, func(string) string { return "" })
+}
+
+// NewPoolWithConfig creates a new pgx connection pool sized from the environment:
+// DB_MAX_CONNS, DB_MIN_CONNS, DB_MAX_CONN_LIFETIME and DB_HEALTH_CHECK_PERIOD.
+// Unset variables keep pgx's defaults (or the pool_* parameters of databaseURL).
+func NewPoolWithConfig(ctx context.Context, databaseURL string) (*pgxpool.Pool, error) {
+	return newPool(ctx, databaseURL, os.Getenv)
+}
+
+func newPool(ctx context.Context, databaseURL string, getenv func(string) string) (*pgxpool.Pool, error) {
+	cfg, err := parsePoolConfig(databaseURL, getenv)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("creating pool: %w", err)
 	}
 	return pool, nil
 }
+
+// parsePoolConfig parses databaseURL and applies pool sizing overrides read through getenv.
+func parsePoolConfig(databaseURL string, getenv func(string) string) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing database URL: %w", err)
+	}
+
+	if v := getenv("DB_MAX_CONNS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid DB_MAX_CONNS %q", v)
+		}
+		cfg.MaxConns = int32(n)
+	}
+	if v := getenv("DB_MIN_CONNS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid DB_MIN_CONNS %q", v)
+		}
+		cfg.MinConns = int32(n)
+	}
+	if cfg.MinConns > cfg.MaxConns {
+		return nil, fmt.Errorf("DB_MIN_CONNS (%d) exceeds DB_MAX_CONNS (%d)", cfg.MinConns, cfg.MaxConns)
+	}
+	if v := getenv("DB_MAX_CONN_LIFETIME"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid DB_MAX_CONN_LIFETIME %q", v)
+		}
+		cfg.MaxConnLifetime = d
+	}
+	if v := getenv("DB_HEALTH_CHECK_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid DB_HEALTH_CHECK_PERIOD %q", v)
+		}
+		cfg.HealthCheckPeriod = d
+	}
+
+	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		dbConnectionsOpened.Add(1)
+		return nil
+	}
+	return cfg, nil
+}
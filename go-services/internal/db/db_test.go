@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func envFunc(vals map[string]string) func(string) string {
+	return func(k string) string { return vals[k] }
+}
+
+func TestParsePoolConfig_FromEnv(t *testing.T) {
+	cfg, err := parsePoolConfig("postgres://u:p@localhost:5432/app", envFunc(map[string]string{
+		"DB_MAX_CONNS":           "20",
+		"DB_MIN_CONNS":           "2",
+		"DB_MAX_CONN_LIFETIME":   "30m",
+		"DB_HEALTH_CHECK_PERIOD": "15s",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxConns != 20 || cfg.MinConns != 2 {
+		t.Errorf("MaxConns/MinConns = %d/%d, want 20/2", cfg.MaxConns, cfg.MinConns)
+	}
+	if cfg.MaxConnLifetime != 30*time.Minute {
+		t.Errorf("MaxConnLifetime = %s, want 30m", cfg.MaxConnLifetime)
+	}
+	if cfg.HealthCheckPeriod != 15*time.Second {
+		t.Errorf("HealthCheckPeriod = %s, want 15s", cfg.HealthCheckPeriod)
+	}
+	if cfg.AfterConnect == nil {
+		t.Error("expected AfterConnect hook to be registered")
+	}
+}
+
+func TestParsePoolConfig_URLParamsKeptWhenEnvUnset(t *testing.T) {
+	cfg, err := parsePoolConfig("postgres://u:p@localhost:5432/app?pool_max_conns=7", envFunc(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxConns != 7 {
+		t.Errorf("MaxConns = %d, want 7 from URL", cfg.MaxConns)
+	}
+}
+
+func TestParsePoolConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{name: "non-numeric max", env: map[string]string{"DB_MAX_CONNS": "lots"}},
+		{name: "zero max", env: map[string]string{"DB_MAX_CONNS": "0"}},
+		{name: "min above max", env: map[string]string{"DB_MAX_CONNS": "2", "DB_MIN_CONNS": "5"}},
+		{name: "bad lifetime", env: map[string]string{"DB_MAX_CONN_LIFETIME": "forever"}},
+		{name: "bad health period", env: map[string]string{"DB_HEALTH_CHECK_PERIOD": "-1s"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parsePoolConfig("postgres://u:p@localhost:5432/app", envFunc(tc.env)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	retryBaseBackoff = 0
+	t.Cleanup(func() { retryBaseBackoff = 50 * time.Millisecond })
+
+	tests := []struct {
+		name      string
+		errs      []error // returned by successive calls; nil once exhausted
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "success", wantCalls: 1},
+		{name: "admin shutdown then success", errs: []error{&pgconn.PgError{Code: "57P01"}}, wantCalls: 2},
+		{name: "connection reset then success", errs: []error{fmt.Errorf("read: %w", syscall.ECONNRESET)}, wantCalls: 2},
+		{name: "connection exception then success", errs: []error{&pgconn.PgError{Code: "08006"}}, wantCalls: 2},
+		{name: "no rows not retried", errs: []error{pgx.ErrNoRows}, wantCalls: 1, wantErr: true},
+		{name: "unique violation not retried", errs: []error{&pgconn.PgError{Code: "23505"}}, wantCalls: 1, wantErr: true},
+		{
+			name:      "gives up after retryAttempts",
+			errs:      []error{&pgconn.PgError{Code: "57P01"}, &pgconn.PgError{Code: "57P01"}, &pgconn.PgError{Code: "57P01"}, nil},
+			wantCalls: retryAttempts,
+			wantErr:   true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			err := withRetry(context.Background(), func() error {
+				calls++
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+				return nil
+			})
+			if (err != nil) != tc.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWithRetry_StopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := withRetry(ctx, func() error {
+		calls++
+		cancel()
+		return &pgconn.PgError{Code: "57P01"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("err = %v, calls = %d, want the error after one call", err, calls)
+	}
+}
+
+// unsentError is an error pgx would raise before sending anything.
+type unsentError struct{}
+
+func (unsentError) Error() string     { return "dial failed" }
+func (unsentError) SafeToRetry() bool { return true }
+
+func TestWithWriteRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{name: "unsent retried", err: unsentError{}, wantCalls: 2},
+		{name: "connection reset not retried", err: fmt.Errorf("read: %w", syscall.ECONNRESET), wantCalls: 1},
+		{name: "connection exception not retried", err: &pgconn.PgError{Code: "08006"}, wantCalls: 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			_ = withWriteRetry(context.Background(), func() error {
+				calls++
+				if calls == 1 {
+					return tc.err
+				}
+				return nil
+			})
+			if calls != tc.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
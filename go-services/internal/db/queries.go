@@ -2,7 +2,12 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -14,14 +19,41 @@ type ProviderRow struct {
 	Type           string
 	BaseURL        string
 	TokenEncrypted []byte
+	// PEM file paths for self-hosted GitLab TLS; empty uses the system roots.
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+	// ProxyURL is an explicit forward proxy for GitLab; empty uses the environment.
+	ProxyURL string
 }
 
 // RepoRow holds repository data from the repositories table.
 type RepoRow struct {
-	ID       string
-	RemoteID string
-	Name     string
-	FullPath string
+	ID              string
+	RemoteID        string
+	Name            string
+	FullPath        string
+	SummaryTemplate string
+	// Reviewer overrides; empty / nil use the Reviewer's defaults.
+	ReviewModel       string
+	ReviewTemperature *float64
+	// AutoApproveOnClean approves MRs whose review has no blocker comments.
+	AutoApproveOnClean bool
+	// CommentPrefix is prepended once to every comment posted on the repo's MRs.
+	CommentPrefix string
+	// ReviewerVariant selects a Reviewer deployment from REVIEWER_VARIANTS; empty is the default.
+	ReviewerVariant string
+	// IncludeRelatedIssues sends the issues an MR closes to the Reviewer as context.
+	IncludeRelatedIssues bool
+	// PostEmptySummary posts the summary note of a review without comments.
+	PostEmptySummary bool
+	// TargetBranchPatterns limits reviews to MRs into matching target branches; empty is all.
+	TargetBranchPatterns []string
+	// RequirePipelineSuccess only reviews MRs whose head pipeline succeeded.
+	RequirePipelineSuccess bool
+	// PostMode is "check_run" to publish review comments as annotations on a GitHub check
+	// run instead of inline comments; otherwise "comments".
+	PostMode string
 }
 
 // ReviewCommentRow holds a review comment row from the database.
@@ -32,6 +64,10 @@ type ReviewCommentRow struct {
 	LineStart   int
 	LineEnd     int
 	Body        string
+	Severity    string
+	// Side is "old" for comments on deleted lines, whose LineStart is an old-file line;
+	// otherwise "new".
+	Side string
 }
 
 // ReviewCommentInput holds data for inserting a new review comment.
@@ -40,22 +76,29 @@ type ReviewCommentInput struct {
 	LineStart int
 	LineEnd   int
 	Body      string
+	Severity  string
+	// Overflow stores the comment as already handled ("overflow") so it is never posted inline.
+	// Unlike "skipped", it is not retried by later runs.
+	Overflow bool
+	// Side is "new" or "old" (see ReviewCommentRow.Side); empty is stored as "new".
+	Side string
 }
 
-// GetRepoWithProvider fetches a repository and its provider by repo ID.
+// GetRepoWithProvider fetches a repository and its provider by repo ID. An archived repo is
+// not found, so no review of it is fetched, posted or approved.
 func GetRepoWithProvider(ctx context.Context, pool *pgxpool.Pool, repoID string) (*RepoRow, *ProviderRow, error) {
 	const q = `
-		SELECT r.id, r.remote_id, r.name, r.full_path,
-		       p.id, p.type, p.base_url, p.token_encrypted
+		SELECT r.id, r.remote_id, r.name, r.full_path, r.summary_template, r.review_model, r.review_temperature, r.auto_approve_on_clean, r.comment_prefix, r.reviewer_variant, r.include_related_issues, r.post_empty_summary, r.target_branch_patterns, r.require_pipeline_success, r.post_mode,
+		       p.id, p.type, p.base_url, p.token_encrypted, p.tls_ca_file, p.tls_cert_file, p.tls_key_file, p.proxy_url
 		FROM repositories r
 		JOIN providers p ON p.id = r.provider_id
-		WHERE r.id = $1`
+		WHERE r.id = $1 AND NOT r.archived`
 
 	var repo RepoRow
 	var prov ProviderRow
 	err := pool.QueryRow(ctx, q, repoID).Scan(
-		&repo.ID, &repo.RemoteID, &repo.Name, &repo.FullPath,
-		&prov.ID, &prov.Type, &prov.BaseURL, &prov.TokenEncrypted,
+		&repo.ID, &repo.RemoteID, &repo.Name, &repo.FullPath, &repo.SummaryTemplate, &repo.ReviewModel, &repo.ReviewTemperature, &repo.AutoApproveOnClean, &repo.CommentPrefix, &repo.ReviewerVariant, &repo.IncludeRelatedIssues, &repo.PostEmptySummary, &repo.TargetBranchPatterns, &repo.RequirePipelineSuccess, &repo.PostMode,
+		&prov.ID, &prov.Type, &prov.BaseURL, &prov.TokenEncrypted, &prov.TLSCAFile, &prov.TLSCertFile, &prov.TLSKeyFile, &prov.ProxyURL,
 	)
 	if err != nil {
 		return nil, nil, fmt.Errorf("GetRepoWithProvider: %w", err)
@@ -63,7 +106,9 @@ func GetRepoWithProvider(ctx context.Context, pool *pgxpool.Pool, repoID string)
 	return &repo, &prov, nil
 }
 
-// CreateReviewRun inserts a new review run with status=pending and returns its ID.
+// CreateReviewRun inserts a new review run with status=pending and returns its ID. The
+// insert is only retried when it never reached the server (see withWriteRetry), so a
+// lost reply can't create the run twice.
 func CreateReviewRun(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int) (string, error) {
 	const q = `
 		INSERT INTO review_runs (repo_id, mr_number, status)
@@ -71,18 +116,62 @@ func CreateReviewRun(ctx context.Context, pool *pgxpool.Pool, repoID string, mrN
 		RETURNING id`
 
 	var id string
-	if err := pool.QueryRow(ctx, q, repoID, mrNumber).Scan(&id); err != nil {
+	err := withWriteRetry(ctx, func() error {
+		return pool.QueryRow(ctx, q, repoID, mrNumber).Scan(&id)
+	})
+	if err != nil {
 		return "", fmt.Errorf("CreateReviewRun: %w", err)
 	}
+	if err := AppendReviewRunEvent(ctx, pool, id, "pending", ""); err != nil {
+		log.Printf("db: recording pending event for run %s: %v", id, err)
+	}
 	return id, nil
 }
 
-// UpdateReviewRunStatus sets the status and updated_at of a review run.
-func UpdateReviewRunStatus(ctx context.Context, pool *pgxpool.Pool, runID, status string) error {
-	const q = `UPDATE review_runs SET status = $1, updated_at = now() WHERE id = $2`
-	if _, err := pool.Exec(ctx, q, status, runID); err != nil {
+// UpdateReviewRunStatus sets the status and updated_at of a review run and records the
+// transition in review_run_events with an optional detail (e.g. the failure reason).
+// A failed event insert is logged and does not fail the status update.
+func UpdateReviewRunStatus(ctx context.Context, pool *pgxpool.Pool, runID, status, detail string) error {
+	// A run cancelled through the API stays cancelled; the text cast keeps this working
+	// before the 'cancelled' enum value exists.
+	const q = `UPDATE review_runs SET status = $1, updated_at = now() WHERE id = $2 AND status::text <> 'cancelled'`
+	tag, err := pool.Exec(ctx, q, status, runID)
+	if err != nil {
 		return fmt.Errorf("UpdateReviewRunStatus: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+	if err := AppendReviewRunEvent(ctx, pool, runID, status, detail); err != nil {
+		log.Printf("db: recording %s event for run %s: %v", status, runID, err)
+	}
+	return nil
+}
+
+// FailPendingReviewRun marks runID failed with detail, but only while it is still pending
+// and belongs to repoID's MR mrNumber, so a rejected request can't fail someone else's run.
+func FailPendingReviewRun(ctx context.Context, pool *pgxpool.Pool, runID, repoID string, mrNumber int, detail string) error {
+	const q = `UPDATE review_runs SET status = 'failed', updated_at = now()
+		WHERE id = $1 AND repo_id = $2 AND mr_number = $3 AND status = 'pending'`
+	tag, err := pool.Exec(ctx, q, runID, repoID, mrNumber)
+	if err != nil {
+		return fmt.Errorf("FailPendingReviewRun: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+	if err := AppendReviewRunEvent(ctx, pool, runID, "failed", detail); err != nil {
+		log.Printf("db: recording failed event for run %s: %v", runID, err)
+	}
+	return nil
+}
+
+// AppendReviewRunEvent records a status transition in a review run's audit log.
+func AppendReviewRunEvent(ctx context.Context, pool *pgxpool.Pool, runID, status, detail string) error {
+	const q = `INSERT INTO review_run_events (review_run_id, status, detail) VALUES ($1, $2, $3)`
+	if _, err := pool.Exec(ctx, q, runID, status, detail); err != nil {
+		return fmt.Errorf("AppendReviewRunEvent: %w", err)
+	}
 	return nil
 }
 
@@ -95,14 +184,23 @@ func UpdateReviewRunSummary(ctx context.Context, pool *pgxpool.Pool, runID, summ
 	return nil
 }
 
+// CommentFingerprint returns a stable identifier for a finding across review runs.
+// Line numbers are excluded so that findings survive unrelated edits above them.
+// Must match the backfill expression in migration 000009_finding_fingerprints.
+func CommentFingerprint(filePath, body string) string {
+	sum := sha256.Sum256([]byte(filePath + "\n" + strings.Trim(body, " \t\r\n")))
+	return hex.EncodeToString(sum[:])
+}
+
 // InsertReviewComments bulk-inserts review comments for a run (posted=false).
 func InsertReviewComments(ctx context.Context, pool *pgxpool.Pool, runID string, comments []ReviewCommentInput) error {
 	const q = `
-		INSERT INTO review_comments (review_run_id, file_path, line_start, line_end, body, posted)
-		VALUES ($1, $2, $3, $4, $5, false)`
+		INSERT INTO review_comments (review_run_id, file_path, line_start, line_end, body, severity, posted, provider_comment_id, fingerprint, side)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $7 THEN 'overflow' END, $8, COALESCE(NULLIF($9, ''), 'new'))`
 
 	for _, c := range comments {
-		if _, err := pool.Exec(ctx, q, runID, c.FilePath, c.LineStart, c.LineEnd, c.Body); err != nil {
+		fp := CommentFingerprint(c.FilePath, c.Body)
+		if _, err := pool.Exec(ctx, q, runID, c.FilePath, c.LineStart, c.LineEnd, c.Body, c.Severity, c.Overflow, fp, c.Side); err != nil {
 			return fmt.Errorf("InsertReviewComments: %w", err)
 		}
 	}
@@ -112,7 +210,7 @@ func InsertReviewComments(ctx context.Context, pool *pgxpool.Pool, runID string,
 // GetUnpostedComments returns all comments for a run where posted=false, ordered by created_at.
 func GetUnpostedComments(ctx context.Context, pool *pgxpool.Pool, runID string) ([]ReviewCommentRow, error) {
 	const q = `
-		SELECT id, review_run_id, file_path, line_start, line_end, body
+		SELECT id, review_run_id, file_path, line_start, line_end, body, severity, side
 		FROM review_comments
 		WHERE review_run_id = $1 AND posted = false
 		ORDER BY created_at`
@@ -126,7 +224,7 @@ func GetUnpostedComments(ctx context.Context, pool *pgxpool.Pool, runID string)
 	var comments []ReviewCommentRow
 	for rows.Next() {
 		var c ReviewCommentRow
-		if err := rows.Scan(&c.ID, &c.ReviewRunID, &c.FilePath, &c.LineStart, &c.LineEnd, &c.Body); err != nil {
+		if err := rows.Scan(&c.ID, &c.ReviewRunID, &c.FilePath, &c.LineStart, &c.LineEnd, &c.Body, &c.Severity, &c.Side); err != nil {
 			return nil, fmt.Errorf("GetUnpostedComments scan: %w", err)
 		}
 		comments = append(comments, c)
@@ -143,6 +241,145 @@ func MarkCommentPosted(ctx context.Context, pool *pgxpool.Pool, commentID, provi
 	return nil
 }
 
+// GetSummaryNoteID returns the provider note id of a run's posted summary, or "" if the
+// summary has not been posted yet.
+func GetSummaryNoteID(ctx context.Context, pool *pgxpool.Pool, runID string) (string, error) {
+	const q = `SELECT COALESCE(summary_note_id, '') FROM review_runs WHERE id = $1`
+	var id string
+	if err := pool.QueryRow(ctx, q, runID).Scan(&id); err != nil {
+		return "", fmt.Errorf("GetSummaryNoteID: %w", err)
+	}
+	return id, nil
+}
+
+// GetSkippedComments returns the comments of an MR's runs that were skipped because their
+// position was outside the diff, so a later run can post them if the line is back. Findings
+// dismissed or already posted on the MR by any run are excluded, and each finding is
+// returned once, from its latest run.
+func GetSkippedComments(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int) ([]ReviewCommentRow, error) {
+	const q = `
+		SELECT DISTINCT ON (c.fingerprint) c.id, c.review_run_id, c.file_path, c.line_start, c.line_end, c.body, c.severity, c.side
+		FROM review_comments c
+		JOIN review_runs r ON r.id = c.review_run_id
+		WHERE r.repo_id = $1 AND r.mr_number = $2
+		  AND c.provider_comment_id = 'skipped' AND c.dismissed_at IS NULL
+		  AND NOT EXISTS (
+		      SELECT 1 FROM review_comments p
+		      JOIN review_runs pr ON pr.id = p.review_run_id
+		      WHERE pr.repo_id = $1 AND pr.mr_number = $2 AND p.fingerprint = c.fingerprint
+		        AND p.posted AND p.provider_comment_id NOT IN ('skipped', 'overflow', 'superseded'))
+		ORDER BY c.fingerprint, c.created_at DESC`
+
+	rows, err := pool.Query(ctx, q, repoID, mrNumber)
+	if err != nil {
+		return nil, fmt.Errorf("GetSkippedComments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []ReviewCommentRow
+	for rows.Next() {
+		var c ReviewCommentRow
+		if err := rows.Scan(&c.ID, &c.ReviewRunID, &c.FilePath, &c.LineStart, &c.LineEnd, &c.Body, &c.Severity, &c.Side); err != nil {
+			return nil, fmt.Errorf("GetSkippedComments scan: %w", err)
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// CommentThreadRow is the position of an inline comment posted on an MR and the provider
+// id it was posted under, which for GitLab is the id of the discussion holding it.
+type CommentThreadRow struct {
+	FilePath          string
+	LineStart         int
+	Side              string
+	ProviderCommentID string
+}
+
+// GetCommentThreads returns, per file, line and side, the thread of the newest inline
+// comment posted on an MR by a run other than runID, so a re-review can reply in it
+// instead of starting a new discussion.
+func GetCommentThreads(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int, runID string) ([]CommentThreadRow, error) {
+	const q = `
+		SELECT DISTINCT ON (c.file_path, c.line_start, c.side) c.file_path, c.line_start, c.side, c.provider_comment_id
+		FROM review_comments c
+		JOIN review_runs r ON r.id = c.review_run_id
+		WHERE r.repo_id = $1 AND r.mr_number = $2 AND r.id <> $3
+		  AND c.posted AND c.provider_comment_id NOT IN ('skipped', 'overflow', 'superseded')
+		ORDER BY c.file_path, c.line_start, c.side, c.created_at DESC`
+
+	rows, err := pool.Query(ctx, q, repoID, mrNumber, runID)
+	if err != nil {
+		return nil, fmt.Errorf("GetCommentThreads: %w", err)
+	}
+	defer rows.Close()
+
+	var threads []CommentThreadRow
+	for rows.Next() {
+		var t CommentThreadRow
+		if err := rows.Scan(&t.FilePath, &t.LineStart, &t.Side, &t.ProviderCommentID); err != nil {
+			return nil, fmt.Errorf("GetCommentThreads scan: %w", err)
+		}
+		threads = append(threads, t)
+	}
+	return threads, rows.Err()
+}
+
+// GetPostedCommentPositions returns the file, line and side of each inline comment runID
+// posted to the provider, with the id it was posted under.
+func GetPostedCommentPositions(ctx context.Context, pool *pgxpool.Pool, runID string) ([]CommentThreadRow, error) {
+	const q = `
+		SELECT file_path, line_start, side, provider_comment_id
+		FROM review_comments
+		WHERE review_run_id = $1
+		  AND posted AND provider_comment_id NOT IN ('skipped', 'overflow', 'superseded')`
+
+	rows, err := pool.Query(ctx, q, runID)
+	if err != nil {
+		return nil, fmt.Errorf("GetPostedCommentPositions: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []CommentThreadRow
+	for rows.Next() {
+		var t CommentThreadRow
+		if err := rows.Scan(&t.FilePath, &t.LineStart, &t.Side, &t.ProviderCommentID); err != nil {
+			return nil, fmt.Errorf("GetPostedCommentPositions scan: %w", err)
+		}
+		positions = append(positions, t)
+	}
+	return positions, rows.Err()
+}
+
+// GetPriorSummaryNoteID returns the provider note id of the most recent summary posted for
+// an MR by an earlier run, or "" if none was posted.
+func GetPriorSummaryNoteID(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int) (string, error) {
+	const q = `
+		SELECT summary_note_id FROM review_runs
+		WHERE repo_id = $1 AND mr_number = $2 AND summary_note_id IS NOT NULL
+		ORDER BY created_at DESC
+		LIMIT 1`
+
+	var id string
+	err := pool.QueryRow(ctx, q, repoID, mrNumber).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("GetPriorSummaryNoteID: %w", err)
+	}
+	return id, nil
+}
+
+// MarkSummaryPosted records the provider note id of a run's posted summary.
+func MarkSummaryPosted(ctx context.Context, pool *pgxpool.Pool, runID, noteID string) error {
+	const q = `UPDATE review_runs SET summary_note_id = $2, updated_at = now() WHERE id = $1`
+	if _, err := pool.Exec(ctx, q, runID, noteID); err != nil {
+		return fmt.Errorf("MarkSummaryPosted: %w", err)
+	}
+	return nil
+}
+
 // GetLatestReviewDiffHash returns the diff_hash of the most recent completed review
 // for the given repo+MR, or ("", false, nil) if none exists.
 func GetLatestReviewDiffHash(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int) (string, bool, error) {
@@ -155,7 +392,7 @@ func GetLatestReviewDiffHash(ctx context.Context, pool *pgxpool.Pool, repoID str
 	var hash string
 	err := pool.QueryRow(ctx, q, repoID, mrNumber).Scan(&hash)
 	if err != nil {
-		if err == pgx.ErrNoRows {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return "", false, nil
 		}
 		return "", false, fmt.Errorf("GetLatestReviewDiffHash: %w", err)
@@ -163,6 +400,26 @@ func GetLatestReviewDiffHash(ctx context.Context, pool *pgxpool.Pool, repoID str
 	return hash, true, nil
 }
 
+// GetLatestReviewHeadSHA returns the MR head SHA the most recent completed review of the
+// given repo+MR was based on, or ("", false, nil) if none exists.
+func GetLatestReviewHeadSHA(ctx context.Context, pool *pgxpool.Pool, repoID string, mrNumber int) (string, bool, error) {
+	const q = `
+		SELECT head_sha FROM review_runs
+		WHERE repo_id = $1 AND mr_number = $2 AND status = 'completed' AND head_sha <> ''
+		ORDER BY created_at DESC
+		LIMIT 1`
+
+	var sha string
+	err := pool.QueryRow(ctx, q, repoID, mrNumber).Scan(&sha)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("GetLatestReviewHeadSHA: %w", err)
+	}
+	return sha, true, nil
+}
+
 // UpdateReviewRunDiffHash sets the diff_hash and updated_at on a review run.
 func UpdateReviewRunDiffHash(ctx context.Context, pool *pgxpool.Pool, runID, diffHash string) error {
 	const q = `UPDATE review_runs SET diff_hash = $1, updated_at = now() WHERE id = $2`
@@ -171,3 +428,34 @@ func UpdateReviewRunDiffHash(ctx context.Context, pool *pgxpool.Pool, runID, dif
 	}
 	return nil
 }
+
+// MarkReviewRunPipelineBlocked records that the pipeline gate skipped a run at head commit
+// headSHA, so the api-server re-dispatches it once that commit's MR pipeline succeeds.
+func MarkReviewRunPipelineBlocked(ctx context.Context, pool *pgxpool.Pool, runID, headSHA string) error {
+	const q = `UPDATE review_runs SET pipeline_blocked = true, head_sha = $2, updated_at = now() WHERE id = $1`
+	if _, err := pool.Exec(ctx, q, runID, headSHA); err != nil {
+		return fmt.Errorf("MarkReviewRunPipelineBlocked: %w", err)
+	}
+	return nil
+}
+
+// ReviewRunMetadata is the snapshot of the MR a review run was based on.
+type ReviewRunMetadata struct {
+	MRTitle      string
+	MRAuthor     string
+	SourceBranch string
+	TargetBranch string
+	HeadSHA      string
+}
+
+// UpdateReviewRunMetadata stores the MR snapshot and updated_at on a review run.
+func UpdateReviewRunMetadata(ctx context.Context, pool *pgxpool.Pool, runID string, meta ReviewRunMetadata) error {
+	const q = `
+		UPDATE review_runs
+		SET mr_title = $1, mr_author = $2, source_branch = $3, target_branch = $4, head_sha = $5, updated_at = now()
+		WHERE id = $6`
+	if _, err := pool.Exec(ctx, q, meta.MRTitle, meta.MRAuthor, meta.SourceBranch, meta.TargetBranch, meta.HeadSHA, runID); err != nil {
+		return fmt.Errorf("UpdateReviewRunMetadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package difffetcher
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redactedText replaces each secret match in diffs and file contents sent to the Reviewer.
+const redactedText = "[REDACTED]"
+
+// redactDiff replaces every match of patterns on the added, removed and context lines of a
+// unified diff with redactedText and returns how many matches it replaced. Hunk bodies are
+// delimited by the line counts in their @@ headers, so file headers, including the "--- "
+// and "+++ " lines, are left alone while changed lines that merely start like one are
+// redacted. No line is added or removed, so positions stay valid.
+func redactDiff(diff string, patterns []*regexp.Regexp) (string, int) {
+	if len(patterns) == 0 {
+		return diff, 0
+	}
+	lines := strings.Split(diff, "\n")
+	total := 0
+	// Old and new lines left in the current hunk; when both are used up, the lines up to
+	// the next hunk header belong to a file header.
+	oldLeft, newLeft := 0, 0
+	for i, l := range lines {
+		if oldLeft <= 0 && newLeft <= 0 {
+			if m := hunkHeaderRe.FindStringSubmatch(l); m != nil {
+				oldLeft, newLeft = headerCount(m[2]), headerCount(m[4])
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(l, `\`):
+			// "\ No newline at end of file" annotates the previous line.
+			continue
+		case strings.HasPrefix(l, "+"):
+			newLeft--
+		case strings.HasPrefix(l, "-"):
+			oldLeft--
+		default:
+			// A context line; an empty one had its leading space stripped.
+			oldLeft--
+			newLeft--
+		}
+		var n int
+		lines[i], n = redactText(l, patterns)
+		total += n
+	}
+	return strings.Join(lines, "\n"), total
+}
+
+// redactText replaces every match of patterns in s with redactedText and returns how many
+// matches it replaced.
+func redactText(s string, patterns []*regexp.Regexp) (string, int) {
+	total := 0
+	for _, re := range patterns {
+		s = re.ReplaceAllStringFunc(s, func(string) string {
+			total++
+			return redactedText
+		})
+	}
+	return s, total
+}
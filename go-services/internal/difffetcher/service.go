@@ -1,29 +1,64 @@
 package difffetcher
 
 import (
-	"errors"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
 
-	restate "github.com/restatedev/sdk-go"
 	"github.com/jackc/pgx/v5/pgxpool"
+	restate "github.com/restatedev/sdk-go"
 
+	"ai-reviewer/go-services/internal/config"
 	"ai-reviewer/go-services/internal/crypto"
 	"ai-reviewer/go-services/internal/db"
+	"ai-reviewer/go-services/internal/lang"
 	"ai-reviewer/go-services/internal/provider"
-	"ai-reviewer/go-services/internal/provider/gitlab"
+	// Imported for their provider.Register calls.
+	_ "ai-reviewer/go-services/internal/provider/bitbucket"
+	_ "ai-reviewer/go-services/internal/provider/gitea"
+	_ "ai-reviewer/go-services/internal/provider/github"
+	_ "ai-reviewer/go-services/internal/provider/gitlab"
 )
 
 const maxChangedLines = 5000
 
+// Bounds on the related issues sent to the Reviewer: how many, and the description bytes
+// kept per issue.
+const (
+	maxRelatedIssues         = 5
+	maxRelatedIssueDescBytes = 4096
+)
+
+// TokenEstimator approximates the number of LLM tokens in a piece of text.
+type TokenEstimator func(text string) int
+
+// approxTokens estimates tokens as one per four bytes, a common rule of thumb for
+// BPE tokenizers on source code.
+func approxTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
 // DiffFetcher is a Restate service that fetches PR diff and details from the VCS provider.
 type DiffFetcher struct {
-	pool   *pgxpool.Pool
-	encKey []byte
+	pool           *pgxpool.Pool
+	encKey         []byte
+	cfg            *config.Store
+	estimateTokens TokenEstimator
 }
 
 // New creates a new DiffFetcher.
-func New(pool *pgxpool.Pool, encKey []byte) *DiffFetcher {
-	return &DiffFetcher{pool: pool, encKey: encKey}
+func New(pool *pgxpool.Pool, encKey []byte, cfg *config.Store) *DiffFetcher {
+	return &DiffFetcher{
+		pool:           pool,
+		encKey:         encKey,
+		cfg:            cfg,
+		estimateTokens: approxTokens,
+	}
 }
 
 // FetchRequest is the input for FetchPRDetails.
@@ -31,27 +66,133 @@ type FetchRequest struct {
 	RepoID   string `json:"repo_id"`
 	MRNumber int    `json:"mr_number"`
 	Force    bool   `json:"force"`
+	// SinceSHA, when set, asks for only the changes between this commit and the MR head
+	// (an incremental review). Providers without a compare API get the full MR diff.
+	SinceSHA string `json:"since_sha,omitempty"`
+	// ReviewDrafts fetches the diff of a draft MR too. Without it a draft only gets its
+	// details and Draft set, since the caller won't review it.
+	ReviewDrafts bool `json:"review_drafts,omitempty"`
 }
 
 // FetchResponse is the output from FetchPRDetails.
 type FetchResponse struct {
-	Diff          string   `json:"diff"`
-	MRTitle       string   `json:"mr_title"`
-	MRDescription string   `json:"mr_description"`
-	MRAuthor      string   `json:"mr_author"`
-	SourceBranch  string   `json:"source_branch"`
-	TargetBranch  string   `json:"target_branch"`
-	ChangedFiles  []string `json:"changed_files"`
-	ChangedLines  int      `json:"changed_lines"`
-	DiffTooLarge  bool     `json:"diff_too_large"`
-	RepoRemoteID  string   `json:"repo_remote_id"`
-	DiffHash      string   `json:"diff_hash"`
-	Skip          bool     `json:"skip"`
-	Draft         bool     `json:"draft"`
+	Diff            string   `json:"diff"`
+	MRTitle         string   `json:"mr_title"`
+	MRDescription   string   `json:"mr_description"`
+	MRAuthor        string   `json:"mr_author"`
+	SourceBranch    string   `json:"source_branch"`
+	TargetBranch    string   `json:"target_branch"`
+	HeadSHA         string   `json:"head_sha"`
+	ChangedFiles    []string `json:"changed_files"`
+	ChangedLines    int      `json:"changed_lines"`
+	EstimatedTokens int      `json:"estimated_tokens"`
+	DiffTooLarge    bool     `json:"diff_too_large"`
+	RepoRemoteID    string   `json:"repo_remote_id"`
+	DiffHash        string   `json:"diff_hash"` // see diffHash
+	Skip            bool     `json:"skip"`
+	Draft           bool     `json:"draft"`
+	// State is the MR's provider.MRState*; a merged or closed MR only gets State set.
+	State string `json:"state,omitempty"`
+
+	// Per-repo Reviewer overrides; empty / nil use the Reviewer's defaults.
+	ReviewModel       string   `json:"review_model,omitempty"`
+	ReviewTemperature *float64 `json:"review_temperature,omitempty"`
+	// ReviewerVariant picks the Reviewer deployment; see prreview.reviewerTarget.
+	ReviewerVariant string `json:"reviewer_variant,omitempty"`
+
+	// AutoApproveOnClean asks PRReview to approve the MR when the review has no blockers.
+	AutoApproveOnClean bool `json:"auto_approve_on_clean,omitempty"`
+	// SkipEmptySummary asks PRReview not to post the summary of a review without comments;
+	// set when the repo turned post_empty_summary off.
+	SkipEmptySummary bool `json:"skip_empty_summary,omitempty"`
+	// PipelineBlocked is set when the repo requires a successful pipeline and the MR head's
+	// isn't one; PipelineStatus is then its status ("" when the head has no pipeline). Only
+	// HeadSHA is filled in besides them.
+	PipelineBlocked bool   `json:"pipeline_blocked,omitempty"`
+	PipelineStatus  string `json:"pipeline_status,omitempty"`
+	// TargetBranchPatterns are the repo's target_branch_patterns. When TargetBranch matches
+	// none of them the response stops after the MR details and PRReview skips the run.
+	TargetBranchPatterns []string `json:"target_branch_patterns,omitempty"`
+
+	// Languages maps each changed file with a recognised language to it; see lang.Detect.
+	Languages map[string]string `json:"languages,omitempty"`
+
+	// SinceSHA is the base the diff was computed from; empty means the full MR diff.
+	SinceSHA string `json:"since_sha,omitempty"`
+
+	// RelatedIssues are the issues the MR closes, when the repo has include_related_issues.
+	RelatedIssues []RelatedIssue `json:"related_issues,omitempty"`
+
+	// FileContents maps changed file paths to their content at HeadSHA, for the files
+	// selected by fetchFileContents. Empty unless FILE_CONTEXT_MAX_FILES is set.
+	FileContents map[string]string `json:"file_contents,omitempty"`
+}
+
+// RelatedIssue is an issue linked to the MR, passed to the Reviewer as intent context.
+type RelatedIssue struct {
+	IID         int    `json:"iid"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// closingIssueLister is implemented by providers that can list the issues an MR closes (GitLab).
+type closingIssueLister interface {
+	GetMRClosingIssues(ctx context.Context, repoRemoteID string, mrNumber int) ([]provider.Issue, error)
+}
+
+// fetchSettings is the part of the reloadable config FetchPRDetails uses, snapshotted
+// through restate.Run. The redact patterns are journaled as their source and compiled
+// again by redactPatterns; nil keeps redaction off.
+type fetchSettings struct {
+	DiffContextLines    int      `json:"diff_context_lines"`
+	RedactPatterns      []string `json:"redact_patterns"`
+	MaxDiffTokens       int      `json:"max_diff_tokens"`
+	FileContextMaxFiles int      `json:"file_context_max_files"`
+	FileContextMaxBytes int      `json:"file_context_max_bytes"`
+}
+
+// newFetchSettings copies the settings FetchPRDetails uses out of cfg.
+func newFetchSettings(cfg config.Config) fetchSettings {
+	s := fetchSettings{
+		DiffContextLines:    cfg.DiffContextLines,
+		MaxDiffTokens:       cfg.MaxDiffTokens,
+		FileContextMaxFiles: cfg.FileContextMaxFiles,
+		FileContextMaxBytes: cfg.FileContextMaxBytes,
+	}
+	if cfg.RedactPatterns != nil {
+		s.RedactPatterns = make([]string, len(cfg.RedactPatterns))
+		for i, re := range cfg.RedactPatterns {
+			s.RedactPatterns[i] = re.String()
+		}
+	}
+	return s
+}
+
+// redactPatterns compiles the snapshotted redact patterns. They compiled when the config
+// was loaded, so they compile again here.
+func (s fetchSettings) redactPatterns() []*regexp.Regexp {
+	if s.RedactPatterns == nil {
+		return nil
+	}
+	patterns := make([]*regexp.Regexp, len(s.RedactPatterns))
+	for i, expr := range s.RedactPatterns {
+		patterns[i] = regexp.MustCompile(expr)
+	}
+	return patterns
 }
 
 // FetchPRDetails fetches the diff and metadata for a pull/merge request.
 func (d *DiffFetcher) FetchPRDetails(ctx restate.Context, req FetchRequest) (FetchResponse, error) {
+	// Read the reloadable config once, journaled, so a retry after a reload trims, redacts
+	// and gates the diff like the first attempt.
+	settings, err := restate.Run(ctx, func(restate.RunContext) (fetchSettings, error) {
+		return newFetchSettings(d.cfg.Get()), nil
+	})
+	if err != nil {
+		return FetchResponse{}, err
+	}
+	redactPatterns := settings.redactPatterns()
+
 	repo, prov, err := db.GetRepoWithProvider(ctx, d.pool, req.RepoID)
 	if err != nil {
 		return FetchResponse{}, restate.TerminalError(fmt.Errorf("repo not found: %w", err), 404)
@@ -62,76 +203,263 @@ func (d *DiffFetcher) FetchPRDetails(ctx restate.Context, req FetchRequest) (Fet
 		return FetchResponse{}, restate.TerminalError(fmt.Errorf("decrypting token: %w", err), 500)
 	}
 
-	client, err := newProvider(prov.Type, prov.BaseURL, string(token))
+	client, err := provider.FromRow(prov, string(token))
 	if err != nil {
 		return FetchResponse{}, restate.TerminalError(err, 400)
 	}
 
 	details, err := client.GetMRDetails(ctx, repo.RemoteID, req.MRNumber)
 	if err != nil {
-		return FetchResponse{}, classifyProviderError(err)
+		return FetchResponse{}, provider.ClassifyError(err)
+	}
+
+	if provider.MRClosed(details.State) {
+		return FetchResponse{State: details.State}, nil
+	}
+
+	if !provider.TargetBranchMatches(repo.TargetBranchPatterns, details.TargetBranch) {
+		return FetchResponse{TargetBranch: details.TargetBranch, TargetBranchPatterns: repo.TargetBranchPatterns}, nil
+	}
+
+	if details.Draft && !req.ReviewDrafts {
+		return FetchResponse{Draft: true}, nil
+	}
+
+	if repo.RequirePipelineSuccess {
+		status, blocked, err := checkPipeline(ctx, client, repo.RemoteID, details.HeadSHA)
+		if err != nil {
+			return FetchResponse{}, provider.ClassifyError(err)
+		}
+		if blocked {
+			return FetchResponse{PipelineBlocked: true, PipelineStatus: status, HeadSHA: details.HeadSHA}, nil
+		}
 	}
 
-	diffHash := details.HeadSHA
+	// Dedup on the content of the full MR diff, so pushes and rebases that leave it
+	// unchanged don't trigger another review.
+	fullDiff, err := client.GetMRDiff(ctx, repo.RemoteID, req.MRNumber)
+	if err != nil {
+		return FetchResponse{}, provider.ClassifyError(err)
+	}
+	hash := diffHash(fullDiff.UnifiedDiff)
 
 	if !req.Force {
 		prevHash, found, err := db.GetLatestReviewDiffHash(ctx, d.pool, req.RepoID, req.MRNumber)
 		if err != nil {
 			return FetchResponse{}, fmt.Errorf("checking diff hash: %w", err)
 		}
-		if found && prevHash == diffHash {
-			return FetchResponse{Skip: true, DiffHash: diffHash}, nil
+		if found && prevHash == hash {
+			return FetchResponse{Skip: true, DiffHash: hash}, nil
 		}
 	}
 
-	diff, err := client.GetMRDiff(ctx, repo.RemoteID, req.MRNumber)
-	if err != nil {
-		return FetchResponse{}, classifyProviderError(err)
+	diff, sinceSHA := fetchDiff(ctx, client, repo.RemoteID, req.MRNumber, req.SinceSHA, details.HeadSHA, fullDiff)
+
+	if settings.DiffContextLines >= 0 {
+		// Trim before estimating so the token gate sees what the reviewer will get.
+		diff.UnifiedDiff, diff.ChangedLines = trimDiffContextCount(diff.UnifiedDiff, settings.DiffContextLines)
 	}
 
+	if redactPatterns != nil {
+		// Mask secrets before anything leaves for the Reviewer; line counts are unchanged.
+		var n int
+		if diff.UnifiedDiff, n = redactDiff(diff.UnifiedDiff, redactPatterns); n > 0 {
+			log.Printf("difffetcher: redacted %d secret(s) in the diff of repo %s MR %d", n, req.RepoID, req.MRNumber)
+		}
+	}
+
+	tokens := d.estimateTokens(diff.UnifiedDiff)
+
 	changedFiles := make([]string, len(diff.ChangedFiles))
 	for i, f := range diff.ChangedFiles {
 		changedFiles[i] = f.NewPath
 	}
 
+	tooLarge := isTooLarge(diff, tokens, settings.MaxDiffTokens)
+
+	// Oversized diffs aren't reviewed, so don't spend provider calls on their files.
+	var contents map[string]string
+	if settings.FileContextMaxFiles > 0 && !tooLarge {
+		contents = fetchFileContents(ctx, client, repo.RemoteID, details.HeadSHA, diff.ChangedFiles, settings.FileContextMaxFiles, settings.FileContextMaxBytes)
+		for path, content := range contents {
+			contents[path], _ = redactText(content, redactPatterns)
+		}
+	}
+
+	var issues []RelatedIssue
+	if repo.IncludeRelatedIssues && !tooLarge {
+		issues = fetchRelatedIssues(ctx, client, repo.RemoteID, req.MRNumber)
+		for i := range issues {
+			issues[i].Title, _ = redactText(issues[i].Title, redactPatterns)
+			issues[i].Description, _ = redactText(issues[i].Description, redactPatterns)
+		}
+	}
+
+	// The MR's own text goes to the Reviewer too.
+	title, _ := redactText(details.Title, redactPatterns)
+	description, _ := redactText(details.Description, redactPatterns)
+
 	return FetchResponse{
-		Diff:          diff.UnifiedDiff,
-		MRTitle:       details.Title,
-		MRDescription: details.Description,
-		MRAuthor:      details.Author,
-		SourceBranch:  details.SourceBranch,
-		TargetBranch:  details.TargetBranch,
-		ChangedFiles:  changedFiles,
-		ChangedLines:  diff.ChangedLines,
-		DiffTooLarge:  diff.ChangedLines > maxChangedLines,
-		RepoRemoteID:  repo.RemoteID,
-		DiffHash:      diffHash,
-		Draft:         details.Draft,
+		Diff:            diff.UnifiedDiff,
+		MRTitle:         title,
+		MRDescription:   description,
+		MRAuthor:        details.Author,
+		SourceBranch:    details.SourceBranch,
+		TargetBranch:    details.TargetBranch,
+		HeadSHA:         details.HeadSHA,
+		ChangedFiles:    changedFiles,
+		Languages:       lang.DetectAll(changedFiles),
+		ChangedLines:    diff.ChangedLines,
+		EstimatedTokens: tokens,
+		DiffTooLarge:    tooLarge,
+		RepoRemoteID:    repo.RemoteID,
+		DiffHash:        hash,
+		Draft:           details.Draft,
+		State:           details.State,
+
+		ReviewModel:       repo.ReviewModel,
+		ReviewTemperature: repo.ReviewTemperature,
+		ReviewerVariant:   repo.ReviewerVariant,
+
+		AutoApproveOnClean: repo.AutoApproveOnClean,
+		SkipEmptySummary:   !repo.PostEmptySummary,
+
+		TargetBranchPatterns: repo.TargetBranchPatterns,
+
+		SinceSHA: sinceSHA,
+
+		FileContents:  contents,
+		RelatedIssues: issues,
 	}, nil
 }
 
-func newProvider(provType, baseURL, token string) (provider.GitProvider, error) {
-	switch provType {
-	case "gitlab_self_hosted", "gitlab_cloud":
-		if baseURL == "" {
-			baseURL = "https://gitlab.com"
+// pipelineStatuser is implemented by providers that report CI pipeline status (GitLab).
+type pipelineStatuser interface {
+	GetPipelineStatus(ctx context.Context, repoRemoteID, sha string) (string, error)
+}
+
+// checkPipeline returns the status of the newest pipeline for sha and whether it blocks a
+// review, i.e. isn't a success. A provider without pipelines can't gate, so it never blocks.
+func checkPipeline(ctx context.Context, client provider.GitProvider, remoteID, sha string) (string, bool, error) {
+	p, ok := client.(pipelineStatuser)
+	if !ok {
+		log.Printf("difffetcher: provider of repo %s can't report pipelines, not gating on them", remoteID)
+		return "", false, nil
+	}
+	status, err := p.GetPipelineStatus(ctx, remoteID, sha)
+	if err != nil {
+		return "", false, fmt.Errorf("fetching pipeline status: %w", err)
+	}
+	return status, status != provider.PipelineSuccess, nil
+}
+
+// compareDiffer is implemented by providers that can diff two commits (GitLab's
+// /repository/compare), which incremental reviews need.
+type compareDiffer interface {
+	GetCompareDiff(ctx context.Context, repoRemoteID, from, to string) (*provider.MRDiff, error)
+}
+
+// fetchDiff returns the diff to review and the base it was computed from. With a sinceSHA
+// different from headSHA and a provider that supports it, that is the compare diff from
+// sinceSHA to headSHA; otherwise, or when the compare fails, the already fetched full MR
+// diff with an empty base.
+func fetchDiff(ctx context.Context, client provider.GitProvider, remoteID string, mrNumber int, sinceSHA, headSHA string, full *provider.MRDiff) (*provider.MRDiff, string) {
+	if cd, ok := client.(compareDiffer); ok && sinceSHA != "" && headSHA != "" && sinceSHA != headSHA {
+		diff, err := cd.GetCompareDiff(ctx, remoteID, sinceSHA, headSHA)
+		if err == nil {
+			return diff, sinceSHA
 		}
-		return gitlab.New(baseURL, token), nil
-	default:
-		return nil, fmt.Errorf("unsupported provider type: %s", provType)
+		log.Printf("difffetcher: compare %s...%s for MR %d failed, using the full diff: %v", sinceSHA, headSHA, mrNumber, err)
 	}
+	return full, ""
 }
 
-func classifyProviderError(err error) error {
-	switch {
-	case errors.Is(err, provider.ErrNotFound):
-		return restate.TerminalError(err, 404)
-	case errors.Is(err, provider.ErrUnauthorized):
-		return restate.TerminalError(err, 401)
-	case errors.Is(err, provider.ErrForbidden):
-		return restate.TerminalError(err, 403)
-	default:
-		// Retryable: rate limit, network errors, etc.
-		return err
+// diffHash returns the sha256 of a unified diff with the parts that change without the
+// reviewable content changing normalized away: CRLF line endings and the line numbers
+// in hunk headers, which shift when the MR is rebased onto a base that edited the same
+// files elsewhere. Unlike the head SHA it stays the same across such pushes.
+func diffHash(unifiedDiff string) string {
+	h := sha256.New()
+	for _, line := range strings.Split(strings.ReplaceAll(unifiedDiff, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, "@@ ") {
+			line = "@@"
+		}
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fetchFileContents returns the content at ref of up to maxFiles changed files, in diff
+// order. Deleted and binary files are skipped, as are files over maxBytes. A file the
+// provider can't serve is logged and skipped: the content is extra context, so it never
+// fails the fetch.
+func fetchFileContents(ctx context.Context, client provider.GitProvider, remoteID, ref string, files []provider.ChangedFile, maxFiles, maxBytes int) map[string]string {
+	contents := make(map[string]string)
+	for _, f := range files {
+		if len(contents) == maxFiles {
+			break
+		}
+		if f.Deleted || f.Binary {
+			continue
+		}
+		data, err := client.GetFileContent(ctx, remoteID, ref, f.NewPath, maxBytes)
+		if err != nil {
+			log.Printf("difffetcher: fetching %s at %s: %v", f.NewPath, ref, err)
+			continue
+		}
+		if len(data) > maxBytes {
+			continue
+		}
+		contents[f.NewPath] = string(data)
+	}
+	return contents
+}
+
+// fetchRelatedIssues returns up to maxRelatedIssues issues the MR closes, with descriptions
+// cut to maxRelatedIssueDescBytes. Like file contents they are extra context, so a provider
+// without the capability or a failed request just yields none.
+func fetchRelatedIssues(ctx context.Context, client provider.GitProvider, remoteID string, mrNumber int) []RelatedIssue {
+	lister, ok := client.(closingIssueLister)
+	if !ok {
+		return nil
+	}
+	issues, err := lister.GetMRClosingIssues(ctx, remoteID, mrNumber)
+	if err != nil {
+		log.Printf("difffetcher: fetching closing issues of MR %d: %v", mrNumber, err)
+		return nil
+	}
+	if len(issues) > maxRelatedIssues {
+		issues = issues[:maxRelatedIssues]
+	}
+	related := make([]RelatedIssue, len(issues))
+	for i, is := range issues {
+		related[i] = RelatedIssue{IID: is.IID, Title: is.Title, Description: truncateUTF8(is.Description, maxRelatedIssueDescBytes)}
+	}
+	return related
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// isTooLarge reports whether a diff exceeds what we review automatically. When maxTokens > 0
+// the token estimate is compared against it; otherwise the changed-line count is compared
+// against maxChangedLines. A truncated diff is always too large: its size under-reports the
+// real change.
+func isTooLarge(diff *provider.MRDiff, tokens, maxTokens int) bool {
+	if diff.Truncated {
+		return true
+	}
+	if maxTokens > 0 {
+		return tokens > maxTokens
 	}
+	return diff.ChangedLines > maxChangedLines
 }
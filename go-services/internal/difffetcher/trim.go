@@ -0,0 +1,193 @@
+package difffetcher
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkHeaderRe matches a unified diff hunk header; omitted counts mean 1.
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(.*)$`)
+
+// hunkLine is a hunk body line with the old/new line numbers it sits at.
+type hunkLine struct {
+	text     string
+	old, new int
+}
+
+// trimDiffContext re-emits every hunk of a unified diff with at most ctx context lines
+// before and after each run of changes, splitting hunks whose changes are more than
+// 2*ctx context lines apart and recomputing the @@ headers. File headers, binary markers
+// and hunks that can't be parsed are passed through unchanged.
+func trimDiffContext(diff string, ctx int) string {
+	out, _ := trimDiffContextCount(diff, ctx)
+	return out
+}
+
+// trimDiffContextCount is trimDiffContext that also returns the number of added and
+// removed lines, counted from hunk bodies only so file headers are never mistaken
+// for changes.
+func trimDiffContextCount(diff string, ctx int) (string, int) {
+	lines := strings.Split(diff, "\n")
+	var (
+		sb      strings.Builder
+		changed int
+	)
+	for i := 0; i < len(lines); i++ {
+		m := hunkHeaderRe.FindStringSubmatch(lines[i])
+		if m == nil {
+			sb.WriteString(lines[i])
+			if i < len(lines)-1 {
+				sb.WriteByte('\n')
+			}
+			continue
+		}
+
+		oldStart, _ := strconv.Atoi(m[1])
+		newStart, _ := strconv.Atoi(m[3])
+		oldCount, newCount := headerCount(m[2]), headerCount(m[4])
+
+		// Consume the hunk body by its declared counts; an empty line inside a hunk is a
+		// context line whose leading space was stripped.
+		var body []hunkLine
+		oldLine, newLine := oldStart, newStart
+		seenOld, seenNew := 0, 0
+		j := i + 1
+		for ; j < len(lines) && (seenOld < oldCount || seenNew < newCount || strings.HasPrefix(lines[j], `\`)); j++ {
+			l := lines[j]
+			body = append(body, hunkLine{text: l, old: oldLine, new: newLine})
+			switch {
+			case strings.HasPrefix(l, `\`):
+				// "\ No newline at end of file" annotates the previous line.
+			case strings.HasPrefix(l, "+"):
+				newLine++
+				seenNew++
+				changed++
+			case strings.HasPrefix(l, "-"):
+				oldLine++
+				seenOld++
+				changed++
+			default:
+				oldLine++
+				newLine++
+				seenOld++
+				seenNew++
+			}
+		}
+		i = j - 1
+
+		writeTrimmedHunk(&sb, body, m[5], ctx)
+		if i < len(lines)-1 {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String(), changed
+}
+
+func headerCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func isChange(l hunkLine) bool {
+	return strings.HasPrefix(l.text, "+") || strings.HasPrefix(l.text, "-")
+}
+
+// writeTrimmedHunk writes body as one or more hunks with at most ctx context lines around
+// each group of changes. It writes no trailing newline. A hunk without changes is kept whole.
+func writeTrimmedHunk(sb *strings.Builder, body []hunkLine, section string, ctx int) {
+	var changes []int
+	for k, l := range body {
+		if isChange(l) {
+			changes = append(changes, k)
+		}
+	}
+	if len(changes) == 0 {
+		writeHunk(sb, body, section)
+		return
+	}
+
+	// Group changes whose gap of context lines is at most 2*ctx.
+	first := true
+	start := changes[0]
+	for n := 0; n < len(changes); n++ {
+		end := changes[n]
+		if n+1 < len(changes) && contextBetween(body, end, changes[n+1]) <= 2*ctx {
+			continue
+		}
+		lo := extendContext(body, start, -1, ctx)
+		hi := extendContext(body, end, +1, ctx)
+		if !first {
+			sb.WriteByte('\n')
+		}
+		writeHunk(sb, body[lo:hi+1], section)
+		first = false
+		if n+1 < len(changes) {
+			start = changes[n+1]
+		}
+	}
+}
+
+// contextBetween counts context lines strictly between body[a] and body[b].
+func contextBetween(body []hunkLine, a, b int) int {
+	n := 0
+	for k := a + 1; k < b; k++ {
+		if !isChange(body[k]) && !strings.HasPrefix(body[k].text, `\`) {
+			n++
+		}
+	}
+	return n
+}
+
+// extendContext moves from index k in direction dir over at most ctx context lines and
+// returns the last index reached. Trailing "\ No newline" markers are always kept.
+func extendContext(body []hunkLine, k, dir, ctx int) int {
+	taken := 0
+	for next := k + dir; next >= 0 && next < len(body); next += dir {
+		l := body[next]
+		if strings.HasPrefix(l.text, `\`) {
+			k = next
+			continue
+		}
+		if isChange(l) || taken == ctx {
+			break
+		}
+		taken++
+		k = next
+	}
+	return k
+}
+
+// writeHunk writes a header computed from lines followed by the lines themselves.
+func writeHunk(sb *strings.Builder, lines []hunkLine, section string) {
+	oldCount, newCount := 0, 0
+	for _, l := range lines {
+		switch {
+		case strings.HasPrefix(l.text, `\`):
+		case strings.HasPrefix(l.text, "+"):
+			newCount++
+		case strings.HasPrefix(l.text, "-"):
+			oldCount++
+		default:
+			oldCount++
+			newCount++
+		}
+	}
+	oldStart, newStart := lines[0].old, lines[0].new
+	// An empty side is addressed by the line before it, as git does.
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@%s", oldStart, oldCount, newStart, newCount, section)
+	for _, l := range lines {
+		sb.WriteByte('\n')
+		sb.WriteString(l.text)
+	}
+}
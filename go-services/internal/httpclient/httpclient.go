@@ -0,0 +1,79 @@
+// Package httpclient builds the HTTP clients used for provider APIs, with optional TLS
+// settings for self-hosted instances behind a private CA or requiring client certificates.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// TLSOptions are the per-provider TLS settings, all PEM file paths on the worker host.
+type TLSOptions struct {
+	// CAFile is a CA bundle trusted in addition to the system roots.
+	CAFile string
+	// CertFile and KeyFile are an optional client certificate; both or neither must be set.
+	CertFile string
+	KeyFile  string
+}
+
+// IsZero reports whether no TLS option is set.
+func (o TLSOptions) IsZero() bool {
+	return o == TLSOptions{}
+}
+
+// clients caches one client per option set so connections are reused across calls.
+// Files are read once per process; rotating them requires a restart.
+var clients sync.Map // TLSOptions -> *http.Client
+
+// New returns the HTTP client for opts: http.DefaultClient when no option is set, otherwise
+// a client whose transport trusts CAFile and presents the client certificate.
+func New(opts TLSOptions) (*http.Client, error) {
+	if opts.IsZero() {
+		return http.DefaultClient, nil
+	}
+	if c, ok := clients.Load(opts); ok {
+		return c.(*http.Client), nil
+	}
+	cfg, err := tlsConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = cfg
+	c, _ := clients.LoadOrStore(opts, &http.Client{Transport: tr})
+	return c.(*http.Client), nil
+}
+
+func tlsConfig(opts TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %s contains no PEM certificates", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("client certificate and key files must be set together")
+	}
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
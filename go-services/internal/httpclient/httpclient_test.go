@@ -0,0 +1,89 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCAFile(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNew_CustomCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	// The default client does not trust the test server's self-signed certificate.
+	if resp, err := http.DefaultClient.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected default client to reject the test certificate")
+	}
+
+	c, err := New(TLSOptions{CAFile: writeCAFile(t, srv)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET with custom CA: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+
+	again, err := New(TLSOptions{CAFile: writeCAFile(t, srv)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == c {
+		t.Error("different CA path should build a separate client")
+	}
+}
+
+func TestNew_ZeroOptions(t *testing.T) {
+	c, err := New(TLSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != http.DefaultClient {
+		t.Error("zero options should return http.DefaultClient")
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "bad.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts TLSOptions
+	}{
+		{"missing CA file", TLSOptions{CAFile: filepath.Join(dir, "missing.pem")}},
+		{"CA file without certificates", TLSOptions{CAFile: notPEM}},
+		{"cert without key", TLSOptions{CertFile: notPEM}},
+		{"unparseable key pair", TLSOptions{CertFile: notPEM, KeyFile: notPEM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opts); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
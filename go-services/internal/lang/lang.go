@@ -0,0 +1,77 @@
+package lang
+
+import (
+	"path"
+	"strings"
+)
+
+// byExt maps lower-cased file extensions to language names.
+var byExt = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".pyi":   "python",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".jsx":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".java":  "java",
+	".kt":    "kotlin",
+	".kts":   "kotlin",
+	".scala": "scala",
+	".rb":    "ruby",
+	".php":   "php",
+	".rs":    "rust",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cxx":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".swift": "swift",
+	".m":     "objective-c",
+	".sh":    "shell",
+	".bash":  "shell",
+	".sql":   "sql",
+	".proto": "protobuf",
+	".tf":    "terraform",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".json":  "json",
+	".toml":  "toml",
+	".md":    "markdown",
+	".html":  "html",
+	".css":   "css",
+	".scss":  "scss",
+	".vue":   "vue",
+}
+
+// byName maps well-known extensionless file names to language names.
+var byName = map[string]string{
+	"Dockerfile": "dockerfile",
+	"Makefile":   "makefile",
+}
+
+// Detect returns the language of the file at p judged by its name or extension,
+// or "" when it isn't recognised.
+func Detect(p string) string {
+	base := path.Base(p)
+	if l, ok := byName[base]; ok {
+		return l
+	}
+	return byExt[strings.ToLower(path.Ext(base))]
+}
+
+// DetectAll maps each path with a recognised language to that language; unknown
+// files are left out.
+func DetectAll(paths []string) map[string]string {
+	langs := make(map[string]string, len(paths))
+	for _, p := range paths {
+		if l := Detect(p); l != "" {
+			langs[p] = l
+		}
+	}
+	return langs
+}
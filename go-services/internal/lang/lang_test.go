@@ -0,0 +1,31 @@
+package lang
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"main.go", "go"},
+		{"reviewer/reviewer/service.py", "python"},
+		{"web/src/App.TSX", "typescript"},
+		{"src/lib.rs", "rust"},
+		{"deploy/Dockerfile", "dockerfile"},
+		{"config/app.yml", "yaml"},
+		{"LICENSE", ""},
+		{"assets/logo.xyz", ""},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.path); got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDetectAll_SkipsUnknown(t *testing.T) {
+	got := DetectAll([]string{"a.go", "b.py", "NOTICE"})
+	if len(got) != 2 || got["a.go"] != "go" || got["b.py"] != "python" {
+		t.Errorf("unexpected languages: %v", got)
+	}
+}
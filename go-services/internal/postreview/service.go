@@ -1,27 +1,132 @@
 package postreview
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"unicode/utf8"
 
 	restate "github.com/restatedev/sdk-go"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/sync/semaphore"
 
+	"ai-reviewer/go-services/internal/config"
 	"ai-reviewer/go-services/internal/crypto"
 	"ai-reviewer/go-services/internal/db"
 	"ai-reviewer/go-services/internal/provider"
-	"ai-reviewer/go-services/internal/provider/gitlab"
+	// Imported for their provider.Register calls.
+	_ "ai-reviewer/go-services/internal/provider/bitbucket"
+	_ "ai-reviewer/go-services/internal/provider/gitea"
+	"ai-reviewer/go-services/internal/provider/github"
+	_ "ai-reviewer/go-services/internal/provider/gitlab"
 )
 
+// providerLimiter bounds concurrent provider API calls across all Post invocations in this
+// worker process. It is not coordinated across workers.
+var providerLimiter = semaphore.NewWeighted(config.DefaultProviderMaxConcurrency)
+
+// SetProviderConcurrency sets the maximum number of concurrent provider API calls.
+// Values < 1 are treated as 1. Call it at startup, before any Post invocation runs.
+func SetProviderConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	providerLimiter = semaphore.NewWeighted(int64(n))
+}
+
+// withProviderSlot runs fn while holding a provider call slot. Waiting for a slot is
+// aborted when ctx is done.
+func withProviderSlot(ctx context.Context, fn func() error) error {
+	if err := providerLimiter.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer providerLimiter.Release(1)
+	return fn()
+}
+
 // PostReview is a Restate service that posts review results to the VCS provider.
 type PostReview struct {
 	pool   *pgxpool.Pool
 	encKey []byte
+	cfg    *config.Store
 }
 
 // New creates a new PostReview service.
-func New(pool *pgxpool.Pool, encKey []byte) *PostReview {
-	return &PostReview{pool: pool, encKey: encKey}
+func New(pool *pgxpool.Pool, encKey []byte, cfg *config.Store) *PostReview {
+	return &PostReview{pool: pool, encKey: encKey, cfg: cfg}
+}
+
+// commentStore is the subset of DB queries needed to post inline comments.
+type commentStore interface {
+	GetUnpostedComments(ctx context.Context, runID string) ([]db.ReviewCommentRow, error)
+	MarkCommentPosted(ctx context.Context, commentID, providerCommentID string) error
+	GetSkippedComments(ctx context.Context, repoID string, mrNumber int) ([]db.ReviewCommentRow, error)
+	GetCommentThreads(ctx context.Context, repoID string, mrNumber int, runID string) ([]db.CommentThreadRow, error)
+	GetPostedCommentPositions(ctx context.Context, runID string) ([]db.CommentThreadRow, error)
+}
+
+// noteLister is implemented by providers that can list an MR's top-level notes (GitLab).
+type noteLister interface {
+	ListMRNotes(ctx context.Context, repoRemoteID string, mrNumber int) ([]provider.Note, error)
+}
+
+// discussionReplier is implemented by providers that can reply in an existing inline
+// comment thread (GitLab).
+type discussionReplier interface {
+	ReplyToDiscussion(ctx context.Context, repoRemoteID string, mrNumber int, discussionID, body string) (*provider.CommentResult, error)
+}
+
+// checkRunCreator is implemented by providers that can publish a review as a check run with
+// annotations (GitHub).
+type checkRunCreator interface {
+	CreateCheckRun(ctx context.Context, repoRemoteID, headSHA string, annotations []github.Annotation) (int64, error)
+}
+
+// summaryStore is the subset of DB queries that tracks a run's posted summary note.
+type summaryStore interface {
+	GetSummaryNoteID(ctx context.Context, runID string) (string, error)
+	GetPriorSummaryNoteID(ctx context.Context, repoID string, mrNumber int) (string, error)
+	MarkSummaryPosted(ctx context.Context, runID, noteID string) error
+}
+
+// poolCommentStore adapts *pgxpool.Pool to the commentStore and summaryStore interfaces.
+type poolCommentStore struct {
+	pool *pgxpool.Pool
+}
+
+func (s poolCommentStore) GetUnpostedComments(ctx context.Context, runID string) ([]db.ReviewCommentRow, error) {
+	return db.GetUnpostedComments(ctx, s.pool, runID)
+}
+
+func (s poolCommentStore) MarkCommentPosted(ctx context.Context, commentID, providerCommentID string) error {
+	return db.MarkCommentPosted(ctx, s.pool, commentID, providerCommentID)
+}
+
+func (s poolCommentStore) GetSkippedComments(ctx context.Context, repoID string, mrNumber int) ([]db.ReviewCommentRow, error) {
+	return db.GetSkippedComments(ctx, s.pool, repoID, mrNumber)
+}
+
+func (s poolCommentStore) GetCommentThreads(ctx context.Context, repoID string, mrNumber int, runID string) ([]db.CommentThreadRow, error) {
+	return db.GetCommentThreads(ctx, s.pool, repoID, mrNumber, runID)
+}
+
+func (s poolCommentStore) GetPostedCommentPositions(ctx context.Context, runID string) ([]db.CommentThreadRow, error) {
+	return db.GetPostedCommentPositions(ctx, s.pool, runID)
+}
+
+func (s poolCommentStore) GetSummaryNoteID(ctx context.Context, runID string) (string, error) {
+	return db.GetSummaryNoteID(ctx, s.pool, runID)
+}
+
+func (s poolCommentStore) GetPriorSummaryNoteID(ctx context.Context, repoID string, mrNumber int) (string, error) {
+	return db.GetPriorSummaryNoteID(ctx, s.pool, repoID, mrNumber)
+}
+
+func (s poolCommentStore) MarkSummaryPosted(ctx context.Context, runID, noteID string) error {
+	return db.MarkSummaryPosted(ctx, s.pool, runID, noteID)
 }
 
 // PostRequest is the input for Post.
@@ -32,17 +137,74 @@ type PostRequest struct {
 	RepoRemoteID string `json:"repo_remote_id"`
 	Summary      string `json:"summary"`
 	DryRun       bool   `json:"dry_run"`
+	// SeverityCounts holds the number of comments per severity, appended to the posted summary.
+	SeverityCounts map[string]int `json:"severity_counts,omitempty"`
+	// CommentCount is the total number of inline comments in the review.
+	CommentCount int `json:"comment_count"`
+	// Diff is the unified diff the review was based on. When set, inline comments on lines
+	// outside its new side are skipped locally instead of being rejected by the provider.
+	Diff string `json:"diff,omitempty"`
+	// SkipEmptySummary stores the summary without posting a summary note; PRReview sets it
+	// for reviews without comments when the repo turned post_empty_summary off. Skipped
+	// comments of earlier runs are still reposted, and with UPDATE_SUMMARY_IN_PLACE the
+	// previous review's note is updated to this summary.
+	SkipEmptySummary bool `json:"skip_empty_summary,omitempty"`
+	// HeadSHA is the MR head commit the review was based on. For repos with post_mode
+	// "check_run" the comments are published as annotations on a check run on it.
+	HeadSHA string `json:"head_sha,omitempty"`
 }
 
 // PostResponse is the output from Post.
 type PostResponse struct {
 	CommentsPosted int  `json:"comments_posted"`
 	SummaryPosted  bool `json:"summary_posted"`
+	// CommentsSkipped counts comments marked "skipped" instead of posted, because their
+	// line isn't in the diff or the provider rejected the position; SkippedReasons holds
+	// one "<file>:<line>: <reason>" entry per skipped comment.
+	CommentsSkipped int      `json:"comments_skipped"`
+	SkippedReasons  []string `json:"skipped_reasons,omitempty"`
+	// CommentsReposted counts comments skipped by an earlier run of the MR that were posted
+	// now because their line is back in the diff.
+	CommentsReposted int `json:"comments_reposted,omitempty"`
+	// CommentsSuperseded counts comments skipped by an earlier run that were marked
+	// "superseded" instead of reposted, because this run posted on the same line.
+	CommentsSuperseded int `json:"comments_superseded,omitempty"`
+	// CommentsReplied counts the posted and reposted comments that went into the thread an
+	// earlier run started on the same line instead of a new discussion.
+	CommentsReplied int `json:"comments_replied,omitempty"`
+}
+
+// skip records a comment that was marked skipped rather than posted.
+func (r *PostResponse) skip(c db.ReviewCommentRow, reason string) {
+	r.CommentsSkipped++
+	r.SkippedReasons = append(r.SkippedReasons, fmt.Sprintf("%s:%d: %s", c.FilePath, c.LineStart, reason))
+}
+
+// postSettings is the part of the reloadable config Post uses, snapshotted through restate.Run.
+type postSettings struct {
+	MaxCommentBytes      int  `json:"max_comment_bytes"`
+	UpdateSummaryInPlace bool `json:"update_summary_in_place"`
+	PostSummaryLast      bool `json:"post_summary_last"`
 }
 
 // Post stores the summary and posts review comments to the VCS provider.
-// In dry_run mode, the summary is stored but nothing is posted to the provider.
+// In dry_run mode, or with skip_empty_summary, the summary is stored but nothing is
+// posted to the provider.
 func (p *PostReview) Post(ctx restate.Context, req PostRequest) (PostResponse, error) {
+	// Read the reloadable config once, journaled, so a retry after a reload formats and
+	// orders the posts like the first attempt.
+	settings, err := restate.Run(ctx, func(restate.RunContext) (postSettings, error) {
+		cfg := p.cfg.Get()
+		return postSettings{
+			MaxCommentBytes:      cfg.MaxCommentBytes,
+			UpdateSummaryInPlace: cfg.UpdateSummaryInPlace,
+			PostSummaryLast:      cfg.PostSummaryLast,
+		}, nil
+	})
+	if err != nil {
+		return PostResponse{}, err
+	}
+
 	// Always persist the summary to DB.
 	if err := db.UpdateReviewRunSummary(ctx, p.pool, req.ReviewRunID, req.Summary); err != nil {
 		return PostResponse{}, fmt.Errorf("storing summary: %w", err)
@@ -52,7 +214,7 @@ func (p *PostReview) Post(ctx restate.Context, req PostRequest) (PostResponse, e
 		return PostResponse{SummaryPosted: false}, nil
 	}
 
-	_, prov, err := db.GetRepoWithProvider(ctx, p.pool, req.RepoID)
+	repo, prov, err := db.GetRepoWithProvider(ctx, p.pool, req.RepoID)
 	if err != nil {
 		return PostResponse{}, restate.TerminalError(fmt.Errorf("repo not found: %w", err), 404)
 	}
@@ -62,72 +224,650 @@ func (p *PostReview) Post(ctx restate.Context, req PostRequest) (PostResponse, e
 		return PostResponse{}, restate.TerminalError(fmt.Errorf("decrypting token: %w", err), 500)
 	}
 
-	client, err := newProvider(prov.Type, prov.BaseURL, string(token))
+	client, err := provider.FromRow(prov, string(token))
 	if err != nil {
 		return PostResponse{}, restate.TerminalError(err, 400)
 	}
 
-	// Post summary as a top-level MR note.
-	if _, err := client.PostComment(ctx, req.RepoRemoteID, req.MRNumber, req.Summary); err != nil {
-		return PostResponse{}, classifyProviderError(err)
+	format := bodyFormat{prefix: repo.CommentPrefix, maxBytes: settings.MaxCommentBytes}
+	summaryNote := truncateBody(withCommentPrefix(repo.CommentPrefix, renderSummary(repo.SummaryTemplate, summaryData{
+		Summary:      withSeverityCounts(req.Summary, req.SeverityCounts),
+		CommentCount: req.CommentCount,
+	})), format.maxBytes)
+
+	// The summary note is journaled so a retry after a mid-inline failure does not post it
+	// twice, and its note id is stored on the run so a re-executed step doesn't either.
+	store := poolCommentStore{pool: p.pool}
+	postSummary := func() error {
+		_, err := restate.Run(ctx, func(rc restate.RunContext) (string, error) {
+			return postSummaryNote(rc, store, client, req, summaryNote, settings.UpdateSummaryInPlace, repo.CommentPrefix)
+		})
+		return err
+	}
+
+	if req.SkipEmptySummary {
+		// No summary note for an empty review, but publish still reposts earlier runs'
+		// skipped comments whose lines are back, and an in-place summary is rewritten so
+		// it doesn't keep describing the previous review.
+		postSummary = func() error {
+			if !settings.UpdateSummaryInPlace {
+				return nil
+			}
+			_, err := restate.Run(ctx, func(rc restate.RunContext) (string, error) {
+				return replacePriorSummaryNote(rc, store, client, req, summaryNote, repo.CommentPrefix)
+			})
+			return err
+		}
+	}
+
+	var resp PostResponse
+	if creator, ok := client.(checkRunCreator); ok && repo.PostMode == "check_run" && req.HeadSHA != "" {
+		resp, err = publishCheckRun(ctx, store, creator, req, settings.PostSummaryLast, format, postSummary)
+	} else {
+		resp, err = publish(ctx, store, client, req, settings.PostSummaryLast, format, postSummary)
+	}
+	if req.SkipEmptySummary {
+		resp.SummaryPosted = false
+	}
+	return resp, err
+}
+
+// postSummaryNote posts the run's summary note and records its id on the run. If the run
+// already has a summary note (the post succeeded but the step was retried), that note is
+// updated in place instead of posting a duplicate; a failed update, e.g. on a provider
+// without UpdateComment, is logged. With inPlace, a run's first post updates the note of the
+// MR's previous review instead, falling back to a new note if that one is gone or can't be
+// edited with the bot's token. If the DB has no previous note (e.g. it was restored from a
+// backup), the MR's newest note starting with prefix is taken as the previous summary, on
+// providers that can list notes.
+func postSummaryNote(ctx context.Context, store summaryStore, client provider.GitProvider, req PostRequest, body string, inPlace bool, prefix string) (string, error) {
+	update := func(noteID string) error {
+		return withProviderSlot(ctx, func() error {
+			_, err := client.UpdateComment(ctx, req.RepoRemoteID, req.MRNumber, noteID, body)
+			return err
+		})
+	}
+
+	noteID, err := store.GetSummaryNoteID(ctx, req.ReviewRunID)
+	if err != nil {
+		return "", fmt.Errorf("loading summary note id: %w", err)
+	}
+	if noteID != "" {
+		if err := update(noteID); err != nil {
+			log.Printf("postreview: updating summary note %s of run %s: %v", noteID, req.ReviewRunID, err)
+		}
+		return noteID, nil
+	}
+
+	if inPlace {
+		prior, err := priorSummaryNote(ctx, store, client, req, prefix)
+		if err != nil {
+			return "", err
+		}
+		if prior != "" {
+			err := update(prior)
+			if err == nil {
+				if err := store.MarkSummaryPosted(ctx, req.ReviewRunID, prior); err != nil {
+					return "", fmt.Errorf("marking summary posted: %w", err)
+				}
+				return prior, nil
+			}
+			if !errors.Is(err, provider.ErrNotFound) && !errors.Is(err, provider.ErrForbidden) {
+				return "", provider.ClassifyError(err)
+			}
+			// Deleted on the provider, not ours to edit (a human's note that happens to
+			// start with the prefix), or the provider can't update notes: post a new one.
+		}
+	}
+
+	var result *provider.CommentResult
+	err = withProviderSlot(ctx, func() (err error) {
+		result, err = client.PostComment(ctx, req.RepoRemoteID, req.MRNumber, body)
+		return err
+	})
+	if err != nil {
+		return "", provider.ClassifyError(err)
+	}
+	if err := store.MarkSummaryPosted(ctx, req.ReviewRunID, result.ID); err != nil {
+		return "", fmt.Errorf("marking summary posted: %w", err)
+	}
+	return result.ID, nil
+}
+
+// replacePriorSummaryNote updates the summary note of the MR's previous review to body and
+// records it as the run's note, without posting a new note if there is none or it is gone
+// or not the bot's to edit. Post uses it for an empty review it doesn't post a summary for.
+func replacePriorSummaryNote(ctx context.Context, store summaryStore, client provider.GitProvider, req PostRequest, body, prefix string) (string, error) {
+	prior, err := priorSummaryNote(ctx, store, client, req, prefix)
+	if err != nil || prior == "" {
+		return "", err
+	}
+	err = withProviderSlot(ctx, func() error {
+		_, err := client.UpdateComment(ctx, req.RepoRemoteID, req.MRNumber, prior, body)
+		return err
+	})
+	if errors.Is(err, provider.ErrNotFound) || errors.Is(err, provider.ErrForbidden) {
+		log.Printf("postreview: prior summary note %s of MR %d not updated: %v", prior, req.MRNumber, err)
+		return "", nil
+	}
+	if err != nil {
+		return "", provider.ClassifyError(err)
+	}
+	if err := store.MarkSummaryPosted(ctx, req.ReviewRunID, prior); err != nil {
+		return "", fmt.Errorf("marking summary posted: %w", err)
+	}
+	return prior, nil
+}
+
+// priorSummaryNote returns the id of the summary note of the MR's previous review: the one
+// recorded in the DB or, failing that and with a prefix, the MR's newest note starting
+// with it. "" if there is none.
+func priorSummaryNote(ctx context.Context, store summaryStore, client provider.GitProvider, req PostRequest, prefix string) (string, error) {
+	prior, err := store.GetPriorSummaryNoteID(ctx, req.RepoID, req.MRNumber)
+	if err != nil {
+		return "", fmt.Errorf("loading prior summary note id: %w", err)
+	}
+	if prior == "" && prefix != "" {
+		if prior, err = findSummaryNote(ctx, client, req, prefix); err != nil {
+			return "", provider.ClassifyError(err)
+		}
+	}
+	return prior, nil
+}
+
+// findSummaryNote returns the id of the MR's newest top-level note that starts with prefix,
+// or "" if there is none or the provider can't list notes.
+func findSummaryNote(ctx context.Context, client provider.GitProvider, req PostRequest, prefix string) (string, error) {
+	lister, ok := client.(noteLister)
+	if !ok {
+		return "", nil
+	}
+	var notes []provider.Note
+	err := withProviderSlot(ctx, func() (err error) {
+		notes, err = lister.ListMRNotes(ctx, req.RepoRemoteID, req.MRNumber)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, n := range notes {
+		if strings.HasPrefix(n.Body, prefix) {
+			return n.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// publish posts the summary and all unposted inline comments for a run, then reposts the
+// MR's previously skipped comments whose line is in the run's diff (see repostSkipped).
+// By default the summary goes first; with summaryLast it is posted only after every inline
+// comment succeeded, so its presence marks a complete review. Inline comments are idempotent
+// via the posted flag: on retry, already-posted rows are skipped. Inline bodies are built
+// by format. A comment on a line where an earlier run of the MR left a comment is posted as
+// a reply in that thread, on providers that support it (see postInline).
+func publish(ctx context.Context, store commentStore, client provider.GitProvider, req PostRequest, summaryLast bool, format bodyFormat, postSummary func() error) (PostResponse, error) {
+	var resp PostResponse
+
+	if !summaryLast {
+		if err := postSummary(); err != nil {
+			return resp, err
+		}
+		resp.SummaryPosted = true
 	}
 
 	// Load and post unposted inline comments. Already-posted ones are skipped on retry.
-	comments, err := db.GetUnpostedComments(ctx, p.pool, req.ReviewRunID)
+	comments, err := store.GetUnpostedComments(ctx, req.ReviewRunID)
+	if err != nil {
+		return resp, fmt.Errorf("loading unposted comments: %w", err)
+	}
+	threads, err := loadThreads(ctx, store, client, req)
 	if err != nil {
-		return PostResponse{}, fmt.Errorf("loading unposted comments: %w", err)
+		return resp, err
+	}
+
+	var lines *diffLines
+	if req.Diff != "" {
+		lines = newDiffLines(req.Diff)
 	}
 
-	posted := 0
 	for _, c := range comments {
-		result, err := client.PostInlineComment(ctx, req.RepoRemoteID, req.MRNumber, provider.InlineComment{
-			FilePath: c.FilePath,
-			Line:     c.LineStart,
-			Body:     c.Body,
-			NewLine:  true,
-		})
+		if lines != nil && !lines.contains(c) {
+			// Line not in the diff — the provider would reject it; skip without the API call.
+			if err := store.MarkCommentPosted(ctx, c.ID, "skipped"); err != nil {
+				return resp, fmt.Errorf("marking skipped comment: %w", err)
+			}
+			resp.skip(c, "line not in diff")
+			continue
+		}
+		id, replied, err := postInline(ctx, client, req, c, format.inline(c), threads)
 		if err != nil {
 			if errors.Is(err, provider.ErrInvalidInput) {
 				// Invalid position (e.g. line not in diff) — skip and mark as posted to avoid
 				// retrying a comment that will never succeed.
-				if markErr := db.MarkCommentPosted(ctx, p.pool, c.ID, "skipped"); markErr != nil {
-					return PostResponse{CommentsPosted: posted, SummaryPosted: true}, fmt.Errorf("marking skipped comment: %w", markErr)
+				if markErr := store.MarkCommentPosted(ctx, c.ID, "skipped"); markErr != nil {
+					return resp, fmt.Errorf("marking skipped comment: %w", markErr)
 				}
+				resp.skip(c, err.Error())
 				continue
 			}
 			// Return partial progress — Restate will retry, and posted=true rows are skipped.
-			return PostResponse{CommentsPosted: posted, SummaryPosted: true}, classifyProviderError(err)
+			return resp, provider.ClassifyError(err)
 		}
-		if err := db.MarkCommentPosted(ctx, p.pool, c.ID, result.ID); err != nil {
-			return PostResponse{CommentsPosted: posted, SummaryPosted: true}, fmt.Errorf("marking comment posted: %w", err)
+		if err := store.MarkCommentPosted(ctx, c.ID, id); err != nil {
+			return resp, fmt.Errorf("marking comment posted: %w", err)
+		}
+		resp.CommentsPosted++
+		if replied {
+			resp.CommentsReplied++
+		}
+	}
+
+	if lines != nil {
+		if err := repostSkipped(ctx, store, client, req, format, lines, threads, &resp); err != nil {
+			return resp, err
 		}
-		posted++
 	}
 
-	return PostResponse{CommentsPosted: posted, SummaryPosted: true}, nil
+	if summaryLast {
+		if err := postSummary(); err != nil {
+			return resp, err
+		}
+		resp.SummaryPosted = true
+	}
+
+	return resp, nil
 }
 
-func newProvider(provType, baseURL, token string) (provider.GitProvider, error) {
-	switch provType {
-	case "gitlab_self_hosted", "gitlab_cloud":
-		if baseURL == "" {
-			baseURL = "https://gitlab.com"
+// publishCheckRun posts the summary like publish, but publishes the run's unposted inline
+// comments as annotations on one check run on req.HeadSHA instead of inline comments; a
+// review without comments gets a successful check run. Annotations can only point at the
+// head commit, so comments on old-side lines, and with req.Diff those on lines outside it,
+// are marked skipped. Annotated comments are marked posted with "check_run:<id>". Earlier
+// runs' skipped comments are not reposted: each check run covers its own review.
+func publishCheckRun(ctx context.Context, store commentStore, creator checkRunCreator, req PostRequest, summaryLast bool, format bodyFormat, postSummary func() error) (PostResponse, error) {
+	var resp PostResponse
+
+	if !summaryLast {
+		if err := postSummary(); err != nil {
+			return resp, err
 		}
-		return gitlab.New(baseURL, token), nil
-	default:
-		return nil, fmt.Errorf("unsupported provider type: %s", provType)
+		resp.SummaryPosted = true
+	}
+
+	comments, err := store.GetUnpostedComments(ctx, req.ReviewRunID)
+	if err != nil {
+		return resp, fmt.Errorf("loading unposted comments: %w", err)
+	}
+
+	var lines *diffLines
+	if req.Diff != "" {
+		lines = newDiffLines(req.Diff)
+	}
+
+	var annotated []db.ReviewCommentRow
+	var annotations []github.Annotation
+	for _, c := range comments {
+		reason := ""
+		switch {
+		case c.Side == "old":
+			reason = "old-side line; check runs annotate the head commit"
+		case lines != nil && !lines.contains(c):
+			reason = "line not in diff"
+		}
+		if reason != "" {
+			if err := store.MarkCommentPosted(ctx, c.ID, "skipped"); err != nil {
+				return resp, fmt.Errorf("marking skipped comment: %w", err)
+			}
+			resp.skip(c, reason)
+			continue
+		}
+		annotated = append(annotated, c)
+		annotations = append(annotations, github.Annotation{
+			Path:      c.FilePath,
+			StartLine: c.LineStart,
+			EndLine:   c.LineEnd,
+			Message:   truncateBody(c.Body, format.maxBytes),
+			Level:     github.AnnotationLevel(c.Severity),
+		})
+	}
+
+	var checkRunID int64
+	err = withProviderSlot(ctx, func() (err error) {
+		checkRunID, err = creator.CreateCheckRun(ctx, req.RepoRemoteID, req.HeadSHA, annotations)
+		return err
+	})
+	if err != nil {
+		return resp, provider.ClassifyError(err)
+	}
+	for _, c := range annotated {
+		if err := store.MarkCommentPosted(ctx, c.ID, fmt.Sprintf("check_run:%d", checkRunID)); err != nil {
+			return resp, fmt.Errorf("marking comment posted: %w", err)
+		}
+		resp.CommentsPosted++
+	}
+
+	if summaryLast {
+		if err := postSummary(); err != nil {
+			return resp, err
+		}
+		resp.SummaryPosted = true
+	}
+
+	return resp, nil
+}
+
+// threadKey is the position an inline comment is anchored to.
+type threadKey struct {
+	path string
+	line int
+	old  bool
+}
+
+// commentThreads maps a position to the thread an earlier run of the MR posted there.
+type commentThreads map[threadKey]string
+
+// loadThreads returns the threads of the comments earlier runs posted on req's MR, or nil
+// if client can't reply in them.
+func loadThreads(ctx context.Context, store commentStore, client provider.GitProvider, req PostRequest) (commentThreads, error) {
+	if _, ok := client.(discussionReplier); !ok {
+		return nil, nil
+	}
+	rows, err := store.GetCommentThreads(ctx, req.RepoID, req.MRNumber, req.ReviewRunID)
+	if err != nil {
+		return nil, fmt.Errorf("loading comment threads: %w", err)
+	}
+	threads := make(commentThreads, len(rows))
+	for _, t := range rows {
+		threads[threadKey{path: t.FilePath, line: t.LineStart, old: t.Side == "old"}] = t.ProviderCommentID
+	}
+	return threads, nil
+}
+
+// postInline posts body for comment c. If threads holds a thread on c's position, body is
+// a reply in it; otherwise, or if the thread was deleted, it starts a new discussion. It
+// returns the id to store for c, which for a reply is the thread's, so later runs keep
+// replying there, and whether body went in as a reply.
+func postInline(ctx context.Context, client provider.GitProvider, req PostRequest, c db.ReviewCommentRow, body string, threads commentThreads) (string, bool, error) {
+	if r, ok := client.(discussionReplier); ok {
+		if threadID := threads[threadKey{path: c.FilePath, line: c.LineStart, old: c.Side == "old"}]; threadID != "" {
+			err := withProviderSlot(ctx, func() error {
+				_, err := r.ReplyToDiscussion(ctx, req.RepoRemoteID, req.MRNumber, threadID, body)
+				return err
+			})
+			if err == nil {
+				return threadID, true, nil
+			}
+			if !errors.Is(err, provider.ErrNotFound) {
+				return "", false, err
+			}
+			// Deleted on the provider: start a new thread.
+		}
+	}
+
+	var result *provider.CommentResult
+	err := withProviderSlot(ctx, func() (err error) {
+		result, err = client.PostInlineComment(ctx, req.RepoRemoteID, req.MRNumber, provider.InlineComment{
+			FilePath: c.FilePath,
+			Line:     c.LineStart,
+			Body:     body,
+			NewLine:  c.Side != "old",
+		})
+		return err
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return result.ID, false, nil
+}
+
+// diffLines holds the lines of a run's diff that inline comments can anchor to, per side.
+type diffLines struct {
+	new, old map[string]map[int]bool
+}
+
+func newDiffLines(diff string) *diffLines {
+	return &diffLines{new: provider.NewSideLines(diff), old: provider.OldSideLines(diff)}
+}
+
+// contains reports whether c's start line is in the diff on c's side.
+func (d *diffLines) contains(c db.ReviewCommentRow) bool {
+	if c.Side == "old" {
+		return d.old[c.FilePath][c.LineStart]
+	}
+	return d.new[c.FilePath][c.LineStart]
+}
+
+// repostSkipped posts the comments that earlier runs of the MR skipped because their line
+// was outside the diff, if lines now contains it. A comment whose line is still missing
+// or whose position the provider rejects again stays skipped for a later push. One on a
+// file, line and side this run already posted on is marked "superseded" instead: the
+// current review covers that line, and it is never reposted.
+func repostSkipped(ctx context.Context, store commentStore, client provider.GitProvider, req PostRequest, format bodyFormat, lines *diffLines, threads commentThreads, resp *PostResponse) error {
+	skipped, err := store.GetSkippedComments(ctx, req.RepoID, req.MRNumber)
+	if err != nil {
+		return fmt.Errorf("loading skipped comments: %w", err)
+	}
+	posted, err := store.GetPostedCommentPositions(ctx, req.ReviewRunID)
+	if err != nil {
+		return fmt.Errorf("loading posted comment positions: %w", err)
+	}
+	current := make(map[threadKey]bool, len(posted))
+	for _, p := range posted {
+		current[threadKey{path: p.FilePath, line: p.LineStart, old: p.Side == "old"}] = true
+	}
+
+	for _, c := range skipped {
+		// This run's own skipped comments were just checked against the same diff.
+		if c.ReviewRunID == req.ReviewRunID || !lines.contains(c) {
+			continue
+		}
+		if current[threadKey{path: c.FilePath, line: c.LineStart, old: c.Side == "old"}] {
+			if err := store.MarkCommentPosted(ctx, c.ID, "superseded"); err != nil {
+				return fmt.Errorf("marking superseded comment: %w", err)
+			}
+			resp.CommentsSuperseded++
+			continue
+		}
+		id, replied, err := postInline(ctx, client, req, c, format.inline(c), threads)
+		if err != nil {
+			if errors.Is(err, provider.ErrInvalidInput) {
+				continue
+			}
+			return provider.ClassifyError(err)
+		}
+		if err := store.MarkCommentPosted(ctx, c.ID, id); err != nil {
+			return fmt.Errorf("marking comment posted: %w", err)
+		}
+		resp.CommentsReposted++
+		if replied {
+			resp.CommentsReplied++
+		}
+	}
+	return nil
+}
+
+// ApproveRequest is the input for Approve.
+type ApproveRequest struct {
+	RepoID       string `json:"repo_id"`
+	MRNumber     int    `json:"mr_number"`
+	RepoRemoteID string `json:"repo_remote_id"`
+}
+
+// ApproveResponse is the output from Approve. Reason says why the MR was not approved.
+type ApproveResponse struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// approver is implemented by providers that can approve merge requests (GitLab).
+type approver interface {
+	ApproveMR(ctx context.Context, repoRemoteID string, mrNumber int) error
+}
+
+// Approve approves the MR as the provider token's user. A provider without approvals or a
+// token that may not approve (ErrForbidden) is reported in the response, not as an error.
+func (p *PostReview) Approve(ctx restate.Context, req ApproveRequest) (ApproveResponse, error) {
+	_, prov, err := db.GetRepoWithProvider(ctx, p.pool, req.RepoID)
+	if err != nil {
+		return ApproveResponse{}, restate.TerminalError(fmt.Errorf("repo not found: %w", err), 404)
+	}
+
+	token, err := crypto.Decrypt(prov.TokenEncrypted, p.encKey)
+	if err != nil {
+		return ApproveResponse{}, restate.TerminalError(fmt.Errorf("decrypting token: %w", err), 500)
+	}
+
+	client, err := provider.FromRow(prov, string(token))
+	if err != nil {
+		return ApproveResponse{}, restate.TerminalError(err, 400)
 	}
+
+	return restate.Run(ctx, func(rc restate.RunContext) (ApproveResponse, error) {
+		return approve(rc, client, req)
+	})
 }
 
-func classifyProviderError(err error) error {
+// approve approves req's MR through client if it supports approvals.
+func approve(ctx context.Context, client provider.GitProvider, req ApproveRequest) (ApproveResponse, error) {
+	a, ok := client.(approver)
+	if !ok {
+		return ApproveResponse{Reason: "provider does not support approvals"}, nil
+	}
+	err := withProviderSlot(ctx, func() error {
+		return a.ApproveMR(ctx, req.RepoRemoteID, req.MRNumber)
+	})
 	switch {
-	case errors.Is(err, provider.ErrNotFound):
-		return restate.TerminalError(err, 404)
-	case errors.Is(err, provider.ErrUnauthorized):
-		return restate.TerminalError(err, 401)
+	case err == nil:
+		return ApproveResponse{Approved: true}, nil
 	case errors.Is(err, provider.ErrForbidden):
-		return restate.TerminalError(err, 403)
+		log.Printf("postreview: MR %d in %s not approved: token lacks approval rights", req.MRNumber, req.RepoRemoteID)
+		return ApproveResponse{Reason: "token lacks approval rights"}, nil
 	default:
-		return err
+		return ApproveResponse{}, provider.ClassifyError(err)
+	}
+}
+
+// severities lists the known comment severities, most severe first.
+var severities = []struct {
+	name, emoji, title string
+}{
+	{"blocker", "🛑", "Blocker"},
+	{"warning", "⚠️", "Warning"},
+	{"nit", "💡", "Nit"},
+}
+
+// severityLabel returns the prefix for an inline comment body of the given severity,
+// or "" if the severity is unknown.
+func severityLabel(severity string) string {
+	for _, s := range severities {
+		if s.name == severity {
+			return fmt.Sprintf("%s **%s:** ", s.emoji, s.title)
+		}
+	}
+	return ""
+}
+
+// inlineBody is the posted body of an inline comment: its severity label and text, after
+// the comment prefix.
+func inlineBody(prefix string, c db.ReviewCommentRow) string {
+	return withCommentPrefix(prefix, severityLabel(c.Severity)+c.Body)
+}
+
+// bodyFormat holds a repo's settings for the bodies of posted comments.
+type bodyFormat struct {
+	prefix   string // the repo's comment prefix (see withCommentPrefix)
+	maxBytes int    // cap on a posted body (see truncateBody); <= 0 means none
+}
+
+// inline is the posted body of inline comment c, capped at maxBytes.
+func (f bodyFormat) inline(c db.ReviewCommentRow) string {
+	return truncateBody(inlineBody(f.prefix, c), f.maxBytes)
+}
+
+// truncatedMarker ends a body cut by truncateBody.
+const truncatedMarker = "\n\n… (truncated)"
+
+// truncateBody cuts s to at most max bytes, on a UTF-8 boundary, ending it with
+// truncatedMarker so readers know text is missing. Providers reject notes over their size
+// limit (about 1 MB on GitLab), which long summaries with many folded comments can reach.
+// max <= 0 leaves s unchanged.
+func truncateBody(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	if max <= len(truncatedMarker) {
+		return cutUTF8(s, max)
+	}
+	return cutUTF8(s, max-len(truncatedMarker)) + truncatedMarker
+}
+
+// cutUTF8 returns the longest prefix of s of at most n bytes that doesn't split a rune.
+func cutUTF8(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// withCommentPrefix prepends the repo's comment prefix to body, unless body already starts
+// with it, so a re-posted or edited body never carries it twice.
+func withCommentPrefix(prefix, body string) string {
+	if prefix == "" || strings.HasPrefix(body, prefix) {
+		return body
+	}
+	return prefix + " " + body
+}
+
+// withSeverityCounts appends a per-severity tally of the inline comments to the summary.
+func withSeverityCounts(summary string, counts map[string]int) string {
+	var parts []string
+	for _, s := range severities {
+		if n := counts[s.name]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d %s", s.emoji, n, s.name))
+		}
+	}
+	if len(parts) == 0 {
+		return summary
+	}
+	return summary + "\n\n**Findings:** " + strings.Join(parts, " · ")
+}
+
+// DetailsSummaryTemplate renders the summary in a collapsible section under a header line
+// with the comment count. Selected by setting a repo's summary_template to "details".
+const DetailsSummaryTemplate = `**AI review** — {{.CommentCount}} inline comment{{if ne .CommentCount 1}}s{{end}}
+
+<details>
+<summary>Summary</summary>
+
+{{.Summary}}
+
+</details>`
+
+// summaryData holds the placeholders available to a summary template.
+type summaryData struct {
+	Summary      string
+	CommentCount int
+}
+
+// renderSummary applies a repo's summary template. An empty template posts the summary
+// as-is; a template that fails to parse or execute is logged and the plain summary used.
+func renderSummary(tmpl string, data summaryData) string {
+	switch tmpl {
+	case "":
+		return data.Summary
+	case "details":
+		tmpl = DetailsSummaryTemplate
+	}
+
+	t, err := template.New("summary").Parse(tmpl)
+	if err != nil {
+		log.Printf("postreview: invalid summary template, posting plain summary: %v", err)
+		return data.Summary
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		log.Printf("postreview: rendering summary template, posting plain summary: %v", err)
+		return data.Summary
 	}
+	return b.String()
 }
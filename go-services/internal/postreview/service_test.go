@@ -0,0 +1,1059 @@
+package postreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	restate "github.com/restatedev/sdk-go"
+
+	"ai-reviewer/go-services/internal/config"
+	"ai-reviewer/go-services/internal/db"
+	"ai-reviewer/go-services/internal/provider"
+	"ai-reviewer/go-services/internal/provider/github"
+)
+
+// stubCommentStore is an in-memory commentStore that tracks the posted flag. skipped holds
+// comments skipped by earlier runs of the MR, threads the threads they posted.
+type stubCommentStore struct {
+	comments []db.ReviewCommentRow
+	skipped  []db.ReviewCommentRow
+	threads  []db.CommentThreadRow
+	posted   map[string]string
+}
+
+func newStubCommentStore(comments ...db.ReviewCommentRow) *stubCommentStore {
+	return &stubCommentStore{comments: comments, posted: make(map[string]string)}
+}
+
+func (s *stubCommentStore) GetUnpostedComments(_ context.Context, _ string) ([]db.ReviewCommentRow, error) {
+	var out []db.ReviewCommentRow
+	for _, c := range s.comments {
+		if _, ok := s.posted[c.ID]; !ok {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubCommentStore) GetSkippedComments(_ context.Context, _ string, _ int) ([]db.ReviewCommentRow, error) {
+	var out []db.ReviewCommentRow
+	for _, c := range s.skipped {
+		if s.posted[c.ID] == "" || s.posted[c.ID] == "skipped" {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubCommentStore) GetCommentThreads(_ context.Context, _ string, _ int, _ string) ([]db.CommentThreadRow, error) {
+	return s.threads, nil
+}
+
+func (s *stubCommentStore) GetPostedCommentPositions(_ context.Context, runID string) ([]db.CommentThreadRow, error) {
+	var out []db.CommentThreadRow
+	for _, c := range s.comments {
+		id := s.posted[c.ID]
+		if c.ReviewRunID != runID || id == "" || id == "skipped" || id == "overflow" || id == "superseded" {
+			continue
+		}
+		out = append(out, db.CommentThreadRow{FilePath: c.FilePath, LineStart: c.LineStart, Side: c.Side, ProviderCommentID: id})
+	}
+	return out, nil
+}
+
+func (s *stubCommentStore) MarkCommentPosted(_ context.Context, commentID, providerCommentID string) error {
+	s.posted[commentID] = providerCommentID
+	return nil
+}
+
+// stubProvider records the order of posting calls. failOn maps a comment body to the error
+// returned for it (once).
+type stubProvider struct {
+	provider.GitProvider
+	calls  []string
+	failOn map[string]error
+	// oldSide records the bodies of inline comments posted on the old side of the diff.
+	oldSide []string
+}
+
+func (p *stubProvider) PostInlineComment(_ context.Context, _ string, _ int, c provider.InlineComment) (*provider.CommentResult, error) {
+	if err, ok := p.failOn[c.Body]; ok {
+		delete(p.failOn, c.Body)
+		return nil, err
+	}
+	p.calls = append(p.calls, c.Body)
+	if !c.NewLine {
+		p.oldSide = append(p.oldSide, c.Body)
+	}
+	return &provider.CommentResult{ID: "note-" + c.Body}, nil
+}
+
+// summaryPoster simulates the journaled summary post: it records at most one call.
+func (p *stubProvider) summaryPoster() func() error {
+	done := false
+	return func() error {
+		if !done {
+			p.calls = append(p.calls, "summary")
+			done = true
+		}
+		return nil
+	}
+}
+
+func testComments() []db.ReviewCommentRow {
+	return []db.ReviewCommentRow{
+		{ID: "c1", FilePath: "a.go", LineStart: 1, Body: "first"},
+		{ID: "c2", FilePath: "b.go", LineStart: 2, Body: "second"},
+	}
+}
+
+func TestPublish_SummaryFirst(t *testing.T) {
+	store := newStubCommentStore(testComments()...)
+	client := &stubProvider{}
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, false, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"summary", "first", "second"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+	if resp.CommentsPosted != 2 || !resp.SummaryPosted {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestPublish_SummaryLast(t *testing.T) {
+	store := newStubCommentStore(testComments()...)
+	client := &stubProvider{}
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, true, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"first", "second", "summary"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+	if resp.CommentsPosted != 2 || !resp.SummaryPosted {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestPublish_SummaryLast_MidInlineFailure(t *testing.T) {
+	store := newStubCommentStore(testComments()...)
+	client := &stubProvider{failOn: map[string]error{"second": provider.ErrRateLimited}}
+	postSummary := client.summaryPoster()
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, true, bodyFormat{}, postSummary)
+	if err == nil {
+		t.Fatal("expected error from failed inline comment")
+	}
+	if resp.SummaryPosted {
+		t.Error("summary must not be posted when an inline comment failed")
+	}
+	if want := []string{"first"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+
+	// Retry: only the failed comment is re-posted, then the summary.
+	resp, err = publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, true, bodyFormat{}, postSummary)
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if want := []string{"first", "second", "summary"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+	if resp.CommentsPosted != 1 || !resp.SummaryPosted {
+		t.Errorf("unexpected retry response: %+v", resp)
+	}
+}
+
+func TestPublish_SummaryFirst_MidInlineFailure(t *testing.T) {
+	store := newStubCommentStore(testComments()...)
+	client := &stubProvider{failOn: map[string]error{"second": provider.ErrRateLimited}}
+	postSummary := client.summaryPoster()
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, false, bodyFormat{}, postSummary)
+	if err == nil {
+		t.Fatal("expected error from failed inline comment")
+	}
+	if !resp.SummaryPosted || resp.CommentsPosted != 1 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	// Retry: the journaled summary is not posted again and "first" is not re-posted.
+	if _, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, false, bodyFormat{}, postSummary); err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if want := []string{"summary", "first", "second"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+}
+
+func TestPublish_InvalidPositionSkipped(t *testing.T) {
+	store := newStubCommentStore(testComments()...)
+	client := &stubProvider{failOn: map[string]error{"first": provider.ErrInvalidInput}}
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, true, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.posted["c1"] != "skipped" {
+		t.Errorf("expected c1 marked skipped, got %q", store.posted["c1"])
+	}
+	if resp.CommentsPosted != 1 || !resp.SummaryPosted {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestPublish_ReportsRejectedPositions(t *testing.T) {
+	store := newStubCommentStore(
+		db.ReviewCommentRow{ID: "c1", FilePath: "a.go", LineStart: 1, Body: "first"},
+		db.ReviewCommentRow{ID: "c2", FilePath: "b.go", LineStart: 7, Body: "second"},
+		db.ReviewCommentRow{ID: "c3", FilePath: "c.go", LineStart: 3, Body: "third"},
+	)
+	client := &stubProvider{failOn: map[string]error{
+		"second": fmt.Errorf("%w: line_code can't be blank", provider.ErrInvalidInput),
+	}}
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, false, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.CommentsPosted != 2 || resp.CommentsSkipped != 1 {
+		t.Fatalf("posted=%d skipped=%d, want 2 and 1", resp.CommentsPosted, resp.CommentsSkipped)
+	}
+	if len(resp.SkippedReasons) != 1 || !strings.HasPrefix(resp.SkippedReasons[0], "b.go:7: ") ||
+		!strings.Contains(resp.SkippedReasons[0], "line_code can't be blank") {
+		t.Errorf("SkippedReasons = %q", resp.SkippedReasons)
+	}
+}
+
+func TestPublish_LineOutsideDiffSkippedLocally(t *testing.T) {
+	store := newStubCommentStore(testComments()...)
+	client := &stubProvider{}
+	// Only b.go line 2 is on the new side of the diff; a.go isn't in it at all.
+	diff := "diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1,2 +1,2 @@\n package b\n-var x = 1\n+var x = 2\n"
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1", Diff: diff}, true, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.posted["c1"] != "skipped" {
+		t.Errorf("expected c1 marked skipped, got %q", store.posted["c1"])
+	}
+	if want := []string{"second", "summary"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+	if resp.CommentsPosted != 1 || resp.CommentsSkipped != 1 {
+		t.Errorf("posted=%d skipped=%d, want 1 and 1", resp.CommentsPosted, resp.CommentsSkipped)
+	}
+	if want := []string{"a.go:1: line not in diff"}; !reflect.DeepEqual(resp.SkippedReasons, want) {
+		t.Errorf("SkippedReasons = %q, want %q", resp.SkippedReasons, want)
+	}
+}
+
+func TestPublish_OldSideCommentPostedOnOldLine(t *testing.T) {
+	store := newStubCommentStore(
+		db.ReviewCommentRow{ID: "c1", FilePath: "b.go", LineStart: 2, Body: "removed", Side: "old"},
+		db.ReviewCommentRow{ID: "c2", FilePath: "b.go", LineStart: 1, Body: "context", Side: "old"},
+	)
+	client := &stubProvider{}
+	// Old line 2 of b.go is deleted and old line 1 is context; both are on the old side.
+	diff := "diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1,2 +1,2 @@\n package b\n-var x = 1\n+var x = 2\n"
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1", Diff: diff}, true, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"removed", "context"}; !reflect.DeepEqual(client.oldSide, want) {
+		t.Errorf("old-side comments = %v, want %v", client.oldSide, want)
+	}
+	if resp.CommentsPosted != 2 || resp.CommentsSkipped != 0 {
+		t.Errorf("posted=%d skipped=%d, want 2 and 0", resp.CommentsPosted, resp.CommentsSkipped)
+	}
+}
+
+func TestPublish_OldSideLineOutsideDiffSkipped(t *testing.T) {
+	store := newStubCommentStore(db.ReviewCommentRow{ID: "c1", FilePath: "b.go", LineStart: 3, Body: "gone", Side: "old"})
+	client := &stubProvider{}
+	diff := "diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1,2 +1,2 @@\n package b\n-var x = 1\n+var x = 2\n"
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1", Diff: diff}, true, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.posted["c1"] != "skipped" {
+		t.Errorf("expected c1 marked skipped, got %q", store.posted["c1"])
+	}
+	if resp.CommentsSkipped != 1 {
+		t.Errorf("skipped=%d, want 1", resp.CommentsSkipped)
+	}
+}
+
+// stubCheckRunCreator records the check runs created through it.
+type stubCheckRunCreator struct {
+	headSHA     string
+	annotations [][]github.Annotation
+	err         error
+}
+
+func (c *stubCheckRunCreator) CreateCheckRun(_ context.Context, _ string, headSHA string, annotations []github.Annotation) (int64, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.headSHA = headSHA
+	c.annotations = append(c.annotations, annotations)
+	return 42, nil
+}
+
+func TestPublishCheckRun_AnnotatesComments(t *testing.T) {
+	store := newStubCommentStore(
+		db.ReviewCommentRow{ID: "c1", FilePath: "a.go", LineStart: 1, Body: "outside", Severity: "warning"},
+		db.ReviewCommentRow{ID: "c2", FilePath: "b.go", LineStart: 2, LineEnd: 2, Body: "nil deref", Severity: "blocker"},
+		db.ReviewCommentRow{ID: "c3", FilePath: "b.go", LineStart: 2, Body: "removed", Side: "old"},
+	)
+	summary := &stubProvider{}
+	creator := &stubCheckRunCreator{}
+	diff := "diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1,2 +1,2 @@\n package b\n-var x = 1\n+var x = 2\n"
+
+	resp, err := publishCheckRun(context.Background(), store, creator, PostRequest{ReviewRunID: "run1", Diff: diff, HeadSHA: "abc"}, true, bodyFormat{}, summary.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]github.Annotation{{{Path: "b.go", StartLine: 2, EndLine: 2, Message: "nil deref", Level: github.LevelFailure}}}
+	if creator.headSHA != "abc" || !reflect.DeepEqual(creator.annotations, want) {
+		t.Errorf("check run on %q with %+v, want abc with %+v", creator.headSHA, creator.annotations, want)
+	}
+	if store.posted["c2"] != "check_run:42" || store.posted["c1"] != "skipped" || store.posted["c3"] != "skipped" {
+		t.Errorf("posted = %v", store.posted)
+	}
+	if resp.CommentsPosted != 1 || resp.CommentsSkipped != 2 || !resp.SummaryPosted {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if !reflect.DeepEqual(summary.calls, []string{"summary"}) {
+		t.Errorf("summary calls = %v", summary.calls)
+	}
+}
+
+func TestPublishCheckRun_NoComments(t *testing.T) {
+	summary := &stubProvider{}
+	creator := &stubCheckRunCreator{}
+
+	resp, err := publishCheckRun(context.Background(), newStubCommentStore(), creator, PostRequest{ReviewRunID: "run1", HeadSHA: "abc"}, false, bodyFormat{}, summary.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A clean review still gets a (successful) check run.
+	if len(creator.annotations) != 1 || len(creator.annotations[0]) != 0 {
+		t.Errorf("annotations = %+v, want one check run without annotations", creator.annotations)
+	}
+	if resp.CommentsPosted != 0 || !resp.SummaryPosted {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestPublishCheckRun_ErrorLeavesCommentsUnposted(t *testing.T) {
+	store := newStubCommentStore(testComments()...)
+	summary := &stubProvider{}
+	creator := &stubCheckRunCreator{err: provider.ErrForbidden}
+
+	_, err := publishCheckRun(context.Background(), store, creator, PostRequest{ReviewRunID: "run1", HeadSHA: "abc"}, true, bodyFormat{}, summary.summaryPoster())
+	if !restate.IsTerminalError(err) {
+		t.Fatalf("err = %v, want a terminal error", err)
+	}
+	if len(store.posted) != 0 || len(summary.calls) != 0 {
+		t.Errorf("posted = %v, summary calls = %v; want nothing after a failed check run", store.posted, summary.calls)
+	}
+}
+
+func TestPublish_RepostsSkippedCommentBackInDiff(t *testing.T) {
+	store := newStubCommentStore(db.ReviewCommentRow{ID: "c1", ReviewRunID: "run2", FilePath: "b.go", LineStart: 2, Body: "new"})
+	store.skipped = []db.ReviewCommentRow{
+		{ID: "old1", ReviewRunID: "run1", FilePath: "b.go", LineStart: 1, Body: "back in diff"},
+		{ID: "old2", ReviewRunID: "run1", FilePath: "a.go", LineStart: 1, Body: "still outside"},
+	}
+	client := &stubProvider{}
+	diff := "diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1,2 +1,2 @@\n package b\n-var x = 1\n+var x = 2\n"
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run2", Diff: diff}, true, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"new", "back in diff", "summary"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+	if store.posted["old1"] != "note-back in diff" {
+		t.Errorf("old1 posted as %q, want the provider note id", store.posted["old1"])
+	}
+	if _, ok := store.posted["old2"]; ok {
+		t.Errorf("old2 should stay skipped, got %q", store.posted["old2"])
+	}
+	if resp.CommentsPosted != 1 || resp.CommentsReposted != 1 {
+		t.Errorf("posted=%d reposted=%d, want 1 and 1", resp.CommentsPosted, resp.CommentsReposted)
+	}
+}
+
+func TestPublish_SkippedCommentOnCurrentRunLineSuperseded(t *testing.T) {
+	store := newStubCommentStore(db.ReviewCommentRow{ID: "c1", ReviewRunID: "run2", FilePath: "b.go", LineStart: 2, Body: "new"})
+	store.skipped = []db.ReviewCommentRow{
+		{ID: "old1", ReviewRunID: "run1", FilePath: "b.go", LineStart: 2, Body: "same line"},
+		// Same line number on the other side is a different position.
+		{ID: "old2", ReviewRunID: "run1", FilePath: "b.go", LineStart: 2, Body: "removed", Side: "old"},
+	}
+	client := &stubProvider{}
+	diff := "diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1,2 +1,2 @@\n package b\n-var x = 1\n+var x = 2\n"
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run2", Diff: diff}, true, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"new", "removed", "summary"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+	if store.posted["old1"] != "superseded" {
+		t.Errorf("old1 marked %q, want superseded", store.posted["old1"])
+	}
+	if resp.CommentsSuperseded != 1 || resp.CommentsReposted != 1 {
+		t.Errorf("superseded=%d reposted=%d, want 1 and 1", resp.CommentsSuperseded, resp.CommentsReposted)
+	}
+
+	// A later run doesn't pick the superseded comment up again.
+	if again, _ := store.GetSkippedComments(context.Background(), "", 0); len(again) != 0 {
+		t.Errorf("skipped comments after the run = %+v, want none", again)
+	}
+}
+
+func TestPublish_RepostRejectedStaysSkipped(t *testing.T) {
+	store := newStubCommentStore()
+	store.skipped = []db.ReviewCommentRow{{ID: "old1", ReviewRunID: "run1", FilePath: "b.go", LineStart: 2, Body: "rejected"}}
+	client := &stubProvider{failOn: map[string]error{"rejected": fmt.Errorf("%w: line_code can't be blank", provider.ErrInvalidInput)}}
+	diff := "diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1,2 +1,2 @@\n package b\n-var x = 1\n+var x = 2\n"
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run2", Diff: diff}, true, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := store.posted["old1"]; ok || resp.CommentsReposted != 0 {
+		t.Errorf("old1 posted as %q (reposted=%d), want it left skipped", store.posted["old1"], resp.CommentsReposted)
+	}
+}
+
+func TestPublish_NoRepostWithoutDiff(t *testing.T) {
+	store := newStubCommentStore()
+	store.skipped = []db.ReviewCommentRow{{ID: "old1", ReviewRunID: "run1", FilePath: "b.go", LineStart: 2, Body: "old"}}
+	client := &stubProvider{}
+
+	if _, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run2"}, true, bodyFormat{}, client.summaryPoster()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"summary"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+}
+
+func TestPublish_SeverityLabelPrefix(t *testing.T) {
+	store := newStubCommentStore(
+		db.ReviewCommentRow{ID: "c1", FilePath: "a.go", LineStart: 1, Body: "nil deref", Severity: "blocker"},
+		db.ReviewCommentRow{ID: "c2", FilePath: "b.go", LineStart: 2, Body: "plain"},
+	)
+	client := &stubProvider{}
+
+	if _, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, true, bodyFormat{}, client.summaryPoster()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"🛑 **Blocker:** nil deref", "plain", "summary"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+}
+
+func TestPublish_CommentPrefixOnce(t *testing.T) {
+	const prefix = "🤖 nitai:"
+	store := newStubCommentStore(db.ReviewCommentRow{ID: "c1", FilePath: "b.go", LineStart: 2, Body: "nil deref", Severity: "blocker"})
+	store.skipped = []db.ReviewCommentRow{{ID: "old1", ReviewRunID: "run1", FilePath: "b.go", LineStart: 1, Body: prefix + " already prefixed"}}
+	client := &stubProvider{}
+	diff := "diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1,2 +1,2 @@\n package b\n-var x = 1\n+var x = 2\n"
+
+	if _, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run2", Diff: diff}, true, bodyFormat{prefix: prefix}, client.summaryPoster()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{prefix + " 🛑 **Blocker:** nil deref", prefix + " already prefixed", "summary"}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %q, want %q", client.calls, want)
+	}
+	for _, body := range client.calls[:2] {
+		if n := strings.Count(body, prefix); n != 1 {
+			t.Errorf("prefix appears %d times in %q, want once", n, body)
+		}
+	}
+}
+
+func TestPublish_LongInlineBodyTruncated(t *testing.T) {
+	long := strings.Repeat("x", 200)
+	store := newStubCommentStore(db.ReviewCommentRow{ID: "c1", FilePath: "a.go", LineStart: 1, Body: long})
+	client := &stubProvider{}
+
+	if _, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, true, bodyFormat{maxBytes: 100}, client.summaryPoster()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.calls) != 2 {
+		t.Fatalf("calls = %q, want an inline comment and the summary", client.calls)
+	}
+	body := client.calls[0]
+	if len(body) != 100 || !strings.HasSuffix(body, truncatedMarker) {
+		t.Errorf("inline body = %q (%d bytes), want 100 bytes ending in the marker", body, len(body))
+	}
+	if store.posted["c1"] != "note-"+body {
+		t.Errorf("c1 posted as %q, want the truncated note", store.posted["c1"])
+	}
+}
+
+func TestTruncateBody(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"no cap", "hello world", 0, "hello world"},
+		{"under", "hello", 10, "hello"},
+		{"exact", "hello", 5, "hello"},
+		{"over", strings.Repeat("a", 30), 25, strings.Repeat("a", 25-len(truncatedMarker)) + truncatedMarker},
+		// "é" is two bytes; a cut between them backs off to the rune start.
+		{"rune boundary", "aé" + strings.Repeat("b", 30), 2 + len(truncatedMarker), "a" + truncatedMarker},
+		{"cap below marker", "abcdef", 3, "abc"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := truncateBody(tc.s, tc.max)
+			if got != tc.want {
+				t.Errorf("truncateBody(%q, %d) = %q, want %q", tc.s, tc.max, got, tc.want)
+			}
+			if tc.max > 0 && len(got) > tc.max {
+				t.Errorf("len = %d, over max %d", len(got), tc.max)
+			}
+		})
+	}
+}
+
+func TestWithCommentPrefix(t *testing.T) {
+	const prefix = "🤖 nitai:"
+	tests := []struct {
+		prefix, body, want string
+	}{
+		{"", "body", "body"},
+		{prefix, "body", prefix + " body"},
+		{prefix, prefix + " body", prefix + " body"},
+	}
+	for _, tc := range tests {
+		if got := withCommentPrefix(tc.prefix, tc.body); got != tc.want {
+			t.Errorf("withCommentPrefix(%q, %q) = %q, want %q", tc.prefix, tc.body, got, tc.want)
+		}
+	}
+	// Applying it again, e.g. to an edited summary, leaves the body unchanged.
+	once := withCommentPrefix(prefix, "summary")
+	if twice := withCommentPrefix(prefix, once); twice != once {
+		t.Errorf("second application changed %q to %q", once, twice)
+	}
+}
+
+func TestWithSeverityCounts(t *testing.T) {
+	got := withSeverityCounts("Looks mostly fine.", map[string]int{"nit": 3, "blocker": 1})
+	want := "Looks mostly fine.\n\n**Findings:** 🛑 1 blocker · 💡 3 nit"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := withSeverityCounts("No issues.", nil); got != "No issues." {
+		t.Errorf("expected summary unchanged without counts, got %q", got)
+	}
+}
+
+// concurrencyProvider tracks the peak number of in-flight PostInlineComment calls.
+type concurrencyProvider struct {
+	provider.GitProvider
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (p *concurrencyProvider) PostInlineComment(ctx context.Context, _ string, _ int, c provider.InlineComment) (*provider.CommentResult, error) {
+	p.mu.Lock()
+	p.inFlight++
+	if p.inFlight > p.peak {
+		p.peak = p.inFlight
+	}
+	p.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+	return &provider.CommentResult{ID: "note-" + c.Body}, nil
+}
+
+func TestPublish_ProviderConcurrencyLimit(t *testing.T) {
+	SetProviderConcurrency(1)
+	t.Cleanup(func() { SetProviderConcurrency(config.DefaultProviderMaxConcurrency) })
+
+	client := &concurrencyProvider{}
+	noSummary := func() error { return nil }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store := newStubCommentStore(testComments()...)
+			if _, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, true, bodyFormat{}, noSummary); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if client.peak != 1 {
+		t.Errorf("peak concurrent provider calls = %d, want 1", client.peak)
+	}
+}
+
+func TestWithProviderSlot_HonorsCancellation(t *testing.T) {
+	SetProviderConcurrency(1)
+	t.Cleanup(func() { SetProviderConcurrency(config.DefaultProviderMaxConcurrency) })
+
+	release := make(chan struct{})
+	held := make(chan struct{})
+	go withProviderSlot(context.Background(), func() error { //nolint:errcheck
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	called := false
+	err := withProviderSlot(ctx, func() error { called = true; return nil })
+	if err == nil || called {
+		t.Fatalf("expected cancellation while waiting for a slot, got err=%v called=%v", err, called)
+	}
+}
+
+func TestRenderSummary(t *testing.T) {
+	data := summaryData{Summary: "Two bugs found.", CommentCount: 2}
+
+	if got := renderSummary("", data); got != "Two bugs found." {
+		t.Errorf("empty template: got %q", got)
+	}
+
+	want := "**AI review** — 2 inline comments\n\n<details>\n<summary>Summary</summary>\n\nTwo bugs found.\n\n</details>"
+	if got := renderSummary("details", data); got != want {
+		t.Errorf("details template:\ngot  %q\nwant %q", got, want)
+	}
+
+	if got := renderSummary("details", summaryData{Summary: "One.", CommentCount: 1}); !strings.HasPrefix(got, "**AI review** — 1 inline comment\n") {
+		t.Errorf("details template singular: got %q", got)
+	}
+
+	if got := renderSummary("{{.CommentCount}} | {{.Summary}}", data); got != "2 | Two bugs found." {
+		t.Errorf("custom template: got %q", got)
+	}
+
+	if got := renderSummary("{{.Nope", data); got != "Two bugs found." {
+		t.Errorf("invalid template should fall back to plain summary, got %q", got)
+	}
+	if got := renderSummary("{{.Missing}}", data); got != "Two bugs found." {
+		t.Errorf("failing template should fall back to plain summary, got %q", got)
+	}
+}
+
+// approvingProvider is a stubProvider that also supports approvals.
+type approvingProvider struct {
+	stubProvider
+	err      error
+	approved []int
+}
+
+func (p *approvingProvider) ApproveMR(_ context.Context, _ string, mrNumber int) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.approved = append(p.approved, mrNumber)
+	return nil
+}
+
+func TestApprove(t *testing.T) {
+	req := ApproveRequest{RepoID: "r1", MRNumber: 7, RepoRemoteID: "5"}
+
+	t.Run("approved", func(t *testing.T) {
+		client := &approvingProvider{}
+		resp, err := approve(context.Background(), client, req)
+		if err != nil || !resp.Approved {
+			t.Fatalf("approve = %+v, %v; want approved", resp, err)
+		}
+		if !reflect.DeepEqual(client.approved, []int{7}) {
+			t.Errorf("approved MRs %v, want [7]", client.approved)
+		}
+	})
+
+	t.Run("token lacks approval rights", func(t *testing.T) {
+		resp, err := approve(context.Background(), &approvingProvider{err: provider.ErrForbidden}, req)
+		if err != nil {
+			t.Fatalf("expected ErrForbidden to be reported, not returned: %v", err)
+		}
+		if resp.Approved || resp.Reason == "" {
+			t.Errorf("got %+v, want not approved with a reason", resp)
+		}
+	})
+
+	t.Run("provider without approvals", func(t *testing.T) {
+		resp, err := approve(context.Background(), &stubProvider{}, req)
+		if err != nil || resp.Approved || resp.Reason == "" {
+			t.Errorf("approve = %+v, %v; want not approved with a reason", resp, err)
+		}
+	})
+
+	t.Run("transient error is returned", func(t *testing.T) {
+		if _, err := approve(context.Background(), &approvingProvider{err: provider.ErrRateLimited}, req); err == nil {
+			t.Error("expected the rate-limit error to be returned for retry")
+		}
+	})
+}
+
+// stubSummaryStore is an in-memory summaryStore: notes maps run id to its summary note id,
+// prior is the note of the MR's previous review.
+type stubSummaryStore struct {
+	notes map[string]string
+	prior string
+}
+
+func newStubSummaryStore() *stubSummaryStore {
+	return &stubSummaryStore{notes: make(map[string]string)}
+}
+
+func (s *stubSummaryStore) GetSummaryNoteID(_ context.Context, runID string) (string, error) {
+	return s.notes[runID], nil
+}
+
+func (s *stubSummaryStore) GetPriorSummaryNoteID(_ context.Context, _ string, _ int) (string, error) {
+	return s.prior, nil
+}
+
+func (s *stubSummaryStore) MarkSummaryPosted(_ context.Context, runID, noteID string) error {
+	s.notes[runID] = noteID
+	return nil
+}
+
+// replyingProvider is a stubProvider that can reply in threads. replyErr fails every reply.
+type replyingProvider struct {
+	stubProvider
+	replies  []string
+	replyErr error
+}
+
+func (p *replyingProvider) ReplyToDiscussion(_ context.Context, _ string, _ int, discussionID, body string) (*provider.CommentResult, error) {
+	if p.replyErr != nil {
+		return nil, p.replyErr
+	}
+	p.replies = append(p.replies, discussionID+": "+body)
+	return &provider.CommentResult{ID: "reply-" + body}, nil
+}
+
+func TestPublish_RepliesInPriorThread(t *testing.T) {
+	store := newStubCommentStore(testComments()...)
+	store.threads = []db.CommentThreadRow{
+		{FilePath: "a.go", LineStart: 1, Side: "new", ProviderCommentID: "disc1"},
+		{FilePath: "b.go", LineStart: 2, Side: "old", ProviderCommentID: "disc2"},
+	}
+	client := &replyingProvider{}
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run2"}, false, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"disc1: first"}; !reflect.DeepEqual(client.replies, want) {
+		t.Errorf("replies = %v, want %v", client.replies, want)
+	}
+	// b.go:2 has a thread on the old side only, so "second" starts a new discussion.
+	if want := []string{"summary", "second"}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+	if store.posted["c1"] != "disc1" || store.posted["c2"] != "note-second" {
+		t.Errorf("posted = %v, want c1 in disc1 and c2 as a new discussion", store.posted)
+	}
+	if resp.CommentsPosted != 2 || resp.CommentsReplied != 1 {
+		t.Errorf("posted=%d replied=%d, want 2 and 1", resp.CommentsPosted, resp.CommentsReplied)
+	}
+}
+
+func TestPublish_ReplyFallsBackWhenThreadGone(t *testing.T) {
+	store := newStubCommentStore(testComments()[0])
+	store.threads = []db.CommentThreadRow{{FilePath: "a.go", LineStart: 1, Side: "new", ProviderCommentID: "disc1"}}
+	client := &replyingProvider{replyErr: provider.ErrNotFound}
+
+	resp, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run2"}, true, bodyFormat{}, client.summaryPoster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.posted["c1"] != "note-first" || resp.CommentsReplied != 0 {
+		t.Errorf("c1 posted as %q (replied=%d), want a new discussion", store.posted["c1"], resp.CommentsReplied)
+	}
+}
+
+func TestPublish_ReplyErrorIsReturned(t *testing.T) {
+	store := newStubCommentStore(testComments()[0])
+	store.threads = []db.CommentThreadRow{{FilePath: "a.go", LineStart: 1, Side: "new", ProviderCommentID: "disc1"}}
+	client := &replyingProvider{replyErr: provider.ErrRateLimited}
+
+	_, err := publish(context.Background(), store, client, PostRequest{ReviewRunID: "run2"}, true, bodyFormat{}, client.summaryPoster())
+	if !errors.Is(err, provider.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if _, ok := store.posted["c1"]; ok || len(client.calls) != 0 {
+		t.Errorf("c1 posted as %q with calls %v, want nothing posted", store.posted["c1"], client.calls)
+	}
+}
+
+// notePoster records summary posts and updates. postErr fails the next PostComment;
+// updateErr fails every UpdateComment.
+type notePoster struct {
+	provider.GitProvider
+	posts     []string
+	updates   []string
+	postErr   error
+	updateErr error
+}
+
+func (p *notePoster) PostComment(_ context.Context, _ string, _ int, body string) (*provider.CommentResult, error) {
+	if err := p.postErr; err != nil {
+		p.postErr = nil
+		return nil, err
+	}
+	p.posts = append(p.posts, body)
+	return &provider.CommentResult{ID: fmt.Sprintf("note-%d", len(p.posts))}, nil
+}
+
+func (p *notePoster) UpdateComment(_ context.Context, _ string, _ int, noteID, body string) (*provider.CommentResult, error) {
+	if p.updateErr != nil {
+		return nil, p.updateErr
+	}
+	p.updates = append(p.updates, noteID+": "+body)
+	return &provider.CommentResult{ID: noteID}, nil
+}
+
+func TestPostSummaryNote_RetryUpdatesInsteadOfDuplicating(t *testing.T) {
+	store := newStubSummaryStore()
+	client := &notePoster{}
+	req := PostRequest{ReviewRunID: "run1"}
+
+	id, err := postSummaryNote(context.Background(), store, client, req, "summary v1", false, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "note-1" || store.notes["run1"] != "note-1" {
+		t.Fatalf("id = %q, stored = %q, want note-1", id, store.notes["run1"])
+	}
+
+	// Retry of the same run: the stored note is updated, nothing new is posted.
+	id, err = postSummaryNote(context.Background(), store, client, req, "summary v2", false, "")
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if id != "note-1" {
+		t.Errorf("retry id = %q, want note-1", id)
+	}
+	if want := []string{"summary v1"}; !reflect.DeepEqual(client.posts, want) {
+		t.Errorf("posts = %v, want %v", client.posts, want)
+	}
+	if want := []string{"note-1: summary v2"}; !reflect.DeepEqual(client.updates, want) {
+		t.Errorf("updates = %v, want %v", client.updates, want)
+	}
+}
+
+func TestPostSummaryNote_RetryWithoutUpdateSupportSkips(t *testing.T) {
+	store := newStubSummaryStore()
+	store.notes["run1"] = "note-9"
+	client := &notePoster{updateErr: provider.ErrNotFound}
+
+	id, err := postSummaryNote(context.Background(), store, client, PostRequest{ReviewRunID: "run1"}, "summary", true, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "note-9" || len(client.posts) != 0 {
+		t.Errorf("id = %q, posts = %v; want the stored note and no post", id, client.posts)
+	}
+}
+
+func TestPostSummaryNote_FailedPostNotRecorded(t *testing.T) {
+	store := newStubSummaryStore()
+	client := &notePoster{postErr: provider.ErrRateLimited}
+	req := PostRequest{ReviewRunID: "run1"}
+
+	if _, err := postSummaryNote(context.Background(), store, client, req, "summary", false, ""); err == nil {
+		t.Fatal("expected error from failed post")
+	}
+	if _, ok := store.notes["run1"]; ok {
+		t.Error("a failed post must not be recorded")
+	}
+
+	if _, err := postSummaryNote(context.Background(), store, client, req, "summary", false, ""); err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if len(client.posts) != 1 || store.notes["run1"] != "note-1" {
+		t.Errorf("posts = %v, stored = %q; want one post recorded as note-1", client.posts, store.notes["run1"])
+	}
+}
+
+func TestPostSummaryNote_InPlaceUpdatesPriorReview(t *testing.T) {
+	store := newStubSummaryStore()
+	store.prior = "note-3"
+	client := &notePoster{}
+	req := PostRequest{ReviewRunID: "run2", RepoID: "repo1", MRNumber: 7}
+
+	// Without inPlace a re-review posts a fresh note.
+	if _, err := postSummaryNote(context.Background(), newStubSummaryStore(), client, req, "new", false, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.posts) != 1 || len(client.updates) != 0 {
+		t.Fatalf("posts = %v, updates = %v; want one post", client.posts, client.updates)
+	}
+
+	client = &notePoster{}
+	id, err := postSummaryNote(context.Background(), store, client, req, "re-review", true, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "note-3" || store.notes["run2"] != "note-3" {
+		t.Errorf("id = %q, stored = %q; want the prior note recorded on the run", id, store.notes["run2"])
+	}
+	if want := []string{"note-3: re-review"}; !reflect.DeepEqual(client.updates, want) || len(client.posts) != 0 {
+		t.Errorf("updates = %v, posts = %v; want only %v", client.updates, client.posts, want)
+	}
+}
+
+func TestPostSummaryNote_InPlaceFallsBackWhenPriorGone(t *testing.T) {
+	store := newStubSummaryStore()
+	store.prior = "note-3"
+	client := &notePoster{updateErr: provider.ErrNotFound}
+
+	id, err := postSummaryNote(context.Background(), store, client, PostRequest{ReviewRunID: "run2"}, "re-review", true, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "note-1" || store.notes["run2"] != "note-1" || len(client.posts) != 1 {
+		t.Errorf("id = %q, stored = %q, posts = %v; want a new note", id, store.notes["run2"], client.posts)
+	}
+}
+
+func TestPostSummaryNote_InPlaceUpdateErrorFails(t *testing.T) {
+	store := newStubSummaryStore()
+	store.prior = "note-3"
+	client := &notePoster{updateErr: provider.ErrRateLimited}
+
+	if _, err := postSummaryNote(context.Background(), store, client, PostRequest{ReviewRunID: "run2"}, "re-review", true, ""); err == nil {
+		t.Fatal("expected error from failed update")
+	}
+	if len(client.posts) != 0 {
+		t.Errorf("posts = %v; a transient update error must not post a new note", client.posts)
+	}
+}
+
+func TestReplacePriorSummaryNote(t *testing.T) {
+	req := PostRequest{ReviewRunID: "run2", RepoID: "repo1", MRNumber: 7}
+
+	store := newStubSummaryStore()
+	store.prior = "note-3"
+	client := &notePoster{}
+	id, err := replacePriorSummaryNote(context.Background(), store, client, req, "no issues", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "note-3" || store.notes["run2"] != "note-3" {
+		t.Errorf("id = %q, stored = %q; want the prior note recorded on the run", id, store.notes["run2"])
+	}
+	if want := []string{"note-3: no issues"}; !reflect.DeepEqual(client.updates, want) || len(client.posts) != 0 {
+		t.Errorf("updates = %v, posts = %v; want only %v", client.updates, client.posts, want)
+	}
+
+	// Without a previous note, or one that can't be edited, nothing is posted.
+	for name, client := range map[string]*notePoster{"no prior": {}, "forbidden": {updateErr: provider.ErrForbidden}} {
+		store := newStubSummaryStore()
+		if name != "no prior" {
+			store.prior = "note-3"
+		}
+		if _, err := replacePriorSummaryNote(context.Background(), store, client, req, "no issues", ""); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+		if len(client.posts) != 0 || store.notes["run2"] != "" {
+			t.Errorf("%s: posts = %v, stored = %q; want nothing", name, client.posts, store.notes["run2"])
+		}
+	}
+}
+
+// listingNotePoster is a notePoster whose provider can list the MR's notes.
+type listingNotePoster struct {
+	notePoster
+	notes []provider.Note
+}
+
+func (p *listingNotePoster) ListMRNotes(_ context.Context, _ string, _ int) ([]provider.Note, error) {
+	return p.notes, nil
+}
+
+func TestPostSummaryNote_InPlaceEditsBotNoteFoundOnProvider(t *testing.T) {
+	store := newStubSummaryStore() // no prior note in the DB, e.g. after a restore
+	client := &listingNotePoster{notes: []provider.Note{
+		{ID: "41", Body: "LGTM from a human"},
+		{ID: "40", Body: "🤖 nitai: old summary"},
+		{ID: "12", Body: "🤖 nitai: older summary"},
+	}}
+
+	id, err := postSummaryNote(context.Background(), store, client, PostRequest{ReviewRunID: "run2"}, "🤖 nitai: re-review", true, "🤖 nitai:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "40" || store.notes["run2"] != "40" {
+		t.Errorf("id = %q, stored = %q; want the newest bot note", id, store.notes["run2"])
+	}
+	if want := []string{"40: 🤖 nitai: re-review"}; !reflect.DeepEqual(client.updates, want) || len(client.posts) != 0 {
+		t.Errorf("updates = %v, posts = %v; want only %v", client.updates, client.posts, want)
+	}
+}
+
+func TestPostSummaryNote_InPlaceNoBotNoteOnProviderPosts(t *testing.T) {
+	store := newStubSummaryStore()
+	client := &listingNotePoster{notes: []provider.Note{{ID: "41", Body: "LGTM from a human"}}}
+
+	id, err := postSummaryNote(context.Background(), store, client, PostRequest{ReviewRunID: "run2"}, "🤖 nitai: review", true, "🤖 nitai:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "note-1" || len(client.posts) != 1 || len(client.updates) != 0 {
+		t.Errorf("id = %q, posts = %v, updates = %v; want a new note", id, client.posts, client.updates)
+	}
+}
+
+func TestPostSummaryNote_InPlaceHumanNoteWithPrefixPosts(t *testing.T) {
+	store := newStubSummaryStore()
+	// A human quoted the prefix; editing their note is forbidden to the bot's token.
+	client := &listingNotePoster{
+		notePoster: notePoster{updateErr: provider.ErrForbidden},
+		notes:      []provider.Note{{ID: "41", Body: "🤖 nitai: why did you flag this?"}},
+	}
+
+	id, err := postSummaryNote(context.Background(), store, client, PostRequest{ReviewRunID: "run2"}, "🤖 nitai: review", true, "🤖 nitai:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "note-1" || store.notes["run2"] != "note-1" || len(client.posts) != 1 {
+		t.Errorf("id = %q, stored = %q, posts = %v; want a new note", id, store.notes["run2"], client.posts)
+	}
+}
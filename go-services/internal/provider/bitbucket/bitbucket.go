@@ -0,0 +1,308 @@
+package bitbucket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ai-reviewer/go-services/internal/provider"
+)
+
+// DefaultBaseURL is the Bitbucket Cloud API root.
+const DefaultBaseURL = "https://api.bitbucket.org"
+
+// Client is a Bitbucket Cloud REST API 2.0 client. Repo remote IDs are
+// "workspace/repo_slug".
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client (useful for testing).
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.httpClient = c
+	}
+}
+
+// New creates a Bitbucket Cloud client. baseURL is the API root (DefaultBaseURL),
+// without a trailing slash. token is either an OAuth access token, sent as a bearer
+// token, or "username:app_password", sent with basic auth.
+func New(baseURL, token string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: http.DefaultClient,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// ── HTTP helpers ──────────────────────────────────────────────────────────────
+
+func (c *Client) newRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if user, pass, ok := strings.Cut(c.token, ":"); ok {
+		req.SetBasicAuth(user, pass)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	return c.httpClient.Do(req)
+}
+
+func checkStatus(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusUnauthorized:
+		return provider.ErrUnauthorized
+	case http.StatusForbidden:
+		return provider.ErrForbidden
+	case http.StatusNotFound:
+		return provider.ErrNotFound
+	case http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity:
+		// The request itself is wrong (bad inline anchor, conflicting state); retrying won't help.
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: %s", provider.ErrInvalidInput, strings.TrimSpace(string(body)))
+	case http.StatusTooManyRequests:
+		return provider.ErrRateLimited
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("bitbucket: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+
+func decodeJSON(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// get performs a GET and returns the response after checking its status.
+func (c *Client) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// pullURL returns the API URL of a pull request in a "workspace/repo_slug" repo.
+func (c *Client) pullURL(repoRemoteID string, mrNumber int) (string, error) {
+	workspace, slug, ok := strings.Cut(repoRemoteID, "/")
+	if !ok || workspace == "" || slug == "" || strings.Contains(slug, "/") {
+		return "", fmt.Errorf("%w: bitbucket remote id %q is not workspace/repo_slug", provider.ErrInvalidInput, repoRemoteID)
+	}
+	return fmt.Sprintf("%s/2.0/repositories/%s/%s/pullrequests/%d",
+		c.baseURL, url.PathEscape(workspace), url.PathEscape(slug), mrNumber), nil
+}
+
+// ── ListRepos ─────────────────────────────────────────────────────────────────
+
+// ListRepos returns all repositories the authenticated user is a member of,
+// following the "next" page URL.
+func (c *Client) ListRepos(ctx context.Context) ([]provider.Repo, error) {
+	var repos []provider.Repo
+	next := c.baseURL + "/2.0/repositories?role=member&pagelen=100"
+
+	for next != "" {
+		resp, err := c.get(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		var page bitbucketRepoPage
+		if err := decodeJSON(resp, &page); err != nil {
+			return nil, fmt.Errorf("bitbucket: decode repositories: %w", err)
+		}
+
+		for _, r := range page.Values {
+			repo := provider.Repo{
+				RemoteID: r.FullName,
+				Name:     r.Name,
+				FullPath: r.FullName,
+			}
+			for _, l := range r.Links.Clone {
+				if l.Name == "https" {
+					repo.HTTPURL = l.Href
+				}
+			}
+			repos = append(repos, repo)
+		}
+
+		next = page.Next
+	}
+
+	return repos, nil
+}
+
+// ── GetMRDetails ──────────────────────────────────────────────────────────────
+
+// GetMRDetails returns metadata for the given pull request. HeadSHA is the source
+// commit hash as reported by Bitbucket, which is abbreviated.
+func (c *Client) GetMRDetails(ctx context.Context, repoRemoteID string, mrNumber int) (*provider.MRDetails, error) {
+	u, err := c.pullURL(repoRemoteID, mrNumber)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	var pr bitbucketPR
+	if err := decodeJSON(resp, &pr); err != nil {
+		return nil, fmt.Errorf("bitbucket: decode pull request: %w", err)
+	}
+
+	author := pr.Author.Nickname
+	if author == "" {
+		author = pr.Author.DisplayName
+	}
+	return &provider.MRDetails{
+		Title:        pr.Title,
+		Description:  pr.Description,
+		Author:       author,
+		SourceBranch: pr.Source.Branch.Name,
+		TargetBranch: pr.Destination.Branch.Name,
+		HeadSHA:      pr.Source.Commit.Hash,
+		Draft:        pr.Draft,
+		State:        prState(pr.State),
+	}, nil
+}
+
+// prState maps a Bitbucket pull request state to an MRDetails state.
+func prState(state string) string {
+	switch state {
+	case "OPEN":
+		return provider.MRStateOpened
+	case "MERGED":
+		return provider.MRStateMerged
+	case "DECLINED", "SUPERSEDED":
+		return provider.MRStateClosed
+	}
+	return ""
+}
+
+// ── GetMRDiff ────────────────────────────────────────────────────────────────
+
+// GetMRDiff returns the unified diff for the given pull request. Bitbucket's /diff
+// endpoint redirects to a git-format diff, which is used as-is and only split per file.
+func (c *Client) GetMRDiff(ctx context.Context, repoRemoteID string, mrNumber int) (*provider.MRDiff, error) {
+	u, err := c.pullURL(repoRemoteID, mrNumber)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.get(ctx, u+"/diff")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket: read diff: %w", err)
+	}
+
+	unified := string(raw)
+	files, total := provider.ParseUnifiedDiff(unified)
+	return &provider.MRDiff{
+		UnifiedDiff:  unified,
+		ChangedFiles: files,
+		ChangedLines: total,
+	}, nil
+}
+
+// ── GetFileContent ────────────────────────────────────────────────────────────
+
+// GetFileContent is not implemented yet and always returns provider.ErrNotFound.
+func (c *Client) GetFileContent(ctx context.Context, repoRemoteID string, ref, path string, maxBytes int) ([]byte, error) {
+	return nil, provider.ErrNotFound
+}
+
+// ── Comments ──────────────────────────────────────────────────────────────────
+
+// PostComment posts a top-level comment on the pull request.
+func (c *Client) PostComment(ctx context.Context, repoRemoteID string, mrNumber int, body string) (*provider.CommentResult, error) {
+	var comment bitbucketComment
+	comment.Content.Raw = body
+	return c.postComment(ctx, repoRemoteID, mrNumber, comment)
+}
+
+// UpdateComment is not implemented yet and always returns provider.ErrNotFound.
+func (c *Client) UpdateComment(ctx context.Context, repoRemoteID string, mrNumber int, providerCommentID, body string) (*provider.CommentResult, error) {
+	return nil, provider.ErrNotFound
+}
+
+// PostInlineComment posts a comment anchored to a file line via Bitbucket's inline
+// anchor ("to" for the new side, "from" for the old side).
+func (c *Client) PostInlineComment(ctx context.Context, repoRemoteID string, mrNumber int, comment provider.InlineComment) (*provider.CommentResult, error) {
+	inline := &bitbucketInline{Path: comment.FilePath}
+	if comment.NewLine {
+		inline.To = comment.Line
+	} else {
+		inline.From = comment.Line
+	}
+
+	var bc bitbucketComment
+	bc.Content.Raw = comment.Body
+	bc.Inline = inline
+	return c.postComment(ctx, repoRemoteID, mrNumber, bc)
+}
+
+func (c *Client) postComment(ctx context.Context, repoRemoteID string, mrNumber int, comment bitbucketComment) (*provider.CommentResult, error) {
+	u, err := c.pullURL(repoRemoteID, mrNumber)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(comment)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, u+"/comments", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	var created bitbucketComment
+	if err := decodeJSON(resp, &created); err != nil {
+		return nil, fmt.Errorf("bitbucket: decode comment: %w", err)
+	}
+	return &provider.CommentResult{ID: strconv.FormatInt(created.ID, 10)}, nil
+}
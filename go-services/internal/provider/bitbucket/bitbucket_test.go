@@ -0,0 +1,243 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ai-reviewer/go-services/internal/provider"
+)
+
+// ── helpers ───────────────────────────────────────────────────────────────────
+
+func newTestServer(t *testing.T, routes map[string]http.HandlerFunc) (*httptest.Server, *Client) {
+	t.Helper()
+	mux := http.NewServeMux()
+	for path, h := range routes {
+		mux.HandleFunc(path, h)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c := New(srv.URL, "test-token", WithHTTPClient(srv.Client()))
+	return srv, c
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// ── auth ──────────────────────────────────────────────────────────────────────
+
+func TestAuth(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		writeJSON(w, bitbucketRepoPage{})
+	}))
+	t.Cleanup(srv.Close)
+
+	if _, err := New(srv.URL, "oauth-token").ListRepos(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotAuth != "Bearer oauth-token" {
+		t.Errorf("OAuth token: Authorization = %q", gotAuth)
+	}
+
+	if _, err := New(srv.URL, "alice:app-pass").ListRepos(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotAuth != "Basic YWxpY2U6YXBwLXBhc3M=" {
+		t.Errorf("app password: Authorization = %q", gotAuth)
+	}
+}
+
+// ── ListRepos ─────────────────────────────────────────────────────────────────
+
+func TestListRepos_FollowsNext(t *testing.T) {
+	var srvURL string
+	srv, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/2.0/repositories": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "2" {
+				writeJSON(w, map[string]any{
+					"values": []map[string]any{{"name": "api", "full_name": "acme/api"}},
+				})
+				return
+			}
+			writeJSON(w, map[string]any{
+				"values": []map[string]any{{
+					"name": "web", "full_name": "acme/web",
+					"links": map[string]any{"clone": []map[string]string{
+						{"name": "https", "href": "https://bitbucket.org/acme/web.git"},
+						{"name": "ssh", "href": "git@bitbucket.org:acme/web.git"},
+					}},
+				}},
+				"next": srvURL + "/2.0/repositories?role=member&pagelen=100&page=2",
+			})
+		},
+	})
+	srvURL = srv.URL
+
+	repos, err := c.ListRepos(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("expected 2 repos, got %d", len(repos))
+	}
+	if repos[0].RemoteID != "acme/web" || repos[0].HTTPURL != "https://bitbucket.org/acme/web.git" {
+		t.Errorf("unexpected first repo: %+v", repos[0])
+	}
+	if repos[1].RemoteID != "acme/api" {
+		t.Errorf("unexpected second repo: %+v", repos[1])
+	}
+}
+
+// ── GetMRDetails ──────────────────────────────────────────────────────────────
+
+func TestGetMRDetails(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/2.0/repositories/acme/web/pullrequests/7": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]any{
+				"title": "Add login", "description": "desc", "draft": true, "state": "DECLINED",
+				"author":      map[string]string{"nickname": "alice"},
+				"source":      map[string]any{"branch": map[string]string{"name": "feat"}, "commit": map[string]string{"hash": "abc123"}},
+				"destination": map[string]any{"branch": map[string]string{"name": "main"}},
+			})
+		},
+	})
+
+	d, err := c.GetMRDetails(context.Background(), "acme/web", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Title != "Add login" || d.Author != "alice" || d.SourceBranch != "feat" || d.TargetBranch != "main" || d.HeadSHA != "abc123" || !d.Draft || d.State != provider.MRStateClosed {
+		t.Errorf("unexpected details: %+v", d)
+	}
+}
+
+func TestGetMRDetails_NotFound(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{})
+	if _, err := c.GetMRDetails(context.Background(), "acme/web", 7); !errors.Is(err, provider.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// ── GetMRDiff ────────────────────────────────────────────────────────────────
+
+func TestGetMRDiff_FollowsRedirect(t *testing.T) {
+	const diff = "diff --git a/main.go b/main.go\n" +
+		"index 1111111..2222222 100644\n" +
+		"--- a/main.go\n" +
+		"+++ b/main.go\n" +
+		"@@ -1,2 +1,2 @@\n" +
+		" package main\n" +
+		"-func a() {}\n" +
+		"+func b() {}\n"
+
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/2.0/repositories/acme/web/pullrequests/7/diff": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/2.0/repositories/acme/web/diff/acme/web:abc%0Ddef", http.StatusFound)
+		},
+		"/2.0/repositories/acme/web/diff/": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(diff))
+		},
+	})
+
+	d, err := c.GetMRDiff(context.Background(), "acme/web", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.UnifiedDiff != diff {
+		t.Errorf("expected diff to be passed through, got:\n%s", d.UnifiedDiff)
+	}
+	if d.ChangedLines != 2 || len(d.ChangedFiles) != 1 || d.ChangedFiles[0].NewPath != "main.go" {
+		t.Errorf("unexpected diff summary: lines=%d files=%+v", d.ChangedLines, d.ChangedFiles)
+	}
+}
+
+// ── Comments ──────────────────────────────────────────────────────────────────
+
+func TestPostComment(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/2.0/repositories/acme/web/pullrequests/7/comments": func(w http.ResponseWriter, r *http.Request) {
+			var req bitbucketComment
+			json.NewDecoder(r.Body).Decode(&req)
+			if r.Method != http.MethodPost || req.Content.Raw != "hello" || req.Inline != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, map[string]any{"id": 101})
+		},
+	})
+
+	res, err := c.PostComment(context.Background(), "acme/web", 7, "hello")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.ID != "101" {
+		t.Errorf("expected ID=101, got %s", res.ID)
+	}
+}
+
+func TestPostInlineComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		newLine  bool
+		wantTo   int
+		wantFrom int
+	}{
+		{name: "new side", newLine: true, wantTo: 12},
+		{name: "old side", newLine: false, wantFrom: 12},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, c := newTestServer(t, map[string]http.HandlerFunc{
+				"/2.0/repositories/acme/web/pullrequests/7/comments": func(w http.ResponseWriter, r *http.Request) {
+					var req bitbucketComment
+					json.NewDecoder(r.Body).Decode(&req)
+					if req.Inline == nil || req.Inline.Path != "main.go" || req.Inline.To != tc.wantTo || req.Inline.From != tc.wantFrom {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					w.WriteHeader(http.StatusCreated)
+					writeJSON(w, map[string]any{"id": 102})
+				},
+			})
+
+			res, err := c.PostInlineComment(context.Background(), "acme/web", 7, provider.InlineComment{
+				FilePath: "main.go", Line: 12, Body: "look", NewLine: tc.newLine,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.ID != "102" {
+				t.Errorf("expected ID=102, got %s", res.ID)
+			}
+		})
+	}
+}
+
+func TestPostInlineComment_Rejected(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/2.0/repositories/acme/web/pullrequests/7/comments": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		},
+	})
+
+	_, err := c.PostInlineComment(context.Background(), "acme/web", 7, provider.InlineComment{FilePath: "x", Line: 1, NewLine: true})
+	if !errors.Is(err, provider.ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestInvalidRemoteID(t *testing.T) {
+	c := New("http://unused", "t")
+	if _, err := c.PostComment(context.Background(), "just-a-slug", 1, "x"); !errors.Is(err, provider.ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput, got %v", err)
+	}
+}
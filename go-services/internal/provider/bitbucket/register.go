@@ -0,0 +1,16 @@
+package bitbucket
+
+import "ai-reviewer/go-services/internal/provider"
+
+func init() {
+	provider.Register("bitbucket_cloud", newFromConfig)
+}
+
+// newFromConfig builds a Bitbucket Cloud client, defaulting to DefaultBaseURL.
+func newFromConfig(cfg provider.Config) (provider.GitProvider, error) {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return New(baseURL, cfg.Token), nil
+}
@@ -0,0 +1,62 @@
+package bitbucket
+
+// bitbucketRepoPage maps a page of GET /2.0/repositories. Next is the absolute URL of
+// the following page and is empty on the last one.
+type bitbucketRepoPage struct {
+	Values []bitbucketRepo `json:"values"`
+	Next   string          `json:"next"`
+}
+
+// bitbucketRepo is a repository item within bitbucketRepoPage.
+type bitbucketRepo struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"` // "workspace/repo_slug"
+	Links    struct {
+		Clone []struct {
+			Name string `json:"name"`
+			Href string `json:"href"`
+		} `json:"clone"`
+	} `json:"links"`
+}
+
+// bitbucketPR maps the response from GET /2.0/repositories/:workspace/:repo/pullrequests/:id.
+type bitbucketPR struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Draft       bool   `json:"draft"`
+	State       string `json:"state"` // OPEN, MERGED, DECLINED or SUPERSEDED
+	Author      struct {
+		Nickname    string `json:"nickname"`
+		DisplayName string `json:"display_name"`
+	} `json:"author"`
+	Source      bitbucketEndpoint `json:"source"`
+	Destination bitbucketEndpoint `json:"destination"`
+}
+
+// bitbucketEndpoint is the source or destination of a pull request.
+type bitbucketEndpoint struct {
+	Branch struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+	Commit struct {
+		Hash string `json:"hash"`
+	} `json:"commit"`
+}
+
+// bitbucketComment is both the request and response body of
+// POST /2.0/repositories/:workspace/:repo/pullrequests/:id/comments.
+type bitbucketComment struct {
+	ID      int64 `json:"id,omitempty"`
+	Content struct {
+		Raw string `json:"raw"`
+	} `json:"content"`
+	Inline *bitbucketInline `json:"inline,omitempty"`
+}
+
+// bitbucketInline anchors a comment to a file line. To is a line on the new side,
+// From a line on the old side; exactly one is set.
+type bitbucketInline struct {
+	Path string `json:"path"`
+	To   int    `json:"to,omitempty"`
+	From int    `json:"from,omitempty"`
+}
@@ -0,0 +1,311 @@
+package gitea
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ai-reviewer/go-services/internal/provider"
+)
+
+// pageSize is the page size requested from list endpoints. Gitea caps it at the
+// instance's MAX_RESPONSE_ITEMS (50 by default).
+const pageSize = 50
+
+// Client is a Gitea REST API v1 client. Repo remote IDs are "owner/repo".
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client (useful for testing).
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.httpClient = c
+	}
+}
+
+// New creates a Gitea client. baseURL should be the Gitea instance root
+// (e.g. "https://gitea.example.com"), without a trailing slash.
+func New(baseURL, token string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: http.DefaultClient,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// ── HTTP helpers ──────────────────────────────────────────────────────────────
+
+func (c *Client) newRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	return c.httpClient.Do(req)
+}
+
+func checkStatus(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusUnauthorized:
+		return provider.ErrUnauthorized
+	case http.StatusForbidden:
+		return provider.ErrForbidden
+	case http.StatusNotFound:
+		return provider.ErrNotFound
+	case http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity:
+		// The request itself is wrong (bad position, conflicting state); retrying won't help.
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: %s", provider.ErrInvalidInput, strings.TrimSpace(string(body)))
+	case http.StatusTooManyRequests:
+		return provider.ErrRateLimited
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("gitea: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+
+func decodeJSON(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// get performs a GET and returns the response after checking its status.
+func (c *Client) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// post sends v as JSON and decodes the response into out.
+func (c *Client) post(ctx context.Context, u string, v, out any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return err
+	}
+	return decodeJSON(resp, out)
+}
+
+// repoURL returns the API URL of an "owner/repo" remote ID.
+func (c *Client) repoURL(repoRemoteID string) (string, error) {
+	owner, repo, ok := strings.Cut(repoRemoteID, "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return "", fmt.Errorf("%w: gitea remote id %q is not owner/repo", provider.ErrInvalidInput, repoRemoteID)
+	}
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s", c.baseURL, url.PathEscape(owner), url.PathEscape(repo)), nil
+}
+
+// ── ListRepos ─────────────────────────────────────────────────────────────────
+
+// ListRepos returns all repositories the authenticated user can access, paging until
+// a short page is returned.
+func (c *Client) ListRepos(ctx context.Context) ([]provider.Repo, error) {
+	var repos []provider.Repo
+
+	for page := 1; ; page++ {
+		resp, err := c.get(ctx, fmt.Sprintf("%s/api/v1/user/repos?limit=%d&page=%d", c.baseURL, pageSize, page))
+		if err != nil {
+			return nil, err
+		}
+		var items []giteaRepo
+		if err := decodeJSON(resp, &items); err != nil {
+			return nil, fmt.Errorf("gitea: decode repos: %w", err)
+		}
+
+		for _, r := range items {
+			repos = append(repos, provider.Repo{
+				RemoteID: r.FullName,
+				Name:     r.Name,
+				FullPath: r.FullName,
+				HTTPURL:  r.CloneURL,
+			})
+		}
+
+		if len(items) < pageSize {
+			return repos, nil
+		}
+	}
+}
+
+// ── GetMRDetails ──────────────────────────────────────────────────────────────
+
+// GetMRDetails returns metadata for the given pull request. Gitea has no draft flag;
+// pulls whose title carries Gitea's default work-in-progress prefix are reported as drafts.
+func (c *Client) GetMRDetails(ctx context.Context, repoRemoteID string, mrNumber int) (*provider.MRDetails, error) {
+	base, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.get(ctx, fmt.Sprintf("%s/pulls/%d", base, mrNumber))
+	if err != nil {
+		return nil, err
+	}
+
+	var pr giteaPull
+	if err := decodeJSON(resp, &pr); err != nil {
+		return nil, fmt.Errorf("gitea: decode pull: %w", err)
+	}
+
+	return &provider.MRDetails{
+		Title:        pr.Title,
+		Description:  pr.Body,
+		Author:       pr.User.Login,
+		SourceBranch: pr.Head.Ref,
+		TargetBranch: pr.Base.Ref,
+		HeadSHA:      pr.Head.SHA,
+		Draft:        isWorkInProgress(pr.Title),
+		State:        pullState(pr),
+	}, nil
+}
+
+// pullState maps a Gitea pull's state to an MRDetails state; a merged pull is "closed" too.
+func pullState(pr giteaPull) string {
+	switch {
+	case pr.Merged:
+		return provider.MRStateMerged
+	case pr.State == "closed":
+		return provider.MRStateClosed
+	case pr.State == "open":
+		return provider.MRStateOpened
+	}
+	return ""
+}
+
+// isWorkInProgress reports whether a pull title starts with one of Gitea's default
+// WORK_IN_PROGRESS_PREFIXES.
+func isWorkInProgress(title string) bool {
+	upper := strings.ToUpper(strings.TrimSpace(title))
+	return strings.HasPrefix(upper, "WIP:") || strings.HasPrefix(upper, "[WIP]")
+}
+
+// ── GetMRDiff ────────────────────────────────────────────────────────────────
+
+// GetMRDiff returns the unified diff for the given pull request. Gitea's .diff endpoint
+// already returns git's format with headers, so it is used as-is and only split per file.
+func (c *Client) GetMRDiff(ctx context.Context, repoRemoteID string, mrNumber int) (*provider.MRDiff, error) {
+	base, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.get(ctx, fmt.Sprintf("%s/pulls/%d.diff", base, mrNumber))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("gitea: read diff: %w", err)
+	}
+
+	unified := string(raw)
+	files, total := provider.ParseUnifiedDiff(unified)
+	return &provider.MRDiff{
+		UnifiedDiff:  unified,
+		ChangedFiles: files,
+		ChangedLines: total,
+	}, nil
+}
+
+// ── GetFileContent ────────────────────────────────────────────────────────────
+
+// GetFileContent is not implemented yet and always returns provider.ErrNotFound.
+func (c *Client) GetFileContent(ctx context.Context, repoRemoteID string, ref, path string, maxBytes int) ([]byte, error) {
+	return nil, provider.ErrNotFound
+}
+
+// ── PostComment ───────────────────────────────────────────────────────────────
+
+// PostComment posts a top-level comment on the pull request's conversation.
+func (c *Client) PostComment(ctx context.Context, repoRemoteID string, mrNumber int, body string) (*provider.CommentResult, error) {
+	base, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	var comment giteaComment
+	if err := c.post(ctx, fmt.Sprintf("%s/issues/%d/comments", base, mrNumber), map[string]string{"body": body}, &comment); err != nil {
+		return nil, err
+	}
+	return &provider.CommentResult{ID: strconv.FormatInt(comment.ID, 10)}, nil
+}
+
+// ── UpdateComment ─────────────────────────────────────────────────────────────
+
+// UpdateComment is not implemented yet and always returns provider.ErrNotFound.
+func (c *Client) UpdateComment(ctx context.Context, repoRemoteID string, mrNumber int, providerCommentID, body string) (*provider.CommentResult, error) {
+	return nil, provider.ErrNotFound
+}
+
+// ── PostInlineComment ─────────────────────────────────────────────────────────
+
+// PostInlineComment posts a line comment by creating a single-comment review on the
+// pull request's head. The returned ID is the review's ID.
+func (c *Client) PostInlineComment(ctx context.Context, repoRemoteID string, mrNumber int, comment provider.InlineComment) (*provider.CommentResult, error) {
+	base, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := giteaReviewComment{Path: comment.FilePath, Body: comment.Body}
+	if comment.NewLine {
+		rc.NewPosition = comment.Line
+	} else {
+		rc.OldPosition = comment.Line
+	}
+
+	var review giteaReview
+	err = c.post(ctx, fmt.Sprintf("%s/pulls/%d/reviews", base, mrNumber), map[string]any{
+		"event":    "COMMENT",
+		"comments": []giteaReviewComment{rc},
+	}, &review)
+	if err != nil {
+		return nil, err
+	}
+	return &provider.CommentResult{ID: strconv.FormatInt(review.ID, 10)}, nil
+}
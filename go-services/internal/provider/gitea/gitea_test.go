@@ -0,0 +1,299 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ai-reviewer/go-services/internal/provider"
+)
+
+// ── helpers ───────────────────────────────────────────────────────────────────
+
+func newTestServer(t *testing.T, routes map[string]http.HandlerFunc) (*httptest.Server, *Client) {
+	t.Helper()
+	mux := http.NewServeMux()
+	for path, h := range routes {
+		mux.HandleFunc(path, h)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c := New(srv.URL, "test-token", WithHTTPClient(srv.Client()))
+	return srv, c
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// ── ListRepos ─────────────────────────────────────────────────────────────────
+
+func TestListRepos_MultiPage(t *testing.T) {
+	full := make([]giteaRepo, pageSize)
+	for i := range full {
+		full[i] = giteaRepo{ID: int64(i + 1), Name: "r", FullName: "acme/r"}
+	}
+	last := []giteaRepo{{ID: 99, Name: "app", FullName: "acme/app", CloneURL: "https://gitea.example/acme/app.git"}}
+
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v1/user/repos": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "token test-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch r.URL.Query().Get("page") {
+			case "1":
+				writeJSON(w, full)
+			case "2":
+				writeJSON(w, last)
+			default:
+				t.Errorf("unexpected page %q", r.URL.Query().Get("page"))
+			}
+		},
+	})
+
+	repos, err := c.ListRepos(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repos) != pageSize+1 {
+		t.Fatalf("expected %d repos, got %d", pageSize+1, len(repos))
+	}
+	r := repos[len(repos)-1]
+	if r.RemoteID != "acme/app" || r.FullPath != "acme/app" || r.HTTPURL != "https://gitea.example/acme/app.git" {
+		t.Errorf("unexpected repo fields: %+v", r)
+	}
+}
+
+func TestListRepos_Unauthorized(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v1/user/repos": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+	})
+
+	if _, err := c.ListRepos(context.Background()); !errors.Is(err, provider.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+// ── GetMRDetails ──────────────────────────────────────────────────────────────
+
+func TestGetMRDetails(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v1/repos/acme/app/pulls/5": func(w http.ResponseWriter, r *http.Request) {
+			pr := giteaPull{Title: "WIP: add feature", Body: "desc", Head: giteaBranch{Ref: "feat", SHA: "abc"}, Base: giteaBranch{Ref: "main"}}
+			pr.User.Login = "alice"
+			writeJSON(w, pr)
+		},
+	})
+
+	d, err := c.GetMRDetails(context.Background(), "acme/app", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Title != "WIP: add feature" || d.Author != "alice" || d.SourceBranch != "feat" || d.TargetBranch != "main" || d.HeadSHA != "abc" {
+		t.Errorf("unexpected details: %+v", d)
+	}
+	if !d.Draft {
+		t.Error("expected WIP-prefixed pull to be a draft")
+	}
+}
+
+func TestPullState(t *testing.T) {
+	tests := []struct {
+		pr   giteaPull
+		want string
+	}{
+		{giteaPull{State: "open"}, provider.MRStateOpened},
+		{giteaPull{State: "closed"}, provider.MRStateClosed},
+		{giteaPull{State: "closed", Merged: true}, provider.MRStateMerged},
+		{giteaPull{}, ""},
+	}
+	for _, tc := range tests {
+		if got := pullState(tc.pr); got != tc.want {
+			t.Errorf("pullState(%+v) = %q, want %q", tc.pr, got, tc.want)
+		}
+	}
+}
+
+func TestGetMRDetails_InvalidRemoteID(t *testing.T) {
+	c := New("http://unused", "t")
+	if _, err := c.GetMRDetails(context.Background(), "42", 1); !errors.Is(err, provider.ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+// ── GetMRDiff ────────────────────────────────────────────────────────────────
+
+const sampleDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@
+ package main
+-func a() {}
++func b() {}
++func c() {}
+diff --git a/new.txt b/new.txt
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++hello
+diff --git a/logo.png b/logo.png
+new file mode 100644
+index 0000000..4444444
+Binary files /dev/null and b/logo.png differ
+diff --git a/old.go b/renamed.go
+similarity index 100%
+rename from old.go
+rename to renamed.go
+`
+
+func TestGetMRDiff(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v1/repos/acme/app/pulls/5.diff": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(sampleDiff))
+		},
+	})
+
+	diff, err := c.GetMRDiff(context.Background(), "acme/app", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff.UnifiedDiff != sampleDiff {
+		t.Error("expected Gitea's diff to be passed through unchanged")
+	}
+	if diff.ChangedLines != 4 {
+		t.Errorf("expected 4 changed lines, got %d", diff.ChangedLines)
+	}
+	if len(diff.ChangedFiles) != 4 {
+		t.Fatalf("expected 4 files, got %d: %+v", len(diff.ChangedFiles), diff.ChangedFiles)
+	}
+
+	mod, added, bin, ren := diff.ChangedFiles[0], diff.ChangedFiles[1], diff.ChangedFiles[2], diff.ChangedFiles[3]
+	if mod.NewPath != "main.go" || mod.NewFile || mod.Diff == "" || mod.Diff[:2] != "@@" {
+		t.Errorf("unexpected modified file: %+v", mod)
+	}
+	if !added.NewFile || added.NewPath != "new.txt" {
+		t.Errorf("unexpected added file: %+v", added)
+	}
+	if !bin.Binary || bin.NewPath != "logo.png" {
+		t.Errorf("unexpected binary file: %+v", bin)
+	}
+	if !ren.Renamed || ren.OldPath != "old.go" || ren.NewPath != "renamed.go" {
+		t.Errorf("unexpected renamed file: %+v", ren)
+	}
+}
+
+func TestGetMRDiff_NotFound(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{})
+
+	if _, err := c.GetMRDiff(context.Background(), "acme/app", 99); !errors.Is(err, provider.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// ── PostComment ───────────────────────────────────────────────────────────────
+
+func TestPostComment(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v1/repos/acme/app/issues/5/comments": func(w http.ResponseWriter, r *http.Request) {
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if r.Method != http.MethodPost || req["body"] != "hello" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, giteaComment{ID: 7})
+		},
+	})
+
+	res, err := c.PostComment(context.Background(), "acme/app", 5, "hello")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.ID != "7" {
+		t.Errorf("expected ID=7, got %s", res.ID)
+	}
+}
+
+// ── PostInlineComment ─────────────────────────────────────────────────────────
+
+func TestPostInlineComment(t *testing.T) {
+	tests := []struct {
+		name    string
+		newLine bool
+		wantNew int
+		wantOld int
+	}{
+		{name: "new side", newLine: true, wantNew: 10},
+		{name: "old side", newLine: false, wantOld: 10},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, c := newTestServer(t, map[string]http.HandlerFunc{
+				"/api/v1/repos/acme/app/pulls/5/reviews": func(w http.ResponseWriter, r *http.Request) {
+					var req struct {
+						Event    string               `json:"event"`
+						Comments []giteaReviewComment `json:"comments"`
+					}
+					json.NewDecoder(r.Body).Decode(&req)
+					if req.Event != "COMMENT" || len(req.Comments) != 1 {
+						w.WriteHeader(http.StatusUnprocessableEntity)
+						return
+					}
+					rc := req.Comments[0]
+					if rc.Path != "main.go" || rc.NewPosition != tc.wantNew || rc.OldPosition != tc.wantOld {
+						w.WriteHeader(http.StatusUnprocessableEntity)
+						return
+					}
+					writeJSON(w, giteaReview{ID: 3})
+				},
+			})
+
+			res, err := c.PostInlineComment(context.Background(), "acme/app", 5, provider.InlineComment{
+				FilePath: "main.go", Line: 10, Body: "look", NewLine: tc.newLine,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.ID != "3" {
+				t.Errorf("expected ID=3, got %s", res.ID)
+			}
+		})
+	}
+}
+
+func TestPostInlineComment_Rejected(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v1/repos/acme/app/pulls/5/reviews": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		},
+	})
+
+	_, err := c.PostInlineComment(context.Background(), "acme/app", 5, provider.InlineComment{FilePath: "x", Line: 1})
+	if !errors.Is(err, provider.ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestRegisteredType_RequiresBaseURL(t *testing.T) {
+	if _, err := provider.New("gitea", provider.Config{Token: "tok"}); err == nil {
+		t.Fatal("expected an error without a base URL")
+	}
+	p, err := provider.New("gitea", provider.Config{BaseURL: "https://gitea.example.com", Token: "tok"})
+	if err != nil {
+		t.Fatalf("provider.New: %v", err)
+	}
+	if _, ok := p.(*Client); !ok {
+		t.Fatalf("provider.New returned %T, want *Client", p)
+	}
+}
@@ -0,0 +1,20 @@
+package gitea
+
+import (
+	"fmt"
+
+	"ai-reviewer/go-services/internal/provider"
+)
+
+func init() {
+	provider.Register("gitea", newFromConfig)
+}
+
+// newFromConfig builds a client for a Gitea instance; there is no public default, so the
+// base URL is required.
+func newFromConfig(cfg provider.Config) (provider.GitProvider, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("gitea provider requires a base URL")
+	}
+	return New(cfg.BaseURL, cfg.Token), nil
+}
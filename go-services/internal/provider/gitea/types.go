@@ -0,0 +1,47 @@
+package gitea
+
+// giteaRepo maps a repository item from GET /api/v1/user/repos.
+type giteaRepo struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+}
+
+// giteaPull maps the response from GET /api/v1/repos/:owner/:repo/pulls/:index.
+type giteaPull struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	User  struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Head   giteaBranch `json:"head"`
+	Base   giteaBranch `json:"base"`
+	State  string      `json:"state"` // "open" or "closed"
+	Merged bool        `json:"merged"`
+}
+
+// giteaBranch is the head or base of a pull request.
+type giteaBranch struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+// giteaComment maps the response from POST /api/v1/repos/:owner/:repo/issues/:index/comments.
+type giteaComment struct {
+	ID int64 `json:"id"`
+}
+
+// giteaReview maps the response from POST /api/v1/repos/:owner/:repo/pulls/:index/reviews.
+type giteaReview struct {
+	ID int64 `json:"id"`
+}
+
+// giteaReviewComment is an inline comment within a create-review request.
+// Exactly one of NewPosition/OldPosition is set; they are file line numbers.
+type giteaReviewComment struct {
+	Path        string `json:"path"`
+	Body        string `json:"body"`
+	NewPosition int    `json:"new_position,omitempty"`
+	OldPosition int    `json:"old_position,omitempty"`
+}
@@ -0,0 +1,477 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ai-reviewer/go-services/internal/provider"
+)
+
+// DefaultBaseURL is the github.com API root.
+const DefaultBaseURL = "https://api.github.com"
+
+// pageSize is the page size requested from list endpoints (GitHub's maximum).
+const pageSize = 100
+
+// CheckRunName is the name the review's check run is shown under on the PR.
+const CheckRunName = "AI review"
+
+// maxAnnotationsPerRequest is GitHub's limit on annotations in one check-run create or
+// update; the rest are added by further updates.
+const maxAnnotationsPerRequest = 50
+
+// Annotation levels of a check run, from least to most severe.
+const (
+	LevelNotice  = "notice"
+	LevelWarning = "warning"
+	LevelFailure = "failure"
+)
+
+// Annotation is a check-run annotation on a range of lines of a file at the head commit.
+type Annotation struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	Message   string
+	// Level is one of LevelNotice, LevelWarning or LevelFailure.
+	Level string
+}
+
+// AnnotationLevel maps a review comment severity to an annotation level: blockers fail
+// the check, warnings warn and anything else is a notice.
+func AnnotationLevel(severity string) string {
+	switch severity {
+	case "blocker":
+		return LevelFailure
+	case "warning":
+		return LevelWarning
+	default:
+		return LevelNotice
+	}
+}
+
+// Client is a GitHub REST API client. Repo remote IDs are "owner/repo". Besides
+// provider.GitProvider it can post a review as a check run (CreateCheckRun).
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client (useful for testing).
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.httpClient = c
+	}
+}
+
+// New creates a GitHub client. baseURL is the API root (DefaultBaseURL, or
+// "https://ghe.example.com/api/v3" for GitHub Enterprise Server).
+func New(baseURL, token string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: http.DefaultClient,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// ── HTTP helpers ──────────────────────────────────────────────────────────────
+
+func (c *Client) newRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func checkStatus(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusUnauthorized:
+		return provider.ErrUnauthorized
+	case http.StatusForbidden:
+		// GitHub signals an exhausted rate limit with 403 and no remaining requests.
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			return provider.ErrRateLimited
+		}
+		return provider.ErrForbidden
+	case http.StatusNotFound:
+		return provider.ErrNotFound
+	case http.StatusUnprocessableEntity:
+		// Validation failed (e.g. a line outside the diff); retrying won't help.
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: %s", provider.ErrInvalidInput, strings.TrimSpace(string(body)))
+	case http.StatusTooManyRequests:
+		return provider.ErrRateLimited
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("github: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+
+// get performs a GET with the given Accept media type ("" keeps the JSON default) and
+// returns the response after checking its status.
+func (c *Client) get(ctx context.Context, u, accept string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// send sends v as JSON with the given method and decodes the response into out.
+func (c *Client) send(ctx context.Context, method, u string, v, out any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, method, u, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// repoURL returns the API URL of an "owner/repo" remote ID.
+func (c *Client) repoURL(repoRemoteID string) (string, error) {
+	owner, repo, ok := strings.Cut(repoRemoteID, "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return "", fmt.Errorf("%w: github remote id %q is not owner/repo", provider.ErrInvalidInput, repoRemoteID)
+	}
+	return fmt.Sprintf("%s/repos/%s/%s", c.baseURL, url.PathEscape(owner), url.PathEscape(repo)), nil
+}
+
+// ── ListRepos ─────────────────────────────────────────────────────────────────
+
+// ListRepos returns all repositories the authenticated user can access, paging until
+// a short page is returned.
+func (c *Client) ListRepos(ctx context.Context) ([]provider.Repo, error) {
+	var repos []provider.Repo
+
+	for page := 1; ; page++ {
+		resp, err := c.get(ctx, fmt.Sprintf("%s/user/repos?per_page=%d&page=%d", c.baseURL, pageSize, page), "")
+		if err != nil {
+			return nil, err
+		}
+		var items []githubRepo
+		err = json.NewDecoder(resp.Body).Decode(&items)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("github: decode repos: %w", err)
+		}
+
+		for _, r := range items {
+			repos = append(repos, provider.Repo{
+				RemoteID: r.FullName,
+				Name:     r.Name,
+				FullPath: r.FullName,
+				HTTPURL:  r.CloneURL,
+			})
+		}
+
+		if len(items) < pageSize {
+			return repos, nil
+		}
+	}
+}
+
+// ── GetMRDetails ──────────────────────────────────────────────────────────────
+
+// GetMRDetails returns metadata for the given pull request.
+func (c *Client) GetMRDetails(ctx context.Context, repoRemoteID string, mrNumber int) (*provider.MRDetails, error) {
+	base, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.get(ctx, fmt.Sprintf("%s/pulls/%d", base, mrNumber), "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var pr githubPull
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return nil, fmt.Errorf("github: decode pull: %w", err)
+	}
+
+	return &provider.MRDetails{
+		Title:        pr.Title,
+		Description:  pr.Body,
+		Author:       pr.User.Login,
+		SourceBranch: pr.Head.Ref,
+		TargetBranch: pr.Base.Ref,
+		HeadSHA:      pr.Head.SHA,
+		Draft:        pr.Draft,
+		State:        pullState(pr),
+	}, nil
+}
+
+// pullState maps a GitHub pull's state to an MRDetails state; a merged pull is "closed" too.
+func pullState(pr githubPull) string {
+	switch {
+	case pr.Merged:
+		return provider.MRStateMerged
+	case pr.State == "closed":
+		return provider.MRStateClosed
+	case pr.State == "open":
+		return provider.MRStateOpened
+	}
+	return ""
+}
+
+// ── GetMRDiff ────────────────────────────────────────────────────────────────
+
+// GetMRDiff returns the unified diff for the given pull request. GitHub's diff media type
+// already returns git's format with headers, so it is used as-is and only split per file.
+func (c *Client) GetMRDiff(ctx context.Context, repoRemoteID string, mrNumber int) (*provider.MRDiff, error) {
+	base, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.get(ctx, fmt.Sprintf("%s/pulls/%d", base, mrNumber), "application/vnd.github.diff")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("github: read diff: %w", err)
+	}
+
+	unified := string(raw)
+	files, total := provider.ParseUnifiedDiff(unified)
+	return &provider.MRDiff{
+		UnifiedDiff:  unified,
+		ChangedFiles: files,
+		ChangedLines: total,
+	}, nil
+}
+
+// ── GetFileContent ────────────────────────────────────────────────────────────
+
+// GetFileContent returns the raw content of path at ref via the contents API, reading at
+// most maxBytes+1 bytes so a huge file isn't buffered whole.
+func (c *Client) GetFileContent(ctx context.Context, repoRemoteID string, ref, path string, maxBytes int) ([]byte, error) {
+	base, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/contents/%s?ref=%s", base, (&url.URL{Path: path}).EscapedPath(), url.QueryEscape(ref))
+	resp, err := c.get(ctx, u, "application/vnd.github.raw")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("github: read file %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// ── PostComment ───────────────────────────────────────────────────────────────
+
+// PostComment posts a top-level comment on the pull request's conversation.
+func (c *Client) PostComment(ctx context.Context, repoRemoteID string, mrNumber int, body string) (*provider.CommentResult, error) {
+	base, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	var comment githubComment
+	if err := c.send(ctx, http.MethodPost, fmt.Sprintf("%s/issues/%d/comments", base, mrNumber), map[string]string{"body": body}, &comment); err != nil {
+		return nil, err
+	}
+	return &provider.CommentResult{ID: strconv.FormatInt(comment.ID, 10)}, nil
+}
+
+// ── UpdateComment ─────────────────────────────────────────────────────────────
+
+// UpdateComment replaces the body of a comment posted with PostComment. GitHub addresses
+// issue comments by ID alone, so mrNumber is unused.
+func (c *Client) UpdateComment(ctx context.Context, repoRemoteID string, mrNumber int, providerCommentID, body string) (*provider.CommentResult, error) {
+	base, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(providerCommentID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: github comment id %q", provider.ErrInvalidInput, providerCommentID)
+	}
+
+	var comment githubComment
+	if err := c.send(ctx, http.MethodPatch, fmt.Sprintf("%s/issues/comments/%d", base, id), map[string]string{"body": body}, &comment); err != nil {
+		return nil, err
+	}
+	return &provider.CommentResult{ID: strconv.FormatInt(comment.ID, 10)}, nil
+}
+
+// ── PostInlineComment ─────────────────────────────────────────────────────────
+
+// PostInlineComment posts a line comment by creating a single-comment review on the
+// pull request's head. The returned ID is the review's ID.
+func (c *Client) PostInlineComment(ctx context.Context, repoRemoteID string, mrNumber int, comment provider.InlineComment) (*provider.CommentResult, error) {
+	base, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := githubReviewComment{Path: comment.FilePath, Line: comment.Line, Side: "RIGHT", Body: comment.Body}
+	if !comment.NewLine {
+		rc.Side = "LEFT"
+	}
+
+	var review githubReview
+	err = c.send(ctx, http.MethodPost, fmt.Sprintf("%s/pulls/%d/reviews", base, mrNumber), map[string]any{
+		"event":    "COMMENT",
+		"comments": []githubReviewComment{rc},
+	}, &review)
+	if err != nil {
+		return nil, err
+	}
+	return &provider.CommentResult{ID: strconv.FormatInt(review.ID, 10)}, nil
+}
+
+// ── CreateCheckRun ────────────────────────────────────────────────────────────
+
+// CreateCheckRun creates a completed check run on headSHA carrying the annotations and
+// returns its ID. The conclusion is "failure" when any annotation is LevelFailure,
+// "neutral" when there are other annotations and "success" when there are none. GitHub
+// accepts 50 annotations per request, so the rest are appended by updating the run.
+func (c *Client) CreateCheckRun(ctx context.Context, repoRemoteID, headSHA string, annotations []Annotation) (int64, error) {
+	repoBase, err := c.repoURL(repoRemoteID)
+	if err != nil {
+		return 0, err
+	}
+	base := repoBase + "/check-runs"
+	first, rest := splitAnnotations(annotations)
+
+	var created githubCheckRun
+	if err := c.send(ctx, http.MethodPost, base, newCheckRunRequest(headSHA, annotations, first), &created); err != nil {
+		return 0, fmt.Errorf("github: create check run: %w", err)
+	}
+	for len(rest) > 0 {
+		var batch []Annotation
+		batch, rest = splitAnnotations(rest)
+		update := githubCheckRunUpdate{Output: checkRunOutput(annotations, batch)}
+		if err := c.send(ctx, http.MethodPatch, fmt.Sprintf("%s/%d", base, created.ID), update, nil); err != nil {
+			return created.ID, fmt.Errorf("github: add check run annotations: %w", err)
+		}
+	}
+	return created.ID, nil
+}
+
+// splitAnnotations returns the first request's worth of annotations and the remainder.
+func splitAnnotations(a []Annotation) (batch, rest []Annotation) {
+	if len(a) <= maxAnnotationsPerRequest {
+		return a, nil
+	}
+	return a[:maxAnnotationsPerRequest], a[maxAnnotationsPerRequest:]
+}
+
+// newCheckRunRequest builds the create payload; all is every annotation of the run, batch
+// the ones sent with this request.
+func newCheckRunRequest(headSHA string, all, batch []Annotation) githubCheckRunRequest {
+	return githubCheckRunRequest{
+		Name:       CheckRunName,
+		HeadSHA:    headSHA,
+		Status:     "completed",
+		Conclusion: checkRunConclusion(all),
+		Output:     checkRunOutput(all, batch),
+	}
+}
+
+func checkRunOutput(all, batch []Annotation) githubCheckRunOutput {
+	out := githubCheckRunOutput{
+		Title:       fmt.Sprintf("%d finding(s)", len(all)),
+		Summary:     checkRunSummary(all),
+		Annotations: make([]githubAnnotation, len(batch)),
+	}
+	for i, a := range batch {
+		end := a.EndLine
+		if end < a.StartLine {
+			end = a.StartLine
+		}
+		out.Annotations[i] = githubAnnotation{
+			Path:            a.Path,
+			StartLine:       a.StartLine,
+			EndLine:         end,
+			AnnotationLevel: a.Level,
+			Message:         a.Message,
+		}
+	}
+	return out
+}
+
+func checkRunConclusion(all []Annotation) string {
+	if len(all) == 0 {
+		return "success"
+	}
+	for _, a := range all {
+		if a.Level == LevelFailure {
+			return "failure"
+		}
+	}
+	return "neutral"
+}
+
+func checkRunSummary(all []Annotation) string {
+	if len(all) == 0 {
+		return "No issues found."
+	}
+	counts := map[string]int{}
+	for _, a := range all {
+		counts[a.Level]++
+	}
+	var parts []string
+	for _, level := range []string{LevelFailure, LevelWarning, LevelNotice} {
+		if n := counts[level]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, level))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
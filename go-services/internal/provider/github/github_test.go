@@ -0,0 +1,396 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ai-reviewer/go-services/internal/provider"
+)
+
+// ── helpers ───────────────────────────────────────────────────────────────────
+
+func newTestServer(t *testing.T, routes map[string]http.HandlerFunc) (*httptest.Server, *Client) {
+	t.Helper()
+	mux := http.NewServeMux()
+	for path, h := range routes {
+		mux.HandleFunc(path, h)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c := New(srv.URL, "test-token", WithHTTPClient(srv.Client()))
+	return srv, c
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// ── ListRepos ─────────────────────────────────────────────────────────────────
+
+func TestListRepos_MultiPage(t *testing.T) {
+	full := make([]githubRepo, pageSize)
+	for i := range full {
+		full[i] = githubRepo{ID: int64(i + 1), Name: "r", FullName: "acme/r"}
+	}
+	last := []githubRepo{{ID: 99, Name: "app", FullName: "acme/app", CloneURL: "https://github.com/acme/app.git"}}
+
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /user/repos": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer test-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch r.URL.Query().Get("page") {
+			case "1":
+				writeJSON(w, full)
+			case "2":
+				writeJSON(w, last)
+			default:
+				t.Errorf("unexpected page %q", r.URL.Query().Get("page"))
+			}
+		},
+	})
+
+	repos, err := c.ListRepos(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repos) != pageSize+1 {
+		t.Fatalf("expected %d repos, got %d", pageSize+1, len(repos))
+	}
+	r := repos[len(repos)-1]
+	if r.RemoteID != "acme/app" || r.FullPath != "acme/app" || r.HTTPURL != "https://github.com/acme/app.git" {
+		t.Errorf("unexpected repo fields: %+v", r)
+	}
+}
+
+// ── GetMRDetails ──────────────────────────────────────────────────────────────
+
+func TestGetMRDetails(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /repos/acme/app/pulls/5": func(w http.ResponseWriter, r *http.Request) {
+			pr := githubPull{Title: "add feature", Body: "desc", Head: githubBranch{Ref: "feat", SHA: "abc"}, Base: githubBranch{Ref: "main"}, State: "open", Draft: true}
+			pr.User.Login = "alice"
+			writeJSON(w, pr)
+		},
+	})
+
+	d, err := c.GetMRDetails(context.Background(), "acme/app", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Title != "add feature" || d.Author != "alice" || d.SourceBranch != "feat" || d.TargetBranch != "main" || d.HeadSHA != "abc" {
+		t.Errorf("unexpected details: %+v", d)
+	}
+	if !d.Draft || d.State != provider.MRStateOpened {
+		t.Errorf("draft = %v, state = %q; want a draft opened pull", d.Draft, d.State)
+	}
+}
+
+func TestGetMRDetails_InvalidRemoteID(t *testing.T) {
+	c := New("http://unused", "t")
+	if _, err := c.GetMRDetails(context.Background(), "42", 1); !errors.Is(err, provider.ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+// ── GetMRDiff ────────────────────────────────────────────────────────────────
+
+func TestGetMRDiff(t *testing.T) {
+	const diff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,2 @@
+ package main
+-func a() {}
++func b() {}
+`
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /repos/acme/app/pulls/5": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Accept") != "application/vnd.github.diff" {
+				t.Errorf("Accept = %q", r.Header.Get("Accept"))
+			}
+			w.Write([]byte(diff))
+		},
+	})
+
+	d, err := c.GetMRDiff(context.Background(), "acme/app", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.UnifiedDiff != diff || d.ChangedLines != 2 || len(d.ChangedFiles) != 1 || d.ChangedFiles[0].NewPath != "main.go" {
+		t.Errorf("unexpected diff: %+v", d)
+	}
+}
+
+// ── GetFileContent ────────────────────────────────────────────────────────────
+
+func TestGetFileContent(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"GET /repos/acme/app/contents/src/main.go": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("ref") != "abc" || r.Header.Get("Accept") != "application/vnd.github.raw" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("package main\n"))
+		},
+	})
+
+	got, err := c.GetFileContent(context.Background(), "acme/app", "abc", "src/main.go", 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// At most maxBytes+1 bytes are read.
+	if string(got) != "packa" {
+		t.Errorf("content = %q, want %q", got, "packa")
+	}
+}
+
+// ── PostComment / UpdateComment ───────────────────────────────────────────────
+
+func TestPostComment(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"POST /repos/acme/app/issues/5/comments": func(w http.ResponseWriter, r *http.Request) {
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["body"] != "hello" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, githubComment{ID: 7})
+		},
+	})
+
+	res, err := c.PostComment(context.Background(), "acme/app", 5, "hello")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.ID != "7" {
+		t.Errorf("expected ID=7, got %s", res.ID)
+	}
+}
+
+func TestUpdateComment(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"PATCH /repos/acme/app/issues/comments/7": func(w http.ResponseWriter, r *http.Request) {
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["body"] != "edited" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			writeJSON(w, githubComment{ID: 7})
+		},
+	})
+
+	res, err := c.UpdateComment(context.Background(), "acme/app", 5, "7", "edited")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.ID != "7" {
+		t.Errorf("expected ID=7, got %s", res.ID)
+	}
+	if _, err := c.UpdateComment(context.Background(), "acme/app", 5, "skipped", "edited"); !errors.Is(err, provider.ErrInvalidInput) {
+		t.Errorf("non-numeric id: expected ErrInvalidInput, got %v", err)
+	}
+}
+
+// ── PostInlineComment ─────────────────────────────────────────────────────────
+
+func TestPostInlineComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		newLine  bool
+		wantSide string
+	}{
+		{name: "new side", newLine: true, wantSide: "RIGHT"},
+		{name: "old side", newLine: false, wantSide: "LEFT"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, c := newTestServer(t, map[string]http.HandlerFunc{
+				"POST /repos/acme/app/pulls/5/reviews": func(w http.ResponseWriter, r *http.Request) {
+					var req struct {
+						Event    string                `json:"event"`
+						Comments []githubReviewComment `json:"comments"`
+					}
+					json.NewDecoder(r.Body).Decode(&req)
+					if req.Event != "COMMENT" || len(req.Comments) != 1 {
+						w.WriteHeader(http.StatusUnprocessableEntity)
+						return
+					}
+					rc := req.Comments[0]
+					if rc.Path != "main.go" || rc.Line != 10 || rc.Side != tc.wantSide {
+						w.WriteHeader(http.StatusUnprocessableEntity)
+						return
+					}
+					writeJSON(w, githubReview{ID: 3})
+				},
+			})
+
+			res, err := c.PostInlineComment(context.Background(), "acme/app", 5, provider.InlineComment{
+				FilePath: "main.go", Line: 10, Body: "look", NewLine: tc.newLine,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.ID != "3" {
+				t.Errorf("expected ID=3, got %s", res.ID)
+			}
+		})
+	}
+}
+
+func TestRegisteredType_DefaultsToGitHubCom(t *testing.T) {
+	p, err := provider.New("github", provider.Config{Token: "tok"})
+	if err != nil {
+		t.Fatalf("provider.New: %v", err)
+	}
+	c, ok := p.(*Client)
+	if !ok {
+		t.Fatalf("provider.New returned %T, want *Client", p)
+	}
+	if c.baseURL != DefaultBaseURL {
+		t.Errorf("baseURL = %q, want %q", c.baseURL, DefaultBaseURL)
+	}
+}
+
+// ── CreateCheckRun ────────────────────────────────────────────────────────────
+
+func TestCreateCheckRun_Payload(t *testing.T) {
+	var got map[string]any
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"POST /repos/acme/app/check-runs": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer test-token" {
+				t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+			}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, githubCheckRun{ID: 7})
+		},
+	})
+
+	id, err := c.CreateCheckRun(context.Background(), "acme/app", "abc123", []Annotation{
+		{Path: "a.go", StartLine: 3, EndLine: 5, Message: "nil deref", Level: AnnotationLevel("blocker")},
+		{Path: "b.go", StartLine: 9, Message: "naming", Level: AnnotationLevel("nit")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != 7 {
+		t.Errorf("id = %d, want 7", id)
+	}
+
+	if got["name"] != CheckRunName || got["head_sha"] != "abc123" || got["status"] != "completed" || got["conclusion"] != "failure" {
+		t.Errorf("payload = %v", got)
+	}
+	output := got["output"].(map[string]any)
+	if output["summary"] != "1 failure, 1 notice" {
+		t.Errorf("summary = %q", output["summary"])
+	}
+	annotations := output["annotations"].([]any)
+	want := []map[string]any{
+		{"path": "a.go", "start_line": float64(3), "end_line": float64(5), "annotation_level": "failure", "message": "nil deref"},
+		// A single-line comment without an end line ends where it starts.
+		{"path": "b.go", "start_line": float64(9), "end_line": float64(9), "annotation_level": "notice", "message": "naming"},
+	}
+	if len(annotations) != len(want) {
+		t.Fatalf("annotations = %v", annotations)
+	}
+	for i, a := range annotations {
+		for k, v := range want[i] {
+			if a.(map[string]any)[k] != v {
+				t.Errorf("annotation %d %s = %v, want %v", i, k, a.(map[string]any)[k], v)
+			}
+		}
+	}
+}
+
+func TestCreateCheckRun_BatchesAnnotations(t *testing.T) {
+	var created, updated []int
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"POST /repos/acme/app/check-runs": func(w http.ResponseWriter, r *http.Request) {
+			var body githubCheckRunRequest
+			json.NewDecoder(r.Body).Decode(&body)
+			created = append(created, len(body.Output.Annotations))
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, githubCheckRun{ID: 7})
+		},
+		"PATCH /repos/acme/app/check-runs/7": func(w http.ResponseWriter, r *http.Request) {
+			var body githubCheckRunUpdate
+			json.NewDecoder(r.Body).Decode(&body)
+			updated = append(updated, len(body.Output.Annotations))
+			writeJSON(w, githubCheckRun{ID: 7})
+		},
+	})
+
+	annotations := make([]Annotation, 2*maxAnnotationsPerRequest+1)
+	for i := range annotations {
+		annotations[i] = Annotation{Path: fmt.Sprintf("f%d.go", i), StartLine: 1, Level: LevelWarning}
+	}
+	if _, err := c.CreateCheckRun(context.Background(), "acme/app", "abc123", annotations); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(created) != "[50]" || fmt.Sprint(updated) != "[50 1]" {
+		t.Errorf("created with %v, updated with %v annotations", created, updated)
+	}
+}
+
+func TestCreateCheckRun_Conclusion(t *testing.T) {
+	tests := []struct {
+		levels []string
+		want   string
+	}{
+		{levels: nil, want: "success"},
+		{levels: []string{LevelNotice, LevelWarning}, want: "neutral"},
+		{levels: []string{LevelNotice, LevelFailure}, want: "failure"},
+	}
+	for _, tc := range tests {
+		var annotations []Annotation
+		for _, l := range tc.levels {
+			annotations = append(annotations, Annotation{Level: l})
+		}
+		if got := checkRunConclusion(annotations); got != tc.want {
+			t.Errorf("checkRunConclusion(%v) = %q, want %q", tc.levels, got, tc.want)
+		}
+	}
+}
+
+func TestCreateCheckRun_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  string
+		wantErr error
+	}{
+		{name: "invalid annotation", status: http.StatusUnprocessableEntity, wantErr: provider.ErrInvalidInput},
+		{name: "no permission", status: http.StatusForbidden, wantErr: provider.ErrForbidden},
+		{name: "rate limited", status: http.StatusForbidden, header: "0", wantErr: provider.ErrRateLimited},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, c := newTestServer(t, map[string]http.HandlerFunc{
+				"POST /repos/acme/app/check-runs": func(w http.ResponseWriter, r *http.Request) {
+					if tc.header != "" {
+						w.Header().Set("X-RateLimit-Remaining", tc.header)
+					}
+					w.WriteHeader(tc.status)
+				},
+			})
+			_, err := c.CreateCheckRun(context.Background(), "acme/app", "abc123", nil)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("err = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
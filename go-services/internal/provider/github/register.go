@@ -0,0 +1,16 @@
+package github
+
+import "ai-reviewer/go-services/internal/provider"
+
+func init() {
+	provider.Register("github", newFromConfig)
+}
+
+// newFromConfig builds a GitHub client, defaulting to DefaultBaseURL (github.com).
+func newFromConfig(cfg provider.Config) (provider.GitProvider, error) {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return New(baseURL, cfg.Token), nil
+}
@@ -0,0 +1,83 @@
+package github
+
+// githubRepo maps a repository item from GET /user/repos.
+type githubRepo struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+}
+
+// githubPull maps the response from GET /repos/:owner/:repo/pulls/:number.
+type githubPull struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	User  struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Head   githubBranch `json:"head"`
+	Base   githubBranch `json:"base"`
+	State  string       `json:"state"` // "open" or "closed"
+	Draft  bool         `json:"draft"`
+	Merged bool         `json:"merged"`
+}
+
+// githubBranch is the head or base of a pull request.
+type githubBranch struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+// githubComment maps an issue comment returned by POST /repos/:owner/:repo/issues/:number/comments
+// and PATCH /repos/:owner/:repo/issues/comments/:id.
+type githubComment struct {
+	ID int64 `json:"id"`
+}
+
+// githubReview maps the response from POST /repos/:owner/:repo/pulls/:number/reviews.
+type githubReview struct {
+	ID int64 `json:"id"`
+}
+
+// githubReviewComment is an inline comment within a create-review request. Line is a file
+// line number on Side, "RIGHT" for the new file and "LEFT" for the old one.
+type githubReviewComment struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Side string `json:"side"`
+	Body string `json:"body"`
+}
+
+// githubCheckRunRequest maps the body of POST /repos/:owner/:repo/check-runs.
+type githubCheckRunRequest struct {
+	Name       string               `json:"name"`
+	HeadSHA    string               `json:"head_sha"`
+	Status     string               `json:"status"`
+	Conclusion string               `json:"conclusion"`
+	Output     githubCheckRunOutput `json:"output"`
+}
+
+// githubCheckRunUpdate maps the body of PATCH /repos/:owner/:repo/check-runs/:id; the
+// annotations in Output are appended to the run's existing ones.
+type githubCheckRunUpdate struct {
+	Output githubCheckRunOutput `json:"output"`
+}
+
+type githubCheckRunOutput struct {
+	Title       string             `json:"title"`
+	Summary     string             `json:"summary"`
+	Annotations []githubAnnotation `json:"annotations"`
+}
+
+type githubAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Message         string `json:"message"`
+}
+
+// githubCheckRun maps the check run returned by the create endpoint.
+type githubCheckRun struct {
+	ID int64 `json:"id"`
+}
@@ -4,23 +4,50 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"ai-reviewer/go-services/internal/provider"
 )
 
+// DefaultUserAgent identifies our API traffic to GitLab admins. It is a var so release
+// builds can stamp the version via -ldflags "-X".
+var DefaultUserAgent = "nitai/dev"
+
 // Client is a GitLab REST API v4 client.
 type Client struct {
 	baseURL    string
 	token      string
+	userAgent  string
+	repoScope  string
 	httpClient *http.Client
+	limiter    *RateLimiter
+	maxPages   int
+	proxy      string
+	metrics    MetricsSink
 }
 
+// DefaultMaxPages caps how many pages a paginated listing follows (100 items each).
+const DefaultMaxPages = 1000
+
+// ErrPageLimit is returned when a listing still advertises a next page after the cap
+// set by WithMaxPages, e.g. a misbehaving server that always sends X-Next-Page.
+var ErrPageLimit = errors.New("gitlab: page limit exceeded")
+
+// Repo listing scopes accepted by WithRepoScope, besides "group:<id or full path>".
+const (
+	ScopeMembership = "membership"
+	ScopeAll        = "all"
+	scopeGroup      = "group:"
+)
+
 // Option configures a Client.
 type Option func(*Client)
 
@@ -31,17 +58,147 @@ func WithHTTPClient(c *http.Client) Option {
 	}
 }
 
+// WithRepoScope sets which projects ListRepos returns: ScopeMembership (the default; projects
+// the token's user is a member of), ScopeAll (every project visible to the token, i.e. the
+// whole instance for an admin token) or "group:<id>" (a group and its subgroups).
+func WithRepoScope(scope string) Option {
+	return func(cl *Client) {
+		cl.repoScope = scope
+	}
+}
+
+// ValidateRepoScope reports an error if scope is not one WithRepoScope accepts.
+// An empty scope means ScopeMembership.
+func ValidateRepoScope(scope string) error {
+	_, err := projectsURL(scope)
+	return err
+}
+
+// projectsURL returns the path and scope query of the project listing for scope,
+// ending in "?" or "&" so paging parameters can be appended.
+func projectsURL(scope string) (string, error) {
+	switch {
+	case scope == "" || scope == ScopeMembership:
+		return "/api/v4/projects?membership=true&", nil
+	case scope == ScopeAll:
+		return "/api/v4/projects?", nil
+	case strings.HasPrefix(scope, scopeGroup) && strings.TrimPrefix(scope, scopeGroup) != "":
+		group := strings.TrimPrefix(scope, scopeGroup)
+		return "/api/v4/groups/" + url.PathEscape(group) + "/projects?include_subgroups=true&", nil
+	default:
+		return "", fmt.Errorf("gitlab: invalid repo scope %q (want %q, %q or \"group:<id>\")", scope, ScopeMembership, ScopeAll)
+	}
+}
+
+// WithMaxPages overrides DefaultMaxPages for paginated listings; n <= 0 keeps the default.
+func WithMaxPages(n int) Option {
+	return func(cl *Client) {
+		if n > 0 {
+			cl.maxPages = n
+		}
+	}
+}
+
+// WithProxy routes requests through the proxy at rawURL (e.g. "http://proxy.corp:3128")
+// instead of the HTTPS_PROXY / NO_PROXY environment the default transport honours. It
+// applies on top of the client chosen by WithHTTPClient, whatever the option order. An
+// empty rawURL keeps the environment; an invalid one fails every request.
+func WithProxy(rawURL string) Option {
+	return func(cl *Client) {
+		cl.proxy = rawURL
+	}
+}
+
+// ValidateProxyURL reports an error if rawURL is not a proxy URL WithProxy accepts:
+// an http, https or socks5 URL with a host and no credentials, which would be stored and
+// listed in plain text. An empty rawURL is valid. The error never repeats rawURL.
+func ValidateProxyURL(rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+		return errors.New("gitlab: invalid proxy URL (want http, https or socks5 with a host)")
+	}
+	if u.User != nil {
+		return errors.New("gitlab: invalid proxy URL (credentials are not supported)")
+	}
+	return nil
+}
+
+type proxyKey struct {
+	base  *http.Client
+	proxy string
+}
+
+// proxyClients caches the proxied copy of each base client so clients built per call
+// share one transport and its idle connections.
+var proxyClients sync.Map // proxyKey -> *http.Client
+
+// withProxy returns a copy of base whose transport (a clone of base's, or of the default
+// transport) sends requests through proxy.
+func withProxy(base *http.Client, proxy string) *http.Client {
+	key := proxyKey{base, proxy}
+	if c, ok := proxyClients.Load(key); ok {
+		return c.(*http.Client)
+	}
+	bt, ok := base.Transport.(*http.Transport)
+	if !ok {
+		bt = http.DefaultTransport.(*http.Transport)
+	}
+	tr := bt.Clone()
+	if err := ValidateProxyURL(proxy); err != nil {
+		tr.Proxy = func(*http.Request) (*url.URL, error) { return nil, err }
+	} else {
+		u, _ := url.Parse(proxy)
+		tr.Proxy = http.ProxyURL(u)
+	}
+	hc := *base
+	hc.Transport = tr
+	c, _ := proxyClients.LoadOrStore(key, &hc)
+	return c.(*http.Client)
+}
+
+// MetricsSink receives one observation per GitLab API request, e.g. to export latency
+// histograms or log slow calls. method is the Client method that made the request
+// ("GetMRDiff"), path the API route with ids replaced ("projects/:id/merge_requests/:id/diffs"),
+// status the HTTP status (0 when no response arrived) and latency the round trip, excluding
+// any rate-limit wait. It is called synchronously, so it must be cheap and safe for
+// concurrent use.
+type MetricsSink interface {
+	ObserveRequest(method, path string, status int, latency time.Duration)
+}
+
+// WithMetrics reports every request to sink. Without it requests aren't observed.
+func WithMetrics(sink MetricsSink) Option {
+	return func(cl *Client) {
+		cl.metrics = sink
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent on every request.
+func WithUserAgent(ua string) Option {
+	return func(cl *Client) {
+		cl.userAgent = ua
+	}
+}
+
 // New creates a GitLab client. baseURL should be the GitLab instance root
 // (e.g. "https://gitlab.com"), without a trailing slash.
 func New(baseURL, token string, opts ...Option) *Client {
 	c := &Client{
 		baseURL:    strings.TrimRight(baseURL, "/"),
 		token:      token,
+		userAgent:  DefaultUserAgent,
 		httpClient: http.DefaultClient,
+		maxPages:   DefaultMaxPages,
 	}
 	for _, o := range opts {
 		o(c)
 	}
+	if c.proxy != "" {
+		c.httpClient = withProxy(c.httpClient, c.proxy)
+	}
 	return c
 }
 
@@ -53,14 +210,71 @@ func (c *Client) newRequest(ctx context.Context, method, rawURL string, body io.
 		return nil, err
 	}
 	req.Header.Set("PRIVATE-TOKEN", c.token)
+	req.Header.Set("User-Agent", c.userAgent)
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 	return req, nil
 }
 
-func (c *Client) do(req *http.Request) (*http.Response, error) {
-	return c.httpClient.Do(req)
+// do sends req for the Client method named op, after any rate-limit wait.
+func (c *Client) do(op string, req *http.Request) (*http.Response, error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if c.metrics != nil {
+		status := 0
+		if err == nil {
+			status = resp.StatusCode
+		}
+		c.metrics.ObserveRequest(op, pathCategory(req.URL.EscapedPath()), status, time.Since(start))
+	}
+	if c.limiter != nil && err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		c.limiter.observe(resp.Header)
+	}
+	return resp, err
+}
+
+// idCollections are the API path segments followed by an id (or an encoded path or ref)
+// that pathCategory replaces with ":id".
+var idCollections = map[string]bool{
+	"projects":       true,
+	"groups":         true,
+	"merge_requests": true,
+	"notes":          true,
+	"files":          true,
+	"issues":         true,
+	"versions":       true,
+	"discussions":    true,
+}
+
+// pathCategory turns a request path into its API route with ids replaced, so metrics
+// don't get one series per project or MR: "/api/v4/projects/42/merge_requests/7/diffs"
+// becomes "projects/:id/merge_requests/:id/diffs".
+func pathCategory(p string) string {
+	segs := strings.Split(strings.Trim(strings.TrimPrefix(p, "/api/v4"), "/"), "/")
+	for i := 1; i < len(segs); i++ {
+		if idCollections[segs[i-1]] {
+			segs[i] = ":id"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// checkPage is called before fetching page number pages (0-based) of a listing. It stops
+// the loop when ctx is done or the listing has run past c.maxPages.
+func (c *Client) checkPage(ctx context.Context, pages int, what string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pages >= c.maxPages {
+		return fmt.Errorf("%w: %s listing has more than %d pages", ErrPageLimit, what, c.maxPages)
+	}
+	return nil
 }
 
 func checkStatus(resp *http.Response) error {
@@ -73,15 +287,19 @@ func checkStatus(resp *http.Response) error {
 		return provider.ErrForbidden
 	case http.StatusNotFound:
 		return provider.ErrNotFound
-	case http.StatusBadRequest:
+	case http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity:
+		// The request itself is wrong (bad position, conflicting state); retrying won't help.
 		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("%w: %s", provider.ErrInvalidInput, strings.TrimSpace(string(body)))
 	case http.StatusTooManyRequests:
 		return provider.ErrRateLimited
-	default:
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("gitlab: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
+	body, _ := io.ReadAll(resp.Body)
+	msg := strings.TrimSpace(string(body))
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("gitlab: %w", &provider.ProviderServerError{StatusCode: resp.StatusCode, Body: msg})
+	}
+	return fmt.Errorf("gitlab: unexpected status %d: %s", resp.StatusCode, msg)
 }
 
 func decodeJSON(resp *http.Response, v any) error {
@@ -94,16 +312,24 @@ func decodeJSON(resp *http.Response, v any) error {
 // ListRepos returns all repositories the authenticated user is a member of,
 // following X-Next-Page pagination.
 func (c *Client) ListRepos(ctx context.Context) ([]provider.Repo, error) {
+	listURL, err := projectsURL(c.repoScope)
+	if err != nil {
+		return nil, err
+	}
+
 	var repos []provider.Repo
 	nextPage := "1"
 
-	for nextPage != "" {
-		u := fmt.Sprintf("%s/api/v4/projects?membership=true&per_page=100&page=%s", c.baseURL, url.QueryEscape(nextPage))
+	for pages := 0; nextPage != ""; pages++ {
+		if err := c.checkPage(ctx, pages, "projects"); err != nil {
+			return nil, err
+		}
+		u := fmt.Sprintf("%s%sper_page=100&page=%s", c.baseURL, listURL, url.QueryEscape(nextPage))
 		req, err := c.newRequest(ctx, http.MethodGet, u, nil)
 		if err != nil {
 			return nil, err
 		}
-		resp, err := c.do(req)
+		resp, err := c.do("ListRepos", req)
 		if err != nil {
 			return nil, err
 		}
@@ -142,7 +368,7 @@ func (c *Client) GetMRDetails(ctx context.Context, repoRemoteID string, mrNumber
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.do(req)
+	resp, err := c.do("GetMRDetails", req)
 	if err != nil {
 		return nil, err
 	}
@@ -164,22 +390,140 @@ func (c *Client) GetMRDetails(ctx context.Context, repoRemoteID string, mrNumber
 		TargetBranch: mr.TargetBranch,
 		HeadSHA:      mr.SHA,
 		Draft:        mr.Draft,
+		Labels:       mr.Labels,
+		State:        mr.State,
+		MergeStatus:  mr.MergeStatus,
 	}, nil
 }
 
+// ── GetMRClosingIssues ────────────────────────────────────────────────────────
+
+// closingIssuesPageSize bounds GetMRClosingIssues to a single page of issues.
+const closingIssuesPageSize = 20
+
+// GetMRClosingIssues returns the issues the merge request closes on merge (e.g. through
+// "Closes #123" in its description), at most closingIssuesPageSize of them.
+func (c *Client) GetMRClosingIssues(ctx context.Context, repoRemoteID string, mrNumber int) ([]provider.Issue, error) {
+	u := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d/closes_issues?per_page=%d",
+		c.baseURL, url.PathEscape(repoRemoteID), mrNumber, closingIssuesPageSize)
+	req, err := c.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do("GetMRClosingIssues", req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	var page []gitlabIssue
+	if err := decodeJSON(resp, &page); err != nil {
+		return nil, fmt.Errorf("gitlab: decode closing issues: %w", err)
+	}
+	issues := make([]provider.Issue, len(page))
+	for i, is := range page {
+		issues[i] = provider.Issue{IID: is.IID, Title: is.Title, Description: is.Description}
+	}
+	return issues, nil
+}
+
 // ── GetMRDiff ────────────────────────────────────────────────────────────────
 
 // GetMRDiff returns the unified diff for the given merge request.
+// It reads the paginated /diffs endpoint, falling back to the deprecated /changes
+// endpoint on GitLab versions that don't have it (404).
 // GitLab returns diff fragments without `diff --git` headers; this method
 // reconstructs them so the output matches the standard unified diff format.
+// When GitLab caps the response (overflow, a "N+" changes_count, or collapsed/too
+// large files), the result is marked Truncated.
 func (c *Client) GetMRDiff(ctx context.Context, repoRemoteID string, mrNumber int) (*provider.MRDiff, error) {
+	changes, err := c.listMRDiffs(ctx, repoRemoteID, mrNumber)
+	if errors.Is(err, provider.ErrNotFound) {
+		changes, err = c.getMRChanges(ctx, repoRemoteID, mrNumber)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buildMRDiff(changes), nil
+}
+
+// GetCompareDiff returns the unified diff between two commits of a project, from the
+// merge base of from and to up to to, in the same reconstructed format as GetMRDiff.
+// A compare GitLab timed out on is returned as an error, not a partial diff.
+func (c *Client) GetCompareDiff(ctx context.Context, repoRemoteID, from, to string) (*provider.MRDiff, error) {
+	u := fmt.Sprintf("%s/api/v4/projects/%s/repository/compare?from=%s&to=%s",
+		c.baseURL, url.PathEscape(repoRemoteID), url.QueryEscape(from), url.QueryEscape(to))
+	req, err := c.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do("GetCompareDiff", req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	var cmp gitlabCompare
+	if err := decodeJSON(resp, &cmp); err != nil {
+		return nil, fmt.Errorf("gitlab: decode compare: %w", err)
+	}
+	if cmp.CompareTimeout {
+		return nil, fmt.Errorf("gitlab: compare %s...%s timed out", from, to)
+	}
+	return buildMRDiff(&gitlabMRChanges{Changes: cmp.Diffs}), nil
+}
+
+// listMRDiffs fetches every page of GET .../merge_requests/:iid/diffs, following X-Next-Page.
+func (c *Client) listMRDiffs(ctx context.Context, repoRemoteID string, mrNumber int) (*gitlabMRChanges, error) {
+	changes := &gitlabMRChanges{}
+	nextPage := "1"
+
+	for pages := 0; nextPage != ""; pages++ {
+		if err := c.checkPage(ctx, pages, "MR diffs"); err != nil {
+			return nil, err
+		}
+		u := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d/diffs?per_page=100&page=%s",
+			c.baseURL, url.PathEscape(repoRemoteID), mrNumber, url.QueryEscape(nextPage))
+		req, err := c.newRequest(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do("GetMRDiff", req)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var page []gitlabDiffChange
+		if err := decodeJSON(resp, &page); err != nil {
+			return nil, fmt.Errorf("gitlab: decode MR diffs: %w", err)
+		}
+		changes.Changes = append(changes.Changes, page...)
+
+		nextPage = resp.Header.Get("X-Next-Page")
+	}
+
+	return changes, nil
+}
+
+// getMRChanges fetches GET .../merge_requests/:iid/changes (deprecated in favor of /diffs).
+func (c *Client) getMRChanges(ctx context.Context, repoRemoteID string, mrNumber int) (*gitlabMRChanges, error) {
 	u := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d/changes",
 		c.baseURL, url.PathEscape(repoRemoteID), mrNumber)
 	req, err := c.newRequest(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.do(req)
+	resp, err := c.do("GetMRDiff", req)
 	if err != nil {
 		return nil, err
 	}
@@ -192,14 +536,23 @@ func (c *Client) GetMRDiff(ctx context.Context, repoRemoteID string, mrNumber in
 	if err := decodeJSON(resp, &changes); err != nil {
 		return nil, fmt.Errorf("gitlab: decode MR changes: %w", err)
 	}
+	return &changes, nil
+}
 
+// buildMRDiff reconstructs a unified diff from GitLab's per-file entries.
+func buildMRDiff(changes *gitlabMRChanges) *provider.MRDiff {
 	var (
 		sb           strings.Builder
 		changedFiles []provider.ChangedFile
 		totalLines   int
+		truncated    = changes.Overflow || strings.HasSuffix(changes.ChangesCount, "+")
 	)
 
 	for _, ch := range changes.Changes {
+		if ch.Collapsed || ch.TooLarge {
+			// GitLab withheld this file's diff; the review would miss it.
+			truncated = true
+		}
 		oldPath := ch.OldPath
 		newPath := ch.NewPath
 		if ch.NewFile {
@@ -209,6 +562,8 @@ func (c *Client) GetMRDiff(ctx context.Context, repoRemoteID string, mrNumber in
 			newPath = "/dev/null"
 		}
 
+		binary := isBinaryChange(ch)
+
 		// Reconstruct unified diff header.
 		fmt.Fprintf(&sb, "diff --git a/%s b/%s\n", ch.OldPath, ch.NewPath)
 		if ch.NewFile {
@@ -216,14 +571,30 @@ func (c *Client) GetMRDiff(ctx context.Context, repoRemoteID string, mrNumber in
 		} else if ch.DeletedFile {
 			fmt.Fprintf(&sb, "deleted file mode 100644\n")
 		}
-		fmt.Fprintf(&sb, "--- %s\n", aPath(oldPath))
-		fmt.Fprintf(&sb, "+++ %s\n", bPath(newPath))
-		sb.WriteString(ch.Diff)
-		if len(ch.Diff) > 0 && ch.Diff[len(ch.Diff)-1] != '\n' {
-			sb.WriteByte('\n')
+		// A pure rename has no hunks; git marks it 100% similar and writes no ---/+++ lines.
+		pureRename := ch.RenamedFile && ch.Diff == "" && !ch.Collapsed && !ch.TooLarge
+		if ch.RenamedFile {
+			if pureRename {
+				fmt.Fprintf(&sb, "similarity index 100%%\n")
+			}
+			fmt.Fprintf(&sb, "rename from %s\n", ch.OldPath)
+			fmt.Fprintf(&sb, "rename to %s\n", ch.NewPath)
+		}
+		switch {
+		case pureRename:
+			// The rename header is the whole entry.
+		case binary:
+			// Binary changes have no hunks; emit git's marker and don't count lines.
+			fmt.Fprintf(&sb, "Binary files %s and %s differ\n", aPath(oldPath), bPath(newPath))
+		default:
+			fmt.Fprintf(&sb, "--- %s\n", aPath(oldPath))
+			fmt.Fprintf(&sb, "+++ %s\n", bPath(newPath))
+			sb.WriteString(ch.Diff)
+			if len(ch.Diff) > 0 && ch.Diff[len(ch.Diff)-1] != '\n' {
+				sb.WriteByte('\n')
+			}
+			totalLines += countChangedLines(ch.Diff)
 		}
-
-		totalLines += countChangedLines(ch.Diff)
 
 		changedFiles = append(changedFiles, provider.ChangedFile{
 			OldPath: ch.OldPath,
@@ -232,6 +603,7 @@ func (c *Client) GetMRDiff(ctx context.Context, repoRemoteID string, mrNumber in
 			NewFile: ch.NewFile,
 			Deleted: ch.DeletedFile,
 			Renamed: ch.RenamedFile,
+			Binary:  binary,
 		})
 	}
 
@@ -239,7 +611,17 @@ func (c *Client) GetMRDiff(ctx context.Context, repoRemoteID string, mrNumber in
 		UnifiedDiff:  sb.String(),
 		ChangedFiles: changedFiles,
 		ChangedLines: totalLines,
-	}, nil
+		Truncated:    truncated,
+	}
+}
+
+// isBinaryChange reports whether GitLab returned a binary change: either a
+// "Binary files ... differ" marker, or an empty diff for an added/deleted file.
+func isBinaryChange(ch gitlabDiffChange) bool {
+	if strings.HasPrefix(ch.Diff, "Binary files ") {
+		return true
+	}
+	return ch.Diff == "" && (ch.NewFile || ch.DeletedFile) && !ch.Collapsed && !ch.TooLarge
 }
 
 // aPath formats the --- path line for unified diff output.
@@ -274,6 +656,105 @@ func countChangedLines(diff string) int {
 	return n
 }
 
+// ── GetPipelineStatus ─────────────────────────────────────────────────────────
+
+// GetPipelineStatus returns the status of the newest pipeline for commit sha, e.g.
+// "success", "failed" or "running", or "" if the commit has no pipeline.
+func (c *Client) GetPipelineStatus(ctx context.Context, repoRemoteID, sha string) (string, error) {
+	u := fmt.Sprintf("%s/api/v4/projects/%s/pipelines?sha=%s&order_by=id&sort=desc&per_page=1",
+		c.baseURL, url.PathEscape(repoRemoteID), url.QueryEscape(sha))
+	req, err := c.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do("GetPipelineStatus", req)
+	if err != nil {
+		return "", err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return "", err
+	}
+
+	var pipelines []gitlabPipeline
+	if err := decodeJSON(resp, &pipelines); err != nil {
+		return "", fmt.Errorf("gitlab: decode pipelines: %w", err)
+	}
+	if len(pipelines) == 0 {
+		return "", nil
+	}
+	return pipelines[0].Status, nil
+}
+
+// ── GetFileContent ────────────────────────────────────────────────────────────
+
+// GetFileContent returns the raw content of path at ref via the repository files API,
+// reading at most maxBytes+1 bytes so a huge file isn't buffered whole.
+func (c *Client) GetFileContent(ctx context.Context, repoRemoteID string, ref, path string, maxBytes int) ([]byte, error) {
+	u := fmt.Sprintf("%s/api/v4/projects/%s/repository/files/%s/raw?ref=%s",
+		c.baseURL, url.PathEscape(repoRemoteID), url.PathEscape(path), url.QueryEscape(ref))
+	req, err := c.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do("GetFileContent", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("gitlab: read file %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// ── ApproveMR ─────────────────────────────────────────────────────────────────
+
+// ApproveMR approves a merge request as the token's user. GitLab answers 401 both for a
+// bad token and when the user already approved the MR; ApproveMR tells them apart by
+// reading the MR's approvals, and treats an existing approval as success. A 403 (the user
+// may not approve) is returned as provider.ErrForbidden.
+func (c *Client) ApproveMR(ctx context.Context, repoRemoteID string, mrNumber int) error {
+	u := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d/approve",
+		c.baseURL, url.PathEscape(repoRemoteID), mrNumber)
+	req, err := c.newRequest(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do("ApproveMR", req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkStatus(resp)
+	if !errors.Is(err, provider.ErrUnauthorized) {
+		return err
+	}
+	// If the token still authenticates for reads, the 401 meant "already approved".
+	return c.checkMRApprovals(ctx, repoRemoteID, mrNumber)
+}
+
+// checkMRApprovals reads the MR's approval state, only to learn whether the token is valid.
+func (c *Client) checkMRApprovals(ctx context.Context, repoRemoteID string, mrNumber int) error {
+	u := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d/approvals",
+		c.baseURL, url.PathEscape(repoRemoteID), mrNumber)
+	req, err := c.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do("GetMRApprovals", req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkStatus(resp)
+}
+
 // ── PostComment ───────────────────────────────────────────────────────────────
 
 // PostComment posts a top-level MR note (non-inline comment).
@@ -290,7 +771,7 @@ func (c *Client) PostComment(ctx context.Context, repoRemoteID string, mrNumber
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.do(req)
+	resp, err := c.do("PostComment", req)
 	if err != nil {
 		return nil, err
 	}
@@ -307,6 +788,82 @@ func (c *Client) PostComment(ctx context.Context, repoRemoteID string, mrNumber
 	return &provider.CommentResult{ID: strconv.Itoa(note.ID)}, nil
 }
 
+// ── UpdateComment ─────────────────────────────────────────────────────────────
+
+// UpdateComment replaces the body of a top-level MR note. A deleted note is ErrNotFound.
+func (c *Client) UpdateComment(ctx context.Context, repoRemoteID string, mrNumber int, providerCommentID, body string) (*provider.CommentResult, error) {
+	u := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d/notes/%s",
+		c.baseURL, url.PathEscape(repoRemoteID), mrNumber, url.PathEscape(providerCommentID))
+
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPut, u, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do("UpdateComment", req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	var note gitlabNote
+	if err := decodeJSON(resp, &note); err != nil {
+		return nil, fmt.Errorf("gitlab: decode note: %w", err)
+	}
+	return &provider.CommentResult{ID: strconv.Itoa(note.ID)}, nil
+}
+
+// ── ListMRNotes ───────────────────────────────────────────────────────────────
+
+// ListMRNotes returns the top-level notes of a merge request, newest first, following
+// X-Next-Page pagination. System notes and inline (diff) comments are left out.
+func (c *Client) ListMRNotes(ctx context.Context, repoRemoteID string, mrNumber int) ([]provider.Note, error) {
+	var notes []provider.Note
+	nextPage := "1"
+
+	for pages := 0; nextPage != ""; pages++ {
+		if err := c.checkPage(ctx, pages, "MR notes"); err != nil {
+			return nil, err
+		}
+		u := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d/notes?sort=desc&order_by=created_at&per_page=100&page=%s",
+			c.baseURL, url.PathEscape(repoRemoteID), mrNumber, url.QueryEscape(nextPage))
+		req, err := c.newRequest(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do("ListMRNotes", req)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var page []gitlabNote
+		if err := decodeJSON(resp, &page); err != nil {
+			return nil, fmt.Errorf("gitlab: decode MR notes: %w", err)
+		}
+		for _, n := range page {
+			if n.System || n.Type != "" {
+				continue
+			}
+			notes = append(notes, provider.Note{ID: strconv.Itoa(n.ID), Body: n.Body})
+		}
+
+		nextPage = resp.Header.Get("X-Next-Page")
+	}
+
+	return notes, nil
+}
+
 // ── PostInlineComment ─────────────────────────────────────────────────────────
 
 // PostInlineComment posts a diff comment anchored to a specific line.
@@ -345,7 +902,7 @@ func (c *Client) PostInlineComment(ctx context.Context, repoRemoteID string, mrN
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.do(req)
+	resp, err := c.do("PostInlineComment", req)
 	if err != nil {
 		return nil, err
 	}
@@ -371,7 +928,7 @@ func (c *Client) getMRVersions(ctx context.Context, repoRemoteID string, mrNumbe
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.do(req)
+	resp, err := c.do("PostInlineComment", req)
 	if err != nil {
 		return nil, err
 	}
@@ -390,3 +947,36 @@ func (c *Client) getMRVersions(ctx context.Context, repoRemoteID string, mrNumbe
 
 	return &versions[0], nil
 }
+
+// ── ReplyToDiscussion ─────────────────────────────────────────────────────────
+
+// ReplyToDiscussion adds a note to an existing MR discussion, such as one started by
+// PostInlineComment, and returns the new note's id. A deleted discussion is ErrNotFound.
+func (c *Client) ReplyToDiscussion(ctx context.Context, repoRemoteID string, mrNumber int, discussionID, body string) (*provider.CommentResult, error) {
+	u := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d/discussions/%s/notes",
+		c.baseURL, url.PathEscape(repoRemoteID), mrNumber, url.PathEscape(discussionID))
+
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do("ReplyToDiscussion", req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	var note gitlabNote
+	if err := decodeJSON(resp, &note); err != nil {
+		return nil, fmt.Errorf("gitlab: decode note: %w", err)
+	}
+	return &provider.CommentResult{ID: strconv.Itoa(note.ID)}, nil
+}
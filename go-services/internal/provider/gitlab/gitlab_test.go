@@ -3,10 +3,15 @@ package gitlab
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"ai-reviewer/go-services/internal/provider"
 )
@@ -184,6 +189,26 @@ func TestGetMRDetails_DraftField(t *testing.T) {
 	}
 }
 
+func TestGetMRDetails_StateFields(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/10/merge_requests/3": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"title":"t","sha":"abc","labels":["backend","needs-review"],"state":"merged","merge_status":"can_be_merged"}`))
+		},
+	})
+
+	got, err := c.GetMRDetails(context.Background(), "10", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got.Labels, []string{"backend", "needs-review"}) {
+		t.Errorf("labels = %v", got.Labels)
+	}
+	if got.State != provider.MRStateMerged || got.MergeStatus != "can_be_merged" {
+		t.Errorf("state = %q, merge status = %q", got.State, got.MergeStatus)
+	}
+}
+
 // ── GetMRDiff ─────────────────────────────────────────────────────────────────
 
 func TestGetMRDiff_Success(t *testing.T) {
@@ -285,6 +310,94 @@ func TestGetMRDiff_DeletedFile(t *testing.T) {
 	}
 }
 
+func TestGetMRDiff_BinaryImageAdded(t *testing.T) {
+	changes := gitlabMRChanges{
+		Changes: []gitlabDiffChange{
+			{OldPath: "logo.png", NewPath: "logo.png", NewFile: true, Diff: ""},
+			{OldPath: "main.go", NewPath: "main.go", Diff: "@@ -1 +1 @@\n-a\n+b\n"},
+		},
+	}
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/1/merge_requests/6/changes": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, changes)
+		},
+	})
+
+	diff, err := c.GetMRDiff(context.Background(), "1", 6)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !contains(diff.UnifiedDiff, "Binary files /dev/null and b/logo.png differ") {
+		t.Errorf("expected binary marker for added image:\n%s", diff.UnifiedDiff)
+	}
+	if contains(diff.UnifiedDiff, "+++ b/logo.png") {
+		t.Errorf("unexpected +++ header for binary file:\n%s", diff.UnifiedDiff)
+	}
+	if !diff.ChangedFiles[0].Binary || diff.ChangedFiles[1].Binary {
+		t.Errorf("unexpected Binary flags: %+v", diff.ChangedFiles)
+	}
+	if diff.ChangedLines != 2 { // only main.go lines count
+		t.Errorf("expected 2 changed lines, got %d", diff.ChangedLines)
+	}
+}
+
+func TestGetMRDiff_BinaryModified(t *testing.T) {
+	changes := gitlabMRChanges{
+		Changes: []gitlabDiffChange{
+			{OldPath: "data.bin", NewPath: "data.bin", Diff: "Binary files a/data.bin and b/data.bin differ\n"},
+		},
+	}
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/1/merge_requests/7/changes": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, changes)
+		},
+	})
+
+	diff, err := c.GetMRDiff(context.Background(), "1", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !contains(diff.UnifiedDiff, "Binary files a/data.bin and b/data.bin differ") {
+		t.Errorf("expected binary marker:\n%s", diff.UnifiedDiff)
+	}
+	if !diff.ChangedFiles[0].Binary {
+		t.Error("expected ChangedFile.Binary=true")
+	}
+	if diff.ChangedLines != 0 {
+		t.Errorf("expected 0 changed lines, got %d", diff.ChangedLines)
+	}
+}
+
+func TestGetMRDiff_Overflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes gitlabMRChanges
+		want    bool
+	}{
+		{name: "not truncated", changes: gitlabMRChanges{ChangesCount: "3"}, want: false},
+		{name: "overflow flag", changes: gitlabMRChanges{ChangesCount: "3", Overflow: true}, want: true},
+		{name: "capped changes_count", changes: gitlabMRChanges{ChangesCount: "100+"}, want: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, c := newTestServer(t, map[string]http.HandlerFunc{
+				"/api/v4/projects/1/merge_requests/5/changes": func(w http.ResponseWriter, r *http.Request) {
+					writeJSON(w, tc.changes)
+				},
+			})
+
+			diff, err := c.GetMRDiff(context.Background(), "1", 5)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff.Truncated != tc.want {
+				t.Errorf("Truncated = %v, want %v", diff.Truncated, tc.want)
+			}
+		})
+	}
+}
+
 func TestGetMRDiff_NotFound(t *testing.T) {
 	_, c := newTestServer(t, map[string]http.HandlerFunc{
 		"/api/v4/projects/1/merge_requests/99/changes": func(w http.ResponseWriter, r *http.Request) {
@@ -298,6 +411,61 @@ func TestGetMRDiff_NotFound(t *testing.T) {
 	}
 }
 
+func TestGetMRDiff_DiffsPaginated(t *testing.T) {
+	pages := map[string][]gitlabDiffChange{
+		"1": {{OldPath: "a.go", NewPath: "a.go", Diff: "@@ -1 +1,2 @@\n-x\n+y\n+z\n"}},
+		"2": {{OldPath: "b.go", NewPath: "b.go", Diff: "@@ -1,2 +1 @@\n-p\n-q\n+r\n"}},
+	}
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/1/merge_requests/5/diffs": func(w http.ResponseWriter, r *http.Request) {
+			page := r.URL.Query().Get("page")
+			if page == "1" {
+				w.Header().Set("X-Next-Page", "2")
+			}
+			writeJSON(w, pages[page])
+		},
+		"/api/v4/projects/1/merge_requests/5/changes": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("/changes should not be called when /diffs is available")
+		},
+	})
+
+	diff, err := c.GetMRDiff(context.Background(), "1", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diff.ChangedFiles) != 2 {
+		t.Fatalf("expected 2 changed files, got %d", len(diff.ChangedFiles))
+	}
+	if diff.ChangedLines != 6 {
+		t.Errorf("expected 6 changed lines across pages, got %d", diff.ChangedLines)
+	}
+	if !strings.Contains(diff.UnifiedDiff, "diff --git a/a.go b/a.go") || !strings.Contains(diff.UnifiedDiff, "diff --git a/b.go b/b.go") {
+		t.Errorf("expected headers for both pages, got:\n%s", diff.UnifiedDiff)
+	}
+	if diff.Truncated {
+		t.Error("expected Truncated=false")
+	}
+}
+
+func TestGetMRDiff_DiffsCollapsedTruncates(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/1/merge_requests/5/diffs": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, []gitlabDiffChange{{OldPath: "big.go", NewPath: "big.go", NewFile: true, TooLarge: true}})
+		},
+	})
+
+	diff, err := c.GetMRDiff(context.Background(), "1", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !diff.Truncated {
+		t.Error("expected Truncated=true for a too_large file")
+	}
+	if len(diff.ChangedFiles) != 1 || diff.ChangedFiles[0].Binary {
+		t.Errorf("too_large file should not be reported as binary: %+v", diff.ChangedFiles)
+	}
+}
+
 // ── PostComment ───────────────────────────────────────────────────────────────
 
 func TestPostComment_Success(t *testing.T) {
@@ -447,3 +615,663 @@ func containsStr(s, sub string) bool {
 	}
 	return false
 }
+
+func TestCheckStatus_ConflictAndUnprocessableAreInvalidInput(t *testing.T) {
+	for _, status := range []int{http.StatusConflict, http.StatusUnprocessableEntity} {
+		_, c := newTestServer(t, map[string]http.HandlerFunc{
+			"/api/v4/projects/5/merge_requests/1/notes": func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+				w.Write([]byte(`{"message":"rejected"}`))
+			},
+		})
+
+		_, err := c.PostComment(context.Background(), "5", 1, "hello")
+		if !errors.Is(err, provider.ErrInvalidInput) {
+			t.Errorf("status %d: expected ErrInvalidInput, got %v", status, err)
+		}
+	}
+}
+
+func TestCheckStatus_ServerErrorIsTyped(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/merge_requests/1": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("502 Bad Gateway\n"))
+		},
+	})
+
+	_, err := c.GetMRDetails(context.Background(), "5", 1)
+	var serverErr *provider.ProviderServerError
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("expected ProviderServerError, got %v", err)
+	}
+	if serverErr.StatusCode != http.StatusBadGateway || serverErr.Body != "502 Bad Gateway" {
+		t.Errorf("got status %d body %q", serverErr.StatusCode, serverErr.Body)
+	}
+}
+
+func TestCheckStatus_OtherStatusIsUntyped(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/merge_requests/1": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		},
+	})
+
+	_, err := c.GetMRDetails(context.Background(), "5", 1)
+	var serverErr *provider.ProviderServerError
+	if err == nil || errors.As(err, &serverErr) {
+		t.Errorf("expected a plain error for 418, got %v", err)
+	}
+}
+
+// ── User-Agent ────────────────────────────────────────────────────────────────
+
+func TestUserAgent(t *testing.T) {
+	var got []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/42/merge_requests/7", func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("User-Agent"))
+		writeJSON(w, gitlabMR{Title: "t"})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	for _, c := range []*Client{
+		New(srv.URL, "tok", WithHTTPClient(srv.Client())),
+		New(srv.URL, "tok", WithHTTPClient(srv.Client()), WithUserAgent("nitai/1.2.3")),
+	} {
+		if _, err := c.GetMRDetails(context.Background(), "42", 7); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if want := []string{DefaultUserAgent, "nitai/1.2.3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("User-Agent headers = %v, want %v", got, want)
+	}
+}
+
+// ── Repo scope ────────────────────────────────────────────────────────────────
+
+func TestListRepos_GroupScope(t *testing.T) {
+	var gotPath, gotSubgroups string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/groups/", func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotSubgroups = r.URL.Query().Get("include_subgroups")
+		writeJSON(w, []gitlabProject{{ID: 7, Name: "svc", PathWithNamespace: "platform/backend/svc"}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c := New(srv.URL, "tok", WithHTTPClient(srv.Client()), WithRepoScope("group:platform/backend"))
+
+	repos, err := c.ListRepos(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotPath != "/api/v4/groups/platform%2Fbackend/projects" {
+		t.Errorf("path = %q, want the group projects endpoint with an escaped full path", gotPath)
+	}
+	if gotSubgroups != "true" {
+		t.Errorf("include_subgroups = %q, want true", gotSubgroups)
+	}
+	if len(repos) != 1 || repos[0].FullPath != "platform/backend/svc" {
+		t.Errorf("unexpected repos: %+v", repos)
+	}
+}
+
+func TestListRepos_AllScope(t *testing.T) {
+	var gotQuery url.Values
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects": func(w http.ResponseWriter, r *http.Request) {
+			gotQuery = r.URL.Query()
+			writeJSON(w, []gitlabProject{})
+		},
+	})
+	WithRepoScope(ScopeAll)(c)
+
+	if _, err := c.ListRepos(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotQuery.Has("membership") {
+		t.Errorf("all scope should not filter by membership, query = %v", gotQuery)
+	}
+}
+
+func TestValidateRepoScope(t *testing.T) {
+	for _, scope := range []string{"", "membership", "all", "group:42", "group:platform/backend"} {
+		if err := ValidateRepoScope(scope); err != nil {
+			t.Errorf("ValidateRepoScope(%q) = %v, want nil", scope, err)
+		}
+	}
+	for _, scope := range []string{"group:", "groups:42", "everything"} {
+		if err := ValidateRepoScope(scope); err == nil {
+			t.Errorf("ValidateRepoScope(%q) = nil, want error", scope)
+		}
+	}
+}
+
+func TestGetMRDiff_PureRename(t *testing.T) {
+	diff := buildMRDiff(&gitlabMRChanges{Changes: []gitlabDiffChange{
+		{OldPath: "old/name.go", NewPath: "new/name.go", RenamedFile: true},
+	}})
+
+	want := "diff --git a/old/name.go b/new/name.go\n" +
+		"similarity index 100%\n" +
+		"rename from old/name.go\n" +
+		"rename to new/name.go\n"
+	if diff.UnifiedDiff != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", diff.UnifiedDiff, want)
+	}
+	if !diff.ChangedFiles[0].Renamed || diff.ChangedFiles[0].Binary || diff.ChangedLines != 0 {
+		t.Errorf("unexpected changed file: %+v (lines %d)", diff.ChangedFiles[0], diff.ChangedLines)
+	}
+}
+
+func TestGetMRDiff_RenameWithEdit(t *testing.T) {
+	diff := buildMRDiff(&gitlabMRChanges{Changes: []gitlabDiffChange{
+		{
+			OldPath:     "old.go",
+			NewPath:     "new.go",
+			RenamedFile: true,
+			Diff:        "@@ -1,2 +1,2 @@\n package p\n-var x = 1\n+var x = 2\n",
+		},
+	}})
+
+	want := "diff --git a/old.go b/new.go\n" +
+		"rename from old.go\n" +
+		"rename to new.go\n" +
+		"--- a/old.go\n" +
+		"+++ b/new.go\n" +
+		"@@ -1,2 +1,2 @@\n package p\n-var x = 1\n+var x = 2\n"
+	if diff.UnifiedDiff != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", diff.UnifiedDiff, want)
+	}
+	if contains(diff.UnifiedDiff, "similarity index") {
+		t.Error("similarity index should only be emitted for pure renames")
+	}
+	if diff.ChangedLines != 2 {
+		t.Errorf("ChangedLines = %d, want 2", diff.ChangedLines)
+	}
+}
+
+func TestGetCompareDiff(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/1/repository/compare": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("from") != "aaa" || r.URL.Query().Get("to") != "bbb" {
+				t.Errorf("unexpected query: %s", r.URL.RawQuery)
+			}
+			writeJSON(w, gitlabCompare{Diffs: []gitlabDiffChange{
+				{OldPath: "main.go", NewPath: "main.go", Diff: "@@ -1 +1 @@\n-old\n+new\n"},
+			}})
+		},
+	})
+
+	diff, err := c.GetCompareDiff(context.Background(), "1", "aaa", "bbb")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !contains(diff.UnifiedDiff, "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n") {
+		t.Errorf("missing reconstructed header:\n%s", diff.UnifiedDiff)
+	}
+	if len(diff.ChangedFiles) != 1 || diff.ChangedLines != 2 {
+		t.Errorf("unexpected files/lines: %d/%d", len(diff.ChangedFiles), diff.ChangedLines)
+	}
+}
+
+func TestGetCompareDiff_Timeout(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/1/repository/compare": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, gitlabCompare{CompareTimeout: true})
+		},
+	})
+
+	if _, err := c.GetCompareDiff(context.Background(), "1", "aaa", "bbb"); err == nil {
+		t.Fatal("expected an error for a timed-out compare")
+	}
+}
+
+func TestListRepos_PageCap(t *testing.T) {
+	var calls int
+	srv, _ := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects": func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			// A broken server that always claims there is another page.
+			w.Header().Set("X-Next-Page", strconv.Itoa(calls+1))
+			writeJSON(w, []gitlabProject{{ID: calls, Name: "p"}})
+		},
+	})
+	c := New(srv.URL, "test-token", WithHTTPClient(srv.Client()), WithMaxPages(3))
+
+	_, err := c.ListRepos(context.Background())
+	if !errors.Is(err, ErrPageLimit) {
+		t.Fatalf("expected ErrPageLimit, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 page requests, got %d", calls)
+	}
+}
+
+func TestListRepos_StopsWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects": func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			cancel() // the caller gives up while the first page is in flight
+			w.Header().Set("X-Next-Page", "2")
+			writeJSON(w, []gitlabProject{{ID: 1, Name: "p"}})
+		},
+	})
+
+	if _, err := c.ListRepos(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 page request, got %d", calls)
+	}
+}
+
+func TestGetFileContent(t *testing.T) {
+	var gotPath, gotRef string
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/1/repository/files/": func(w http.ResponseWriter, r *http.Request) {
+			gotPath, gotRef = r.URL.EscapedPath(), r.URL.Query().Get("ref")
+			w.Write([]byte("package main\n"))
+		},
+	})
+
+	content, err := c.GetFileContent(context.Background(), "1", "abc123", "cmd/app/main.go", 1024)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(content) != "package main\n" {
+		t.Errorf("content = %q", content)
+	}
+	if gotPath != "/api/v4/projects/1/repository/files/cmd%2Fapp%2Fmain.go/raw" {
+		t.Errorf("path = %q, want the file path escaped as one segment", gotPath)
+	}
+	if gotRef != "abc123" {
+		t.Errorf("ref = %q, want abc123", gotRef)
+	}
+}
+
+func TestGetFileContent_NotFound(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/1/repository/files/": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"message":"404 File Not Found"}`, http.StatusNotFound)
+		},
+	})
+
+	if _, err := c.GetFileContent(context.Background(), "1", "abc123", "nope.go", 1024); !errors.Is(err, provider.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetFileContent_ReadsAtMostMaxBytesPlusOne(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/1/repository/files/": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(strings.Repeat("x", 4096)))
+		},
+	})
+
+	content, err := c.GetFileContent(context.Background(), "1", "abc123", "big.go", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(content) != 11 {
+		t.Errorf("read %d bytes, want 11", len(content))
+	}
+}
+
+func TestApproveMR_Success(t *testing.T) {
+	var method string
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/merge_requests/1/approve": func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			writeJSON(w, map[string]any{"approved": true})
+		},
+	})
+
+	if err := c.ApproveMR(context.Background(), "5", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if method != http.MethodPost {
+		t.Errorf("expected POST, got %s", method)
+	}
+}
+
+func TestApproveMR_Forbidden(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/merge_requests/1/approve": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		},
+	})
+
+	if err := c.ApproveMR(context.Background(), "5", 1); err != provider.ErrForbidden {
+		t.Errorf("expected ErrForbidden, got %v", err)
+	}
+}
+
+func TestApproveMR_AlreadyApproved(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/merge_requests/1/approve": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+		"/api/v4/projects/5/merge_requests/1/approvals": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]any{"approved": true})
+		},
+	})
+
+	if err := c.ApproveMR(context.Background(), "5", 1); err != nil {
+		t.Errorf("expected an existing approval to count as success, got %v", err)
+	}
+}
+
+func TestApproveMR_BadToken(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/merge_requests/1/approve": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+		"/api/v4/projects/5/merge_requests/1/approvals": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+	})
+
+	if err := c.ApproveMR(context.Background(), "5", 1); !errors.Is(err, provider.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestUpdateComment(t *testing.T) {
+	var method, body string
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/merge_requests/1/notes/77": func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			var payload map[string]string
+			json.NewDecoder(r.Body).Decode(&payload)
+			body = payload["body"]
+			writeJSON(w, gitlabNote{ID: 77})
+		},
+	})
+
+	res, err := c.UpdateComment(context.Background(), "5", 1, "77", "updated summary")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.ID != "77" {
+		t.Errorf("ID = %q, want 77", res.ID)
+	}
+	if method != http.MethodPut || body != "updated summary" {
+		t.Errorf("got %s with body %q, want PUT with the new body", method, body)
+	}
+}
+
+func TestUpdateComment_NotFound(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{})
+
+	if _, err := c.UpdateComment(context.Background(), "5", 1, "77", "x"); !errors.Is(err, provider.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestReplyToDiscussion(t *testing.T) {
+	var method, body string
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/merge_requests/1/discussions/abc123/notes": func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			var payload map[string]string
+			json.NewDecoder(r.Body).Decode(&payload)
+			body = payload["body"]
+			writeJSON(w, gitlabNote{ID: 88})
+		},
+	})
+
+	res, err := c.ReplyToDiscussion(context.Background(), "5", 1, "abc123", "still an issue")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.ID != "88" {
+		t.Errorf("ID = %q, want 88", res.ID)
+	}
+	if method != http.MethodPost || body != "still an issue" {
+		t.Errorf("got %s with body %q, want POST with the reply body", method, body)
+	}
+}
+
+func TestReplyToDiscussion_NotFound(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{})
+
+	if _, err := c.ReplyToDiscussion(context.Background(), "5", 1, "abc123", "x"); !errors.Is(err, provider.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// ── ListMRNotes ───────────────────────────────────────────────────────────────
+
+func TestListMRNotes_PaginatesAndFilters(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/merge_requests/1/notes": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("sort") != "desc" {
+				t.Errorf("sort = %q, want desc", r.URL.Query().Get("sort"))
+			}
+			switch r.URL.Query().Get("page") {
+			case "1":
+				w.Header().Set("X-Next-Page", "2")
+				writeJSON(w, []gitlabNote{
+					{ID: 30, Body: "added 1 commit", System: true},
+					{ID: 29, Body: "inline", Type: "DiffNote"},
+					{ID: 28, Body: "bot: summary"},
+				})
+			case "2":
+				writeJSON(w, []gitlabNote{{ID: 10, Body: "human note"}})
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		},
+	})
+
+	notes, err := c.ListMRNotes(context.Background(), "5", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []provider.Note{{ID: "28", Body: "bot: summary"}, {ID: "10", Body: "human note"}}
+	if !reflect.DeepEqual(notes, want) {
+		t.Errorf("notes = %+v, want %+v", notes, want)
+	}
+}
+
+func TestGetMRClosingIssues(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/merge_requests/1/closes_issues": func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("per_page"); got != "20" {
+				t.Errorf("per_page = %q, want 20", got)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"id":900,"iid":12,"title":"Login fails","description":"Steps to reproduce","state":"opened"}]`))
+		},
+	})
+
+	issues, err := c.GetMRClosingIssues(context.Background(), "5", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []provider.Issue{{IID: 12, Title: "Login fails", Description: "Steps to reproduce"}}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("issues = %+v, want %+v", issues, want)
+	}
+}
+
+func TestGetPipelineStatus(t *testing.T) {
+	_, c := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/5/pipelines": func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			if q.Get("per_page") != "1" || q.Get("order_by") != "id" || q.Get("sort") != "desc" {
+				t.Errorf("query = %q, want the newest pipeline only", r.URL.RawQuery)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			switch q.Get("sha") {
+			case "abc":
+				w.Write([]byte(`[{"id":42,"status":"success","sha":"abc"}]`))
+			case "def":
+				w.Write([]byte(`[{"id":43,"status":"failed","sha":"def"}]`))
+			default:
+				w.Write([]byte(`[]`))
+			}
+		},
+	})
+
+	for sha, want := range map[string]string{"abc": "success", "def": "failed", "none": ""} {
+		got, err := c.GetPipelineStatus(context.Background(), "5", sha)
+		if err != nil {
+			t.Fatalf("GetPipelineStatus(%s): %v", sha, err)
+		}
+		if got != want {
+			t.Errorf("GetPipelineStatus(%s) = %q, want %q", sha, got, want)
+		}
+	}
+}
+
+// ── Proxy ─────────────────────────────────────────────────────────────────────
+
+func TestWithProxy_RoutesThroughProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute target URL in the request line.
+		proxied = append(proxied, r.URL.String())
+		writeJSON(w, []gitlabProject{{ID: 1, Name: "foo", PathWithNamespace: "ns/foo"}})
+	}))
+	t.Cleanup(proxy.Close)
+
+	c := New("http://gitlab.invalid", "test-token", WithProxy(proxy.URL))
+	repos, err := c.ListRepos(context.Background())
+	if err != nil {
+		t.Fatalf("ListRepos: %v", err)
+	}
+	if len(repos) != 1 {
+		t.Fatalf("expected 1 repo, got %d", len(repos))
+	}
+	if len(proxied) != 1 || !strings.HasPrefix(proxied[0], "http://gitlab.invalid/api/v4/projects?") {
+		t.Errorf("proxied requests = %v, want one to http://gitlab.invalid/api/v4/projects", proxied)
+	}
+	if c.httpClient == http.DefaultClient || http.DefaultClient.Transport != nil {
+		t.Error("WithProxy must not modify the shared default client")
+	}
+	if again := New("http://gitlab.invalid", "other", WithProxy(proxy.URL)); again.httpClient != c.httpClient {
+		t.Error("clients with the same proxy should share one HTTP client")
+	}
+}
+
+func TestWithProxy_Invalid(t *testing.T) {
+	c := New("http://gitlab.invalid", "test-token", WithProxy("ftp://proxy"))
+	if _, err := c.ListRepos(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid proxy URL") {
+		t.Errorf("expected invalid proxy URL error, got %v", err)
+	}
+}
+
+func TestValidateProxyURL(t *testing.T) {
+	for _, ok := range []string{"", "http://proxy:3128", "socks5://127.0.0.1:1080"} {
+		if err := ValidateProxyURL(ok); err != nil {
+			t.Errorf("ValidateProxyURL(%q): unexpected error %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"proxy:3128", "ftp://proxy", "http://", "::", "https://user:pw@proxy.corp"} {
+		err := ValidateProxyURL(bad)
+		if err == nil {
+			t.Errorf("ValidateProxyURL(%q): expected error", bad)
+		} else if strings.Contains(err.Error(), "pw") {
+			t.Errorf("ValidateProxyURL(%q): error %q leaks the credentials", bad, err)
+		}
+	}
+}
+
+func TestRegisteredTypes(t *testing.T) {
+	for _, typ := range []string{"gitlab_self_hosted", "gitlab_cloud"} {
+		p, err := provider.New(typ, provider.Config{Token: "tok"})
+		if err != nil {
+			t.Fatalf("provider.New(%s): %v", typ, err)
+		}
+		c, ok := p.(*Client)
+		if !ok {
+			t.Fatalf("provider.New(%s) returned %T, want *Client", typ, p)
+		}
+		if c.baseURL != DefaultBaseURL {
+			t.Errorf("%s: baseURL = %q, want %q", typ, c.baseURL, DefaultBaseURL)
+		}
+	}
+}
+
+// ── Metrics ───────────────────────────────────────────────────────────────────
+
+type observation struct {
+	method, path string
+	status       int
+}
+
+// captureSink records every request observation.
+type captureSink struct {
+	obs []observation
+}
+
+func (s *captureSink) ObserveRequest(method, path string, status int, latency time.Duration) {
+	if latency < 0 {
+		panic("negative latency")
+	}
+	s.obs = append(s.obs, observation{method, path, status})
+}
+
+func TestWithMetrics_ObservesEachRequest(t *testing.T) {
+	srv, _ := newTestServer(t, map[string]http.HandlerFunc{
+		"/api/v4/projects/group%2Fapp/merge_requests/7": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, gitlabMR{Title: "t"})
+		},
+		"/api/v4/projects/group%2Fapp/merge_requests/8": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		},
+	})
+	sink := &captureSink{}
+	c := New(srv.URL, "test-token", WithHTTPClient(srv.Client()), WithMetrics(sink))
+
+	if _, err := c.GetMRDetails(context.Background(), "group/app", 7); err != nil {
+		t.Fatalf("GetMRDetails: %v", err)
+	}
+	if _, err := c.GetMRDetails(context.Background(), "group/app", 8); !errors.Is(err, provider.ErrNotFound) {
+		t.Fatalf("GetMRDetails(8) = %v, want ErrNotFound", err)
+	}
+
+	want := []observation{
+		{"GetMRDetails", "projects/:id/merge_requests/:id", http.StatusOK},
+		{"GetMRDetails", "projects/:id/merge_requests/:id", http.StatusNotFound},
+	}
+	if !reflect.DeepEqual(sink.obs, want) {
+		t.Errorf("observations = %+v, want %+v", sink.obs, want)
+	}
+}
+
+func TestWithMetrics_TransportErrorHasNoStatus(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	sink := &captureSink{}
+	c := New(srv.URL, "test-token", WithMetrics(sink))
+
+	if _, err := c.GetMRDetails(context.Background(), "42", 7); err == nil {
+		t.Fatal("expected a connection error")
+	}
+	if len(sink.obs) != 1 || sink.obs[0].status != 0 {
+		t.Errorf("observations = %+v, want one with status 0", sink.obs)
+	}
+}
+
+func TestPathCategory(t *testing.T) {
+	for in, want := range map[string]string{
+		"/api/v4/projects":                                    "projects",
+		"/api/v4/projects/42/merge_requests/7/diffs":          "projects/:id/merge_requests/:id/diffs",
+		"/api/v4/projects/a%2Fb/repository/files/main.go/raw": "projects/:id/repository/files/:id/raw",
+		"/api/v4/projects/42/merge_requests/7/notes/99":       "projects/:id/merge_requests/:id/notes/:id",
+		"/api/v4/groups/platform%2Fteam/projects":             "groups/:id/projects",
+		"/api/v4/projects/42/repository/compare":              "projects/:id/repository/compare",
+	} {
+		if got := pathCategory(in); got != want {
+			t.Errorf("pathCategory(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
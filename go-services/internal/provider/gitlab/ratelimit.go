@@ -0,0 +1,89 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter pauses every request made through it after GitLab answers 429 with a
+// RateLimit-Reset header, until that reset time passes. GitLab throttles per user and
+// instance, so one limiter should be shared by all clients talking to the same host;
+// SharedRateLimiter hands out one per host for that.
+type RateLimiter struct {
+	mu    sync.Mutex
+	until time.Time
+
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+// NewRateLimiter returns a RateLimiter using the wall clock.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{now: time.Now, after: time.After}
+}
+
+var (
+	sharedMu       sync.Mutex
+	sharedLimiters = map[string]*RateLimiter{}
+)
+
+// SharedRateLimiter returns the process-wide RateLimiter for baseURL's host, creating
+// it on first use.
+func SharedRateLimiter(baseURL string) *RateLimiter {
+	host := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	l, ok := sharedLimiters[host]
+	if !ok {
+		l = NewRateLimiter()
+		sharedLimiters[host] = l
+	}
+	return l
+}
+
+// WithRateLimiter makes the client wait on l before each request and report 429s to it.
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(cl *Client) {
+		cl.limiter = l
+	}
+}
+
+// Wait blocks until no rate-limit pause is in effect or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		d := l.until.Sub(l.now())
+		l.mu.Unlock()
+		if d <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.after(d):
+		}
+	}
+}
+
+// observe records the pause a 429 response asks for. RateLimit-Reset is a Unix
+// timestamp; a missing or unparsable header leaves the limiter untouched, and an
+// earlier reset never shortens a pause already in effect.
+func (l *RateLimiter) observe(h http.Header) {
+	secs, err := strconv.ParseInt(h.Get("RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	reset := time.Unix(secs, 0)
+	l.mu.Lock()
+	if reset.After(l.until) {
+		l.until = reset
+	}
+	l.mu.Unlock()
+}
@@ -0,0 +1,30 @@
+package gitlab
+
+import (
+	"fmt"
+
+	"ai-reviewer/go-services/internal/httpclient"
+	"ai-reviewer/go-services/internal/provider"
+)
+
+// DefaultBaseURL is the GitLab.com instance root, used when a provider has no base URL.
+const DefaultBaseURL = "https://gitlab.com"
+
+func init() {
+	provider.Register("gitlab_self_hosted", newFromConfig)
+	provider.Register("gitlab_cloud", newFromConfig)
+}
+
+// newFromConfig builds a client with the provider's TLS files and proxy. Clients for the
+// same host share one RateLimiter.
+func newFromConfig(cfg provider.Config) (provider.GitProvider, error) {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	hc, err := httpclient.New(httpclient.TLSOptions{CAFile: cfg.TLSCAFile, CertFile: cfg.TLSCertFile, KeyFile: cfg.TLSKeyFile})
+	if err != nil {
+		return nil, fmt.Errorf("provider TLS config: %w", err)
+	}
+	return New(baseURL, cfg.Token, WithHTTPClient(hc), WithProxy(cfg.ProxyURL), WithRateLimiter(SharedRateLimiter(baseURL))), nil
+}
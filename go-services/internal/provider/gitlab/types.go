@@ -15,18 +15,27 @@ type gitlabMR struct {
 	Author       struct {
 		Username string `json:"username"`
 	} `json:"author"`
-	SourceBranch string `json:"source_branch"`
-	TargetBranch string `json:"target_branch"`
-	SHA          string `json:"sha"`
-	Draft        bool   `json:"draft"`
+	SourceBranch string   `json:"source_branch"`
+	TargetBranch string   `json:"target_branch"`
+	SHA          string   `json:"sha"`
+	Draft        bool     `json:"draft"`
+	Labels       []string `json:"labels"`
+	State        string   `json:"state"`
+	MergeStatus  string   `json:"merge_status"`
 }
 
 // gitlabMRChanges maps the response from GET /api/v4/projects/:id/merge_requests/:iid/changes.
+// ChangesCount is a string because GitLab reports capped counts as e.g. "100+";
+// Overflow is set when GitLab dropped files or diffs from the response.
 type gitlabMRChanges struct {
-	Changes []gitlabDiffChange `json:"changes"`
+	Changes      []gitlabDiffChange `json:"changes"`
+	ChangesCount string             `json:"changes_count"`
+	Overflow     bool               `json:"overflow"`
 }
 
-// gitlabDiffChange is a single file entry within the changes response.
+// gitlabDiffChange is a single file entry within the changes response, and an element
+// of the paginated GET /api/v4/projects/:id/merge_requests/:iid/diffs response.
+// Collapsed and TooLarge are only reported by /diffs; such entries have an empty Diff.
 type gitlabDiffChange struct {
 	OldPath     string `json:"old_path"`
 	NewPath     string `json:"new_path"`
@@ -34,11 +43,32 @@ type gitlabDiffChange struct {
 	NewFile     bool   `json:"new_file"`
 	DeletedFile bool   `json:"deleted_file"`
 	RenamedFile bool   `json:"renamed_file"`
+	Collapsed   bool   `json:"collapsed"`
+	TooLarge    bool   `json:"too_large"`
 }
 
-// gitlabNote maps the response from POST /api/v4/projects/:id/merge_requests/:iid/notes.
+// gitlabCompare maps the response from GET /api/v4/projects/:id/repository/compare.
+// CompareTimeout is set when GitLab gave up computing the diffs.
+type gitlabCompare struct {
+	Diffs          []gitlabDiffChange `json:"diffs"`
+	CompareTimeout bool               `json:"compare_timeout"`
+}
+
+// gitlabNote maps a note of /api/v4/projects/:id/merge_requests/:iid/notes. Type is
+// "DiffNote" for inline comments and empty for top-level notes; System marks notes GitLab
+// generates for MR events.
 type gitlabNote struct {
-	ID int `json:"id"`
+	ID     int    `json:"id"`
+	Body   string `json:"body"`
+	System bool   `json:"system"`
+	Type   string `json:"type"`
+}
+
+// gitlabIssue maps an element of GET /api/v4/projects/:id/merge_requests/:iid/closes_issues.
+type gitlabIssue struct {
+	IID         int    `json:"iid"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
 }
 
 // gitlabDiscussion maps the response from POST /api/v4/projects/:id/merge_requests/:iid/discussions.
@@ -53,3 +83,9 @@ type gitlabMRVersion struct {
 	BaseSHA  string `json:"base_commit_sha"`
 	StartSHA string `json:"start_commit_sha"`
 }
+
+// gitlabPipeline maps an item from GET /api/v4/projects/:id/pipelines.
+type gitlabPipeline struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
@@ -3,6 +3,10 @@ package provider
 import (
 	"context"
 	"errors"
+	"fmt"
+	"path"
+
+	restate "github.com/restatedev/sdk-go"
 )
 
 // Sentinel errors returned by GitProvider implementations.
@@ -14,6 +18,36 @@ var (
 	ErrInvalidInput = errors.New("invalid input") // e.g. invalid inline comment position
 )
 
+// ProviderServerError is returned for a 5xx response from the provider's API. Server errors
+// are usually transient, so callers keep retrying them; the type lets them tell these apart
+// from decode and network errors when logging.
+type ProviderServerError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ProviderServerError) Error() string {
+	return fmt.Sprintf("server error %d: %s", e.StatusCode, e.Body)
+}
+
+// ClassifyError turns the sentinel errors a retry can't fix into Restate terminal errors
+// with a matching status code; anything else is returned as is, so Restate retries it.
+func ClassifyError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return restate.TerminalError(err, 404)
+	case errors.Is(err, ErrUnauthorized):
+		return restate.TerminalError(err, 401)
+	case errors.Is(err, ErrForbidden):
+		return restate.TerminalError(err, 403)
+	case errors.Is(err, ErrInvalidInput):
+		return restate.TerminalError(err, 422)
+	default:
+		// Retryable: ProviderServerError (5xx), rate limit, network errors, etc.
+		return err
+	}
+}
+
 // GitProvider abstracts VCS platform operations needed by the reviewer.
 // repoRemoteID is provider-specific (e.g. numeric string for GitLab, "owner/repo" for GitHub).
 // mrNumber is the MR/PR number (GitLab MR IID).
@@ -24,6 +58,13 @@ type GitProvider interface {
 	GetMRDetails(ctx context.Context, repoRemoteID string, mrNumber int) (*MRDetails, error)
 	PostComment(ctx context.Context, repoRemoteID string, mrNumber int, body string) (*CommentResult, error)
 	PostInlineComment(ctx context.Context, repoRemoteID string, mrNumber int, comment InlineComment) (*CommentResult, error)
+	// UpdateComment replaces the body of a top-level comment posted with PostComment.
+	// Providers that don't support it yet return ErrNotFound.
+	UpdateComment(ctx context.Context, repoRemoteID string, mrNumber int, providerCommentID, body string) (*CommentResult, error)
+	// GetFileContent returns the raw content of path at ref (a commit SHA or branch),
+	// reading at most maxBytes+1 bytes: a longer result than maxBytes means the file is
+	// larger and was cut. Providers that don't support it yet return ErrNotFound.
+	GetFileContent(ctx context.Context, repoRemoteID string, ref, path string, maxBytes int) ([]byte, error)
 }
 
 // Repo is a repository accessible to the authenticated user.
@@ -39,6 +80,7 @@ type MRDiff struct {
 	UnifiedDiff  string
 	ChangedFiles []ChangedFile
 	ChangedLines int
+	Truncated    bool // provider capped the diff; ChangedFiles/ChangedLines under-report
 }
 
 // ChangedFile is a single file changed in a merge request.
@@ -49,6 +91,7 @@ type ChangedFile struct {
 	NewFile bool
 	Deleted bool
 	Renamed bool
+	Binary  bool // no textual diff; not counted in MRDiff.ChangedLines
 }
 
 // MRDetails holds metadata about a merge request.
@@ -60,6 +103,53 @@ type MRDetails struct {
 	TargetBranch string
 	HeadSHA      string
 	Draft        bool
+	Labels       []string
+	// State is MRStateOpened, MRStateMerged or MRStateClosed; empty if the provider
+	// doesn't report it.
+	State string
+	// MergeStatus is GitLab's merge_status (e.g. "can_be_merged"); empty elsewhere.
+	MergeStatus string
+}
+
+// Merge request states reported in MRDetails.State.
+const (
+	MRStateOpened = "opened"
+	MRStateMerged = "merged"
+	MRStateClosed = "closed"
+)
+
+// MRClosed reports whether state is a merged or closed merge request, which is no longer
+// worth reviewing.
+func MRClosed(state string) bool {
+	return state == MRStateMerged || state == MRStateClosed
+}
+
+// PipelineSuccess is the status of a CI pipeline that passed, as reported by providers
+// that expose pipelines (GitLab's status values).
+const PipelineSuccess = "success"
+
+// PipelineRunning reports whether a pipeline with status hasn't finished yet, so its
+// outcome may still change.
+func PipelineRunning(status string) bool {
+	switch status {
+	case "created", "waiting_for_resource", "preparing", "pending", "running", "scheduled":
+		return true
+	}
+	return false
+}
+
+// TargetBranchMatches reports whether branch matches one of patterns, path.Match globs
+// such as "release/*". No patterns match every branch; malformed ones match none.
+func TargetBranchMatches(patterns []string, branch string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, branch); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // InlineComment is a comment anchored to a specific line in a file.
@@ -70,6 +160,19 @@ type InlineComment struct {
 	NewLine  bool // true → comment on new (right) side; false → old (left) side
 }
 
+// Note is a top-level comment on a merge request.
+type Note struct {
+	ID   string
+	Body string
+}
+
+// Issue is an issue linked to a merge request.
+type Issue struct {
+	IID         int
+	Title       string
+	Description string
+}
+
 // CommentResult is the result of posting a comment.
 type CommentResult struct {
 	ID string
@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	restate "github.com/restatedev/sdk-go"
+)
+
+func TestClassifyError_InvalidInputIsTerminal(t *testing.T) {
+	err := ClassifyError(fmt.Errorf("%w: position is invalid", ErrInvalidInput))
+	if !restate.IsTerminalError(err) {
+		t.Fatalf("expected terminal error, got %v", err)
+	}
+	if code := restate.ErrorCode(err); code != 422 {
+		t.Errorf("code = %d, want 422", code)
+	}
+	if restate.IsTerminalError(ClassifyError(ErrRateLimited)) {
+		t.Error("rate limiting must stay retryable")
+	}
+}
+
+func TestClassifyError_AuthAndNotFoundAreTerminal(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code uint16
+	}{
+		{ErrNotFound, 404},
+		{ErrUnauthorized, 401},
+		{ErrForbidden, 403},
+	} {
+		err := ClassifyError(fmt.Errorf("gitlab: %w", tc.err))
+		if !restate.IsTerminalError(err) || restate.ErrorCode(err) != restate.Code(tc.code) {
+			t.Errorf("ClassifyError(%v) = %v (code %d), want terminal %d", tc.err, err, restate.ErrorCode(err), tc.code)
+		}
+	}
+}
+
+func TestClassifyError_ServerErrorIsRetryable(t *testing.T) {
+	err := ClassifyError(fmt.Errorf("gitlab: %w", &ProviderServerError{StatusCode: 502}))
+	if restate.IsTerminalError(err) {
+		t.Fatalf("expected a retryable error, got terminal %v", err)
+	}
+	var serverErr *ProviderServerError
+	if !errors.As(err, &serverErr) || serverErr.StatusCode != 502 {
+		t.Errorf("classification lost the server error: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"fmt"
+	"sync"
+
+	"ai-reviewer/go-services/internal/db"
+)
+
+// Config is what a Factory gets to build a client for one providers row.
+type Config struct {
+	// BaseURL is the provider's API root; empty selects its public default, if it has one.
+	BaseURL string
+	Token   string
+	// PEM file paths for a self-hosted instance's TLS; empty uses the system roots.
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+	// ProxyURL is an explicit forward proxy; empty uses the environment.
+	ProxyURL string
+}
+
+// Factory builds a GitProvider from cfg.
+type Factory func(cfg Config) (GitProvider, error)
+
+// Registry maps provider types (the providers.type column) to the factories that build
+// their clients.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+// Register adds the factory for typeName. It panics if typeName is already registered, so
+// two implementations can't silently shadow each other.
+func (r *Registry) Register(typeName string, factory Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.factories[typeName]; dup {
+		panic("provider: Register called twice for type " + typeName)
+	}
+	r.factories[typeName] = factory
+}
+
+// New builds a client for a provider of type typeName.
+func (r *Registry) New(typeName string, cfg Config) (GitProvider, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[typeName]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider type: %s", typeName)
+	}
+	return factory(cfg)
+}
+
+// defaultRegistry holds the implementations that register themselves from init.
+var defaultRegistry = NewRegistry()
+
+// Register adds the factory for typeName to the default registry. Implementations call it
+// from init, so a service gets them by importing the package.
+func Register(typeName string, factory Factory) {
+	defaultRegistry.Register(typeName, factory)
+}
+
+// New builds a client for a provider of type typeName from the default registry.
+func New(typeName string, cfg Config) (GitProvider, error) {
+	return defaultRegistry.New(typeName, cfg)
+}
+
+// FromRow builds a client for a providers row from the default registry, with its
+// decrypted token.
+func FromRow(row *db.ProviderRow, token string) (GitProvider, error) {
+	return New(row.Type, Config{
+		BaseURL:     row.BaseURL,
+		Token:       token,
+		TLSCAFile:   row.TLSCAFile,
+		TLSCertFile: row.TLSCertFile,
+		TLSKeyFile:  row.TLSKeyFile,
+		ProxyURL:    row.ProxyURL,
+	})
+}
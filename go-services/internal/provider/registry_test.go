@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"ai-reviewer/go-services/internal/db"
+)
+
+// fakeProvider is a GitProvider that remembers the Config it was built from.
+type fakeProvider struct {
+	GitProvider
+	cfg Config
+}
+
+func TestRegistry_New(t *testing.T) {
+	r := NewRegistry()
+	r.Register("fake", func(cfg Config) (GitProvider, error) {
+		return &fakeProvider{cfg: cfg}, nil
+	})
+
+	p, err := r.New("fake", Config{BaseURL: "https://git.example.com", Token: "tok"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	fp, ok := p.(*fakeProvider)
+	if !ok {
+		t.Fatalf("New returned %T, want *fakeProvider", p)
+	}
+	if fp.cfg.BaseURL != "https://git.example.com" || fp.cfg.Token != "tok" {
+		t.Errorf("factory got %+v", fp.cfg)
+	}
+}
+
+func TestRegistry_UnknownType(t *testing.T) {
+	r := NewRegistry()
+	_, err := r.New("svn", Config{})
+	if err == nil || !strings.Contains(err.Error(), "unsupported provider type: svn") {
+		t.Fatalf("New(svn) error = %v, want unsupported provider type", err)
+	}
+}
+
+func TestRegistry_DuplicatePanics(t *testing.T) {
+	r := NewRegistry()
+	factory := func(Config) (GitProvider, error) { return &fakeProvider{}, nil }
+	r.Register("fake", factory)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("second Register did not panic")
+		}
+	}()
+	r.Register("fake", factory)
+}
+
+func TestFromRow(t *testing.T) {
+	Register("fake-fromrow", func(cfg Config) (GitProvider, error) {
+		return &fakeProvider{cfg: cfg}, nil
+	})
+
+	row := &db.ProviderRow{
+		Type:        "fake-fromrow",
+		BaseURL:     "https://git.example.com",
+		TLSCAFile:   "/etc/ca.pem",
+		TLSCertFile: "/etc/cert.pem",
+		TLSKeyFile:  "/etc/key.pem",
+		ProxyURL:    "http://proxy:3128",
+	}
+	p, err := FromRow(row, "tok")
+	if err != nil {
+		t.Fatalf("FromRow: %v", err)
+	}
+	want := Config{
+		BaseURL:     "https://git.example.com",
+		Token:       "tok",
+		TLSCAFile:   "/etc/ca.pem",
+		TLSCertFile: "/etc/cert.pem",
+		TLSKeyFile:  "/etc/key.pem",
+		ProxyURL:    "http://proxy:3128",
+	}
+	if got := p.(*fakeProvider).cfg; got != want {
+		t.Errorf("factory got %+v, want %+v", got, want)
+	}
+}
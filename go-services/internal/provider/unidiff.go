@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseUnifiedDiff splits a git-format unified diff (as returned by providers that serve
+// raw diffs) into per-file entries and counts changed lines across non-binary files.
+// Each entry's Diff holds the hunks only (from the first "@@"), like GitLab's per-file diffs.
+func ParseUnifiedDiff(diff string) ([]ChangedFile, int) {
+	var (
+		files []ChangedFile
+		total int
+	)
+	for _, section := range strings.Split(diff, "\ndiff --git ") {
+		section = strings.TrimPrefix(section, "diff --git ")
+		if strings.TrimSpace(section) == "" {
+			continue
+		}
+		header, hunks, _ := strings.Cut(section, "\n@@")
+		if hunks != "" {
+			hunks = "@@" + hunks
+		}
+
+		f := ChangedFile{Diff: hunks}
+		lines := strings.Split(header, "\n")
+		// First line is "a/<old> b/<new>"; the lines below override it when present.
+		if a, b, ok := strings.Cut(lines[0], " b/"); ok {
+			f.OldPath = strings.TrimPrefix(a, "a/")
+			f.NewPath = b
+		}
+		for _, l := range lines[1:] {
+			switch {
+			case strings.HasPrefix(l, "new file mode"):
+				f.NewFile = true
+			case strings.HasPrefix(l, "deleted file mode"):
+				f.Deleted = true
+			case strings.HasPrefix(l, "rename from "):
+				f.OldPath = strings.TrimPrefix(l, "rename from ")
+				f.Renamed = true
+			case strings.HasPrefix(l, "rename to "):
+				f.NewPath = strings.TrimPrefix(l, "rename to ")
+			case strings.HasPrefix(l, "Binary files "), l == "GIT binary patch":
+				f.Binary = true
+			case strings.HasPrefix(l, "--- a/"):
+				f.OldPath = strings.TrimPrefix(l, "--- a/")
+			case strings.HasPrefix(l, "+++ b/"):
+				f.NewPath = strings.TrimPrefix(l, "+++ b/")
+			}
+		}
+		if !f.Binary {
+			total += countHunkLines(f.Diff)
+		}
+		files = append(files, f)
+	}
+	return files, total
+}
+
+// countHunkLines counts added and removed lines in a diff's hunks.
+func countHunkLines(diff string) int {
+	count := 0
+	for _, line := range strings.Split(diff, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		if (line[0] == '+' && !strings.HasPrefix(line, "+++")) ||
+			(line[0] == '-' && !strings.HasPrefix(line, "---")) {
+			count++
+		}
+	}
+	return count
+}
+
+// hunkHeaderRe matches a unified diff hunk header; omitted counts mean 1.
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// NewSideLines returns, per new file path, the new-side line numbers present in a
+// git-format unified diff: added lines plus the context lines around them. These are the
+// lines providers accept inline comments on. Deleted and binary files have no entry.
+func NewSideLines(diff string) map[string]map[int]bool {
+	return sideLines(diff, false)
+}
+
+// OldSideLines is NewSideLines for the old side: per old file path, the deleted lines plus
+// the context lines around them, which is where comments on removed code anchor. New and
+// binary files have no entry.
+func OldSideLines(diff string) map[string]map[int]bool {
+	return sideLines(diff, true)
+}
+
+// sideLines collects the line numbers of one side of each file's hunks.
+func sideLines(diff string, old bool) map[string]map[int]bool {
+	files, _ := ParseUnifiedDiff(diff)
+	out := make(map[string]map[int]bool, len(files))
+	for _, f := range files {
+		if f.Binary || (old && f.NewFile) || (!old && f.Deleted) {
+			continue
+		}
+		lines := make(map[int]bool)
+		body := strings.Split(f.Diff, "\n")
+		for i := 0; i < len(body); i++ {
+			m := hunkHeaderRe.FindStringSubmatch(body[i])
+			if m == nil {
+				continue
+			}
+			oldCount, newCount := hunkCount(m[2]), hunkCount(m[4])
+			oldLine, _ := strconv.Atoi(m[1])
+			newLine, _ := strconv.Atoi(m[3])
+			// Consume the hunk by its declared counts; an empty line inside a hunk is a
+			// context line whose leading space was stripped.
+			seenOld, seenNew := 0, 0
+			for i++; i < len(body) && (seenOld < oldCount || seenNew < newCount); i++ {
+				switch l := body[i]; {
+				case strings.HasPrefix(l, `\`):
+				case strings.HasPrefix(l, "+"):
+					if !old {
+						lines[newLine] = true
+					}
+					newLine++
+					seenNew++
+				case strings.HasPrefix(l, "-"):
+					if old {
+						lines[oldLine] = true
+					}
+					oldLine++
+					seenOld++
+				default:
+					if old {
+						lines[oldLine] = true
+					} else {
+						lines[newLine] = true
+					}
+					oldLine++
+					newLine++
+					seenOld++
+					seenNew++
+				}
+			}
+			i--
+		}
+		if old {
+			out[f.OldPath] = lines
+		} else {
+			out[f.NewPath] = lines
+		}
+	}
+	return out
+}
+
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewSideLines(t *testing.T) {
+	diff := "diff --git a/main.go b/main.go\n" +
+		"--- a/main.go\n" +
+		"+++ b/main.go\n" +
+		"@@ -10,3 +10,5 @@ func main() {\n" +
+		" \tctx := context.Background()\n" +
+		"-\trun(ctx)\n" +
+		"+\tif err := run(ctx); err != nil {\n" +
+		"+\t\tlog.Fatal(err)\n" +
+		"+\t}\n" +
+		"\n" +
+		"@@ -40 +41 @@\n" +
+		"-\treturn nil\n" +
+		"+\treturn err\n" +
+		"\\ No newline at end of file\n" +
+		"diff --git a/old.go b/old.go\n" +
+		"deleted file mode 100644\n" +
+		"--- a/old.go\n" +
+		"+++ /dev/null\n" +
+		"@@ -1,2 +0,0 @@\n" +
+		"-package old\n" +
+		"-\n" +
+		"diff --git a/logo.png b/logo.png\n" +
+		"Binary files a/logo.png and b/logo.png differ\n"
+
+	got := NewSideLines(diff)
+	want := map[string]map[int]bool{
+		"main.go": {10: true, 11: true, 12: true, 13: true, 14: true, 41: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewSideLines() = %v, want %v", got, want)
+	}
+}
+
+func TestOldSideLines(t *testing.T) {
+	diff := "diff --git a/main.go b/main.go\n" +
+		"--- a/main.go\n" +
+		"+++ b/main.go\n" +
+		"@@ -10,3 +10,5 @@ func main() {\n" +
+		" \tctx := context.Background()\n" +
+		"-\trun(ctx)\n" +
+		"+\tif err := run(ctx); err != nil {\n" +
+		"+\t\tlog.Fatal(err)\n" +
+		"+\t}\n" +
+		"\n" +
+		"diff --git a/old.go b/old.go\n" +
+		"deleted file mode 100644\n" +
+		"--- a/old.go\n" +
+		"+++ /dev/null\n" +
+		"@@ -1,2 +0,0 @@\n" +
+		"-package old\n" +
+		"-\n" +
+		"diff --git a/new.go b/new.go\n" +
+		"new file mode 100644\n" +
+		"--- /dev/null\n" +
+		"+++ b/new.go\n" +
+		"@@ -0,0 +1 @@\n" +
+		"+package new\n"
+
+	got := OldSideLines(diff)
+	want := map[string]map[int]bool{
+		"main.go": {10: true, 11: true, 12: true},
+		"old.go":  {1: true, 2: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OldSideLines() = %v, want %v", got, want)
+	}
+}
+
+func TestNewSideLines_Empty(t *testing.T) {
+	if got := NewSideLines(""); len(got) != 0 {
+		t.Errorf("NewSideLines(\"\") = %v, want empty", got)
+	}
+}
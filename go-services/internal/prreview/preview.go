@@ -0,0 +1,94 @@
+package prreview
+
+import (
+	"fmt"
+
+	restate "github.com/restatedev/sdk-go"
+
+	"ai-reviewer/go-services/internal/config"
+	"ai-reviewer/go-services/internal/difffetcher"
+)
+
+// ReviewPreview is a Restate Service that runs the review pipeline up to the Reviewer and
+// returns the result without creating a review run, storing comments or posting anything.
+// It is called request-response by the API server's PreviewReview RPC.
+type ReviewPreview struct {
+	cfg *config.Store
+}
+
+// NewPreview creates a new ReviewPreview service.
+func NewPreview(cfg *config.Store) *ReviewPreview {
+	return &ReviewPreview{cfg: cfg}
+}
+
+// PreviewRequest is the input for Preview.
+type PreviewRequest struct {
+	RepoID   string `json:"repo_id"`
+	MRNumber int    `json:"mr_number"`
+}
+
+// PreviewResponse is the output from Preview: the Reviewer's summary and comments, or
+// DiffTooLarge with neither when the diff exceeds what is reviewed automatically.
+type PreviewResponse struct {
+	reviewerOutput
+	DiffTooLarge bool `json:"diff_too_large"`
+	// SkipReason is set, with nothing else, when a review run would skip the MR; it is the
+	// detail the run would record (see previewSkipReason).
+	SkipReason string `json:"skip_reason,omitempty"`
+}
+
+// Preview fetches the MR and runs the Reviewer on it. The diff-hash dedup is bypassed so a
+// preview of an already-reviewed head still runs; drafts are previewed like any other MR.
+func (p *ReviewPreview) Preview(ctx restate.Context, req PreviewRequest) (PreviewResponse, error) {
+	// Journaled like Run's, so a replay after a config reload calls the same Reviewer.
+	settings, err := restate.Run(ctx, func(restate.RunContext) (runSettings, error) {
+		return newRunSettings(p.cfg.Get()), nil
+	})
+	if err != nil {
+		return PreviewResponse{}, err
+	}
+
+	fetchResp, err := restate.Service[difffetcher.FetchResponse](ctx, "DiffFetcher", "FetchPRDetails").
+		Request(difffetcher.FetchRequest{
+			RepoID:       req.RepoID,
+			MRNumber:     req.MRNumber,
+			Force:        true,
+			ReviewDrafts: true,
+		})
+	if err != nil {
+		return PreviewResponse{}, fmt.Errorf("fetching PR details: %w", err)
+	}
+	if reason := previewSkipReason(fetchResp); reason != "" {
+		return PreviewResponse{SkipReason: reason}, nil
+	}
+	if fetchResp.DiffTooLarge {
+		return PreviewResponse{DiffTooLarge: true}, nil
+	}
+
+	service, handler := reviewerTarget(settings, fetchResp.ReviewerVariant)
+	reviewer, err := restate.Service[reviewerOutput](ctx, service, handler).
+		Request(newReviewerInput(fetchResp))
+	if err != nil {
+		return PreviewResponse{}, fmt.Errorf("running reviewer: %w", err)
+	}
+	if err := validateReviewerOutput(reviewer); err != nil {
+		return PreviewResponse{}, restate.TerminalError(err, 500)
+	}
+
+	reviewer.Comments = dedupeComments(reviewer.Comments)
+	return PreviewResponse{reviewerOutput: reviewer}, nil
+}
+
+// previewSkipReason returns why Run would skip the fetched MR without reviewing it: it was
+// merged or closed, targets a branch outside the repo's patterns, or its head pipeline
+// blocks the review. The reasons are the details Run records; "" means it is reviewed.
+// Drafts are previewed, and a running pipeline isn't waited for.
+func previewSkipReason(resp difffetcher.FetchResponse) string {
+	if detail := closedMRDetail(resp.State); detail != "" {
+		return detail
+	}
+	if detail := targetBranchDetail(resp.TargetBranchPatterns, resp.TargetBranch); detail != "" {
+		return detail
+	}
+	return pipelineDetail(resp.PipelineBlocked, resp.PipelineStatus)
+}
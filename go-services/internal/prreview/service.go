@@ -3,25 +3,31 @@ package prreview
 import (
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 	"time"
 
 	restate "github.com/restatedev/sdk-go"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"ai-reviewer/go-services/internal/config"
+	"ai-reviewer/go-services/internal/crypto"
 	"ai-reviewer/go-services/internal/db"
 	"ai-reviewer/go-services/internal/difffetcher"
 	"ai-reviewer/go-services/internal/postreview"
+	"ai-reviewer/go-services/internal/provider"
 )
 
 // PRReview is a Restate Virtual Object that orchestrates the full PR review pipeline.
 // It is keyed by "<repo_id>-<mr_number>" to ensure one active review per PR at a time.
 type PRReview struct {
 	pool *pgxpool.Pool
+	cfg  *config.Store
 }
 
 // New creates a new PRReview virtual object.
-func New(pool *pgxpool.Pool) *PRReview {
-	return &PRReview{pool: pool}
+func New(pool *pgxpool.Pool, cfg *config.Store) *PRReview {
+	return &PRReview{pool: pool, cfg: cfg}
 }
 
 // RunRequest is the input for Run.
@@ -31,10 +37,80 @@ type RunRequest struct {
 	MRNumber int    `json:"mr_number"`
 	DryRun   bool   `json:"dry_run"`
 	Force    bool   `json:"force"`
+	// ReviewDrafts reviews the MR even while it is a draft (the repo's review_drafts flag).
+	ReviewDrafts bool `json:"review_drafts,omitempty"`
+	// SkipDebounce starts the run without waiting; set for manual triggers (TriggerReview).
+	SkipDebounce bool `json:"skip_debounce,omitempty"`
+	// DispatchToken is the api-server's signature of the request; see verifyDispatch.
+	DispatchToken string `json:"dispatch_token,omitempty"`
 }
 
+// verifyDispatch checks req's dispatch token, sent to the object key, against the
+// configured dispatch secrets, so that only the api-server can start reviews through the
+// Restate ingress. An empty DispatchSecret accepts every request.
+func verifyDispatch(req RunRequest, key string, cfg config.Config, now time.Time) error {
+	if cfg.DispatchSecret == "" {
+		return nil
+	}
+	v := crypto.DispatchVerifier{
+		Secrets:      [][]byte{[]byte(cfg.DispatchSecret), []byte(cfg.DispatchSecretPrevious)},
+		AcceptLegacy: cfg.DispatchAcceptLegacy,
+	}
+	return v.Verify(crypto.DispatchClaims{
+		Key:          key,
+		RunID:        req.RunID,
+		RepoID:       req.RepoID,
+		MRNumber:     int64(req.MRNumber),
+		Force:        req.Force,
+		ReviewDrafts: req.ReviewDrafts,
+		SkipDebounce: req.SkipDebounce,
+	}, req.DispatchToken, now)
+}
+
+// runSettings is the part of the reloadable config a run depends on. Run takes it once
+// through restate.Run, so a replay after a SIGHUP reload takes the same path as the
+// original execution. It is journaled, so it holds no secrets.
+type runSettings struct {
+	// StartedAt is when the run started, in unix millis.
+	StartedAt int64 `json:"started_at"`
+
+	ReviewDebounce       time.Duration `json:"review_debounce"`
+	ReviewJitter         time.Duration `json:"review_jitter"`
+	IncrementalReview    bool          `json:"incremental_review"`
+	PipelineWaitChecks   int           `json:"pipeline_wait_checks"`
+	PipelineWaitInterval time.Duration `json:"pipeline_wait_interval"`
+
+	ReviewerService   string            `json:"reviewer_service"`
+	ReviewerHandler   string            `json:"reviewer_handler"`
+	ReviewerVariants  map[string]string `json:"reviewer_variants,omitempty"`
+	ReviewerTimeout   time.Duration     `json:"reviewer_timeout"`
+	MaxPostedComments int               `json:"max_posted_comments"`
+}
+
+// newRunSettings copies the settings a run uses out of cfg.
+func newRunSettings(cfg config.Config) runSettings {
+	return runSettings{
+		ReviewDebounce:       cfg.ReviewDebounce,
+		ReviewJitter:         cfg.ReviewJitter,
+		IncrementalReview:    cfg.IncrementalReview,
+		PipelineWaitChecks:   cfg.PipelineWaitChecks,
+		PipelineWaitInterval: cfg.PipelineWaitInterval,
+
+		ReviewerService:   cfg.ReviewerService,
+		ReviewerHandler:   cfg.ReviewerHandler,
+		ReviewerVariants:  cfg.ReviewerVariants,
+		ReviewerTimeout:   cfg.ReviewerTimeout,
+		MaxPostedComments: cfg.MaxPostedComments,
+	}
+}
+
+// reviewerSchemaVersion is the version of the reviewerInput/reviewerOutput contract with
+// the Python Reviewer. Bump it together with reviewer/models.py on any breaking change.
+const reviewerSchemaVersion = 1
+
 // reviewerInput is the payload sent to the Python Reviewer service.
 type reviewerInput struct {
+	SchemaVersion int      `json:"schema_version"`
 	Diff          string   `json:"diff"`
 	MRTitle       string   `json:"mr_title"`
 	MRDescription string   `json:"mr_description"`
@@ -42,6 +118,15 @@ type reviewerInput struct {
 	SourceBranch  string   `json:"source_branch"`
 	TargetBranch  string   `json:"target_branch"`
 	ChangedFiles  []string `json:"changed_files"`
+	// Languages maps changed file paths to their detected language; unknown files are absent.
+	Languages map[string]string `json:"languages,omitempty"`
+	// FileContents maps some changed file paths to their full content at the MR head.
+	FileContents map[string]string `json:"file_contents,omitempty"`
+	// RelatedIssues are the issues the MR closes, as context for its intent.
+	RelatedIssues []difffetcher.RelatedIssue `json:"related_issues,omitempty"`
+	// Per-repo overrides; omitted when unset so the Reviewer falls back to its env defaults.
+	ReviewModel       string   `json:"review_model,omitempty"`
+	ReviewTemperature *float64 `json:"review_temperature,omitempty"`
 }
 
 // reviewComment is a single inline comment from the Reviewer service.
@@ -50,25 +135,51 @@ type reviewComment struct {
 	LineStart int    `json:"line_start"`
 	LineEnd   int    `json:"line_end"`
 	Body      string `json:"body"`
+	Severity  string `json:"severity"`
+	// Side is "old" when the lines are on the old file (a deletion); otherwise "new".
+	Side string `json:"side,omitempty"`
 }
 
 // reviewerOutput is the response from the Python Reviewer service.
+// SchemaVersion echoes the version the Reviewer speaks; 0 means it predates versioning.
 type reviewerOutput struct {
-	Summary  string          `json:"summary"`
-	Comments []reviewComment `json:"comments"`
+	SchemaVersion int             `json:"schema_version"`
+	Summary       string          `json:"summary"`
+	Comments      []reviewComment `json:"comments"`
 }
 
 // Run orchestrates the full PR review pipeline. Returns the review_run_id.
 func (p *PRReview) Run(ctx restate.ObjectContext, req RunRequest) (string, error) {
 	// Smart debounce: only delay when a recent invocation was cancelled (rapid push scenario).
 	// First trigger for an MR proceeds immediately.
+	// Runs that aren't debounced wait out the optional jitter instead, so a CI job pushing
+	// to many MRs at once doesn't start all their reviews together. Manual triggers skip both.
+	key := restate.Key(ctx)
+	settings, err := restate.Run(ctx, func(rc restate.RunContext) (runSettings, error) {
+		cfg := p.cfg.Get()
+		if err := verifyDispatch(req, key, cfg, time.Now()); err != nil {
+			// Forged, unsigned or expired: fail before touching state, and never retry. The
+			// run the api-server created is failed rather than left pending forever.
+			log.Printf("PRReview: rejecting run for repo %s MR %d: %v", req.RepoID, req.MRNumber, err)
+			if req.RunID != "" {
+				if err := db.FailPendingReviewRun(rc, p.pool, req.RunID, req.RepoID, req.MRNumber, err.Error()); err != nil {
+					log.Printf("PRReview: failing rejected run %s: %v", req.RunID, err)
+				}
+			}
+			return runSettings{}, restate.TerminalError(err, 401)
+		}
+		s := newRunSettings(cfg)
+		s.StartedAt = time.Now().UnixMilli()
+		return s, nil
+	})
+	if err != nil {
+		return "", err
+	}
 	lastStarted, _ := restate.Get[int64](ctx, "last_started_at")
-	now := time.Now().UnixMilli()
-	restate.Set(ctx, "last_started_at", now)
+	restate.Set(ctx, "last_started_at", settings.StartedAt)
 
-	if lastStarted > 0 && (now-lastStarted) < 3*60*1000 {
-		// A recent invocation was cancelled — debounce before proceeding.
-		if err := restate.Sleep(ctx, 3*time.Minute); err != nil {
+	if d := startDelay(req, lastStarted, settings.StartedAt, settings, restate.Rand(ctx).Float64); d > 0 {
+		if err := restate.Sleep(ctx, d); err != nil {
 			return "", err
 		}
 	}
@@ -84,33 +195,92 @@ func (p *PRReview) Run(ctx restate.ObjectContext, req RunRequest) (string, error
 		runID = id
 	}
 
-	// fail updates the run status to failed and propagates the error.
+	// fail updates the run status to failed, recording the error as the event detail,
+	// and propagates the error.
 	fail := func(err error) (string, error) {
-		_ = db.UpdateReviewRunStatus(ctx, p.pool, runID, "failed")
+		_ = db.UpdateReviewRunStatus(ctx, p.pool, runID, "failed", err.Error())
 		return "", err
 	}
 
+	// An incremental re-review only covers what was pushed since the head of the last
+	// completed review.
+	var sinceSHA string
+	if !req.Force && settings.IncrementalReview {
+		sha, found, err := db.GetLatestReviewHeadSHA(ctx, p.pool, req.RepoID, req.MRNumber)
+		if err != nil {
+			return fail(fmt.Errorf("loading last reviewed head: %w", err))
+		}
+		if found {
+			sinceSHA = sha
+		}
+	}
+
 	// Step 1: Fetch diff + details from the VCS provider (includes dedup check).
-	fetchResp, err := restate.Service[difffetcher.FetchResponse](ctx, "DiffFetcher", "FetchPRDetails").
-		Request(difffetcher.FetchRequest{
-			RepoID:   req.RepoID,
-			MRNumber: req.MRNumber,
-			Force:    req.Force,
-		})
+	fetch := func() (difffetcher.FetchResponse, error) {
+		return restate.Service[difffetcher.FetchResponse](ctx, "DiffFetcher", "FetchPRDetails").
+			Request(difffetcher.FetchRequest{
+				RepoID:       req.RepoID,
+				MRNumber:     req.MRNumber,
+				Force:        req.Force,
+				SinceSHA:     sinceSHA,
+				ReviewDrafts: req.ReviewDrafts,
+			})
+	}
+	fetchResp, err := fetch()
 	if err != nil {
 		return fail(fmt.Errorf("fetching PR details: %w", err))
 	}
+	// A repo that requires a successful pipeline can wait for a running one to finish.
+	for checks := 0; waitForPipeline(fetchResp, checks, settings.PipelineWaitChecks); checks++ {
+		if err := restate.Sleep(ctx, settings.PipelineWaitInterval); err != nil {
+			return "", err
+		}
+		if fetchResp, err = fetch(); err != nil {
+			return fail(fmt.Errorf("fetching PR details: %w", err))
+		}
+	}
 
-	// Step 2: Guard against race where MR became a draft during debounce.
-	if fetchResp.Draft {
+	// The MR may have been merged or closed while the run was debounced.
+	if detail := closedMRDetail(fetchResp.State); detail != "" {
+		log.Printf("PRReview: MR %d %s, skipping", req.MRNumber, detail)
+		if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "skipped", detail); err != nil {
+			return "", fmt.Errorf("updating run status to skipped: %w", err)
+		}
+		return runID, nil
+	}
+
+	// Only MRs into the branches the repo reviews, if it limits them.
+	if detail := targetBranchDetail(fetchResp.TargetBranchPatterns, fetchResp.TargetBranch); detail != "" {
+		log.Printf("PRReview: MR %d %s, skipping", req.MRNumber, detail)
+		if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "skipped", detail); err != nil {
+			return "", fmt.Errorf("updating run status to skipped: %w", err)
+		}
+		return runID, nil
+	}
+
+	// Step 2: Guard against race where MR became a draft during debounce, unless the repo
+	// reviews drafts.
+	if fetchResp.Draft && !req.ReviewDrafts {
 		log.Printf("PRReview: MR %d is draft, skipping", req.MRNumber)
-		_ = db.UpdateReviewRunStatus(ctx, p.pool, runID, "draft")
+		_ = db.UpdateReviewRunStatus(ctx, p.pool, runID, "draft", "")
+		return runID, nil
+	}
+
+	// Only MRs whose head pipeline passed, if the repo requires it.
+	if detail := pipelineDetail(fetchResp.PipelineBlocked, fetchResp.PipelineStatus); detail != "" {
+		log.Printf("PRReview: MR %d %s, skipping", req.MRNumber, detail)
+		if err := db.MarkReviewRunPipelineBlocked(ctx, p.pool, runID, fetchResp.HeadSHA); err != nil {
+			return "", fmt.Errorf("marking run pipeline-blocked: %w", err)
+		}
+		if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "skipped", detail); err != nil {
+			return "", fmt.Errorf("updating run status to skipped: %w", err)
+		}
 		return runID, nil
 	}
 
 	// Step 3: Skip if diff hash matches a previous completed review.
 	if fetchResp.Skip {
-		if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "skipped"); err != nil {
+		if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "skipped", ""); err != nil {
 			return "", fmt.Errorf("updating run status to skipped: %w", err)
 		}
 		return runID, nil
@@ -123,8 +293,20 @@ func (p *PRReview) Run(ctx restate.ObjectContext, req RunRequest) (string, error
 		}
 	}
 
+	// Snapshot the MR the review is based on, for auditing and force-push detection.
+	meta := db.ReviewRunMetadata{
+		MRTitle:      fetchResp.MRTitle,
+		MRAuthor:     fetchResp.MRAuthor,
+		SourceBranch: fetchResp.SourceBranch,
+		TargetBranch: fetchResp.TargetBranch,
+		HeadSHA:      fetchResp.HeadSHA,
+	}
+	if err := db.UpdateReviewRunMetadata(ctx, p.pool, runID, meta); err != nil {
+		return fail(fmt.Errorf("storing MR metadata: %w", err))
+	}
+
 	// Step 4: Mark run as running.
-	if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "running"); err != nil {
+	if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "running", ""); err != nil {
 		return fail(fmt.Errorf("updating run status: %w", err))
 	}
 
@@ -136,65 +318,412 @@ func (p *PRReview) Run(ctx restate.ObjectContext, req RunRequest) (string, error
 				RepoID:       req.RepoID,
 				MRNumber:     req.MRNumber,
 				RepoRemoteID: fetchResp.RepoRemoteID,
-				Summary:      "This PR is too large to review automatically (> 5000 changed lines).",
+				Summary:      "This PR is too large to review automatically.",
 				DryRun:       req.DryRun,
 			})
 		if err != nil {
 			return fail(fmt.Errorf("posting too-large message: %w", err))
 		}
-		if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "completed"); err != nil {
+		if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "completed", ""); err != nil {
 			return fail(err)
 		}
 		return runID, nil
 	}
 
 	// Step 6: Call the Python Reviewer service (cross-language via Restate).
-	reviewer, err := restate.Service[reviewerOutput](ctx, "Reviewer", "RunReview").
-		Request(reviewerInput{
-			Diff:          fetchResp.Diff,
-			MRTitle:       fetchResp.MRTitle,
-			MRDescription: fetchResp.MRDescription,
-			MRAuthor:      fetchResp.MRAuthor,
-			SourceBranch:  fetchResp.SourceBranch,
-			TargetBranch:  fetchResp.TargetBranch,
-			ChangedFiles:  fetchResp.ChangedFiles,
-		})
+	service, handler := reviewerTarget(settings, fetchResp.ReviewerVariant)
+	call := &restateReviewerCall{
+		ctx: ctx,
+		fut: restate.Service[reviewerOutput](ctx, service, handler).RequestFuture(newReviewerInput(fetchResp)),
+	}
+	reviewer, err := awaitReviewer(call, settings.ReviewerTimeout)
 	if err != nil {
 		return fail(fmt.Errorf("running reviewer: %w", err))
 	}
+	if err := validateReviewerOutput(reviewer); err != nil {
+		// Retrying won't help until the services are redeployed at matching versions.
+		return fail(restate.TerminalError(err, 500))
+	}
 
 	// Step 7: Persist comments to DB before posting (idempotency).
-	commentInputs := make([]db.ReviewCommentInput, len(reviewer.Comments))
-	for i, c := range reviewer.Comments {
+	comments := dedupeComments(reviewer.Comments)
+	commentInputs := make([]db.ReviewCommentInput, len(comments))
+	for i, c := range comments {
 		commentInputs[i] = db.ReviewCommentInput{
 			FilePath:  c.FilePath,
 			LineStart: c.LineStart,
 			LineEnd:   c.LineEnd,
 			Body:      c.Body,
+			Severity:  normalizeSeverity(c.Severity),
+			Side:      normalizeSide(c.Side),
 		}
 	}
-	if err := db.InsertReviewComments(ctx, p.pool, runID, commentInputs); err != nil {
+	// Only the top comments are posted inline; the rest are stored and listed in the summary.
+	toPost, overflow := selectCommentsToPost(commentInputs, settings.MaxPostedComments)
+	for i := range overflow {
+		overflow[i].Overflow = true
+	}
+	if err := db.InsertReviewComments(ctx, p.pool, runID, append(toPost, overflow...)); err != nil {
 		return fail(fmt.Errorf("inserting review comments: %w", err))
 	}
 
 	// Step 8: Post summary and inline comments to the provider.
-	_, err = restate.Service[postreview.PostResponse](ctx, "PostReview", "Post").
+	postResp, err := restate.Service[postreview.PostResponse](ctx, "PostReview", "Post").
 		Request(postreview.PostRequest{
-			ReviewRunID:  runID,
-			RepoID:       req.RepoID,
-			MRNumber:     req.MRNumber,
-			RepoRemoteID: fetchResp.RepoRemoteID,
-			Summary:      reviewer.Summary,
-			DryRun:       req.DryRun,
+			ReviewRunID:    runID,
+			RepoID:         req.RepoID,
+			MRNumber:       req.MRNumber,
+			RepoRemoteID:   fetchResp.RepoRemoteID,
+			Summary:        withOverflowList(reviewer.Summary, overflow),
+			SeverityCounts: severityCounts(commentInputs),
+			CommentCount:   len(toPost),
+			DryRun:         req.DryRun,
+			Diff:           fetchResp.Diff,
+			HeadSHA:        fetchResp.HeadSHA,
+
+			SkipEmptySummary: skipEmptySummary(fetchResp.SkipEmptySummary, commentInputs),
 		})
 	if err != nil {
 		return fail(fmt.Errorf("posting review: %w", err))
 	}
+	if postResp.CommentsSkipped > 0 {
+		log.Printf("PRReview: run %s posted %d comments, skipped %d: %s",
+			runID, postResp.CommentsPosted, postResp.CommentsSkipped, strings.Join(postResp.SkippedReasons, "; "))
+	}
+
+	// Step 9: Approve a clean MR if the repo opted in. A failed approval doesn't fail the review.
+	if shouldAutoApprove(fetchResp.AutoApproveOnClean, req.DryRun, commentInputs) {
+		approveResp, err := restate.Service[postreview.ApproveResponse](ctx, "PostReview", "Approve").
+			Request(postreview.ApproveRequest{
+				RepoID:       req.RepoID,
+				MRNumber:     req.MRNumber,
+				RepoRemoteID: fetchResp.RepoRemoteID,
+			})
+		switch {
+		case err != nil:
+			log.Printf("PRReview: run %s approving MR %d: %v", runID, req.MRNumber, err)
+		case !approveResp.Approved:
+			log.Printf("PRReview: run %s did not approve MR %d: %s", runID, req.MRNumber, approveResp.Reason)
+		}
+	}
 
-	// Step 9: Mark run as completed.
-	if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "completed"); err != nil {
+	// Step 10: Mark run as completed.
+	if err := db.UpdateReviewRunStatus(ctx, p.pool, runID, "completed", ""); err != nil {
 		return fail(err)
 	}
 
 	return runID, nil
 }
+
+// closedMRDetail returns the run event detail for an MR that was merged or closed by the
+// time it was fetched, or "" if it is still open (or its state is unknown).
+func closedMRDetail(state string) string {
+	if !provider.MRClosed(state) {
+		return ""
+	}
+	return "MR is " + state
+}
+
+// targetBranchDetail returns the skip reason for an MR into branch when it matches none of
+// the repo's target branch patterns, or "" if the MR is reviewed.
+func targetBranchDetail(patterns []string, branch string) string {
+	if provider.TargetBranchMatches(patterns, branch) {
+		return ""
+	}
+	return fmt.Sprintf("targets %s, which matches no target branch pattern", branch)
+}
+
+// waitForPipeline reports whether a run should wait and fetch again after checks re-checks:
+// the MR's head pipeline blocks the review but is still running, and fewer than maxChecks
+// re-checks were made.
+func waitForPipeline(resp difffetcher.FetchResponse, checks, maxChecks int) bool {
+	return resp.PipelineBlocked && provider.PipelineRunning(resp.PipelineStatus) && checks < maxChecks
+}
+
+// pipelineDetail returns the skip reason for an MR whose head pipeline blocks the review
+// (see difffetcher.FetchResponse.PipelineBlocked), or "" if it is reviewed.
+func pipelineDetail(blocked bool, status string) string {
+	if !blocked {
+		return ""
+	}
+	if status == "" {
+		return "head commit has no pipeline; the repo requires a successful one"
+	}
+	return fmt.Sprintf("head pipeline is %s; the repo requires a successful one", status)
+}
+
+// shouldAutoApprove reports whether a completed review should approve the MR: the repo
+// opted in, the run posts to the provider, and no comment is a blocker.
+func shouldAutoApprove(enabled, dryRun bool, comments []db.ReviewCommentInput) bool {
+	if !enabled || dryRun {
+		return false
+	}
+	for _, c := range comments {
+		if c.Severity == "blocker" {
+			return false
+		}
+	}
+	return true
+}
+
+// skipEmptySummary reports whether a review's summary should only be stored: the repo
+// turned post_empty_summary off and the Reviewer found nothing.
+func skipEmptySummary(enabled bool, comments []db.ReviewCommentInput) bool {
+	return enabled && len(comments) == 0
+}
+
+// jitterDelay picks a delay in [0, max) using rnd, which returns values in [0, 1). Run
+// passes Restate's deterministic per-invocation source so replays sleep the same amount.
+func jitterDelay(max time.Duration, rnd func() float64) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rnd() * float64(max))
+}
+
+// shouldDebounce reports whether a run starting at now (unix millis) should wait out the
+// debounce window because a previous run started less than window ago.
+func shouldDebounce(lastStarted, now int64, window time.Duration) bool {
+	return lastStarted > 0 && window > 0 && now-lastStarted < window.Milliseconds()
+}
+
+// startDelay returns how long Run waits before starting: the debounce window when a recent
+// invocation was cancelled, otherwise the jitter. A run with SkipDebounce starts at once.
+func startDelay(req RunRequest, lastStarted, now int64, s runSettings, rnd func() float64) time.Duration {
+	switch {
+	case req.SkipDebounce:
+		return 0
+	case shouldDebounce(lastStarted, now, s.ReviewDebounce):
+		return s.ReviewDebounce
+	default:
+		return jitterDelay(s.ReviewJitter, rnd)
+	}
+}
+
+// reviewerTarget returns the Restate service and handler that review a repo with the given
+// reviewer_variant. An empty variant, or one REVIEWER_VARIANTS doesn't map, gets the default
+// Reviewer service.
+func reviewerTarget(s runSettings, variant string) (service, handler string) {
+	service, handler = s.ReviewerService, s.ReviewerHandler
+	if service == "" {
+		service = config.DefaultReviewerService
+	}
+	if handler == "" {
+		handler = config.DefaultReviewerHandler
+	}
+	if variant == "" {
+		return service, handler
+	}
+	if v, ok := s.ReviewerVariants[variant]; ok {
+		return v, handler
+	}
+	log.Printf("PRReview: reviewer variant %q is not in REVIEWER_VARIANTS, using %s", variant, service)
+	return service, handler
+}
+
+// reviewerCall is an in-flight Reviewer request.
+type reviewerCall interface {
+	// Await waits up to timeout for the Reviewer's answer (indefinitely when timeout is 0);
+	// timedOut reports that the timeout elapsed first.
+	Await(timeout time.Duration) (out reviewerOutput, timedOut bool, err error)
+	// Cancel cancels the Reviewer invocation.
+	Cancel()
+}
+
+// awaitReviewer waits for call and turns a timeout into a terminal error, cancelling the
+// Reviewer so a hung one doesn't keep running. Retrying would only hang again, so the run
+// fails instead.
+func awaitReviewer(call reviewerCall, timeout time.Duration) (reviewerOutput, error) {
+	out, timedOut, err := call.Await(timeout)
+	if timedOut {
+		call.Cancel()
+		return reviewerOutput{}, restate.TerminalError(fmt.Errorf("reviewer did not answer within %s", timeout), 504)
+	}
+	return out, err
+}
+
+// restateReviewerCall races a Reviewer request future against a durable timer.
+type restateReviewerCall struct {
+	ctx restate.ObjectContext
+	fut restate.ResponseFuture[reviewerOutput]
+}
+
+func (c *restateReviewerCall) Await(timeout time.Duration) (reviewerOutput, bool, error) {
+	if timeout <= 0 {
+		out, err := c.fut.Response()
+		return out, false, err
+	}
+	timer := restate.After(c.ctx, timeout)
+	first, err := restate.WaitFirst(c.ctx, c.fut, timer)
+	if err != nil {
+		return reviewerOutput{}, false, err
+	}
+	if first == timer {
+		return reviewerOutput{}, true, nil
+	}
+	out, err := c.fut.Response()
+	return out, false, err
+}
+
+func (c *restateReviewerCall) Cancel() {
+	restate.CancelInvocation(c.ctx, c.fut.GetInvocationId())
+}
+
+// newReviewerInput builds the Reviewer request for a fetched MR.
+func newReviewerInput(fetchResp difffetcher.FetchResponse) reviewerInput {
+	return reviewerInput{
+		SchemaVersion: reviewerSchemaVersion,
+		Diff:          fetchResp.Diff,
+		MRTitle:       fetchResp.MRTitle,
+		MRDescription: fetchResp.MRDescription,
+		MRAuthor:      fetchResp.MRAuthor,
+		SourceBranch:  fetchResp.SourceBranch,
+		TargetBranch:  fetchResp.TargetBranch,
+		ChangedFiles:  fetchResp.ChangedFiles,
+		Languages:     fetchResp.Languages,
+		FileContents:  fetchResp.FileContents,
+		RelatedIssues: fetchResp.RelatedIssues,
+
+		ReviewModel:       fetchResp.ReviewModel,
+		ReviewTemperature: fetchResp.ReviewTemperature,
+	}
+}
+
+// validateReviewerOutput checks that the Reviewer answered with the schema version we
+// sent, so a mismatched rollout fails loudly instead of dropping or misreading fields.
+func validateReviewerOutput(out reviewerOutput) error {
+	if out.SchemaVersion != reviewerSchemaVersion {
+		return fmt.Errorf("reviewer schema version mismatch: got %d, want %d", out.SchemaVersion, reviewerSchemaVersion)
+	}
+	return nil
+}
+
+// dedupeComments drops comments that repeat an earlier one on the same file, side and start
+// line with the same body up to case, whitespace and trailing punctuation. The first
+// occurrence wins, so the reviewer's ordering is preserved.
+func dedupeComments(comments []reviewComment) []reviewComment {
+	type key struct {
+		file string
+		side string
+		line int
+		body string
+	}
+	seen := make(map[key]bool, len(comments))
+	out := make([]reviewComment, 0, len(comments))
+	for _, c := range comments {
+		k := key{file: c.FilePath, side: normalizeSide(c.Side), line: c.LineStart, body: normalizeCommentBody(c.Body)}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, c)
+	}
+	return out
+}
+
+// normalizeCommentBody folds a comment body for duplicate comparison.
+func normalizeCommentBody(body string) string {
+	body = strings.Join(strings.Fields(strings.ToLower(body)), " ")
+	return strings.TrimRight(body, ".!;:")
+}
+
+// normalizeSeverity lowercases the reviewer's severity and maps anything outside
+// blocker/warning/nit to "" so unknown values don't leak into labels and counts.
+func normalizeSeverity(s string) string {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case "blocker", "warning", "nit":
+		return s
+	default:
+		return ""
+	}
+}
+
+// normalizeSide maps the reviewer's side to "old" or "new", the default for anything else.
+func normalizeSide(s string) string {
+	if strings.EqualFold(strings.TrimSpace(s), "old") {
+		return "old"
+	}
+	return "new"
+}
+
+// severityRank orders severities for selectCommentsToPost; unknown sorts last.
+func severityRank(s string) int {
+	switch s {
+	case "blocker":
+		return 0
+	case "warning":
+		return 1
+	case "nit":
+		return 2
+	default:
+		return 3
+	}
+}
+
+// selectCommentsToPost splits comments into the ones to post inline and the overflow,
+// keeping the max most severe with reviewer order breaking ties. Both slices keep the
+// reviewer's order. max <= 0 posts everything.
+func selectCommentsToPost(comments []db.ReviewCommentInput, max int) (post, overflow []db.ReviewCommentInput) {
+	if max <= 0 || len(comments) <= max {
+		return slices.Clone(comments), nil
+	}
+	ranked := make([]int, len(comments))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	slices.SortStableFunc(ranked, func(a, b int) int {
+		return severityRank(comments[a].Severity) - severityRank(comments[b].Severity)
+	})
+	keep := make(map[int]bool, max)
+	for _, i := range ranked[:max] {
+		keep[i] = true
+	}
+	for i, c := range comments {
+		if keep[i] {
+			post = append(post, c)
+		} else {
+			overflow = append(overflow, c)
+		}
+	}
+	return post, overflow
+}
+
+// maxOverflowBody bounds each overflow entry in the summary to its first line, truncated.
+const maxOverflowBody = 120
+
+// withOverflowList appends a bulleted list of comments that weren't posted inline.
+func withOverflowList(summary string, overflow []db.ReviewCommentInput) string {
+	if len(overflow) == 0 {
+		return summary
+	}
+	var b strings.Builder
+	b.WriteString(summary)
+	fmt.Fprintf(&b, "\n\n**%d more comment", len(overflow))
+	if len(overflow) != 1 {
+		b.WriteString("s")
+	}
+	b.WriteString(" not posted inline:**\n")
+	for _, c := range overflow {
+		body, _, _ := strings.Cut(strings.TrimSpace(c.Body), "\n")
+		if r := []rune(body); len(r) > maxOverflowBody {
+			body = string(r[:maxOverflowBody]) + "…"
+		}
+		fmt.Fprintf(&b, "\n- `%s:%d`", c.FilePath, c.LineStart)
+		if c.Severity != "" {
+			fmt.Fprintf(&b, " (%s)", c.Severity)
+		}
+		b.WriteString(" " + body)
+	}
+	return b.String()
+}
+
+// severityCounts tallies comments by severity for the summary note.
+func severityCounts(comments []db.ReviewCommentInput) map[string]int {
+	counts := make(map[string]int)
+	for _, c := range comments {
+		if c.Severity != "" {
+			counts[c.Severity]++
+		}
+	}
+	return counts
+}
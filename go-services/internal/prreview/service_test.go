@@ -0,0 +1,566 @@
+package prreview
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	restate "github.com/restatedev/sdk-go"
+
+	"ai-reviewer/go-services/internal/config"
+	"ai-reviewer/go-services/internal/crypto"
+	"ai-reviewer/go-services/internal/db"
+	"ai-reviewer/go-services/internal/difffetcher"
+)
+
+func TestShouldDebounce(t *testing.T) {
+	const now = int64(10 * 60 * 1000)
+	tests := []struct {
+		name        string
+		lastStarted int64
+		window      time.Duration
+		want        bool
+	}{
+		{name: "first run", lastStarted: 0, window: 3 * time.Minute, want: false},
+		{name: "recent run", lastStarted: now - 60*1000, window: 3 * time.Minute, want: true},
+		{name: "old run", lastStarted: now - 5*60*1000, window: 3 * time.Minute, want: false},
+		{name: "exactly at window", lastStarted: now - 3*60*1000, window: 3 * time.Minute, want: false},
+		{name: "custom short window", lastStarted: now - 60*1000, window: 30 * time.Second, want: false},
+		{name: "disabled", lastStarted: now - 1000, window: 0, want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := shouldDebounce(tc.lastStarted, now, tc.window); got != tc.want {
+				t.Errorf("shouldDebounce(%d, %d, %s) = %v, want %v", tc.lastStarted, now, tc.window, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestJitterDelay(t *testing.T) {
+	tests := []struct {
+		name string
+		max  time.Duration
+		rnd  float64
+		want time.Duration
+	}{
+		{name: "disabled", max: 0, rnd: 0.5, want: 0},
+		{name: "low draw", max: 10 * time.Second, rnd: 0, want: 0},
+		{name: "mid draw", max: 10 * time.Second, rnd: 0.25, want: 2500 * time.Millisecond},
+		{name: "high draw stays below max", max: 10 * time.Second, rnd: 0.999, want: 9990 * time.Millisecond},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := jitterDelay(tc.max, func() float64 { return tc.rnd })
+			if got != tc.want {
+				t.Errorf("jitterDelay(%s) with draw %v = %s, want %s", tc.max, tc.rnd, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStartDelay(t *testing.T) {
+	const now = int64(10 * 60 * 1000)
+	cfg := config.Config{ReviewDebounce: 3 * time.Minute, ReviewJitter: time.Minute}
+	half := func() float64 { return 0.5 }
+	tests := []struct {
+		name        string
+		req         RunRequest
+		lastStarted int64
+		want        time.Duration
+	}{
+		{name: "webhook after recent run", lastStarted: now - 60*1000, want: 3 * time.Minute},
+		{name: "webhook first run", lastStarted: 0, want: 30 * time.Second},
+		{name: "manual after recent run", req: RunRequest{SkipDebounce: true}, lastStarted: now - 60*1000, want: 0},
+		{name: "manual first run", req: RunRequest{SkipDebounce: true}, lastStarted: 0, want: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := startDelay(tc.req, tc.lastStarted, now, newRunSettings(cfg), half); got != tc.want {
+				t.Errorf("startDelay = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestShouldAutoApprove(t *testing.T) {
+	clean := []db.ReviewCommentInput{{Severity: "warning"}, {Severity: "nit"}}
+	blocked := []db.ReviewCommentInput{{Severity: "nit"}, {Severity: "blocker"}}
+	tests := []struct {
+		name     string
+		enabled  bool
+		dryRun   bool
+		comments []db.ReviewCommentInput
+		want     bool
+	}{
+		{name: "no comments", enabled: true, want: true},
+		{name: "only non-blockers", enabled: true, comments: clean, want: true},
+		{name: "has a blocker", enabled: true, comments: blocked, want: false},
+		{name: "not enabled", enabled: false, comments: clean, want: false},
+		{name: "dry run", enabled: true, dryRun: true, want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := shouldAutoApprove(tc.enabled, tc.dryRun, tc.comments); got != tc.want {
+				t.Errorf("shouldAutoApprove = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSkipEmptySummary(t *testing.T) {
+	comments := []db.ReviewCommentInput{{Severity: "nit"}}
+	tests := []struct {
+		name     string
+		skip     bool
+		comments []db.ReviewCommentInput
+		want     bool
+	}{
+		{name: "post empty summary", skip: false, want: false},
+		{name: "skip empty summary", skip: true, want: true},
+		{name: "post with comments", skip: false, comments: comments, want: false},
+		{name: "skip with comments", skip: true, comments: comments, want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := skipEmptySummary(tc.skip, tc.comments); got != tc.want {
+				t.Errorf("skipEmptySummary = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDispatch(t *testing.T) {
+	now := time.Now()
+	req := RunRequest{RunID: "run1", RepoID: "repo1", MRNumber: 42, ReviewDrafts: true}
+	claims := crypto.DispatchClaims{Key: "repo1-42", RunID: "run1", RepoID: "repo1", MRNumber: 42, ReviewDrafts: true}
+	sign := func(expires time.Time, secret string) RunRequest {
+		r := req
+		r.DispatchToken = crypto.SignDispatch(claims, expires, []byte(secret))
+		return r
+	}
+	signed := sign(now.Add(time.Hour), "s3cret")
+	forged := signed
+	forged.RepoID = "someone-elses-repo"
+	legacy := req
+	legacy.DispatchToken = hex.EncodeToString(hmacSHA256([]byte("s3cret"), fmt.Appendf(nil, "v2\n%s\n%s\n%d\n%t\n%t\n%t", "run1", "repo1", 42, false, true, false)))
+
+	tests := []struct {
+		name    string
+		req     RunRequest
+		key     string
+		cfg     config.Config
+		wantErr bool
+	}{
+		{name: "signed", req: signed, key: "repo1-42", cfg: config.Config{DispatchSecret: "s3cret"}},
+		{name: "unsigned", req: req, key: "repo1-42", cfg: config.Config{DispatchSecret: "s3cret"}, wantErr: true},
+		{name: "tampered repo", req: forged, key: "repo1-42", cfg: config.Config{DispatchSecret: "s3cret"}, wantErr: true},
+		{name: "other object key", req: signed, key: "repo1-43", cfg: config.Config{DispatchSecret: "s3cret"}, wantErr: true},
+		{name: "expired", req: sign(now.Add(-time.Minute), "s3cret"), key: "repo1-42", cfg: config.Config{DispatchSecret: "s3cret"}, wantErr: true},
+		{name: "other secret", req: signed, key: "repo1-42", cfg: config.Config{DispatchSecret: "rotated"}, wantErr: true},
+		{name: "previous secret", req: signed, key: "repo1-42", cfg: config.Config{DispatchSecret: "rotated", DispatchSecretPrevious: "s3cret"}},
+		{name: "legacy token accepted", req: legacy, key: "repo1-42", cfg: config.Config{DispatchSecret: "s3cret", DispatchAcceptLegacy: true}},
+		{name: "legacy token refused", req: legacy, key: "repo1-42", cfg: config.Config{DispatchSecret: "s3cret"}, wantErr: true},
+		{name: "verification off", req: req, key: "repo1-42", cfg: config.Config{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := verifyDispatch(tc.req, tc.key, tc.cfg, now); (err != nil) != tc.wantErr {
+				t.Errorf("verifyDispatch = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of msg under secret, as legacy dispatch tokens used.
+func hmacSHA256(secret, msg []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+func TestTargetBranchDetail(t *testing.T) {
+	patterns := []string{"main", "release/*"}
+	tests := []struct {
+		name     string
+		patterns []string
+		branch   string
+		skipped  bool
+	}{
+		{name: "no patterns", branch: "feature/x"},
+		{name: "exact match", patterns: patterns, branch: "main"},
+		{name: "glob match", patterns: patterns, branch: "release/1.2"},
+		{name: "glob stops at slash", patterns: patterns, branch: "release/1.2/fix", skipped: true},
+		{name: "no match", patterns: patterns, branch: "develop", skipped: true},
+		{name: "prefix is not a match", patterns: patterns, branch: "main-old", skipped: true},
+		{name: "malformed pattern", patterns: []string{"release/["}, branch: "release/1", skipped: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := targetBranchDetail(tc.patterns, tc.branch); (got != "") != tc.skipped {
+				t.Errorf("targetBranchDetail(%q, %q) = %q, skipped want %v", tc.patterns, tc.branch, got, tc.skipped)
+			}
+		})
+	}
+}
+
+func TestPipelineDetail(t *testing.T) {
+	tests := []struct {
+		name    string
+		blocked bool
+		status  string
+		want    string
+	}{
+		{name: "not required or passed", status: "success"},
+		{name: "failed", blocked: true, status: "failed", want: "head pipeline is failed; the repo requires a successful one"},
+		{name: "still running", blocked: true, status: "running", want: "head pipeline is running; the repo requires a successful one"},
+		{name: "no pipeline", blocked: true, want: "head commit has no pipeline; the repo requires a successful one"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := pipelineDetail(tc.blocked, tc.status); got != tc.want {
+				t.Errorf("pipelineDetail(%v, %q) = %q, want %q", tc.blocked, tc.status, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWaitForPipeline(t *testing.T) {
+	running := difffetcher.FetchResponse{PipelineBlocked: true, PipelineStatus: "running"}
+	tests := []struct {
+		name      string
+		resp      difffetcher.FetchResponse
+		checks    int
+		maxChecks int
+		want      bool
+	}{
+		{name: "running with checks left", resp: running, checks: 1, maxChecks: 3, want: true},
+		{name: "running, checks used up", resp: running, checks: 3, maxChecks: 3},
+		{name: "running, waiting disabled", resp: running},
+		{name: "failed is final", resp: difffetcher.FetchResponse{PipelineBlocked: true, PipelineStatus: "failed"}, maxChecks: 3},
+		{name: "not blocked", resp: difffetcher.FetchResponse{}, maxChecks: 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := waitForPipeline(tc.resp, tc.checks, tc.maxChecks); got != tc.want {
+				t.Errorf("waitForPipeline(%+v, %d, %d) = %v, want %v", tc.resp, tc.checks, tc.maxChecks, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClosedMRDetail(t *testing.T) {
+	for state, want := range map[string]string{
+		"opened": "",
+		"":       "",
+		"locked": "",
+		"merged": "MR is merged",
+		"closed": "MR is closed",
+	} {
+		if got := closedMRDetail(state); got != want {
+			t.Errorf("closedMRDetail(%q) = %q, want %q", state, got, want)
+		}
+	}
+}
+
+func TestReviewerTarget(t *testing.T) {
+	cfg := config.Config{
+		ReviewerService:  "Reviewer",
+		ReviewerHandler:  "RunReview",
+		ReviewerVariants: map[string]string{"b": "ReviewerB"},
+	}
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		variant     string
+		wantService string
+		wantHandler string
+	}{
+		{name: "no variant", cfg: cfg, wantService: "Reviewer", wantHandler: "RunReview"},
+		{name: "mapped variant", cfg: cfg, variant: "b", wantService: "ReviewerB", wantHandler: "RunReview"},
+		{name: "unknown variant", cfg: cfg, variant: "c", wantService: "Reviewer", wantHandler: "RunReview"},
+		{name: "custom defaults", cfg: config.Config{ReviewerService: "Rev2", ReviewerHandler: "Review"}, wantService: "Rev2", wantHandler: "Review"},
+		{name: "unset config", cfg: config.Config{}, wantService: config.DefaultReviewerService, wantHandler: config.DefaultReviewerHandler},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			service, handler := reviewerTarget(newRunSettings(tc.cfg), tc.variant)
+			if service != tc.wantService || handler != tc.wantHandler {
+				t.Errorf("reviewerTarget = %s/%s, want %s/%s", service, handler, tc.wantService, tc.wantHandler)
+			}
+		})
+	}
+}
+
+// delayedReviewerCall answers after delay, like a Reviewer that takes that long.
+type delayedReviewerCall struct {
+	delay     time.Duration
+	out       reviewerOutput
+	err       error
+	cancelled bool
+}
+
+func (c *delayedReviewerCall) Await(timeout time.Duration) (reviewerOutput, bool, error) {
+	answer := time.After(c.delay)
+	if timeout > 0 {
+		select {
+		case <-answer:
+		case <-time.After(timeout):
+			return reviewerOutput{}, true, nil
+		}
+	} else {
+		<-answer
+	}
+	return c.out, false, c.err
+}
+
+func (c *delayedReviewerCall) Cancel() { c.cancelled = true }
+
+func TestAwaitReviewer(t *testing.T) {
+	t.Run("answers in time", func(t *testing.T) {
+		call := &delayedReviewerCall{delay: time.Millisecond, out: reviewerOutput{Summary: "ok"}}
+		out, err := awaitReviewer(call, time.Second)
+		if err != nil || out.Summary != "ok" || call.cancelled {
+			t.Errorf("got %+v, %v, cancelled=%v", out, err, call.cancelled)
+		}
+	})
+	t.Run("times out", func(t *testing.T) {
+		call := &delayedReviewerCall{delay: time.Second, out: reviewerOutput{Summary: "late"}}
+		_, err := awaitReviewer(call, 10*time.Millisecond)
+		if err == nil || !restate.IsTerminalError(err) {
+			t.Fatalf("err = %v, want a terminal error", err)
+		}
+		if !strings.Contains(err.Error(), "did not answer within 10ms") {
+			t.Errorf("err = %v", err)
+		}
+		if !call.cancelled {
+			t.Error("reviewer invocation not cancelled")
+		}
+	})
+	t.Run("no timeout", func(t *testing.T) {
+		call := &delayedReviewerCall{delay: 20 * time.Millisecond, out: reviewerOutput{Summary: "slow"}}
+		if out, err := awaitReviewer(call, 0); err != nil || out.Summary != "slow" {
+			t.Errorf("got %+v, %v", out, err)
+		}
+	})
+	t.Run("reviewer error", func(t *testing.T) {
+		call := &delayedReviewerCall{err: errors.New("boom")}
+		if _, err := awaitReviewer(call, time.Second); err == nil || restate.IsTerminalError(err) {
+			t.Errorf("err = %v, want the retryable reviewer error", err)
+		}
+	})
+}
+
+func TestNormalizeSeverity(t *testing.T) {
+	for in, want := range map[string]string{
+		"blocker":   "blocker",
+		" Warning ": "warning",
+		"NIT":       "nit",
+		"critical":  "",
+		"":          "",
+	} {
+		if got := normalizeSeverity(in); got != want {
+			t.Errorf("normalizeSeverity(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeSide(t *testing.T) {
+	for in, want := range map[string]string{
+		"old":   "old",
+		" OLD ": "old",
+		"new":   "new",
+		"":      "new",
+		"left":  "new",
+	} {
+		if got := normalizeSide(in); got != want {
+			t.Errorf("normalizeSide(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestValidateReviewerOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		wantErr bool
+	}{
+		{name: "matching version", version: reviewerSchemaVersion, wantErr: false},
+		{name: "unversioned reviewer", version: 0, wantErr: true},
+		{name: "newer reviewer", version: reviewerSchemaVersion + 1, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateReviewerOutput(reviewerOutput{SchemaVersion: tc.version, Summary: "ok"})
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validateReviewerOutput(version=%d) error = %v, wantErr %v", tc.version, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestDedupeComments(t *testing.T) {
+	comments := []reviewComment{
+		{FilePath: "a.go", LineStart: 10, Body: "Possible nil dereference."},
+		{FilePath: "a.go", LineStart: 10, Body: "Possible nil dereference."},              // exact dupe
+		{FilePath: "a.go", LineStart: 10, Body: "  possible nil\n dereference  "},         // near dupe
+		{FilePath: "a.go", LineStart: 10, Body: "Unchecked error from Close."},            // same line, different body
+		{FilePath: "a.go", LineStart: 12, Body: "Possible nil dereference."},              // different line
+		{FilePath: "b.go", LineStart: 10, Body: "Possible nil dereference."},              // different file
+		{FilePath: "a.go", LineStart: 10, Body: "Possible nil dereference.", Side: "old"}, // different side
+	}
+
+	got := dedupeComments(comments)
+	want := []reviewComment{comments[0], comments[3], comments[4], comments[5], comments[6]}
+	if len(got) != len(want) {
+		t.Fatalf("dedupeComments returned %d comments, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("comment %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDedupeComments_Empty(t *testing.T) {
+	if got := dedupeComments(nil); len(got) != 0 {
+		t.Errorf("dedupeComments(nil) = %+v, want empty", got)
+	}
+}
+
+func TestPreviewResponse_JSONShape(t *testing.T) {
+	resp := PreviewResponse{reviewerOutput: reviewerOutput{
+		Summary:  "ok",
+		Comments: []reviewComment{{FilePath: "a.go", LineStart: 1, LineEnd: 1, Body: "b", Severity: "nit"}},
+	}}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	// The reviewer output fields are flattened next to diff_too_large, not nested.
+	for _, key := range []string{"summary", "comments", "diff_too_large"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("missing %q in %s", key, data)
+		}
+	}
+}
+
+func TestNewReviewerInput_RelatedIssues(t *testing.T) {
+	in := newReviewerInput(difffetcher.FetchResponse{
+		Diff:          "d",
+		RelatedIssues: []difffetcher.RelatedIssue{{IID: 7, Title: "Crash on save", Description: "Steps..."}},
+	})
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if want := `"related_issues":[{"iid":7,"title":"Crash on save","description":"Steps..."}]`; !strings.Contains(string(data), want) {
+		t.Errorf("payload %s missing %s", data, want)
+	}
+
+	// Without issues the key is omitted, so older Reviewers see the same payload as before.
+	data, err = json.Marshal(newReviewerInput(difffetcher.FetchResponse{Diff: "d"}))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if strings.Contains(string(data), "related_issues") {
+		t.Errorf("payload %s has related_issues", data)
+	}
+}
+
+func TestSelectCommentsToPost(t *testing.T) {
+	comments := []db.ReviewCommentInput{
+		{FilePath: "a.go", Severity: "nit"},
+		{FilePath: "b.go", Severity: "blocker"},
+		{FilePath: "c.go", Severity: ""},
+		{FilePath: "d.go", Severity: "warning"},
+		{FilePath: "e.go", Severity: "blocker"},
+		{FilePath: "f.go", Severity: "warning"},
+	}
+	files := func(cs []db.ReviewCommentInput) []string {
+		var out []string
+		for _, c := range cs {
+			out = append(out, c.FilePath)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name         string
+		max          int
+		wantPost     []string
+		wantOverflow []string
+	}{
+		{name: "uncapped", max: 0, wantPost: []string{"a.go", "b.go", "c.go", "d.go", "e.go", "f.go"}},
+		{name: "cap above count", max: 10, wantPost: []string{"a.go", "b.go", "c.go", "d.go", "e.go", "f.go"}},
+		{name: "blockers first", max: 2, wantPost: []string{"b.go", "e.go"}, wantOverflow: []string{"a.go", "c.go", "d.go", "f.go"}},
+		{name: "ties keep reviewer order", max: 3, wantPost: []string{"b.go", "d.go", "e.go"}, wantOverflow: []string{"a.go", "c.go", "f.go"}},
+		{name: "unknown severity last", max: 5, wantPost: []string{"a.go", "b.go", "d.go", "e.go", "f.go"}, wantOverflow: []string{"c.go"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			post, overflow := selectCommentsToPost(comments, tc.max)
+			if got := files(post); !slices.Equal(got, tc.wantPost) {
+				t.Errorf("post = %v, want %v", got, tc.wantPost)
+			}
+			if got := files(overflow); !slices.Equal(got, tc.wantOverflow) {
+				t.Errorf("overflow = %v, want %v", got, tc.wantOverflow)
+			}
+		})
+	}
+}
+
+func TestWithOverflowList(t *testing.T) {
+	if got := withOverflowList("Looks good.", nil); got != "Looks good." {
+		t.Errorf("no overflow changed the summary: %q", got)
+	}
+
+	overflow := []db.ReviewCommentInput{
+		{FilePath: "a.go", LineStart: 3, Severity: "nit", Body: "Rename this.\nIt reads better."},
+		{FilePath: "b.go", LineStart: 9, Body: strings.Repeat("x", 130)},
+	}
+	want := "Looks good.\n\n**2 more comments not posted inline:**\n" +
+		"\n- `a.go:3` (nit) Rename this." +
+		"\n- `b.go:9` " + strings.Repeat("x", 120) + "…"
+	if got := withOverflowList("Looks good.", overflow); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPreviewSkipReason(t *testing.T) {
+	tests := []struct {
+		name string
+		resp difffetcher.FetchResponse
+		want string
+	}{
+		{name: "open MR", resp: difffetcher.FetchResponse{State: "opened", TargetBranch: "main"}, want: ""},
+		{name: "merged", resp: difffetcher.FetchResponse{State: "merged"}, want: "MR is merged"},
+		{name: "other target branch", resp: difffetcher.FetchResponse{TargetBranch: "dev", TargetBranchPatterns: []string{"main"}}, want: "targets dev, which matches no target branch pattern"},
+		{name: "pipeline blocked", resp: difffetcher.FetchResponse{PipelineBlocked: true, PipelineStatus: "failed"}, want: "head pipeline is failed; the repo requires a successful one"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := previewSkipReason(tc.resp); got != tc.want {
+				t.Errorf("previewSkipReason = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -12,16 +12,35 @@ OPENROUTER_API_KEY = os.environ["OPENROUTER_API_KEY"]
 REVIEW_MODEL = os.environ.get("REVIEW_MODEL", "anthropic/claude-sonnet-4-20250514")
 MAX_TOKENS = int(os.environ.get("MAX_TOKENS", "16384"))
 
-review_agent: Agent[None, ReviewResponse] = Agent(
-    model=OpenAIChatModel(
-        model_name=REVIEW_MODEL,
+
+def _openrouter_model(model_name: str) -> OpenAIChatModel:
+    return OpenAIChatModel(
+        model_name=model_name,
         provider=OpenAIProvider(
             base_url="https://openrouter.ai/api/v1",
             api_key=OPENROUTER_API_KEY,
         ),
         profile=OpenAIModelProfile(openai_supports_tool_choice_required=False),
-    ),
+    )
+
+
+review_agent: Agent[None, ReviewResponse] = Agent(
+    model=_openrouter_model(REVIEW_MODEL),
     output_type=ReviewResponse,
     instructions=SYSTEM_PROMPT,
     model_settings=ModelSettings(max_tokens=MAX_TOKENS),
 )
+
+
+def run_overrides(review_model: str, review_temperature: float | None) -> dict:
+    """Keyword arguments for review_agent.run applying a repo's model/temperature overrides.
+
+    Unset overrides are omitted so the agent keeps REVIEW_MODEL and the provider's default
+    temperature; model_settings passed to run are merged over the agent's (max_tokens stays).
+    """
+    kwargs: dict = {}
+    if review_model:
+        kwargs["model"] = _openrouter_model(review_model)
+    if review_temperature is not None:
+        kwargs["model_settings"] = ModelSettings(temperature=review_temperature)
+    return kwargs
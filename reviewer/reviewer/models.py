@@ -1,7 +1,20 @@
+from typing import Literal
+
 from pydantic import BaseModel
 
+# Version of the RunReview request/response contract with the Go PRReview workflow.
+# Bump together with reviewerSchemaVersion in go-services/internal/prreview.
+SCHEMA_VERSION = 1
+
+
+class RelatedIssue(BaseModel):
+    iid: int = 0
+    title: str
+    description: str = ""
+
 
 class ReviewRequest(BaseModel):
+    schema_version: int = 0  # 0 = caller predates versioning
     diff: str
     mr_title: str
     mr_description: str
@@ -9,6 +22,15 @@ class ReviewRequest(BaseModel):
     source_branch: str
     target_branch: str
     changed_files: list[str]
+    # path -> detected language for changed files; unrecognised files are absent.
+    languages: dict[str, str] = {}
+    # path -> full content at the MR head for some changed files; context only.
+    file_contents: dict[str, str] = {}
+    # Issues the MR closes, sent when the repo opts in; context for the MR's intent.
+    related_issues: list[RelatedIssue] = []
+    # Per-repo overrides; empty / None fall back to REVIEW_MODEL and the default temperature.
+    review_model: str = ""
+    review_temperature: float | None = None
 
 
 class ReviewComment(BaseModel):
@@ -16,8 +38,16 @@ class ReviewComment(BaseModel):
     line_start: int
     line_end: int
     body: str
+    severity: Literal["blocker", "warning", "nit"] = "warning"
+    side: Literal["new", "old"] = "new"
 
 
 class ReviewResponse(BaseModel):
     summary: str
     comments: list[ReviewComment]
+
+
+class RunReviewResponse(ReviewResponse):
+    """ReviewResponse plus the schema version, kept out of the LLM's output schema."""
+
+    schema_version: int = SCHEMA_VERSION
@@ -13,8 +13,20 @@ Rules:
 and line numbers increment from there for each `+` line.
 - Set `line_start` and `line_end` to the affected range on the new file. Use the same \
 value for both if a single line is affected.
+- To comment on a deleted (`-`) line, set `side` to `old` and use line numbers from the \
+`-` side instead: the `-X` value is the first line of the hunk on the old file. Leave \
+`side` as `new` for everything else.
+- Set `severity` on each comment: `blocker` for bugs or vulnerabilities that must be \
+fixed before merging, `warning` for likely problems worth addressing, `nit` for minor \
+issues the author may ignore.
 - Write the `summary` as a concise paragraph covering the overall quality and the most \
 important findings.
+- Apply the idioms and common pitfalls of each file's language, as listed under \
+**Languages**.
+- Files under **Changed files at head** are the full new versions of some changed \
+files, given for context. Only comment on lines that appear in the diff.
+- **Related issues** are the issues the MR is meant to resolve. Use them to judge whether \
+the change does what was asked, not as code to review.
 - If there are no meaningful issues, return an empty `comments` list and say so in the \
 summary.
 """
@@ -22,14 +34,33 @@ summary.
 
 def build_user_prompt(req: ReviewRequest) -> str:
     changed = ", ".join(req.changed_files) if req.changed_files else "(none)"
+    languages = ", ".join(sorted(set(req.languages.values()))) if req.languages else "(unknown)"
     description = req.mr_description.strip() if req.mr_description else "(no description)"
-    return (
+    prompt = (
         f"## Merge Request\n"
         f"**Title:** {req.mr_title}\n"
         f"**Author:** {req.mr_author}\n"
         f"**Branches:** `{req.source_branch}` → `{req.target_branch}`\n"
-        f"**Changed files:** {changed}\n\n"
+        f"**Changed files:** {changed}\n"
+        f"**Languages:** {languages}\n\n"
         f"**Description:**\n{description}\n\n"
+        f"{_related_issues_section(req)}"
         f"## Diff\n"
         f"```diff\n{req.diff}\n```"
     )
+    if req.file_contents:
+        files = "\n\n".join(
+            f"### {path}\n```\n{content}\n```" for path, content in req.file_contents.items()
+        )
+        prompt += f"\n\n## Changed files at head\n{files}"
+    return prompt
+
+
+def _related_issues_section(req: ReviewRequest) -> str:
+    if not req.related_issues:
+        return ""
+    issues = "\n\n".join(
+        f"### #{issue.iid} {issue.title}\n{issue.description.strip() or '(no description)'}"
+        for issue in req.related_issues
+    )
+    return f"## Related issues\n{issues}\n\n"
@@ -6,18 +6,27 @@ from hypercorn.asyncio import serve
 from hypercorn.config import Config
 from pydantic_ai.exceptions import ModelHTTPError
 
-from .agent import review_agent
-from .models import ReviewRequest, ReviewResponse
+from .agent import review_agent, run_overrides
+from .models import SCHEMA_VERSION, ReviewRequest, RunReviewResponse
 from .prompt import build_user_prompt
 
 reviewer_service = restate.Service("Reviewer")
 
 
 @reviewer_service.handler("RunReview")
-async def run_review(ctx: restate.Context, req: ReviewRequest) -> ReviewResponse:
+async def run_review(ctx: restate.Context, req: ReviewRequest) -> RunReviewResponse:
+    if req.schema_version != SCHEMA_VERSION:
+        # A mismatched rollout won't fix itself on retry.
+        raise restate.TerminalError(
+            f"reviewer schema version mismatch: got {req.schema_version}, want {SCHEMA_VERSION}",
+            status_code=400,
+        )
     try:
-        result = await review_agent.run(build_user_prompt(req))
-        return result.output
+        result = await review_agent.run(
+            build_user_prompt(req),
+            **run_overrides(req.review_model, req.review_temperature),
+        )
+        return RunReviewResponse(**result.output.model_dump())
     except ModelHTTPError as e:
         # 4xx errors are not recoverable by retrying — mark as terminal.
         if 400 <= e.status_code < 500:
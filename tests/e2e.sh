@@ -140,6 +140,19 @@ PROVIDER_RESP=$(connectrpc "api.v1.ProviderService" "CreateProvider" \
 PROVIDER_ID=$(echo "$PROVIDER_RESP" | jq -r '.provider.id')
 echo "    Provider ID: $PROVIDER_ID"
 
+echo "==> ListProviders (type filter)"
+LIST_RESP=$(connectrpc "api.v1.ProviderService" "ListProviders" \
+  '{"type": "PROVIDER_TYPE_GITLAB_SELF_HOSTED", "limit": 500}')
+if ! echo "$LIST_RESP" | jq -e --arg id "$PROVIDER_ID" 'any(.providers[]; .id == $id)' >/dev/null; then
+  echo "ERROR: provider $PROVIDER_ID missing from gitlab_self_hosted listing" >&2
+  exit 1
+fi
+if echo "$LIST_RESP" | jq -e 'any(.providers[]; .type != "PROVIDER_TYPE_GITLAB_SELF_HOSTED")' >/dev/null; then
+  echo "ERROR: type filter returned providers of another type" >&2
+  exit 1
+fi
+echo "    OK"
+
 # ── 2. ListRepos → find target repo ───────────────────────────────────────────
 
 echo "==> ListRepos (finding repo with remote ID $GITLAB_PROJECT_REMOTE_ID)"